@@ -0,0 +1,288 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/internal/app"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+)
+
+// batchQuery is a single line of a batch, ready to be looked up. seq
+// numbers the queries from 0, skipping blank lines and comments.
+type batchQuery struct {
+	seq   int
+	line  int
+	query string
+	app   *app.App
+	err   error
+	// routed lines have resolvers of their own, closed once they're done.
+	routed bool
+}
+
+// batchResult is the outcome of a batch line, as printed with --json.
+type batchResult struct {
+	Line      int                  `json:"line"`
+	Query     string               `json:"query"`
+	Responses []resolvers.Response `json:"responses,omitempty"`
+	Errors    []resolverErrorJSON  `json:"errors,omitempty"`
+
+	seq  int
+	errs []error
+}
+
+// batchSummary counts the outcome of every line of a batch.
+type batchSummary struct {
+	Queries   int `json:"queries"`
+	Succeeded int `json:"succeeded"`
+	Partial   int `json:"partial"`
+	Failed    int `json:"failed"`
+}
+
+// runBatch looks up every line of the --batch file, with at most
+// --batch-concurrency lines at once. Results are printed in the order of the
+// file, or with --json as NDJSON as soon as each line completes. It exits
+// with 0 when every line succeeded, 9 when every line failed and 2 otherwise.
+func runBatch(a *app.App, cfg *config) {
+	var in io.Reader = os.Stdin
+	if a.QueryFlags.Batch != "-" {
+		f, err := os.Open(a.QueryFlags.Batch)
+		if err != nil {
+			a.Logger.Error("Error opening batch file", "error", err)
+			os.Exit(exitGenericFailure)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	// Lines without nameservers share the resolvers of the command line,
+	// others share theirs with lines using the same nameservers.
+	cache := map[string][]resolvers.Resolver{"": a.Resolvers}
+	queries := make(chan batchQuery)
+	var readErr error
+	go func() {
+		defer close(queries)
+		readErr = readBatch(in, a, cfg, cache, queries)
+	}()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		summary batchSummary
+		// Results waiting for the lines before them, when printing in order.
+		pending = make(map[int]batchResult)
+		next    = 0
+	)
+	record := func(res batchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		summary.Queries++
+		switch {
+		case len(res.errs) == 0:
+			summary.Succeeded++
+		case len(res.Responses) > 0:
+			summary.Partial++
+		default:
+			summary.Failed++
+		}
+
+		if a.QueryFlags.ShowJSON {
+			printBatchJSON(a, res)
+			return
+		}
+		pending[res.seq] = res
+		for {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			printBatchResult(a, r)
+			next++
+		}
+	}
+
+	workers := max(a.QueryFlags.BatchConcurrency, 1)
+	lines := make(chan batchQuery)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for q := range lines {
+				res := batchResult{Line: q.line, Query: q.query, seq: q.seq}
+				if q.err != nil {
+					res.errs = []error{q.err}
+				} else {
+					res.Responses, res.errs = performLookup(context.Background(), q.app, cfg)
+					if q.routed {
+						q.app.Close()
+					}
+				}
+				res.Errors = errorsJSON(res.errs)
+				record(res)
+			}
+		}()
+	}
+
+	for q := range queries {
+		lines <- q
+	}
+	close(lines)
+	wg.Wait()
+	a.Close()
+	for _, rslvrs := range cache {
+		resolvers.Close(rslvrs)
+	}
+
+	if readErr != nil {
+		a.Logger.Error("Error reading batch", "error", readErr)
+		os.Exit(exitGenericFailure)
+	}
+
+	if a.QueryFlags.ShowJSON {
+		out, _ := json.Marshal(struct {
+			Summary batchSummary `json:"summary"`
+		}{summary})
+		fmt.Println(string(out))
+	} else {
+		fmt.Fprintf(os.Stderr, "Batch: %d queries, %d succeeded, %d partially failed, %d failed\n",
+			summary.Queries, summary.Succeeded, summary.Partial, summary.Failed)
+	}
+
+	switch {
+	case summary.Failed == 0 && summary.Partial == 0:
+		return
+	case summary.Failed == summary.Queries:
+		os.Exit(exitLookupFailure)
+	default:
+		os.Exit(exitPartialFailure)
+	}
+}
+
+// readBatch parses every line of in and sends it on queries. Lines use the
+// same syntax as the command line arguments (`name TYPE CLASS @nameserver`);
+// blank lines and lines starting with # are skipped. Types, classes and
+// nameservers missing from a line are taken from the command line. The
+// resolvers of the lines are kept in cache by nameservers.
+func readBatch(in io.Reader, a *app.App, cfg *config, cache map[string][]resolvers.Resolver, queries chan<- batchQuery) error {
+	scanner := bufio.NewScanner(in)
+	line, seq := 0, 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		q := batchQuery{seq: seq, line: line, query: text}
+		seq++
+
+		nameservers, qt, qc, qn := loadUnparsedArgs(strings.Fields(text))
+		if len(qn) == 0 {
+			q.err = errors.New("no name to query")
+			queries <- q
+			continue
+		}
+
+		la := *a
+		la.QueryFlags.QNames = qn
+		if len(qt) > 0 {
+			la.QueryFlags.QTypes = qt
+		}
+		if len(qc) > 0 {
+			la.QueryFlags.QClasses = qc
+		}
+		if cfg.reverseLookup {
+			// ReverseLookup exits on an invalid address, which must only
+			// fail this line.
+			if err := checkReverseAddrs(qn); err != nil {
+				q.err = err
+				queries <- q
+				continue
+			}
+			la.ReverseLookup()
+		}
+		la.Questions = nil
+		la.PrepareQuestions()
+
+		key := strings.Join(nameservers, " ")
+		if key == "" && a.QueryFlags.UseAuthoritative && len(a.QueryFlags.Nameservers) == 0 {
+			// Every name has its own authoritative nameservers.
+			key = "authoritative " + la.QueryFlags.QNames[0]
+		}
+		// Split DNS routes depend on the names of the line, so they're
+		// worked out again for every line. Nameservers on the line bypass
+		// them, the same as on the command line.
+		routed := key == "" && len(a.QueryFlags.Routes) > 0
+		if len(nameservers) > 0 {
+			la.QueryFlags.Routes = nil
+		}
+		rslvrs, ok := cache[key]
+		if !ok || routed {
+			if len(nameservers) > 0 {
+				la.QueryFlags.Nameservers = nameservers
+			}
+			if err := la.LoadNameservers(); err != nil {
+				q.err = err
+			} else if rslvrs, err = loadResolvers(&la, cfg); err != nil {
+				q.err = err
+			} else if !routed {
+				cache[key] = rslvrs
+			}
+		}
+		la.Resolvers = rslvrs
+		q.app = &la
+		q.routed = routed
+		queries <- q
+	}
+	return scanner.Err()
+}
+
+func checkReverseAddrs(names []string) error {
+	for _, n := range names {
+		if _, err := dns.ReverseAddr(n); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printBatchResult prints the responses of a line, or logs why it failed.
+func printBatchResult(a *app.App, res batchResult) {
+	for _, err := range res.errs {
+		var lookupErr *resolvers.LookupError
+		if errors.As(err, &lookupErr) {
+			a.Logger.Warn("lookup failed", "line", res.Line, "query", res.Query, "nameserver", lookupErr.Nameserver, "error", lookupErr.Err)
+		} else {
+			a.Logger.Warn("lookup failed", "line", res.Line, "query", res.Query, "error", err)
+		}
+	}
+	if len(res.Responses) == 0 {
+		return
+	}
+	if !a.QueryFlags.ShortOutput {
+		fmt.Printf("; line %d: %s\n", res.Line, res.Query)
+	}
+	a.Output(res.Responses)
+	if !a.QueryFlags.ShortOutput {
+		fmt.Println()
+	}
+}
+
+// printBatchJSON prints the result of a line as a single line of JSON.
+func printBatchJSON(a *app.App, res batchResult) {
+	out, err := json.Marshal(res)
+	if err != nil {
+		a.Logger.Error("Error marshaling JSON")
+		os.Exit(exitGenericFailure)
+	}
+	fmt.Println(string(out))
+}
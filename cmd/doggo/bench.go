@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mr-karan/doggo/internal/app"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+	"github.com/mr-karan/doggo/pkg/utils"
+	flag "github.com/spf13/pflag"
+)
+
+const benchUsage = `Usage: doggo bench NAME [TYPE...] [@NAMESERVER...] [options]
+
+Send a number of queries to every nameserver and report the latency
+percentiles, timeout and error rates and the rcodes returned. Nameservers are
+benchmarked one after another. Without any, the system nameservers are used.
+
+Examples:
+  doggo bench example.com @1.1.1.1 @tls://1.1.1.1 @https://cloudflare-dns.com/dns-query
+  doggo bench example.com AAAA @quic://dns.adguard.com --count 1000 --concurrency 20
+  doggo bench example.com @9.9.9.9 --qps 50 --count 500 --json
+
+Options:
+`
+
+func benchCommand() {
+	f := flag.NewFlagSet("bench", flag.ContinueOnError)
+	f.Usage = func() {
+		fmt.Print(benchUsage)
+		fmt.Print(f.FlagUsages())
+	}
+
+	f.Int("count", 100, "Number of queries to send to every nameserver")
+	f.Int("concurrency", 10, "Number of queries in flight at once")
+	f.Float64("qps", 0, "Cap the rate of queries per second (default: as fast as possible)")
+
+	f.StringSliceP("query", "q", []string{}, "Domain name to query")
+	f.StringSliceP("type", "t", []string{}, "Type of DNS record to be queried (A, AAAA, MX etc)")
+	f.StringSliceP("nameserver", "n", []string{}, "Address of the nameserver to send packets to")
+	f.DurationP("timeout", "T", 5*time.Second, "Sets the timeout for a query")
+	f.BoolP("ipv4", "4", false, "Use IPv4 only")
+	f.BoolP("ipv6", "6", false, "Use IPv6 only")
+	f.String("tls-hostname", "", "Hostname for certificate verification")
+	f.Bool("skip-hostname-verification", false, "Skip TLS Hostname Verification")
+	f.Bool("rd", true, "Set Recursion Desired flag")
+	f.Bool("do", false, "Set DNSSEC OK flag")
+
+	f.BoolP("json", "J", false, "Set the output format as JSON")
+	f.Bool("color", true, "Show colored output")
+	f.Bool("debug", false, "Enable debug mode")
+
+	if err := f.Parse(os.Args[2:]); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		fmt.Printf("Error parsing flags: %v\n", err)
+		os.Exit(exitGenericFailure)
+	}
+
+	debug, _ := f.GetBool("debug")
+	logger := utils.InitLogger(debug)
+	a := app.New(logger, nil, buildVersion)
+
+	nameservers, qt, _, qn := loadUnparsedArgs(f.Args())
+	if flagNameservers, _ := f.GetStringSlice("nameserver"); len(flagNameservers) > 0 {
+		nameservers = flagNameservers
+	}
+	a.QueryFlags.QNames, _ = f.GetStringSlice("query")
+	a.QueryFlags.QNames = append(a.QueryFlags.QNames, qn...)
+	a.QueryFlags.QTypes, _ = f.GetStringSlice("type")
+	a.QueryFlags.QTypes = append(a.QueryFlags.QTypes, qt...)
+	if len(a.QueryFlags.QNames) == 0 {
+		f.Usage()
+		os.Exit(exitGenericFailure)
+	}
+
+	opts := resolvers.BenchOptions{}
+	opts.Count, _ = f.GetInt("count")
+	opts.Concurrency, _ = f.GetInt("concurrency")
+	opts.QPS, _ = f.GetFloat64("qps")
+	opts.Timeout, _ = f.GetDuration("timeout")
+	if opts.Count < 1 || opts.Concurrency < 1 || opts.QPS < 0 {
+		logger.Error("--count and --concurrency must be at least 1 and --qps can't be negative")
+		os.Exit(exitGenericFailure)
+	}
+
+	a.QueryFlags.Nameservers = nameservers
+	a.QueryFlags.UseIPv4, _ = f.GetBool("ipv4")
+	a.QueryFlags.UseIPv6, _ = f.GetBool("ipv6")
+	a.QueryFlags.TLSHostname, _ = f.GetString("tls-hostname")
+	a.QueryFlags.InsecureSkipVerify, _ = f.GetBool("skip-hostname-verification")
+	a.QueryFlags.ShowJSON, _ = f.GetBool("json")
+	a.QueryFlags.Color, _ = f.GetBool("color")
+	a.QueryFlags.Strategy = "all"
+	a.LoadFallbacks()
+	a.PrepareQuestions()
+
+	if err := a.LoadNameservers(); err != nil {
+		logger.Error("Error loading nameservers", "error", err)
+		os.Exit(2)
+	}
+	rslvrs, err := loadResolvers(&a, &config{timeout: opts.Timeout})
+	if err != nil {
+		logger.Error("Error loading resolvers", "error", err)
+		os.Exit(2)
+	}
+	a.Resolvers = rslvrs
+
+	var flags resolvers.QueryFlags
+	flags.RD, _ = f.GetBool("rd")
+	flags.DO, _ = f.GetBool("do")
+
+	// Ctrl-C stops the benchmark early and still reports what was measured.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	results, benchErrors := a.Bench(ctx, flags, opts)
+
+	level := slog.LevelError
+	if len(results) > 0 {
+		level = slog.LevelWarn
+	}
+	for _, err := range benchErrors {
+		logResolverError(logger, level, "Error benchmarking nameserver", err)
+	}
+	a.OutputBench(results)
+
+	// A nameserver that never answered counts as a failure.
+	failed := len(rslvrs) - len(results)
+	for _, res := range results {
+		if res.Responses == 0 {
+			failed++
+		}
+	}
+	if failed > 0 && failed < len(rslvrs) {
+		os.Exit(exitPartialFailure)
+	}
+	if failed > 0 {
+		os.Exit(exitLookupFailure)
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"errors"
@@ -8,12 +9,15 @@ import (
 	"log/slog"
 	"math"
 	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/jsdelivr/globalping-cli/globalping"
 	"github.com/knadh/koanf/providers/posflag"
 	"github.com/knadh/koanf/v2"
+	"github.com/miekg/dns"
 	"github.com/mr-karan/doggo/internal/app"
 	"github.com/mr-karan/doggo/pkg/resolvers"
 	"github.com/mr-karan/doggo/pkg/utils"
@@ -22,11 +26,14 @@ import (
 
 // Exit codes used by the CLI. Exit 0 is implicit success; partial success
 // (some resolvers answered, others failed) is 2; full lookup failure remains
-// 9 to preserve compatibility with the pre-existing convention.
+// 9 to preserve compatibility with the pre-existing convention. A watch
+// interrupted before the value it waits for showed up exits with 130, as
+// shells report Ctrl-C.
 const (
 	exitGenericFailure = 1
 	exitPartialFailure = 2
 	exitLookupFailure  = 9
+	exitInterrupted    = 130
 )
 
 var (
@@ -40,6 +47,14 @@ func main() {
 		completionsCommand()
 		return
 	}
+	if len(os.Args) > 1 && os.Args[1] == "update" {
+		updateCommand()
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		benchCommand()
+		return
+	}
 
 	cfg, err := loadConfig()
 	if err != nil {
@@ -82,6 +97,33 @@ func main() {
 	app.LoadFallbacks()
 	app.PrepareQuestions()
 
+	if app.QueryFlags.Batch != "" && (app.QueryFlags.Trace || app.QueryFlags.Propagation || app.QueryFlags.Watch != 0 || app.QueryFlags.WatchUntil != "") {
+		logger.Error("--batch can't be combined with --trace, --propagation or --watch")
+		os.Exit(exitGenericFailure)
+	}
+
+	if app.QueryFlags.Trace {
+		if len(app.QueryFlags.QNames) == 0 {
+			cfg.flagSet.Usage()
+			os.Exit(0)
+		}
+		runTrace(app, cfg)
+		return
+	}
+
+	if app.QueryFlags.Propagation {
+		if len(app.QueryFlags.QNames) == 0 {
+			cfg.flagSet.Usage()
+			os.Exit(0)
+		}
+		if len(app.QueryFlags.Nameservers) > 0 {
+			logger.Error("--propagation queries its own catalogue of public resolvers and can't be combined with nameservers")
+			os.Exit(exitGenericFailure)
+		}
+		runPropagation(app, cfg)
+		return
+	}
+
 	if err := app.LoadNameservers(); err != nil {
 		logger.Error("Error loading nameservers", "error", err)
 		os.Exit(2)
@@ -94,12 +136,38 @@ func main() {
 	}
 	app.Resolvers = resolvers
 
+	if app.QueryFlags.Batch != "" {
+		runBatch(app, cfg)
+		return
+	}
+
 	if len(app.QueryFlags.QNames) == 0 {
 		cfg.flagSet.Usage()
 		os.Exit(0)
 	}
 
-	responses, lookupErrors := performLookup(app, cfg)
+	isTransfer, err := app.IsTransfer()
+	if err != nil {
+		logger.Error("Error preparing zone transfer", "error", err)
+		os.Exit(2)
+	}
+	isWatch := app.QueryFlags.Watch != 0 || app.QueryFlags.WatchUntil != "" || app.QueryFlags.WatchDeadline != 0
+	if isTransfer {
+		if isWatch {
+			logger.Error("--watch can't be combined with zone transfers")
+			os.Exit(exitGenericFailure)
+		}
+		runTransfer(app)
+		return
+	}
+
+	if isWatch {
+		runWatch(app, cfg)
+		return
+	}
+
+	responses, lookupErrors := performLookup(context.Background(), app, cfg)
+	app.Close()
 	outputResults(app, responses, lookupErrors)
 }
 
@@ -138,6 +206,12 @@ func loadConfig() (*config, error) {
 	if bufsize > 0 && bufsize < 512 {
 		return nil, fmt.Errorf("--bufsize must be 0 or at least 512 (RFC 6891), got %d", bufsize)
 	}
+	if tries := k.Int("tries"); tries < 0 {
+		return nil, fmt.Errorf("--tries can't be negative, got %d", tries)
+	}
+	if retryTimeout := k.Duration("retry-timeout"); retryTimeout < 0 {
+		return nil, fmt.Errorf("--retry-timeout can't be negative, got %s", retryTimeout)
+	}
 
 	cfg.queryFlags = resolvers.QueryFlags{
 		AA: k.Bool("aa"),
@@ -154,6 +228,8 @@ func loadConfig() (*config, error) {
 		EDE:     k.Bool("ede"),
 		ECS:     k.String("ecs"),
 		Bufsize: uint16(bufsize),
+
+		Validate: k.Bool("validate"),
 	}
 
 	return cfg, nil
@@ -167,28 +243,55 @@ func setupFlags() *flag.FlagSet {
 	f.StringSliceP("type", "t", []string{}, "Type of DNS record to be queried (A, AAAA, MX etc)")
 	f.StringSliceP("class", "c", []string{}, "Network class of the DNS record to be queried (IN, CH, HS etc)")
 	f.StringSliceP("nameserver", "n", []string{}, "Address of the nameserver to send packets to")
+	f.StringSlice("route", []string{}, "Send the questions for a domain to its own nameservers, eg '*.corp.example -> @10.0.0.53'")
 	f.BoolP("reverse", "x", false, "Performs a DNS Lookup for an IPv4 or IPv6 address")
 
 	f.String("gp-from", "", "Probe locations as a comma-separated list")
 	f.Int("gp-limit", 1, "Limit the number of probes to use")
 
 	f.DurationP("timeout", "T", 5*time.Second, "Sets the timeout for a query")
+	f.Int("tries", 0, "Number of times a query is sent to a nameserver that doesn't answer")
+	f.Duration("retry-timeout", 0, "Timeout of the first try of a query, doubled at every retry")
 	f.Bool("search", true, "Use the search list provided in resolv.conf")
 	f.Int("ndots", -1, "Specify the ndots parameter")
 	f.BoolP("ipv4", "4", false, "Use IPv4 only")
 	f.BoolP("ipv6", "6", false, "Use IPv6 only")
-	f.String("strategy", "all", "Strategy to query nameservers (all, random, first, internal)")
+	f.String("source", "", "Source address, optionally with a port, to send the queries from")
+	f.String("interface", "", "Network interface to send the queries out of")
+	f.String("proxy", "", "SOCKS5 or HTTP proxy to send the TCP, DoT and DoH queries through")
+	f.String("strategy", "all", "Strategy to query nameservers (all, random, first, internal, failover, fastest)")
 	f.String("tls-hostname", "", "Hostname for certificate verification")
 	f.Bool("skip-hostname-verification", false, "Skip TLS Hostname Verification")
+	f.String("tls-cert", "", "PEM file of the client certificate sent to DoT, DoH and DoQ nameservers")
+	f.String("tls-key", "", "PEM file of the key of the client certificate")
+	f.String("tls-ca", "", "PEM bundle of the CAs to verify the certificates of DoT, DoH and DoQ nameservers against")
+	f.StringSlice("tls-pin", []string{}, "SPKI pin (sha256/<base64>) one of the certificates of DoT, DoH and DoQ nameservers has to match")
+	f.Bool("doh-http3", false, "Send DNS over HTTPS queries over HTTP/3")
+	f.String("odoh-relay", "", "URL or DNS stamp of the relay to send Oblivious DoH queries through")
+	f.Bool("dnscrypt-tcp", false, "Send DNSCrypt queries over TCP")
+	f.Bool("tls-info", false, "Show the TLS connection and certificates of DoT, DoH and DoQ nameservers")
 
 	f.Bool("any", false, "Query all supported DNS record types")
 	f.BoolP("authoritative", "A", false, "Automatically query the authoritative nameserver for the domain")
+	f.Bool("trace", false, "Resolve iteratively from the root servers and show every referral")
+	f.Bool("propagation", false, "Query a catalogue of public resolvers and show which answer most of them return")
+	f.String("batch", "", "Read queries from a file, one per line, or from stdin with -")
+	f.Int("batch-concurrency", 10, "Number of batch lines looked up at once")
+	f.Uint32("ixfr-serial", 0, "Request an incremental zone transfer (IXFR) from the given SOA serial")
+	f.String("tsig", "", "TSIG key to sign queries and zone transfers with, as name:algorithm:secret")
+	f.String("tsig-file", "", "Path to a TSIG key file in BIND format (as written by tsig-keygen)")
+	f.Duration("watch", 0, "Repeat the lookup at this interval and highlight what changed (eg 10s)")
+	f.String("watch-until", "", "Keep watching until an answer has this value")
+	f.Duration("watch-deadline", 0, "Stop watching after this long, failing if the --watch-until value hasn't shown up")
 
 	f.BoolP("json", "J", false, "Set the output format as JSON")
 	f.Bool("short", false, "Short output format")
+	f.Bool("zone-file", false, "Output zone transfers in RFC 1035 zone file format")
 	f.Bool("time", false, "Display how long the response took")
 	f.Bool("color", true, "Show colored output")
 	f.Bool("debug", false, "Enable debug mode")
+	f.String("config", "", "Path to the config file (default: $XDG_CONFIG_HOME/doggo/config.toml)")
+	f.Bool("no-config", false, "Don't load the config file")
 
 	// Add flags for DNS query options
 	f.Bool("aa", false, "Set Authoritative Answer flag")
@@ -197,6 +300,7 @@ func setupFlags() *flag.FlagSet {
 	f.Bool("rd", true, "Set Recursion Desired flag (default: true)")
 	f.Bool("z", false, "Set Z flag (reserved for future use)")
 	f.Bool("do", false, "Set DNSSEC OK flag")
+	f.Bool("validate", false, "Validate the DNSSEC chain of trust from the root for every response")
 
 	// Add flags for EDNS0 options
 	f.Bool("nsid", false, "Request Name Server Identifier (NSID)")
@@ -215,6 +319,11 @@ func parseAndLoadFlags(f *flag.FlagSet) error {
 	if err := f.Parse(os.Args[1:]); err != nil {
 		return fmt.Errorf("error parsing flags: %w", err)
 	}
+	// The config file goes first: posflag only overrides its values with
+	// the flags that were set on the command line.
+	if err := loadConfigFile(f); err != nil {
+		return err
+	}
 	if err := k.Load(posflag.Provider(f, ".", k), nil); err != nil {
 		return fmt.Errorf("error loading flags: %w", err)
 	}
@@ -243,18 +352,33 @@ func initializeApp(logger *slog.Logger, cfg *config) *app.App {
 		os.Exit(2)
 	}
 
-	loadNameservers(&app, cfg.flagSet.Args())
+	loadNameservers(&app, cfg.flagSet)
 	return &app
 }
 
-func loadNameservers(app *app.App, args []string) {
+func loadNameservers(app *app.App, f *flag.FlagSet) {
 	flagNameservers := k.Strings("nameserver")
-	unparsedNameservers, qt, qc, qn := loadUnparsedArgs(args)
+	unparsedNameservers, qt, qc, qn := loadUnparsedArgs(f.Args())
 
-	if len(flagNameservers) > 0 {
+	// Nameservers, types and classes from the config file are only
+	// defaults: the ones given as arguments replace them.
+	switch {
+	case f.Changed("nameserver"):
 		app.QueryFlags.Nameservers = flagNameservers
-	} else {
+	case len(unparsedNameservers) > 0:
 		app.QueryFlags.Nameservers = unparsedNameservers
+	default:
+		app.QueryFlags.Nameservers = flagNameservers
+	}
+	// Split DNS routes don't apply to nameservers given on the command line.
+	if (f.Changed("nameserver") || len(unparsedNameservers) > 0) && !f.Changed("route") {
+		app.QueryFlags.Routes = nil
+	}
+	if len(qt) > 0 && !f.Changed("type") {
+		app.QueryFlags.QTypes = nil
+	}
+	if len(qc) > 0 && !f.Changed("class") {
+		app.QueryFlags.QClasses = nil
 	}
 
 	app.QueryFlags.QTypes = append(app.QueryFlags.QTypes, qt...)
@@ -262,23 +386,98 @@ func loadNameservers(app *app.App, args []string) {
 	app.QueryFlags.QNames = append(app.QueryFlags.QNames, qn...)
 }
 
+// loadResolvers returns the resolvers for app.Nameservers and sets the ones
+// of every split DNS route.
 func loadResolvers(app *app.App, cfg *config) ([]resolvers.Resolver, error) {
-	return resolvers.LoadResolvers(resolvers.Options{
+	opts, err := resolverOptions(app, cfg)
+	if err != nil {
+		return nil, err
+	}
+	for i := range app.Routes {
+		routeOpts := opts
+		routeOpts.Nameservers = app.Routes[i].Nameservers
+		if app.Routes[i].Resolvers, err = resolvers.LoadResolvers(routeOpts); err != nil {
+			return nil, err
+		}
+	}
+	return resolvers.LoadResolvers(opts)
+}
+
+// resolverOptions returns the options every resolver is created with.
+func resolverOptions(app *app.App, cfg *config) (resolvers.Options, error) {
+	var (
+		tsig *resolvers.TSIGKey
+		err  error
+	)
+	switch {
+	case app.QueryFlags.TSIG != "" && app.QueryFlags.TSIGFile != "":
+		return resolvers.Options{}, errors.New("--tsig and --tsig-file can't be used together")
+	case app.QueryFlags.TSIG != "":
+		tsig, err = resolvers.ParseTSIGKey(app.QueryFlags.TSIG)
+	case app.QueryFlags.TSIGFile != "":
+		tsig, err = resolvers.LoadTSIGKeyFile(app.QueryFlags.TSIGFile)
+	}
+	if err != nil {
+		return resolvers.Options{}, err
+	}
+
+	tries, retryTimeout := retries(app)
+	opts := resolvers.Options{
 		Nameservers:        app.Nameservers,
 		UseIPv4:            app.QueryFlags.UseIPv4,
 		UseIPv6:            app.QueryFlags.UseIPv6,
 		SearchList:         app.ResolverOpts.SearchList,
 		Ndots:              app.ResolverOpts.Ndots,
 		Timeout:            cfg.timeout,
+		Tries:              tries,
+		RetryTimeout:       retryTimeout,
 		Logger:             app.Logger,
 		Strategy:           app.QueryFlags.Strategy,
 		InsecureSkipVerify: app.QueryFlags.InsecureSkipVerify,
 		TLSHostname:        app.QueryFlags.TLSHostname,
-	})
+		HTTP3:              app.QueryFlags.DOHHTTP3,
+		ODoHRelay:          app.QueryFlags.ODoHRelay,
+		DNSCryptTCP:        app.QueryFlags.DNSCryptTCP,
+		TLSInfo:            app.QueryFlags.TLSInfo,
+		TLSCert:            app.QueryFlags.TLSCert,
+		TLSKey:             app.QueryFlags.TLSKey,
+		TLSCA:              app.QueryFlags.TLSCA,
+		TLSPins:            app.QueryFlags.TLSPins,
+		Source:             app.QueryFlags.Source,
+		Interface:          app.QueryFlags.Interface,
+		TSIG:               tsig,
+	}
+	if app.QueryFlags.Proxy != "" {
+		if opts.Dialer, err = resolvers.NewProxyDialer(app.QueryFlags.Proxy, opts); err != nil {
+			return resolvers.Options{}, err
+		}
+	}
+	return opts, nil
+}
+
+// retries returns the number of tries of a query and the timeout of the
+// first one, from the flags or else the resolv.conf of the system
+// nameservers.
+func retries(app *app.App) (int, time.Duration) {
+	return cmp.Or(app.QueryFlags.Tries, app.ResolverOpts.Tries),
+		cmp.Or(app.QueryFlags.RetryTimeout, app.ResolverOpts.RetryTimeout)
 }
 
-func performLookup(app *app.App, cfg *config) ([]resolvers.Response, []error) {
-	ctx, cancel := context.WithTimeout(context.Background(), cfg.timeout)
+func performLookup(ctx context.Context, app *app.App, cfg *config) ([]resolvers.Response, []error) {
+	strategy := app.QueryFlags.Strategy
+	// A nameserver may take all its tries to answer.
+	tries, retryTimeout := retries(app)
+	lookupTimeout := resolvers.Options{Timeout: cfg.timeout, Tries: tries, RetryTimeout: retryTimeout}.LookupTimeout()
+	timeout := lookupTimeout
+	if strategy == "failover" {
+		// Every nameserver may time out in turn before one answers.
+		n := 1
+		for _, l := range app.Lookups() {
+			n = max(n, len(l.Resolvers))
+		}
+		timeout *= time.Duration(n)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	var (
@@ -288,29 +487,153 @@ func performLookup(app *app.App, cfg *config) ([]resolvers.Response, []error) {
 		allErrors    []error
 	)
 
-	for _, resolver := range app.Resolvers {
-		wg.Add(1)
-		go func(r resolvers.Resolver) {
-			defer wg.Done()
-			responses, err := r.Lookup(ctx, app.Questions, cfg.queryFlags)
-			mu.Lock()
-			defer mu.Unlock()
-			// Collect any responses the resolver produced even when err != nil
-			// so partial successes within a single resolver still surface.
-			allResponses = append(allResponses, responses...)
-			if err != nil {
-				allErrors = append(allErrors, &resolvers.LookupError{
-					Nameserver: r.Address(),
-					Err:        err,
-				})
-			}
-		}(resolver)
+	for _, l := range app.Lookups() {
+		if strategy == "failover" || strategy == "fastest" {
+			wg.Add(1)
+			go func(rslvrs []resolvers.Resolver, questions []dns.Question) {
+				defer wg.Done()
+				var (
+					responses []resolvers.Response
+					errs      []error
+				)
+				if strategy == "failover" {
+					responses, errs = resolvers.Failover(ctx, rslvrs, questions, cfg.queryFlags, lookupTimeout, app.Logger)
+				} else {
+					responses, errs = resolvers.Fastest(ctx, rslvrs, questions, cfg.queryFlags, app.Logger)
+				}
+				mu.Lock()
+				defer mu.Unlock()
+				allResponses = append(allResponses, responses...)
+				allErrors = append(allErrors, errs...)
+			}(l.Resolvers, l.Questions)
+			continue
+		}
+		for _, resolver := range l.Resolvers {
+			wg.Add(1)
+			go func(r resolvers.Resolver, questions []dns.Question) {
+				defer wg.Done()
+				responses, err := r.Lookup(ctx, questions, cfg.queryFlags)
+				mu.Lock()
+				defer mu.Unlock()
+				// Collect any responses the resolver produced even when err != nil
+				// so partial successes within a single resolver still surface.
+				allResponses = append(allResponses, responses...)
+				if err != nil {
+					allErrors = append(allErrors, &resolvers.LookupError{
+						Nameserver: r.Address(),
+						Err:        err,
+					})
+				}
+			}(resolver, l.Questions)
+		}
 	}
 
 	wg.Wait()
 	return allResponses, allErrors
 }
 
+// runTrace performs an iterative resolution from the root servers for every
+// question and exits with the same codes as a regular lookup: 9 when every
+// trace failed, 2 when only some of them did.
+func runTrace(app *app.App, cfg *config) {
+	opts, err := resolverOptions(app, cfg)
+	if err != nil {
+		app.Logger.Error("Error loading resolvers", "error", err)
+		os.Exit(exitGenericFailure)
+	}
+	results, err := app.Trace(context.Background(), opts)
+	app.OutputTrace(results)
+	if err == nil {
+		return
+	}
+
+	app.Logger.Error("Error tracing DNS records", "error", err)
+	for _, res := range results {
+		if res.Error == "" {
+			os.Exit(exitPartialFailure)
+		}
+	}
+	os.Exit(exitLookupFailure)
+}
+
+// runWatch repeats the lookup until interrupted. With --watch-until it exits
+// as soon as the value shows up, with 9 if the deadline passes first, or
+// with 130 if it's interrupted first.
+func runWatch(a *app.App, cfg *config) {
+	if a.QueryFlags.Watch < 0 || a.QueryFlags.WatchDeadline < 0 {
+		a.Logger.Error("--watch and --watch-deadline must be positive durations")
+		os.Exit(exitGenericFailure)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	err := a.Watch(ctx, func(ctx context.Context) ([]resolvers.Response, []error) {
+		return performLookup(ctx, a, cfg)
+	})
+	a.Close()
+	if errors.Is(err, context.Canceled) {
+		os.Exit(exitInterrupted)
+	}
+	if err != nil {
+		a.Logger.Error("Error watching DNS records", "value", a.QueryFlags.WatchUntil, "error", err)
+		os.Exit(exitLookupFailure)
+	}
+}
+
+// runPropagation queries the catalogue of public resolvers. As with a regular
+// lookup, it exits with 9 when no resolver answered and 2 when only some did;
+// resolvers disagreeing isn't a failure.
+func runPropagation(app *app.App, cfg *config) {
+	opts, err := resolverOptions(app, cfg)
+	if err != nil {
+		app.Logger.Error("Error loading resolvers", "error", err)
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.LookupTimeout())
+	defer cancel()
+	catalogue, version := publicResolvers()
+	props := app.Propagation(ctx, catalogue, version, opts, cfg.queryFlags)
+	app.OutputPropagation(props)
+
+	answered, failed := 0, 0
+	for _, p := range props {
+		answered += p.Answered
+		failed += p.Total - p.Answered
+	}
+	if failed > 0 && answered > 0 {
+		os.Exit(exitPartialFailure)
+	}
+	if failed > 0 {
+		os.Exit(exitLookupFailure)
+	}
+}
+
+// runTransfer performs the requested zone transfers and exits with the same
+// codes as a regular lookup.
+func runTransfer(app *app.App) {
+	responses, transferErrors := app.Transfer(context.Background())
+	if app.QueryFlags.ShowJSON {
+		outputTransferJSON(app.Logger, responses, transferErrors)
+	} else {
+		level := slog.LevelError
+		if len(responses) > 0 {
+			level = slog.LevelWarn
+		}
+		for _, err := range transferErrors {
+			logResolverError(app.Logger, level, "Error transferring zone", err)
+		}
+		app.OutputTransfer(responses)
+	}
+
+	if len(transferErrors) > 0 && len(responses) > 0 {
+		os.Exit(exitPartialFailure)
+	}
+	if len(transferErrors) > 0 {
+		os.Exit(exitLookupFailure)
+	}
+}
+
 func outputResults(app *app.App, responses []resolvers.Response, responseErrors []error) {
 	if app.QueryFlags.ShowJSON {
 		outputJSON(app.Logger, responses, responseErrors)
@@ -344,21 +667,31 @@ func outputResults(app *app.App, responses []resolvers.Response, responseErrors
 // unwrapping LookupError so the nameserver shows up as its own structured
 // field rather than embedded in the message.
 func logResolverError(logger *slog.Logger, level slog.Level, msg string, err error) {
+	var args []any
+	// The certificates presented by the server, for --tls-info.
+	var tlsErr *resolvers.TLSError
+	if errors.As(err, &tlsErr) {
+		for _, cert := range tlsErr.TLS.Certificates {
+			args = append(args, "certificate", cert.String())
+		}
+	}
 	var lookupErr *resolvers.LookupError
 	if errors.As(err, &lookupErr) {
-		logger.Log(context.Background(), level, msg,
+		logger.Log(context.Background(), level, msg, append([]any{
 			"nameserver", lookupErr.Nameserver,
 			"error", lookupErr.Err,
-		)
+		}, args...)...)
 		return
 	}
-	logger.Log(context.Background(), level, msg, "error", err)
+	logger.Log(context.Background(), level, msg, append([]any{"error", err}, args...)...)
 }
 
 // resolverErrorJSON is the per-resolver error shape returned in JSON output.
 type resolverErrorJSON struct {
-	Nameserver string `json:"nameserver,omitempty"`
-	Error      string `json:"error"`
+	Nameserver string              `json:"nameserver,omitempty"`
+	Error      string              `json:"error"`
+	TLS        *resolvers.TLSInfo  `json:"tls,omitempty"`
+	Pin        *resolvers.PinError `json:"pin,omitempty"`
 }
 
 func outputJSON(logger *slog.Logger, responses []resolvers.Response, responseErrors []error) {
@@ -370,18 +703,7 @@ func outputJSON(logger *slog.Logger, responses []resolvers.Response, responseErr
 		Error string `json:"error,omitempty"`
 	}{
 		Responses: responses,
-	}
-
-	for _, err := range responseErrors {
-		var lookupErr *resolvers.LookupError
-		if errors.As(err, &lookupErr) {
-			jsonOutput.Errors = append(jsonOutput.Errors, resolverErrorJSON{
-				Nameserver: lookupErr.Nameserver,
-				Error:      lookupErr.Err.Error(),
-			})
-			continue
-		}
-		jsonOutput.Errors = append(jsonOutput.Errors, resolverErrorJSON{Error: err.Error()})
+		Errors:    errorsJSON(responseErrors),
 	}
 
 	if len(responses) == 0 && len(responseErrors) > 0 {
@@ -395,3 +717,46 @@ func outputJSON(logger *slog.Logger, responses []resolvers.Response, responseErr
 	}
 	fmt.Println(string(jsonData))
 }
+
+func outputTransferJSON(logger *slog.Logger, transfers []resolvers.TransferResponse, transferErrors []error) {
+	jsonOutput := struct {
+		Transfers []resolvers.TransferResponse `json:"transfers,omitempty"`
+		Errors    []resolverErrorJSON          `json:"errors,omitempty"`
+	}{
+		Transfers: transfers,
+		Errors:    errorsJSON(transferErrors),
+	}
+
+	jsonData, err := json.MarshalIndent(jsonOutput, "", "  ")
+	if err != nil {
+		logger.Error("Error marshaling JSON")
+		os.Exit(exitGenericFailure)
+	}
+	fmt.Println(string(jsonData))
+}
+
+// errorsJSON converts per-resolver errors to their JSON shape.
+func errorsJSON(errs []error) []resolverErrorJSON {
+	var out []resolverErrorJSON
+	for _, err := range errs {
+		var tlsInfo *resolvers.TLSInfo
+		var tlsErr *resolvers.TLSError
+		if errors.As(err, &tlsErr) {
+			tlsInfo = tlsErr.TLS
+		}
+		var pinErr *resolvers.PinError
+		errors.As(err, &pinErr)
+		var lookupErr *resolvers.LookupError
+		if errors.As(err, &lookupErr) {
+			out = append(out, resolverErrorJSON{
+				Nameserver: lookupErr.Nameserver,
+				Error:      lookupErr.Err.Error(),
+				TLS:        tlsInfo,
+				Pin:        pinErr,
+			})
+			continue
+		}
+		out = append(out, resolverErrorJSON{Error: err.Error(), TLS: tlsInfo, Pin: pinErr})
+	}
+	return out
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"os"
 )
 
@@ -13,7 +14,7 @@ _doggo() {
     cur="${COMP_WORDS[COMP_CWORD]}"
     prev="${COMP_WORDS[COMP_CWORD-1]}"
 
-    opts="-v --version -h --help -q --query -t --type -n --nameserver -c --class -r --reverse --any --strategy --ndots --search --timeout -4 --ipv4 -6 --ipv6 --tls-hostname --skip-hostname-verification --aa --ad --cd --rd --z --do --nsid --cookie --padding --ede --ecs --bufsize -J --json --short --color --debug --time --gp-from --gp-limit"
+    opts="-v --version -h --help -q --query -t --type -n --nameserver --route -c --class -r --reverse --any -A --authoritative --trace --propagation --ixfr-serial --tsig --tsig-file --watch --watch-until --watch-deadline --batch --batch-concurrency --strategy --ndots --search --timeout --tries --retry-timeout -4 --ipv4 -6 --ipv6 --source --interface --proxy --tls-hostname --skip-hostname-verification --tls-cert --tls-key --tls-ca --tls-pin --doh-http3 --odoh-relay --dnscrypt-tcp --aa --ad --cd --rd --z --do --validate --nsid --cookie --padding --ede --ecs --bufsize -J --json --short --zone-file --color --debug --time --tls-info --config --no-config --gp-from --gp-limit"
 
     case "${prev}" in
         -t|--type)
@@ -25,11 +26,11 @@ _doggo() {
             return 0
             ;;
         -n|--nameserver)
-            COMPREPLY=( $(compgen -A hostname -- ${cur}) )
+            COMPREPLY=( $(compgen -W "$(doggo completions nameservers ${COMP_LINE} 2>/dev/null)" -A hostname -- ${cur}) )
             return 0
             ;;
         --strategy)
-            COMPREPLY=( $(compgen -W "all random first internal" -- ${cur}) )
+            COMPREPLY=( $(compgen -W "all random first internal failover fastest" -- ${cur}) )
             return 0
             ;;
         --search|--color)
@@ -38,8 +39,17 @@ _doggo() {
             ;;
     esac
 
+    if [[ ${COMP_WORDS[1]} == "bench" ]]; then
+        opts="-h --help --count --concurrency --qps -q --query -t --type -n --nameserver -T --timeout -4 --ipv4 -6 --ipv6 --tls-hostname --skip-hostname-verification --rd --do -J --json --color --debug"
+    fi
+    if [[ ${COMP_WORDS[1]} == "update" ]]; then
+        opts="-h --help --add --delete --replace --prereq-name-in-use --prereq-name-not-in-use --prereq-rrset-exists --prereq-rrset-not-exists -n --nameserver --tsig --tsig-file -T --timeout -4 --ipv4 -6 --ipv6 --tls-hostname --skip-hostname-verification -J --json --short --color --debug"
+    fi
+
     if [[ ${cur} == -* ]]; then
         COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+    elif [[ ${cur} == @* ]]; then
+        COMPREPLY=( $(compgen -P @ -W "$(doggo completions nameservers ${COMP_LINE} 2>/dev/null)" -- "${cur#@}") )
     else
         COMPREPLY=( $(compgen -A hostname -- ${cur}) )
     fi
@@ -50,10 +60,31 @@ complete -F _doggo doggo
 
 	zshCompletion = `#compdef doggo
 
+# Aliases and groups of nameservers from the config file.
+_doggo_nameservers() {
+  local -a names
+  names=(${(f)"$(doggo completions nameservers ${words[1,CURRENT-1]} 2>/dev/null)"})
+  _describe -t nameservers 'nameserver alias' names
+}
+
+_doggo_nameserver() {
+  _alternative 'nameservers:nameserver alias:_doggo_nameservers' 'hosts:host:_hosts'
+}
+
+_doggo_arguments() {
+  if compset -P '@'; then
+    _doggo_nameserver
+  else
+    _hosts
+  fi
+}
+
 _doggo() {
   local -a commands
   commands=(
     'completions:Generate shell completion scripts'
+    'update:Send an RFC 2136 dynamic update'
+    'bench:Benchmark nameservers'
   )
 
   _arguments -C \
@@ -61,24 +92,49 @@ _doggo() {
     '(-h --help)'{-h,--help}'[Show list of command-line options]' \
     '(-q --query)'{-q,--query}'[Hostname to query the DNS records for]:hostname:_hosts' \
     '(-t --type)'{-t,--type}'[Type of the DNS Record]:record type:(A AAAA CAA CNAME HINFO MX NS PTR SOA SRV TXT)' \
-    '(-n --nameserver)'{-n,--nameserver}'[Address of a specific nameserver to send queries to]:nameserver:_hosts' \
+    '(-n --nameserver)'{-n,--nameserver}'[Address of a specific nameserver to send queries to]:nameserver:_doggo_nameserver' \
+    '*--route[Send the questions for a domain to its own nameservers]:route (DOMAIN -> @NAMESERVER)' \
     '(-c --class)'{-c,--class}'[Network class of the DNS record being queried]:network class:(IN CH HS)' \
     '(-r --reverse)'{-r,--reverse}'[Performs a DNS Lookup for an IPv4 or IPv6 address]' \
     '--any[Query all supported DNS record types]' \
-    '--strategy[Strategy to query nameservers]:strategy:(all random first internal)' \
+    '(-A --authoritative)'{-A,--authoritative}'[Query the authoritative nameservers for the domain]' \
+    '--trace[Resolve iteratively from the root servers]' \
+    '--propagation[Query a catalogue of public resolvers and show the consensus]' \
+    '--ixfr-serial[Request an incremental zone transfer from the given SOA serial]:serial' \
+    '--tsig[TSIG key used to sign queries and zone transfers]:name\:algorithm\:secret' \
+    '--tsig-file[Read the TSIG key from a BIND key file]:key file:_files' \
+    '--watch[Repeat the lookup at an interval and highlight changes]:interval' \
+    '--watch-until[Keep watching until an answer has this value]:value' \
+    '--watch-deadline[Stop watching after this long]:duration' \
+    '--batch[Read queries from a file, one per line, or from stdin with -]:batch file:_files' \
+    '--batch-concurrency[Number of batch lines looked up at once]:number of lines' \
+    '--strategy[Strategy to query nameservers]:strategy:(all random first internal failover fastest)' \
     '--ndots[Number of required dots in hostname to assume FQDN]:number of dots' \
     '--search[Use the search list defined in resolv.conf]:setting:(true false)' \
     '--timeout[Timeout (in seconds) for the resolver to return a response]:seconds' \
+    '--tries[Number of times a query is sent to a nameserver that does not answer]:number of tries' \
+    '--retry-timeout[Timeout of the first try of a query, doubled at every retry]:duration' \
     '(-4 --ipv4)'{-4,--ipv4}'[Use IPv4 only]' \
     '(-6 --ipv6)'{-6,--ipv6}'[Use IPv6 only]' \
+    '--source[Source address to send the queries from]:address' \
+    '--interface[Network interface to send the queries out of]:interface:_net_interfaces' \
+    '--proxy[SOCKS5 or HTTP proxy to send the TCP, DoT and DoH queries through]:proxy:_urls' \
     '--tls-hostname[Hostname used for verification of certificate incase the provided DoT nameserver is an IP]:hostname:_hosts' \
     '--skip-hostname-verification[Skip TLS hostname verification in case of DoT lookups]' \
+    '--tls-cert[PEM file of the TLS client certificate]:certificate file:_files' \
+    '--tls-key[PEM file of the key of the TLS client certificate]:key file:_files' \
+    '--tls-ca[PEM bundle of the CAs to verify nameservers against]:CA file:_files' \
+    '*--tls-pin[SPKI pin of the nameserver (sha256/BASE64)]:pin' \
+    '--doh-http3[Send DoH queries over HTTP/3]' \
+    '--odoh-relay[URL or DNS stamp of the ODoH relay]:relay:' \
+    '--dnscrypt-tcp[Send DNSCrypt queries over TCP]' \
     '--aa[Set Authoritative Answer flag]' \
     '--ad[Set Authenticated Data flag]' \
     '--cd[Set Checking Disabled flag]' \
     '--rd[Set Recursion Desired flag]' \
     '--z[Set Z flag (reserved for future use)]' \
     '--do[Set DNSSEC OK flag]' \
+    '--validate[Validate the DNSSEC chain of trust]' \
     '--nsid[Request Name Server Identifier (NSID)]' \
     '--cookie[Request DNS Cookie]' \
     '--padding[Request EDNS padding for privacy]' \
@@ -87,12 +143,16 @@ _doggo() {
     '--bufsize[EDNS UDP buffer size in bytes]:buffer size' \
     '(-J --json)'{-J,--json}'[Format the output as JSON]' \
     '--short[Shows only the response section in the output]' \
+    '--zone-file[Print zone transfers in zone file format]' \
     '--color[Colored output]:setting:(true false)' \
     '--debug[Enable debug logging]' \
     '--time[Shows how long the response took from the server]' \
+    '--tls-info[Show the TLS connection and certificates]' \
+    '--config[Path to the config file]:config file:_files' \
+    '--no-config[Do not load the config file]' \
     '--gp-from[Query using Globalping API from a specific location]' \
     '--gp-limit[Limit the number of probes to use from Globalping]' \
-    '*:hostname:_hosts' \
+    '*:hostname:_doggo_arguments' \
     && ret=0
 
   case $state in
@@ -116,6 +176,13 @@ function __fish_doggo_no_subcommand
     return 1
 end
 
+# Aliases and groups of nameservers from the config file.
+function __fish_doggo_nameservers
+    for name in (doggo completions nameservers (commandline -opc) 2>/dev/null)
+        echo -e "$argv[1]$name\tNameserver alias"
+    end
+end
+
 # Meta options
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'version' -d "Show version of doggo"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'help'    -d "Show list of command-line options"
@@ -123,18 +190,35 @@ complete -c doggo -n '__fish_doggo_no_subcommand' -l 'help'    -d "Show list of
 # Query options
 complete -c doggo -n '__fish_doggo_no_subcommand' -s 'q' -l 'query'      -d "Hostname to query the DNS records for" -x -a "(__fish_print_hostnames)"
 complete -c doggo -n '__fish_doggo_no_subcommand' -s 't' -l 'type'       -d "Type of the DNS Record" -x -a "A AAAA CAA CNAME HINFO MX NS PTR SOA SRV TXT"
-complete -c doggo -n '__fish_doggo_no_subcommand' -s 'n' -l 'nameserver' -d "Address of a specific nameserver to send queries to" -x -a "(__fish_print_hostnames)"
+complete -c doggo -n '__fish_doggo_no_subcommand' -s 'n' -l 'nameserver' -d "Address of a specific nameserver to send queries to" -x -a "(__fish_doggo_nameservers) (__fish_print_hostnames)"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'route'      -d "Send the questions for a domain to its own nameservers" -x
 complete -c doggo -n '__fish_doggo_no_subcommand' -s 'c' -l 'class'      -d "Network class of the DNS record being queried" -x -a "IN CH HS"
 complete -c doggo -n '__fish_doggo_no_subcommand' -s 'r' -l 'reverse'    -d "Performs a DNS Lookup for an IPv4 or IPv6 address"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'any'               -d "Query all supported DNS record types"
+complete -c doggo -n '__fish_doggo_no_subcommand' -s 'A' -l 'authoritative' -d "Query the authoritative nameservers for the domain"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'trace'             -d "Resolve iteratively from the root servers"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'propagation'       -d "Query a catalogue of public resolvers and show the consensus"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'ixfr-serial'       -d "Request an incremental zone transfer from the given SOA serial" -x
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'tsig'              -d "TSIG key used to sign queries and zone transfers" -x
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'tsig-file'         -d "Read the TSIG key from a BIND key file" -r
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'watch'             -d "Repeat the lookup at an interval and highlight changes" -x
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'watch-until'       -d "Keep watching until an answer has this value" -x
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'watch-deadline'    -d "Stop watching after this long" -x
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'batch'             -d "Read queries from a file, one per line, or from stdin with -" -r
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'batch-concurrency' -d "Number of batch lines looked up at once" -x
 
 # Resolver options
-complete -c doggo -n '__fish_doggo_no_subcommand' -l 'strategy'  -d "Strategy to query nameservers" -x -a "all random first internal"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'strategy'  -d "Strategy to query nameservers" -x -a "all random first internal failover fastest"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'ndots'     -d "Specify ndots parameter"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'search'    -d "Use the search list defined in resolv.conf" -x -a "true false"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'timeout'   -d "Specify timeout (in seconds) for the resolver to return a response"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'tries'     -d "Number of times a query is sent to a nameserver that doesn't answer" -x
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'retry-timeout' -d "Timeout of the first try of a query, doubled at every retry" -x
 complete -c doggo -n '__fish_doggo_no_subcommand' -s '4' -l 'ipv4' -d "Use IPv4 only"
 complete -c doggo -n '__fish_doggo_no_subcommand' -s '6' -l 'ipv6' -d "Use IPv6 only"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'source'    -d "Source address to send the queries from" -x
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'interface' -d "Network interface to send the queries out of" -x -a "(__fish_print_interfaces)"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'proxy' -d "SOCKS5 or HTTP proxy to send the TCP, DoT and DoH queries through" -x
 
 # Query flags
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'aa' -d "Set Authoritative Answer flag"
@@ -143,6 +227,7 @@ complete -c doggo -n '__fish_doggo_no_subcommand' -l 'cd' -d "Set Checking Disab
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'rd' -d "Set Recursion Desired flag"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'z'  -d "Set Z flag (reserved for future use)"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'do' -d "Set DNSSEC OK flag"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'validate' -d "Validate the DNSSEC chain of trust"
 
 # EDNS0 options
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'nsid'    -d "Request Name Server Identifier (NSID)"
@@ -155,21 +240,53 @@ complete -c doggo -n '__fish_doggo_no_subcommand' -l 'bufsize' -d "EDNS UDP buff
 # Output options
 complete -c doggo -n '__fish_doggo_no_subcommand' -s 'J' -l 'json'  -d "Format the output as JSON"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'short'        -d "Shows only the response section in the output"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'zone-file'    -d "Print zone transfers in zone file format"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'color'        -d "Colored output" -x -a "true false"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'debug'        -d "Enable debug logging"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'time'         -d "Shows how long the response took from the server"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'tls-info'     -d "Show the TLS connection and certificates"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'config'       -d "Path to the config file" -r
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'no-config'    -d "Do not load the config file"
 
 # TLS options
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'tls-hostname'               -d "Hostname for certificate verification" -x -a "(__fish_print_hostnames)"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'skip-hostname-verification' -d "Skip TLS hostname verification in case of DoT lookups"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'tls-cert'                   -d "PEM file of the TLS client certificate" -r
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'tls-key'                    -d "PEM file of the key of the TLS client certificate" -r
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'tls-ca'                     -d "PEM bundle of the CAs to verify nameservers against" -r
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'tls-pin'                    -d "SPKI pin of the nameserver (sha256/BASE64)" -x
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'doh-http3'                  -d "Send DoH queries over HTTP/3"
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'odoh-relay'                 -d "URL or DNS stamp of the ODoH relay" -x
+complete -c doggo -n '__fish_doggo_no_subcommand' -l 'dnscrypt-tcp'               -d "Send DNSCrypt queries over TCP"
 
 # Globalping options
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'gp-from'  -d "Query using Globalping API from a specific location"
 complete -c doggo -n '__fish_doggo_no_subcommand' -l 'gp-limit' -d "Limit the number of probes to use from Globalping"
 
+# Nameserver aliases given as @name
+complete -c doggo -n '__fish_doggo_no_subcommand' -a "(__fish_doggo_nameservers @)"
+
 # Completions command
 complete -c doggo -n '__fish_doggo_no_subcommand' -a completions -d "Generate shell completion scripts"
 complete -c doggo -n '__fish_seen_subcommand_from completions' -a "bash zsh fish" -d "Shell type"
+
+# Bench command
+complete -c doggo -n '__fish_doggo_no_subcommand' -a bench -d "Benchmark nameservers"
+complete -c doggo -n '__fish_seen_subcommand_from bench' -l 'count'       -d "Number of queries to send to every nameserver" -x
+complete -c doggo -n '__fish_seen_subcommand_from bench' -l 'concurrency' -d "Number of queries in flight at once" -x
+complete -c doggo -n '__fish_seen_subcommand_from bench' -l 'qps'         -d "Cap the rate of queries per second" -x
+
+# Update command
+complete -c doggo -n '__fish_doggo_no_subcommand' -a update -d "Send an RFC 2136 dynamic update"
+complete -c doggo -n '__fish_seen_subcommand_from update' -l 'add'                     -d "Add a record" -x
+complete -c doggo -n '__fish_seen_subcommand_from update' -l 'delete'                  -d "Delete a name, an RRset or a single record" -x
+complete -c doggo -n '__fish_seen_subcommand_from update' -l 'replace'                 -d "Replace the RRset with the record" -x
+complete -c doggo -n '__fish_seen_subcommand_from update' -l 'prereq-name-in-use'      -d "Require the name to have records" -x
+complete -c doggo -n '__fish_seen_subcommand_from update' -l 'prereq-name-not-in-use'  -d "Require the name to have no records" -x
+complete -c doggo -n '__fish_seen_subcommand_from update' -l 'prereq-rrset-exists'     -d "Require the RRset to exist" -x
+complete -c doggo -n '__fish_seen_subcommand_from update' -l 'prereq-rrset-not-exists' -d "Require the RRset to not exist" -x
+complete -c doggo -n '__fish_seen_subcommand_from update' -l 'tsig'                    -d "TSIG key used to sign the update" -x
+complete -c doggo -n '__fish_seen_subcommand_from update' -l 'tsig-file'               -d "Read the TSIG key from a BIND key file" -r
 `
 )
 
@@ -187,6 +304,23 @@ func completionsCommand() {
 		fmt.Println(zshCompletion)
 	case "fish":
 		fmt.Println(fishCompletion)
+	case "nameservers":
+		// Used by the completion scripts to offer the aliases and groups of
+		// the config file. They pass the words of the command line being
+		// completed, so that its --config and --no-config are honoured. Its
+		// errors, such as the flag being completed missing its value, and
+		// the ones of the file are left to the lookup itself.
+		f := setupFlags()
+		f.Usage = func() {}
+		f.SetOutput(io.Discard)
+		f.ParseErrorsAllowlist.UnknownFlags = true
+		_ = f.Parse(os.Args[3:])
+		if loadConfigFile(f) != nil {
+			return
+		}
+		for _, name := range nameserverNames() {
+			fmt.Println(name)
+		}
 	default:
 		fmt.Printf("Unsupported shell: %s\n", shell)
 		os.Exit(1)
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf/parsers/toml"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+	"github.com/mr-karan/doggo/pkg/models"
+	flag "github.com/spf13/pflag"
+)
+
+// Options that only make sense for a single invocation and can't be set in
+// the config file.
+var configDenied = map[string]bool{
+	"query":     true,
+	"batch":     true,
+	"version":   true,
+	"config":    true,
+	"no-config": true,
+}
+
+// defaultConfigPath returns $XDG_CONFIG_HOME/doggo/config.toml, falling back
+// to ~/.config when XDG_CONFIG_HOME isn't set.
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "doggo", "config.toml")
+}
+
+// loadConfigFile loads the user's config file into k. It has to be called
+// before the flags are loaded, so that only the flags given on the command
+// line override it. The default file is optional, one given with --config
+// isn't.
+func loadConfigFile(f *flag.FlagSet) error {
+	if noConfig, _ := f.GetBool("no-config"); noConfig {
+		return nil
+	}
+	path, _ := f.GetString("config")
+	explicit := path != ""
+	if !explicit {
+		path = defaultConfigPath()
+		if path == "" {
+			return nil
+		}
+	}
+
+	fk := koanf.New(".")
+	if err := fk.Load(file.Provider(path), toml.Parser()); err != nil {
+		if !explicit && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("error reading config file %s: %w", path, err)
+	}
+	if err := validateConfig(fk, f); err != nil {
+		return fmt.Errorf("error in config file %s: %w", path, err)
+	}
+	return k.Merge(fk)
+}
+
+// validateConfig checks that every key of the config file is a flag and that
+// its value has the type of that flag. A single string is accepted for flags
+// taking a list, eg `nameserver = "1.1.1.1"`. The [aliases] and [groups]
+// tables are checked by validateNameserverNames, the [[public_resolvers]]
+// entries by validatePublicResolvers.
+func validateConfig(fk *koanf.Koanf, f *flag.FlagSet) error {
+	for _, key := range fk.Keys() {
+		if section, _, ok := strings.Cut(key, "."); ok && (section == "aliases" || section == "groups") {
+			continue
+		}
+		if key == "public_resolvers" {
+			continue
+		}
+		fl := f.Lookup(key)
+		if fl == nil {
+			return fmt.Errorf("unknown option %q", key)
+		}
+		if configDenied[key] {
+			return fmt.Errorf("%q can't be set in the config file", key)
+		}
+
+		v := fk.Get(key)
+		ok := true
+		switch fl.Value.Type() {
+		case "bool":
+			_, ok = v.(bool)
+		case "int", "uint32":
+			_, ok = v.(int64)
+		case "string":
+			_, ok = v.(string)
+		case "duration":
+			var s string
+			if s, ok = v.(string); ok {
+				_, err := time.ParseDuration(s)
+				ok = err == nil
+			}
+		case "stringSlice":
+			switch vv := v.(type) {
+			case string:
+				if err := fk.Set(key, []string{vv}); err != nil {
+					return err
+				}
+			case []any:
+				for _, s := range vv {
+					if _, ok = s.(string); !ok {
+						break
+					}
+				}
+			default:
+				ok = false
+			}
+		}
+		if !ok {
+			return fmt.Errorf("invalid value for %q: %v, want a %s", key, v, configTypeName(fl.Value.Type()))
+		}
+	}
+	if err := validateNameserverNames(fk); err != nil {
+		return err
+	}
+	return validatePublicResolvers(fk)
+}
+
+// validateNameserverNames checks the [aliases] table, which maps a name to a
+// nameserver, and the [groups] table, which maps a name to a list of
+// nameservers or aliases.
+func validateNameserverNames(fk *koanf.Koanf) error {
+	for _, key := range fk.Keys() {
+		section, name, ok := strings.Cut(key, ".")
+		if !ok || (section != "aliases" && section != "groups") {
+			continue
+		}
+		if strings.Contains(name, ".") {
+			return fmt.Errorf("invalid %s name %q: names can't contain dots", strings.TrimSuffix(section, "s"), name)
+		}
+		v := fk.Get(key)
+		if section == "aliases" {
+			if _, ok := v.(string); !ok {
+				return fmt.Errorf("invalid value for alias %q: %v, want a nameserver", name, v)
+			}
+			if fk.Exists("groups." + name) {
+				return fmt.Errorf("%q is both an alias and a group", name)
+			}
+			continue
+		}
+
+		if s, ok := v.(string); ok {
+			if err := fk.Set(key, []string{s}); err != nil {
+				return err
+			}
+			v = []any{s}
+		}
+		members, ok := v.([]any)
+		if !ok || len(members) == 0 {
+			return fmt.Errorf("invalid value for group %q: %v, want a list of nameservers", name, v)
+		}
+		for _, m := range members {
+			s, ok := m.(string)
+			if !ok {
+				return fmt.Errorf("invalid value for group %q: %v, want a list of nameservers", name, v)
+			}
+			if fk.Exists("groups." + s) {
+				return fmt.Errorf("group %q can't include the group %q", name, s)
+			}
+		}
+	}
+	return nil
+}
+
+// publicResolverProtocols are the protocols a [[public_resolvers]] entry can
+// be queried over, as shown in the PROTOCOL column of --propagation.
+var publicResolverProtocols = []string{
+	models.UDPResolver, models.TCPResolver, models.DOTResolver,
+	models.DOHResolver, models.DOQResolver,
+}
+
+// validatePublicResolvers checks the [[public_resolvers]] entries, which add
+// resolvers to the catalogue of --propagation. Each has the fields of the
+// built-in entries: an operator, a region, a protocol and an address.
+func validatePublicResolvers(fk *koanf.Koanf) error {
+	if !fk.Exists("public_resolvers") {
+		return nil
+	}
+	entries, ok := fk.Get("public_resolvers").([]any)
+	if !ok {
+		return errors.New(`invalid value for "public_resolvers": want a list of [[public_resolvers]] tables`)
+	}
+	for i, e := range entries {
+		entry, ok := e.(map[string]any)
+		if !ok {
+			return fmt.Errorf("invalid public resolver #%d: %v, want a table", i+1, e)
+		}
+		for key, v := range entry {
+			switch key {
+			case "operator", "region", "protocol", "address":
+			default:
+				return fmt.Errorf("invalid public resolver #%d: unknown field %q", i+1, key)
+			}
+			if s, ok := v.(string); !ok || s == "" {
+				return fmt.Errorf("invalid public resolver #%d: %v isn't a valid %s", i+1, v, key)
+			}
+		}
+		for _, key := range []string{"operator", "region", "protocol", "address"} {
+			if _, ok := entry[key]; !ok {
+				return fmt.Errorf("invalid public resolver #%d: missing %s", i+1, key)
+			}
+		}
+		if protocol := entry["protocol"].(string); !slices.Contains(publicResolverProtocols, protocol) {
+			return fmt.Errorf("invalid public resolver #%d: unsupported protocol %q, want one of %s", i+1, protocol, strings.Join(publicResolverProtocols, ", "))
+		}
+	}
+	return nil
+}
+
+// publicResolvers returns the catalogue of --propagation and its version: the
+// built-in list followed by the [[public_resolvers]] of the config file that
+// aren't already in it. The version is suffixed with "+config" when the file
+// added any.
+func publicResolvers() ([]models.PublicResolver, string) {
+	catalogue := slices.Clone(models.PublicResolvers)
+	added := false
+	for _, e := range k.Slices("public_resolvers") {
+		pr := models.PublicResolver{
+			Operator: e.String("operator"),
+			Region:   e.String("region"),
+			Nameserver: models.Nameserver{
+				Type:    e.String("protocol"),
+				Address: e.String("address"),
+			},
+		}
+		if slices.ContainsFunc(catalogue, func(c models.PublicResolver) bool { return c.Type == pr.Type && c.Address == pr.Address }) {
+			continue
+		}
+		catalogue = append(catalogue, pr)
+		added = true
+	}
+	if added {
+		return catalogue, models.PublicResolversVersion + "+config"
+	}
+	return catalogue, models.PublicResolversVersion
+}
+
+// nameserverNames returns the names of the aliases and groups defined in the
+// config file, sorted.
+func nameserverNames() []string {
+	var names []string
+	for name := range k.StringMap("aliases") {
+		names = append(names, name)
+	}
+	for name := range k.StringsMap("groups") {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func configTypeName(typ string) string {
+	switch typ {
+	case "bool":
+		return "boolean"
+	case "int", "uint32":
+		return "number"
+	case "duration":
+		return `duration (eg "5s")`
+	case "stringSlice":
+		return "list of strings"
+	}
+	return typ
+}
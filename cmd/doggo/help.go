@@ -97,39 +97,73 @@ func renderCustomHelp() {
 			{"mrkaran.dev CNAME", "Query for a CNAME record."},
 			{"mrkaran.dev MX @9.9.9.9", "Uses a custom DNS resolver."},
 			{"-q mrkaran.dev -t MX -n 1.1.1.1", "Using named arguments."},
+			{"mrkaran.dev @cf", "Uses a nameserver alias (or group) from the config file."},
 			{"mrkaran.dev --aa --ad", "Query with Authoritative Answer and Authenticated Data flags set."},
 			{"mrkaran.dev --cd --do", "Query with Checking Disabled and DNSSEC OK flags set."},
+			{"mrkaran.dev --trace", "Follow the delegation chain from the root servers."},
+			{"mrkaran.dev --propagation", "Check which answer public resolvers around the world return."},
+			{"mrkaran.dev --watch-until 192.0.2.1 --watch-deadline 10m", "Wait for a DNS change to show up."},
+			{"--batch domains.txt --json", "Look up every line of a file and print NDJSON."},
+			{"AXFR example.com @tcp://ns1.example.com --zone-file", "Transfer a zone and print it as a zone file."},
 			{"mrkaran.dev --gp-from Germany", "Query using Globalping API from a specific location."},
 		},
 		"TransportOptions": []TransportOption{
 			{"@udp://", "eg: @1.1.1.1", "initiates a UDP query to 1.1.1.1:53."},
 			{"@tcp://", "eg: @tcp://1.1.1.1", "initiates a TCP query to 1.1.1.1:53."},
 			{"@https://", "eg: @https://cloudflare-dns.com/dns-query", "initiates a DOH query to Cloudflare via DoH."},
+			{"@h3://", "eg: @h3://cloudflare-dns.com/dns-query", "initiates a DOH query over HTTP/3."},
+			{"@https+json://", "eg: @https+json://dns.google/resolve", "initiates a query using the DoH JSON API."},
+			{"@odoh://", "eg: @odoh://odoh.cloudflare-dns.com/dns-query", "initiates an Oblivious DoH query, through --odoh-relay."},
 			{"@tls://", "eg: @tls://1.1.1.1", "initiates a DoT query to 1.1.1.1:853."},
-			{"@sdns://", "initiates a DNSCrypt or DoH query using a DNS stamp.", ""},
+			{"@sdns://", "initiates a DNSCrypt, DoH or ODoH query using a DNS stamp.", ""},
 			{"@quic://", "initiates a DOQ query.", ""},
 		},
 		"Subcommands": []Option{
 			{"completions [bash|zsh|fish]", "Generate the shell completion script for the specified shell."},
+			{"update ZONE @NAMESERVER", "Send an RFC 2136 dynamic update. See doggo update --help."},
+			{"bench NAME @NAMESERVER...", "Benchmark nameservers and report latency percentiles. See doggo bench --help."},
 		},
 		"QueryOptions": []Option{
 			{"-q, --query=HOSTNAME", "Hostname to query the DNS records for (eg mrkaran.dev)."},
 			{"-t, --type=TYPE", "Type of the DNS Record (A, MX, NS etc)."},
 			{"-n, --nameserver=ADDR", "Address of a specific nameserver to send queries to (9.9.9.9, 8.8.8.8 etc)."},
+			{"--route='DOMAIN -> @NS'", "Send the questions for DOMAIN and the names under it to their own nameservers (split DNS), eg '*.corp.example -> @10.0.0.53'. Usually set in the config file."},
 			{"-c, --class=CLASS", "Network class of the DNS record (IN, CH, HS etc)."},
 			{"-x, --reverse", "Performs a DNS Lookup for an IPv4 or IPv6 address. Sets the query type and class to PTR and IN respectively."},
 			{"--any", "Query all supported DNS record types (A, AAAA, CNAME, MX, NS, PTR, SOA, SRV, TXT, CAA)."},
 			{"-A, --authoritative", "Find the domain's zone via SOA and query its delegated authoritative nameservers (the NS RRset). Honours --strategy to narrow the set."},
+			{"--trace", "Resolve iteratively from the root servers and show every referral, like dig +trace."},
+			{"--propagation", "Query a built-in catalogue of public resolvers (Cloudflare, Google, Quad9 and others) and show which answer most of them return."},
+			{"--ixfr-serial=SERIAL", "Request an incremental zone transfer (IXFR) of changes since the given SOA serial. Use AXFR as the query type for a full transfer."},
+			{"--tsig=NAME:ALG:SECRET", "TSIG key used to sign queries and zone transfers (eg xfr-key:hmac-sha256:c2VjcmV0). The algorithm defaults to hmac-sha256 if omitted. UDP, TCP and DoT only."},
+			{"--tsig-file=PATH", "Read the TSIG key from a BIND key file, as written by tsig-keygen."},
+			{"--watch=DURATION", "Repeat the lookup at the given interval (eg 10s), highlighting added, removed and changed answers and counting TTLs down."},
+			{"--watch-until=VALUE", "Keep watching until an answer has this value, then exit. Implies --watch=10s if not set."},
+			{"--watch-deadline=DURATION", "Stop watching after this long. Exits with 9 if the --watch-until value hasn't shown up by then."},
+			{"--batch=FILE", "Read queries from a file (or stdin with -), one per line in the same syntax as the arguments (eg example.com MX @1.1.1.1)."},
+			{"--batch-concurrency=INT", "Number of batch lines looked up at once (default 10)."},
 		},
 		"ResolverOptions": []Option{
-			{"--strategy=STRATEGY", "Specify strategy to query nameservers. Options: all, random, first, internal (RFC 1918/ULA private IPs only)."},
+			{"--strategy=STRATEGY", "Specify strategy to query nameservers. Options: all, random, first, internal (RFC 1918/ULA private IPs only), failover (next nameserver on timeout or SERVFAIL), fastest (first good answer wins)."},
 			{"--ndots=INT", "Specify ndots parameter. Takes value from /etc/resolv.conf if using the system namesever or 1 otherwise."},
 			{"--search", "Use the search list defined in resolv.conf. Defaults to true. Set --search=false to disable search list."},
 			{"--timeout=DURATION", "Specify timeout for the resolver to return a response (e.g., 5s, 400ms, 1m)."},
+			{"--tries=INT", "Send a query up to this many times to a nameserver that doesn't answer. Takes the attempts option from /etc/resolv.conf if using the system nameserver or 1 otherwise."},
+			{"--retry-timeout=DURATION", "Timeout of the first try, doubled at every retry up to --timeout. Takes the timeout option from /etc/resolv.conf if using the system nameserver or --timeout otherwise."},
 			{"-4, --ipv4", "Use IPv4 only."},
 			{"-6, --ipv6", "Use IPv6 only."},
+			{"--source=IP[:PORT]", "Send the queries from this address, for every transport."},
+			{"--interface=NAME", "Send the queries out of this network interface, eg on a VPN or multi-homed host (Linux and macOS)."},
+			{"--proxy=URL", "Send the TCP, DoT and DoH queries through a socks5://, socks5h:// or http:// proxy. HTTPS_PROXY is used otherwise."},
 			{"--tls-hostname=HOSTNAME", "Provide a hostname for verification of the certificate if the provided DoT nameserver is an IP."},
 			{"--skip-hostname-verification", "Skip TLS Hostname Verification in case of DOT Lookups."},
+			{"--tls-cert=FILE", "PEM file of the client certificate sent to DoT, DoH and DoQ nameservers asking for one. Per nameserver with ?tls-cert=FILE."},
+			{"--tls-key=FILE", "PEM file of the key of the client certificate, if it's not in the --tls-cert file. Per nameserver with ?tls-key=FILE."},
+			{"--tls-ca=FILE", "PEM bundle of the CAs the certificates of DoT, DoH and DoQ nameservers are verified against, instead of the system ones. Per nameserver with ?tls-ca=FILE."},
+			{"--tls-pin=sha256/BASE64", "Pin the public key of DoT, DoH and DoQ nameservers instead of verifying their certificate and hostname (RFC 7858). Repeatable. Per nameserver with ?tls-pin=PIN."},
+			{"--odoh-relay=RELAY", "URL or DNS stamp of the relay to send Oblivious DoH queries through."},
+			{"--dnscrypt-tcp", "Send DNSCrypt queries over TCP instead of UDP."},
+			{"--doh-http3", "Send DoH queries over HTTP/3. Without it, HTTP/3 is only used once the server advertises it with Alt-Svc."},
 		},
 		"QueryFlags": []Option{
 			{"--aa", "Set Authoritative Answer flag."},
@@ -138,6 +172,7 @@ func renderCustomHelp() {
 			{"--rd", "Set Recursion Desired flag (default: true)."},
 			{"--z", "Set Z flag (reserved for future use)."},
 			{"--do", "Set DNSSEC OK flag."},
+			{"--validate", "Validate the DNSSEC chain of trust from the root and report a secure/insecure/bogus/indeterminate verdict."},
 		},
 		"EdnsOptions": []Option{
 			{"--nsid", "Request Name Server Identifier (NSID) to identify the nameserver."},
@@ -150,9 +185,13 @@ func renderCustomHelp() {
 		"OutputOptions": []Option{
 			{"-J, --json", "Format the output as JSON."},
 			{"--short", "Short output format. Shows only the response section."},
+			{"--zone-file", "Print zone transfers in RFC 1035 zone file format as the records arrive."},
 			{"--color", "Defaults to true. Set --color=false to disable colored output."},
 			{"--debug", "Enable debug logging."},
 			{"--time", "Shows how long the response took from the server."},
+			{"--tls-info", "Show the TLS version, cipher suite, ALPN, resumption and certificate chain of DoT, DoH and DoQ nameservers."},
+			{"--config=PATH", "Load defaults from this config file instead of $XDG_CONFIG_HOME/doggo/config.toml."},
+			{"--no-config", "Don't load any config file, eg to make a script's output reproducible."},
 		},
 		"GlobalPingOptions": []Option{
 			{"--gp-from=Germany", "Query using Globalping API from a specific location."},
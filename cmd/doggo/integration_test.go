@@ -1,6 +1,7 @@
 package main_test
 
 import (
+	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -82,12 +83,19 @@ func startDNSServer(t *testing.T, domain, answer string) (string, func()) {
 		}
 		_ = w.WriteMsg(m)
 	})
+	return startDNSHandler(t, mux)
+}
 
+// startDNSHandler serves handler over UDP on 127.0.0.1 on a random port.
+// Returns the address as "host:port" and a shutdown function the test must
+// call.
+func startDNSHandler(t *testing.T, handler dns.Handler) (string, func()) {
+	t.Helper()
 	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1"), Port: 0})
 	if err != nil {
 		t.Fatalf("ListenUDP: %v", err)
 	}
-	srv := &dns.Server{PacketConn: conn, Handler: mux}
+	srv := &dns.Server{PacketConn: conn, Handler: handler}
 	ready := make(chan struct{})
 	srv.NotifyStartedFunc = func() { close(ready) }
 
@@ -121,11 +129,32 @@ func reservedClosedPort(t *testing.T) int {
 	return port
 }
 
+// startServfailServer answers SERVFAIL to every query.
+func startServfailServer(t *testing.T) string {
+	t.Helper()
+	addr, stop := startDNSHandler(t, dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeServerFailure)
+		_ = w.WriteMsg(m)
+	}))
+	t.Cleanup(stop)
+	return addr
+}
+
 func runDoggo(t *testing.T, args ...string) (stdout, stderr string, exit int) {
+	t.Helper()
+	return runDoggoWithEnv(t, nil, args...)
+}
+
+// runDoggoWithEnv runs doggo with env added to the environment. The config
+// directory points to an empty one unless env sets it, so the user's own
+// config file never gets in the way.
+func runDoggoWithEnv(t *testing.T, env []string, args ...string) (stdout, stderr string, exit int) {
 	t.Helper()
 	bin := doggoBin(t)
 	cmd := exec.Command(bin, args...)
-	cmd.Env = append(os.Environ(), "NO_COLOR=1")
+	cmd.Env = append(os.Environ(), "NO_COLOR=1", "XDG_CONFIG_HOME="+t.TempDir())
+	cmd.Env = append(cmd.Env, env...)
 	var outBuf, errBuf strings.Builder
 	cmd.Stdout = &outBuf
 	cmd.Stderr = &errBuf
@@ -326,3 +355,440 @@ func TestDebugLogsStrategyApplication(t *testing.T) {
 		t.Fatalf("missing dropped_count=1 indicating @deadAddr was filtered\nstderr:\n%s", stderr)
 	}
 }
+
+// startTransferServer starts a TCP DNS test server that answers AXFR queries
+// with the given zone records, wrapped in the zone's SOA.
+func startTransferServer(t *testing.T, soa string, records ...string) string {
+	t.Helper()
+	var rrs []dns.RR
+	for _, s := range append([]string{soa}, append(records, soa)...) {
+		rr, err := dns.NewRR(s)
+		if err != nil {
+			t.Fatalf("dns.NewRR(%q): %v", s, err)
+		}
+		rrs = append(rrs, rr)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	srv := &dns.Server{Listener: ln, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		ch := make(chan *dns.Envelope, 1)
+		ch <- &dns.Envelope{RR: rrs}
+		close(ch)
+		_ = new(dns.Transfer).Out(w, req, ch)
+	})}
+	ready := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(ready) }
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	select {
+	case <-ready:
+	case <-time.After(2 * time.Second):
+		t.Fatal("DNS test server did not start within 2s")
+	}
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return ln.Addr().String()
+}
+
+func TestZoneTransferZoneFileOutput(t *testing.T) {
+	addr := startTransferServer(t,
+		"example.test. 3600 IN SOA ns.example.test. admin.example.test. 7 1800 900 604800 3600",
+		"www.example.test. 300 IN A 192.0.2.1",
+	)
+
+	stdout, stderr, exit := runDoggo(t, "AXFR", "example.test", "@tcp://"+addr, "--zone-file")
+	if exit != 0 {
+		t.Fatalf("exit = %d, want 0\nstderr: %s", exit, stderr)
+	}
+	for _, want := range []string{"; AXFR example.test. from " + addr, "www.example.test.\t300\tIN\tA\t192.0.2.1", "; serial 7, 3 records in 1 messages"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout missing %q:\n%s", want, stdout)
+		}
+	}
+
+	// A UDP nameserver is upgraded to TCP for the transfer.
+	stdout, stderr, exit = runDoggo(t, "AXFR", "example.test", "@"+addr, "--json")
+	if exit != 0 {
+		t.Fatalf("exit = %d, want 0\nstderr: %s", exit, stderr)
+	}
+	var out struct {
+		Transfers []struct {
+			Serial  uint32 `json:"serial"`
+			Records []struct {
+				Address string `json:"address"`
+			} `json:"records"`
+		} `json:"transfers"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+	}
+	if len(out.Transfers) != 1 || out.Transfers[0].Serial != 7 || len(out.Transfers[0].Records) != 3 {
+		t.Fatalf("transfers = %+v, want one transfer of 3 records at serial 7", out.Transfers)
+	}
+}
+
+func TestZoneTransferRejectsMixedQueryTypes(t *testing.T) {
+	_, stderr, exit := runDoggo(t, "AXFR", "A", "example.test", "@127.0.0.1")
+	if exit != 2 {
+		t.Fatalf("exit = %d, want 2\nstderr: %s", exit, stderr)
+	}
+	if !strings.Contains(stderr, "can't be combined") {
+		t.Errorf("stderr = %q, want mixed query type error", stderr)
+	}
+}
+
+func writeBatchFile(t *testing.T, lines ...string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "batch.txt")
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestBatchPrintsInOrderAndExitsTwoOnPartialFailure(t *testing.T) {
+	serverAddr, stop := startDNSServer(t, "batch.test", "192.0.2.30")
+	defer stop()
+	deadAddr := fmt.Sprintf("127.0.0.1:%d", reservedClosedPort(t))
+
+	batch := writeBatchFile(t,
+		"# resolved by the nameserver of the command line",
+		"batch.test",
+		"",
+		"batch.test A @"+deadAddr,
+		"batch.test A IN",
+	)
+	stdout, stderr, exit := runDoggo(t, "--timeout=1s", "--batch", batch, "@"+serverAddr)
+	if exit != 2 {
+		t.Fatalf("exit = %d, want 2\nstdout:\n%s\nstderr:\n%s", exit, stdout, stderr)
+	}
+	first := strings.Index(stdout, "; line 2: batch.test")
+	last := strings.Index(stdout, "; line 5: batch.test A IN")
+	if first < 0 || last < 0 || first > last {
+		t.Fatalf("stdout doesn't list lines 2 and 5 in order:\n%s", stdout)
+	}
+	if strings.Contains(stdout, "; line 4") {
+		t.Errorf("stdout includes the failed line:\n%s", stdout)
+	}
+	if !strings.Contains(stderr, deadAddr) {
+		t.Errorf("stderr missing dead nameserver identity\nstderr:\n%s", stderr)
+	}
+	if !strings.Contains(stderr, "Batch: 3 queries, 2 succeeded, 0 partially failed, 1 failed") {
+		t.Errorf("stderr missing summary\nstderr:\n%s", stderr)
+	}
+}
+
+func TestBatchJSONEmitsOneLinePerQuery(t *testing.T) {
+	serverAddr, stop := startDNSServer(t, "batch.test", "192.0.2.31")
+	defer stop()
+
+	batch := writeBatchFile(t, "batch.test A", "batch.test A IN")
+	stdout, stderr, exit := runDoggo(t, "--timeout=1s", "--batch", batch, "--json", "@"+serverAddr)
+	if exit != 0 {
+		t.Fatalf("exit = %d, want 0\nstderr:\n%s", exit, stderr)
+	}
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("got %d lines of output, want 3:\n%s", len(lines), stdout)
+	}
+	seen := map[int]bool{}
+	for _, line := range lines[:2] {
+		var res struct {
+			Line      int `json:"line"`
+			Responses []struct {
+				Answers []struct {
+					Address string `json:"address"`
+				} `json:"answers"`
+			} `json:"responses"`
+		}
+		if err := json.Unmarshal([]byte(line), &res); err != nil {
+			t.Fatalf("invalid JSON: %v\n%s", err, line)
+		}
+		if len(res.Responses) != 1 || len(res.Responses[0].Answers) != 1 || res.Responses[0].Answers[0].Address != "192.0.2.31" {
+			t.Errorf("line %d: responses = %+v, want the answer of the server", res.Line, res.Responses)
+		}
+		seen[res.Line] = true
+	}
+	if !seen[1] || !seen[2] {
+		t.Errorf("lines = %v, want 1 and 2", seen)
+	}
+	var summary struct {
+		Summary struct {
+			Queries   int `json:"queries"`
+			Succeeded int `json:"succeeded"`
+		} `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(lines[2]), &summary); err != nil {
+		t.Fatalf("invalid JSON: %v\n%s", err, lines[2])
+	}
+	if summary.Summary.Queries != 2 || summary.Summary.Succeeded != 2 {
+		t.Errorf("summary = %+v, want 2 succeeded queries", summary.Summary)
+	}
+}
+
+func TestBatchFullFailureExitsNine(t *testing.T) {
+	deadAddr := fmt.Sprintf("127.0.0.1:%d", reservedClosedPort(t))
+
+	batch := writeBatchFile(t, "batch.test", "MX")
+	stdout, stderr, exit := runDoggo(t, "--timeout=1s", "--batch", batch, "@"+deadAddr)
+	if exit != 9 {
+		t.Fatalf("exit = %d, want 9\nstdout:\n%s\nstderr:\n%s", exit, stdout, stderr)
+	}
+	if !strings.Contains(stderr, "no name to query") {
+		t.Errorf("stderr missing the error of the line without a name\nstderr:\n%s", stderr)
+	}
+}
+
+func writeConfigFile(t *testing.T, dir, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, "doggo", "config.toml")
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatalf("MkdirAll: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	return path
+}
+
+func TestConfigFileSetsDefaults(t *testing.T) {
+	serverAddr, stop := startDNSServer(t, "config.test", "192.0.2.40")
+	defer stop()
+
+	dir := t.TempDir()
+	writeConfigFile(t, dir, fmt.Sprintf("nameserver = %q\ntype = [\"A\"]\nshort = true\ntimeout = \"2s\"\n", serverAddr))
+	env := []string{"XDG_CONFIG_HOME=" + dir}
+
+	stdout, stderr, exit := runDoggoWithEnv(t, env, "config.test")
+	if exit != 0 {
+		t.Fatalf("exit = %d, want 0\nstderr:\n%s", exit, stderr)
+	}
+	if strings.TrimSpace(stdout) != "192.0.2.40" {
+		t.Errorf("stdout = %q, want the short answer from the configured nameserver", stdout)
+	}
+
+	// Flags on the command line win over the config file.
+	stdout, stderr, exit = runDoggoWithEnv(t, env, "config.test", "--short=false")
+	if exit != 0 {
+		t.Fatalf("exit = %d, want 0\nstderr:\n%s", exit, stderr)
+	}
+	if !strings.Contains(stdout, "NAMESERVER") {
+		t.Errorf("stdout = %q, want the table output", stdout)
+	}
+
+	// So do nameservers given as arguments.
+	deadAddr := fmt.Sprintf("127.0.0.1:%d", reservedClosedPort(t))
+	_, stderr, exit = runDoggoWithEnv(t, env, "config.test", "@"+deadAddr)
+	if exit != 9 || !strings.Contains(stderr, deadAddr) {
+		t.Errorf("exit = %d, want 9 from the nameserver of the arguments\nstderr:\n%s", exit, stderr)
+	}
+
+	// --no-config ignores the file, --config points to another one.
+	stdout, stderr, exit = runDoggoWithEnv(t, env, "config.test", "A", "@"+serverAddr, "--no-config")
+	if exit != 0 || !strings.Contains(stdout, "NAMESERVER") {
+		t.Errorf("exit = %d, stdout = %q, want the table output without the config file\nstderr:\n%s", exit, stdout, stderr)
+	}
+	other := writeConfigFile(t, t.TempDir(), fmt.Sprintf("nameserver = [%q]\njson = true\n", serverAddr))
+	stdout, stderr, exit = runDoggoWithEnv(t, env, "config.test", "A", "--config", other)
+	if exit != 0 || !strings.HasPrefix(strings.TrimSpace(stdout), "{") {
+		t.Errorf("exit = %d, stdout = %q, want JSON output from --config\nstderr:\n%s", exit, stdout, stderr)
+	}
+}
+
+func TestConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown option", "nameservers = [\"1.1.1.1\"]\n", `unknown option "nameservers"`},
+		{"wrong type", "timeout = 5\n", `invalid value for "timeout"`},
+		{"denied option", "query = [\"example.com\"]\n", `"query" can't be set`},
+		{"invalid TOML", "short = \n", "error reading config file"},
+		{"alias and group", "[aliases]\nns = \"1.1.1.1\"\n[groups]\nns = [\"8.8.8.8\"]\n", `"ns" is both an alias and a group`},
+		{"nested group", "[groups]\na = [\"1.1.1.1\"]\nb = [\"a\"]\n", `group "b" can't include the group "a"`},
+		{"public resolver protocol", "[[public_resolvers]]\noperator = \"Lab\"\nregion = \"Europe\"\nprotocol = \"http\"\naddress = \"192.0.2.1:53\"\n", `unsupported protocol "http"`},
+		{"public resolver field", "[[public_resolvers]]\noperator = \"Lab\"\nregion = \"Europe\"\nprotocol = \"udp\"\n", "public resolver #1: missing address"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, t.TempDir(), tt.content)
+			stdout, _, exit := runDoggo(t, "example.test", "--config", path)
+			if exit != 1 || !strings.Contains(stdout, tt.want) {
+				t.Errorf("exit = %d, stdout = %q, want exit 1 and %q", exit, stdout, tt.want)
+			}
+		})
+	}
+
+	stdout, _, exit := runDoggo(t, "example.test", "--config", filepath.Join(t.TempDir(), "missing.toml"))
+	if exit != 1 || !strings.Contains(stdout, "missing.toml") {
+		t.Errorf("exit = %d, stdout = %q, want a missing --config file to fail", exit, stdout)
+	}
+}
+
+func TestConfigNameserverAliases(t *testing.T) {
+	serverAddr, stop := startDNSServer(t, "alias.test", "192.0.2.50")
+	defer stop()
+	deadAddr := fmt.Sprintf("127.0.0.1:%d", reservedClosedPort(t))
+
+	dir := t.TempDir()
+	writeConfigFile(t, dir, fmt.Sprintf("[aliases]\nlocal = %q\ndead = %q\n\n[groups]\nboth = [\"local\", \"dead\"]\n", serverAddr, deadAddr))
+	env := []string{"XDG_CONFIG_HOME=" + dir}
+
+	stdout, stderr, exit := runDoggoWithEnv(t, env, "alias.test", "A", "@local", "--short", "--timeout=1s")
+	if exit != 0 || strings.TrimSpace(stdout) != "192.0.2.50" {
+		t.Errorf("exit = %d, stdout = %q, want the answer of the aliased nameserver\nstderr:\n%s", exit, stdout, stderr)
+	}
+
+	// A group expands to all of its nameservers.
+	stdout, stderr, exit = runDoggoWithEnv(t, env, "alias.test", "A", "@both", "--timeout=1s")
+	if exit != 2 || !strings.Contains(stdout, "192.0.2.50") || !strings.Contains(stderr, deadAddr) {
+		t.Errorf("exit = %d, want a partial failure across the group\nstdout:\n%s\nstderr:\n%s", exit, stdout, stderr)
+	}
+
+	stdout, _, _ = runDoggoWithEnv(t, env, "completions", "nameservers")
+	if stdout != "both\ndead\nlocal\n" {
+		t.Errorf("completions nameservers = %q, want the sorted names", stdout)
+	}
+
+	// The words of the command line being completed are passed along, the
+	// last one being the flag whose value is completed.
+	other := writeConfigFile(t, t.TempDir(), "[aliases]\nother = \"192.0.2.1\"\n")
+	stdout, _, _ = runDoggoWithEnv(t, env, "completions", "nameservers", "doggo", "--config", other, "alias.test", "-n")
+	if stdout != "other\n" {
+		t.Errorf("completions nameservers with --config = %q, want the names of that file", stdout)
+	}
+	stdout, _, _ = runDoggoWithEnv(t, env, "completions", "nameservers", "doggo", "--no-config", "--unknown", "-n")
+	if stdout != "" {
+		t.Errorf("completions nameservers with --no-config = %q, want none", stdout)
+	}
+}
+
+func TestConfigPublicResolvers(t *testing.T) {
+	serverAddr, stop := startDNSServer(t, "propagation.test", "192.0.2.55")
+	defer stop()
+
+	dir := t.TempDir()
+	writeConfigFile(t, dir, fmt.Sprintf("[[public_resolvers]]\noperator = \"Lab\"\nregion = \"Europe\"\nprotocol = \"udp\"\naddress = %q\n", serverAddr))
+	env := []string{"XDG_CONFIG_HOME=" + dir}
+
+	// The built-in resolvers are queried as well, and may not be reachable.
+	stdout, stderr, _ := runDoggoWithEnv(t, env, "propagation.test", "A", "--propagation", "--json", "--timeout=500ms")
+	var out struct {
+		Propagation []struct {
+			Catalogue string `json:"catalogue"`
+			Total     int    `json:"total"`
+			Results   []struct {
+				Operator   string `json:"operator"`
+				Region     string `json:"region"`
+				Protocol   string `json:"protocol"`
+				Nameserver string `json:"nameserver"`
+				Answer     string `json:"answer"`
+			} `json:"results"`
+		} `json:"propagation"`
+	}
+	if err := json.Unmarshal([]byte(stdout), &out); err != nil || len(out.Propagation) != 1 {
+		t.Fatalf("unable to parse the propagation output: %v\nstdout:\n%s\nstderr:\n%s", err, stdout, stderr)
+	}
+	p := out.Propagation[0]
+	if !strings.HasSuffix(p.Catalogue, "+config") {
+		t.Errorf("catalogue = %q, want the version to show the config file added resolvers", p.Catalogue)
+	}
+	last := p.Results[len(p.Results)-1]
+	if p.Total != len(p.Results) || last.Operator != "Lab" || last.Region != "Europe" || last.Protocol != "udp" || last.Nameserver != serverAddr || last.Answer != "192.0.2.55" {
+		t.Errorf("last result = %+v of %d, want the resolver of the config file after the built-in ones", last, p.Total)
+	}
+}
+
+func TestSplitDNSRoutes(t *testing.T) {
+	corpAddr, stopCorp := startDNSServer(t, "www.corp.test", "192.0.2.60")
+	defer stopCorp()
+	publicAddr, stopPublic := startDNSServer(t, "public.test", "192.0.2.61")
+	defer stopPublic()
+
+	dir := t.TempDir()
+	writeConfigFile(t, dir, fmt.Sprintf("nameserver = [%q]\nroute = [\"*.corp.test -> @%s\"]\n", publicAddr, corpAddr))
+	env := []string{"XDG_CONFIG_HOME=" + dir}
+
+	stdout, stderr, exit := runDoggoWithEnv(t, env, "www.corp.test", "public.test", "A", "--short", "--timeout=1s", "--debug")
+	if exit != 0 {
+		t.Fatalf("exit = %d, want 0\nstderr:\n%s", exit, stderr)
+	}
+	for _, want := range []string{"192.0.2.60", "192.0.2.61"} {
+		if !strings.Contains(stdout, want) {
+			t.Errorf("stdout missing %s, want each name answered by its own nameserver:\n%s", want, stdout)
+		}
+	}
+	if !strings.Contains(stderr, `msg="Question matched route" name=www.corp.test`) {
+		t.Errorf("debug log doesn't show the matched route\nstderr:\n%s", stderr)
+	}
+
+	// Nameservers on the command line bypass the routes.
+	stdout, _, _ = runDoggoWithEnv(t, env, "www.corp.test", "A", "--short", "--timeout=1s", "@"+publicAddr)
+	if strings.Contains(stdout, "192.0.2.60") {
+		t.Errorf("stdout = %q, want the route to be bypassed", stdout)
+	}
+}
+
+func TestFailoverAndFastestStrategies(t *testing.T) {
+	goodAddr, stopGood := startDNSServer(t, "failover.test", "192.0.2.70")
+	defer stopGood()
+	servfailAddr := startServfailServer(t)
+	closed := fmt.Sprintf("127.0.0.1:%d", reservedClosedPort(t))
+
+	for _, strategy := range []string{"failover", "fastest"} {
+		t.Run(strategy, func(t *testing.T) {
+			stdout, stderr, exit := runDoggo(t, "failover.test", "A", "--json", "--timeout=1s", "--strategy="+strategy,
+				"@"+closed, "@"+servfailAddr, "@"+goodAddr)
+			if exit != 0 {
+				t.Fatalf("exit = %d, want 0\nstderr:\n%s", exit, stderr)
+			}
+			var out struct {
+				Responses []struct {
+					Status     string `json:"status"`
+					Nameserver string `json:"nameserver"`
+				} `json:"responses"`
+			}
+			if err := json.Unmarshal([]byte(stdout), &out); err != nil {
+				t.Fatalf("invalid JSON: %v\n%s", err, stdout)
+			}
+			if len(out.Responses) != 1 {
+				t.Fatalf("got %d responses, want a single one:\n%s", len(out.Responses), stdout)
+			}
+			if rsp := out.Responses[0]; rsp.Nameserver != goodAddr || rsp.Status != "NOERROR" {
+				t.Errorf("answered by %s with %s, want %s with NOERROR", rsp.Nameserver, rsp.Status, goodAddr)
+			}
+		})
+	}
+}
+
+func TestWatchUntilInterruptedExits130(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no SIGINT on windows")
+	}
+	serverAddr, stop := startDNSServer(t, "watch.test", "192.0.2.80")
+	defer stop()
+
+	cmd := exec.Command(doggoBin(t), "watch.test", "A", "@"+serverAddr, "--short", "--watch=100ms", "--watch-until=192.0.2.99")
+	cmd.Env = append(os.Environ(), "NO_COLOR=1", "XDG_CONFIG_HOME="+t.TempDir())
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// Interrupt once the first round is printed.
+	if line, err := bufio.NewReader(stdout).ReadString('\n'); err != nil || line != "192.0.2.80\n" {
+		t.Fatalf("first round = %q, %v, want 192.0.2.80", line, err)
+	}
+	_ = cmd.Process.Signal(os.Interrupt)
+
+	var ee *exec.ExitError
+	if err := cmd.Wait(); !errors.As(err, &ee) || ee.ExitCode() != 130 {
+		t.Errorf("exit = %v, want 130", err)
+	}
+}
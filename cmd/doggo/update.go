@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/internal/app"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+	"github.com/mr-karan/doggo/pkg/utils"
+	flag "github.com/spf13/pflag"
+)
+
+const updateUsage = `Usage: doggo update ZONE @NAMESERVER [options]
+
+Send an RFC 2136 dynamic update to the primary nameserver of ZONE. Names may
+be relative to ZONE. Deletions are applied first, then replacements, then
+additions.
+
+Examples:
+  doggo update example.com @ns1.example.com --add "www 300 IN A 192.0.2.1"
+  doggo update example.com @tcp://ns1.example.com --replace "www 300 A 192.0.2.2" --tsig-file ddns.key
+  doggo update example.com @ns1.example.com --delete "old" --delete "www TXT"
+  doggo update example.com @ns1.example.com --prereq-name-not-in-use new --add "new 60 CNAME www"
+
+Options:
+`
+
+func updateCommand() {
+	f := flag.NewFlagSet("update", flag.ContinueOnError)
+	f.Usage = func() {
+		fmt.Print(updateUsage)
+		fmt.Print(f.FlagUsages())
+	}
+
+	f.StringArray("add", nil, "Add a record, eg \"www 300 IN A 192.0.2.1\"")
+	f.StringArray("delete", nil, "Delete every record of a name (\"www\"), an RRset (\"www A\") or a single record (\"www A 192.0.2.1\")")
+	f.StringArray("replace", nil, "Replace the RRset of the record's name and type with the record")
+	f.StringArray("prereq-name-in-use", nil, "Require the name to have at least one record")
+	f.StringArray("prereq-name-not-in-use", nil, "Require the name to have no records")
+	f.StringArray("prereq-rrset-exists", nil, "Require the RRset to exist (\"www A\"), or to hold exactly the given record")
+	f.StringArray("prereq-rrset-not-exists", nil, "Require the RRset (\"www A\") to not exist")
+
+	f.StringSliceP("nameserver", "n", []string{}, "Address of the primary nameserver to send the update to")
+	f.String("tsig", "", "TSIG key to sign the update with, as name:algorithm:secret")
+	f.String("tsig-file", "", "Path to a TSIG key file in BIND format (as written by tsig-keygen)")
+	f.DurationP("timeout", "T", 5*time.Second, "Sets the timeout for the update")
+	f.BoolP("ipv4", "4", false, "Use IPv4 only")
+	f.BoolP("ipv6", "6", false, "Use IPv6 only")
+	f.String("tls-hostname", "", "Hostname for certificate verification")
+	f.Bool("skip-hostname-verification", false, "Skip TLS Hostname Verification")
+
+	f.BoolP("json", "J", false, "Set the output format as JSON")
+	f.Bool("short", false, "Only print the response code")
+	f.Bool("color", true, "Show colored output")
+	f.Bool("debug", false, "Enable debug mode")
+
+	if err := f.Parse(os.Args[2:]); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(0)
+		}
+		fmt.Printf("Error parsing flags: %v\n", err)
+		os.Exit(exitGenericFailure)
+	}
+
+	debug, _ := f.GetBool("debug")
+	logger := utils.InitLogger(debug)
+	a := app.New(logger, nil, buildVersion)
+
+	spec := app.UpdateSpec{}
+	spec.Add, _ = f.GetStringArray("add")
+	spec.Delete, _ = f.GetStringArray("delete")
+	spec.Replace, _ = f.GetStringArray("replace")
+	spec.NameInUse, _ = f.GetStringArray("prereq-name-in-use")
+	spec.NameNotInUse, _ = f.GetStringArray("prereq-name-not-in-use")
+	spec.RRsetExists, _ = f.GetStringArray("prereq-rrset-exists")
+	spec.RRsetNotExists, _ = f.GetStringArray("prereq-rrset-not-exists")
+
+	nameservers, _, _, args := loadUnparsedArgs(f.Args())
+	if flagNameservers, _ := f.GetStringSlice("nameserver"); len(flagNameservers) > 0 {
+		nameservers = flagNameservers
+	}
+	if len(args) != 1 {
+		f.Usage()
+		os.Exit(exitGenericFailure)
+	}
+	spec.Zone = args[0]
+	if len(nameservers) == 0 {
+		logger.Error("A nameserver to send the update to is required, eg @ns1.example.com")
+		os.Exit(exitGenericFailure)
+	}
+
+	msg, err := app.BuildUpdate(spec)
+	if err != nil {
+		logger.Error("Error building update", "error", err)
+		os.Exit(exitGenericFailure)
+	}
+
+	a.QueryFlags.Nameservers = nameservers
+	a.QueryFlags.UseIPv4, _ = f.GetBool("ipv4")
+	a.QueryFlags.UseIPv6, _ = f.GetBool("ipv6")
+	a.QueryFlags.TLSHostname, _ = f.GetString("tls-hostname")
+	a.QueryFlags.InsecureSkipVerify, _ = f.GetBool("skip-hostname-verification")
+	a.QueryFlags.TSIG, _ = f.GetString("tsig")
+	a.QueryFlags.TSIGFile, _ = f.GetString("tsig-file")
+	a.QueryFlags.ShowJSON, _ = f.GetBool("json")
+	a.QueryFlags.ShortOutput, _ = f.GetBool("short")
+	a.QueryFlags.Color, _ = f.GetBool("color")
+	a.QueryFlags.Strategy = "all"
+	timeout, _ := f.GetDuration("timeout")
+
+	if err := a.LoadNameservers(); err != nil {
+		logger.Error("Error loading nameservers", "error", err)
+		os.Exit(2)
+	}
+	rslvrs, err := loadResolvers(&a, &config{timeout: timeout})
+	if err != nil {
+		logger.Error("Error loading resolvers", "error", err)
+		os.Exit(2)
+	}
+	a.Resolvers = rslvrs
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	responses, updateErrors := a.Update(ctx, msg)
+
+	if a.QueryFlags.ShowJSON {
+		outputUpdateJSON(logger, responses, updateErrors)
+	} else {
+		level := slog.LevelError
+		if len(responses) > 0 {
+			level = slog.LevelWarn
+		}
+		for _, err := range updateErrors {
+			logResolverError(logger, level, "Error sending update", err)
+		}
+		a.OutputUpdate(responses)
+	}
+
+	// An update the server refused counts as a failure, the same as one that
+	// couldn't be sent at all.
+	succeeded := 0
+	for _, rsp := range responses {
+		if rsp.Status == dns.RcodeToString[dns.RcodeSuccess] {
+			succeeded++
+		}
+	}
+	failed := len(updateErrors) + len(responses) - succeeded
+	if failed > 0 && succeeded > 0 {
+		os.Exit(exitPartialFailure)
+	}
+	if failed > 0 {
+		os.Exit(exitLookupFailure)
+	}
+}
+
+func outputUpdateJSON(logger *slog.Logger, updates []resolvers.UpdateResponse, updateErrors []error) {
+	jsonOutput := struct {
+		Updates []resolvers.UpdateResponse `json:"updates,omitempty"`
+		Errors  []resolverErrorJSON        `json:"errors,omitempty"`
+	}{
+		Updates: updates,
+		Errors:  errorsJSON(updateErrors),
+	}
+
+	jsonData, err := json.MarshalIndent(jsonOutput, "", "  ")
+	if err != nil {
+		logger.Error("Error marshaling JSON")
+		os.Exit(exitGenericFailure)
+	}
+	fmt.Println(string(jsonData))
+}
@@ -37,6 +37,7 @@ export default defineConfig({
             { label: "DNS over TLS (DoT)", link: "/resolvers/dot" },
             { label: "DNSCrypt", link: "/resolvers/dnscrypt" },
             { label: "DNS over QUIC (DoQ)", link: "/resolvers/quic" },
+            { label: "Oblivious DoH (ODoH)", link: "/resolvers/odoh" },
           ],
         },
         {
@@ -49,6 +50,15 @@ export default defineConfig({
             { label: "Protocol Tweaks", link: "/features/tweaks" },
             { label: "Shell Completions", link: "/features/shell" },
             { label: "Common Record Types", link: "/features/any" },
+            { label: "Tracing Delegations", link: "/features/trace" },
+            { label: "Zone Transfers", link: "/features/transfer" },
+            { label: "Dynamic Updates", link: "/features/update" },
+            { label: "Watching Changes", link: "/features/watch" },
+            { label: "Propagation Checks", link: "/features/propagation" },
+            { label: "Benchmarking", link: "/features/bench" },
+            { label: "Batch Queries", link: "/features/batch" },
+            { label: "Config File", link: "/features/config" },
+            { label: "Split DNS", link: "/features/routes" },
           ],
         },
       ],
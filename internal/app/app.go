@@ -1,8 +1,10 @@
 package app
 
 import (
+	"io"
 	"log/slog"
 
+	"github.com/fatih/color"
 	"github.com/jsdelivr/globalping-cli/globalping"
 	"github.com/miekg/dns"
 	"github.com/mr-karan/doggo/pkg/models"
@@ -18,8 +20,13 @@ type App struct {
 	Resolvers    []resolvers.Resolver
 	ResolverOpts resolvers.Options
 	Nameservers  []models.Nameserver
+	// Routes are the split DNS routes matching at least one question.
+	Routes []Route
 
 	globalping globalping.Client
+	// stdout is where the rounds of a watch are printed, color.Output when
+	// it's nil.
+	stdout io.Writer
 }
 
 // NewApp initializes an instance of App which holds app wide configuration.
@@ -42,3 +49,20 @@ func New(
 	}
 	return app
 }
+
+// output returns where the rounds of a watch are printed.
+func (app *App) output() io.Writer {
+	if app.stdout != nil {
+		return app.stdout
+	}
+	return color.Output
+}
+
+// Close closes the connections the resolvers of the app and of its routes
+// keep open between lookups.
+func (app *App) Close() {
+	resolvers.Close(app.Resolvers)
+	for _, r := range app.Routes {
+		resolvers.Close(r.Resolvers)
+	}
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+	"github.com/olekukonko/tablewriter"
+	"github.com/olekukonko/tablewriter/tw"
+)
+
+// Bench benchmarks every resolver in turn, so they don't compete with each
+// other for bandwidth.
+func (app *App) Bench(ctx context.Context, flags resolvers.QueryFlags, opts resolvers.BenchOptions) ([]resolvers.BenchResult, []error) {
+	var (
+		results []resolvers.BenchResult
+		errs    []error
+	)
+	for i, r := range app.Resolvers {
+		app.Logger.Debug("Benchmarking nameserver", "nameserver", r.Address(), "queries", opts.Count)
+		res, err := resolvers.Bench(ctx, r, app.Questions, flags, opts)
+		if err != nil {
+			errs = append(errs, &resolvers.LookupError{Nameserver: r.Address(), Err: err})
+			if res.Queries == 0 {
+				continue
+			}
+		} else if res.Responses == 0 && res.Error != "" {
+			errs = append(errs, &resolvers.LookupError{Nameserver: r.Address(), Err: errors.New(res.Error)})
+		}
+		// Resolvers are created in the same order as the nameservers.
+		if i < len(app.Nameservers) {
+			res.Protocol = app.Nameservers[i].Type
+		}
+		results = append(results, res)
+	}
+	return results, errs
+}
+
+// OutputBench displays the results of a benchmark.
+func (app *App) OutputBench(results []resolvers.BenchResult) {
+	if app.QueryFlags.ShowJSON {
+		jsonOutput := struct {
+			Benchmarks []resolvers.BenchResult `json:"benchmarks"`
+		}{
+			Benchmarks: results,
+		}
+		// Pretty print with 4 spaces.
+		res, err := json.MarshalIndent(jsonOutput, "", "    ")
+		if err != nil {
+			app.Logger.Error("unable to output data in JSON", "error", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("%s\n", res)
+		return
+	}
+
+	// Disables colorized output if user specified.
+	if !app.QueryFlags.Color {
+		color.NoColor = true
+	}
+
+	table := newTable()
+	// Auto formatting would split the percentiles into "P 50".
+	table.Options(tablewriter.WithHeaderAutoFormat(tw.Off))
+	table.Header("NAMESERVER", "PROTOCOL", "QUERIES", "QPS", "MIN", "P50", "P90", "P99", "MAX", "TIMEOUTS", "ERRORS", "RCODES")
+	for _, res := range results {
+		timeouts := fmt.Sprintf("%.1f%%", res.TimeoutRate())
+		if res.Timeouts > 0 {
+			timeouts = TerminalColorRed(timeouts)
+		}
+		errs := fmt.Sprintf("%.1f%%", res.ErrorRate())
+		if res.Errors > 0 {
+			errs = TerminalColorRed(errs)
+		}
+		latencies := []string{"-", "-", "-", "-", "-"}
+		if res.Responses > 0 {
+			latencies = []string{
+				formatMillis(res.Min),
+				TerminalColorCyan(formatMillis(res.P50)),
+				formatMillis(res.P90),
+				formatMillis(res.P99),
+				formatMillis(res.Max),
+			}
+		}
+		row := []string{TerminalColorGreen(res.Nameserver), res.Protocol, fmt.Sprintf("%d", res.Queries), fmt.Sprintf("%.1f", res.QPS)}
+		row = append(row, latencies...)
+		table.Append(append(row, timeouts, errs, formatRcodes(res.Rcodes)))
+	}
+	table.Render()
+}
+
+func formatMillis(ms float64) string {
+	return fmt.Sprintf("%.2fms", ms)
+}
+
+// formatRcodes lists the rcodes of a benchmark, most frequent first.
+func formatRcodes(rcodes map[string]int) string {
+	names := make([]string, 0, len(rcodes))
+	for name := range rcodes {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if rcodes[names[i]] != rcodes[names[j]] {
+			return rcodes[names[i]] > rcodes[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%s=%d", name, rcodes[name])
+	}
+	return strings.Join(parts, " ")
+}
@@ -12,9 +12,8 @@ import (
 
 	"github.com/fatih/color"
 	"github.com/jsdelivr/globalping-cli/globalping"
+	"github.com/miekg/dns"
 	"github.com/mr-karan/doggo/pkg/resolvers"
-	"github.com/olekukonko/tablewriter"
-	"github.com/olekukonko/tablewriter/tw"
 )
 
 var (
@@ -98,36 +97,7 @@ func (app *App) OutputGlobalping(m *globalping.Measurement) error {
 		color.NoColor = true
 	}
 
-	table := tablewriter.NewWriter(color.Output)
-	table.Options(
-		tablewriter.WithRendition(tw.Rendition{
-			Borders: tw.Border{
-				Left:   tw.Off,
-				Right:  tw.Off,
-				Top:    tw.Off,
-				Bottom: tw.Off,
-			},
-			Settings: tw.Settings{
-				Separators: tw.Separators{
-					ShowHeader:     tw.Off,
-					ShowFooter:     tw.Off,
-					BetweenRows:    tw.Off,
-					BetweenColumns: tw.Off,
-				},
-				Lines: tw.Lines{
-					ShowTop:        tw.Off,
-					ShowBottom:     tw.Off,
-					ShowHeaderLine: tw.Off,
-					ShowFooterLine: tw.Off,
-				},
-			},
-			Symbols: tw.NewSymbols(tw.StyleLight),
-		}),
-		tablewriter.WithPadding(tw.Padding{Left: "", Right: "  ", Overwrite: true}),
-		tablewriter.WithRowAutoWrap(tw.WrapNormal),
-		tablewriter.WithRowMaxWidth(30),
-		tablewriter.WithHeaderAlignment(tw.AlignLeft),
-	)
+	table := newTable()
 
 	// Formatting options for the table.
 	table.Header("Location", "Name", "Type", "Class", "TTL", "Address", "Nameserver")
@@ -183,14 +153,20 @@ func (app *App) OutputGlobalpingJSON(m *globalping.Measurement) error {
 		}
 		resolver := m.Results[i].Result.Resolver
 		for _, ans := range answers {
-			jsonOutput.Responses[i].Answers = append(jsonOutput.Responses[i].Answers, resolvers.Answer{
+			answer := resolvers.Answer{
 				Name:       ans.Name,
 				Type:       ans.Type,
 				Class:      ans.Class,
 				TTL:        fmt.Sprintf("%ds", ans.TTL),
 				Address:    ans.Value,
 				Nameserver: resolver,
-			})
+			}
+			// Globalping only returns the value as a string, parse it back
+			// to fill in the typed RDATA.
+			if rr, err := dns.NewRR(fmt.Sprintf("%s %d %s %s %s", dns.Fqdn(ans.Name), ans.TTL, ans.Class, ans.Type, ans.Value)); err == nil && rr != nil {
+				answer.RData = resolvers.RDataOf(rr)
+			}
+			jsonOutput.Responses[i].Answers = append(jsonOutput.Responses[i].Answers, answer)
 		}
 	}
 
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"encoding/hex"
 	"fmt"
 	"math/rand"
 	"net"
@@ -13,6 +14,7 @@ import (
 	"github.com/miekg/dns"
 	"github.com/mr-karan/doggo/pkg/config"
 	"github.com/mr-karan/doggo/pkg/models"
+	"github.com/mr-karan/doggo/pkg/resolvers"
 )
 
 func (app *App) LoadNameservers() error {
@@ -20,8 +22,19 @@ func (app *App) LoadNameservers() error {
 
 	app.Nameservers = []models.Nameserver{} // Clear existing nameservers
 
+	if len(app.QueryFlags.Nameservers) == 0 && !app.QueryFlags.UseAuthoritative {
+		app.loadSearchList()
+	}
+	if err := app.loadRoutes(); err != nil {
+		return err
+	}
+	if app.allRouted() {
+		app.Logger.Debug("LoadNameservers: every question matched a route")
+		return nil
+	}
+
 	if len(app.QueryFlags.Nameservers) > 0 {
-		for _, srv := range app.QueryFlags.Nameservers {
+		for _, srv := range app.expandNameservers(app.QueryFlags.Nameservers) {
 			ns, err := initNameserver(srv)
 			if err != nil {
 				app.Logger.Error("error parsing nameserver", "error", err)
@@ -53,6 +66,27 @@ func (app *App) LoadNameservers() error {
 	return nil
 }
 
+// expandNameservers replaces the aliases and groups defined in the config
+// file with the nameservers they stand for, before they're parsed. A group
+// may list aliases but not other groups.
+func (app *App) expandNameservers(names []string) []string {
+	out := make([]string, 0, len(names))
+	for _, n := range names {
+		members, ok := app.QueryFlags.Groups[n]
+		if !ok {
+			members = []string{n}
+		}
+		for _, m := range members {
+			if addr, ok := app.QueryFlags.Aliases[m]; ok {
+				app.Logger.Debug("Expanded nameserver alias", "alias", m, "nameserver", addr)
+				m = addr
+			}
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
 func (app *App) loadSystemNameservers() error {
 	app.Logger.Debug("No user specified nameservers, falling back to system nameservers")
 	ns, ndots, search, err := app.getDefaultServers()
@@ -61,6 +95,39 @@ func (app *App) loadSystemNameservers() error {
 		return fmt.Errorf("error fetching system default nameserver: %v", err)
 	}
 
+	app.setSearchList(ndots, search)
+
+	// The attempts and timeout options apply unless --tries and
+	// --retry-timeout are given.
+	attempts, timeout, err := config.GetResolvOptions()
+	if err != nil {
+		app.Logger.Debug("Unable to read the resolver options", "error", err)
+	}
+	app.ResolverOpts.Tries = attempts
+	app.ResolverOpts.RetryTimeout = timeout
+
+	app.Nameservers = append(app.Nameservers, ns...)
+	app.Logger.Debug("Loaded system nameservers", "nameservers", app.Nameservers)
+	return nil
+}
+
+// loadSearchList sets the search list and ndots of the system configuration
+// up front, as the routes are matched against the names they complete.
+func (app *App) loadSearchList() {
+	if len(app.QueryFlags.Routes) == 0 || !app.QueryFlags.UseSearchList {
+		return
+	}
+	_, ndots, search, err := app.getDefaultServers()
+	if err != nil && search == nil {
+		app.Logger.Debug("Unable to read the search list", "error", err)
+		return
+	}
+	app.setSearchList(ndots, search)
+}
+
+// setSearchList uses the search list and ndots of the system configuration,
+// unless --search=false or --ndots say otherwise.
+func (app *App) setSearchList(ndots int, search []string) {
 	if app.ResolverOpts.Ndots == -1 {
 		app.ResolverOpts.Ndots = ndots
 	}
@@ -68,10 +135,6 @@ func (app *App) loadSystemNameservers() error {
 	if len(search) > 0 && app.QueryFlags.UseSearchList {
 		app.ResolverOpts.SearchList = search
 	}
-
-	app.Nameservers = append(app.Nameservers, ns...)
-	app.Logger.Debug("Loaded system nameservers", "nameservers", app.Nameservers)
-	return nil
 }
 
 // wrapIPv6 wraps bare IPv6 addresses in brackets for URL parsing.
@@ -163,7 +226,7 @@ func wrapIPv6InURL(urlStr string) string {
 	hostPart := parts[1]
 
 	// For HTTPS URLs, don't try to wrap (they have domain names, not IPs usually)
-	if protocol == "https" || protocol == "sdns" {
+	if protocol == "https" || protocol == "h3" || protocol == "https+json" || protocol == "odoh" || protocol == "sdns" {
 		return urlStr
 	}
 
@@ -198,12 +261,36 @@ func initNameserver(n string) (models.Nameserver, error) {
 		Address: getAddressWithDefaultPort(u, models.DefaultUDPPort),
 	}
 
+	// The TLS parameters are options of doggo, not part of the address.
+	if q := u.Query(); q.Has("tls-cert") || q.Has("tls-key") || q.Has("tls-ca") || q.Has("tls-pin") {
+		if u.Scheme == "udp" || u.Scheme == "tcp" {
+			return ns, fmt.Errorf("tls-cert, tls-key, tls-ca and tls-pin are only supported by encrypted nameservers, not %s", u.Scheme)
+		}
+		ns.TLSCert, ns.TLSKey, ns.TLSCA = q.Get("tls-cert"), q.Get("tls-key"), q.Get("tls-ca")
+		for _, pin := range q["tls-pin"] {
+			// The + of base64 is a space in a query string unless it's
+			// escaped, which nobody does on a command line.
+			ns.TLSPins = append(ns.TLSPins, strings.ReplaceAll(pin, " ", "+"))
+		}
+		q.Del("tls-cert")
+		q.Del("tls-key")
+		q.Del("tls-ca")
+		q.Del("tls-pin")
+		u.RawQuery = q.Encode()
+	}
+
 	switch u.Scheme {
 	case "sdns":
 		return handleSDNS(n)
-	case "https":
+	case "https", "h3":
 		ns.Type = models.DOHResolver
 		ns.Address = u.String()
+	case "https+json":
+		ns.Type = models.DOHJSONResolver
+		ns.Address = u.String()
+	case "odoh":
+		ns.Type = models.ODOHResolver
+		ns.Address = u.String()
 	case "tls":
 		ns.Type = models.DOTResolver
 		ns.Address = getAddressWithDefaultPort(u, models.DefaultTLSPort)
@@ -233,6 +320,17 @@ func getAddressWithDefaultPort(u *url.URL, defaultPort string) string {
 }
 
 func handleSDNS(n string) (models.Nameserver, error) {
+	// The stamps of ODoH aren't supported by dnsstamps.
+	if resolvers.IsODoHStamp(n) {
+		target, err := resolvers.ODoHTargetFromStamp(n)
+		if err != nil {
+			return models.Nameserver{}, fmt.Errorf("%w (ODoH relay stamps go in --odoh-relay)", err)
+		}
+		return models.Nameserver{
+			Type:    models.ODOHResolver,
+			Address: target,
+		}, nil
+	}
 	stamp, err := dnsstamps.NewServerStampFromString(n)
 	if err != nil {
 		return models.Nameserver{}, err
@@ -241,9 +339,15 @@ func handleSDNS(n string) (models.Nameserver, error) {
 	switch stamp.Proto {
 	case dnsstamps.StampProtoTypeDoH:
 		address := url.URL{Scheme: "https", Host: stamp.ProviderName, Path: stamp.Path}
+		// The hashes of the certificates the server may present.
+		var hashes []string
+		for _, h := range stamp.Hashes {
+			hashes = append(hashes, hex.EncodeToString(h))
+		}
 		return models.Nameserver{
-			Type:    models.DOHResolver,
-			Address: address.String(),
+			Type:          models.DOHResolver,
+			Address:       address.String(),
+			TLSCertHashes: hashes,
 		}, nil
 	case dnsstamps.StampProtoTypeDNSCrypt:
 		return models.Nameserver{
@@ -382,6 +486,12 @@ func (app *App) applyNameserverStrategy(nameservers []models.Nameserver, source
 		app.logStrategyApplied(source, strategy, len(nameservers), internalServers)
 		return internalServers, nil
 
+	case "failover", "fastest":
+		// Every nameserver is kept; which one answers is decided at lookup
+		// time, see resolvers.Failover and resolvers.Fastest.
+		app.logStrategyApplied(source, strategy, len(nameservers), nameservers)
+		return nameservers, nil
+
 	default:
 		app.Logger.Debug("Nameserver strategy left nameservers unchanged",
 			"source", source,
@@ -485,11 +595,10 @@ func (app *App) getDefaultServers() ([]models.Nameserver, int, []string, error)
 // is dns-external-route53.us-east-1.amazonaws.com), whereas the delegated NS
 // set is what recursive resolvers actually query.
 func (app *App) loadAuthoritativeNameserver(domain string) error {
-	systemServers, _, _, err := config.GetDefaultServers()
-	if err != nil || len(systemServers) == 0 {
+	resolver, err := systemResolverAddr()
+	if err != nil {
 		return fmt.Errorf("unable to load system nameservers for SOA lookup: %w", err)
 	}
-	resolver := net.JoinHostPort(systemServers[0], models.DefaultUDPPort)
 
 	c := &dns.Client{Timeout: 5 * time.Second}
 
@@ -570,18 +679,38 @@ func (app *App) zoneNameservers(c *dns.Client, resolver, zone string) ([]string,
 		return nil, fmt.Errorf("failed to query NS records for zone %q: %w", strings.TrimSuffix(zone, "."), err)
 	}
 
+	names := nsNames(append(r.Answer, r.Ns...))
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no NS records found for zone %q", strings.TrimSuffix(zone, "."))
+	}
+
+	return names, nil
+}
+
+// nsNames extracts the nameserver hostnames from the NS records in rrs,
+// sorted for deterministic selection.
+func nsNames(rrs []dns.RR) []string {
 	var names []string
-	for _, rr := range append(r.Answer, r.Ns...) {
+	for _, rr := range rrs {
 		if ns, ok := rr.(*dns.NS); ok {
 			names = append(names, ns.Ns)
 		}
 	}
-	if len(names) == 0 {
-		return nil, fmt.Errorf("no NS records found for zone %q", strings.TrimSuffix(zone, "."))
-	}
 	sort.Strings(names)
+	return names
+}
 
-	return names, nil
+// systemResolverAddr returns the first system nameserver as a host:port
+// address. It backs the helper lookups used to bootstrap -A and --trace.
+func systemResolverAddr() (string, error) {
+	systemServers, _, _, err := config.GetDefaultServers()
+	if err != nil {
+		return "", err
+	}
+	if len(systemServers) == 0 {
+		return "", fmt.Errorf("no system nameservers configured")
+	}
+	return net.JoinHostPort(systemServers[0], models.DefaultUDPPort), nil
 }
 
 // firstSOA returns the first SOA record from the answer or authority section.
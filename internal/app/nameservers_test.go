@@ -1,11 +1,15 @@
 package app
 
 import (
+	"bytes"
+	"encoding/hex"
 	"io"
 	"log/slog"
+	"reflect"
 	"strings"
 	"testing"
 
+	"github.com/ameshkov/dnsstamps"
 	"github.com/mr-karan/doggo/pkg/models"
 )
 
@@ -40,6 +44,78 @@ func TestLoadNameserversAppliesInternalStrategyToExplicitNameservers(t *testing.
 	assertNameservers(t, app.Nameservers, want)
 }
 
+func TestLoadNameserversExpandsAliasesAndGroups(t *testing.T) {
+	app := newTestApp()
+	app.QueryFlags.Aliases = map[string]string{
+		"cf":       "https://cloudflare-dns.com/dns-query",
+		"corp-dot": "tls://10.0.0.53",
+	}
+	app.QueryFlags.Groups = map[string][]string{
+		"public": {"cf", "8.8.8.8"},
+	}
+	app.QueryFlags.Nameservers = []string{"corp-dot", "public", "9.9.9.9"}
+
+	if err := app.LoadNameservers(); err != nil {
+		t.Fatalf("LoadNameservers() error = %v", err)
+	}
+
+	want := []models.Nameserver{
+		{Address: "10.0.0.53:853", Type: models.DOTResolver},
+		{Address: "https://cloudflare-dns.com/dns-query", Type: models.DOHResolver},
+		{Address: "8.8.8.8:53", Type: models.UDPResolver},
+		{Address: "9.9.9.9:53", Type: models.UDPResolver},
+	}
+	assertNameservers(t, app.Nameservers, want)
+}
+
+func TestInitNameserverTLSParameters(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want models.Nameserver
+	}{
+		{"tls://10.0.0.53?tls-ca=/etc/ca.pem", models.Nameserver{Address: "10.0.0.53:853", Type: models.DOTResolver, TLSCA: "/etc/ca.pem"}},
+		{"quic://10.0.0.53:8853?tls-cert=c.pem&tls-key=k.pem", models.Nameserver{Address: "10.0.0.53:8853", Type: models.DOQResolver, TLSCert: "c.pem", TLSKey: "k.pem"}},
+		{"https://dns.example/dns-query?tls-cert=c.pem&ct=1", models.Nameserver{Address: "https://dns.example/dns-query?ct=1", Type: models.DOHResolver, TLSCert: "c.pem"}},
+		{"https://dns.example/dns-query?ct=1&b=2", models.Nameserver{Address: "https://dns.example/dns-query?ct=1&b=2", Type: models.DOHResolver}},
+		{"tls://1.1.1.1?tls-pin=sha256/ab+c=&tls-pin=sha256/def=", models.Nameserver{Address: "1.1.1.1:853", Type: models.DOTResolver, TLSPins: []string{"sha256/ab+c=", "sha256/def="}}},
+	} {
+		got, err := initNameserver(tc.in)
+		if err != nil {
+			t.Errorf("initNameserver(%q) error = %v", tc.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("initNameserver(%q) = %#v, want %#v", tc.in, got, tc.want)
+		}
+	}
+
+	if _, err := initNameserver("tcp://10.0.0.53?tls-ca=/etc/ca.pem"); err == nil {
+		t.Error("initNameserver accepted TLS parameters for a TCP nameserver")
+	}
+}
+
+func TestInitNameserverDOHStampHashes(t *testing.T) {
+	hash := bytes.Repeat([]byte{0xab}, 32)
+	stamp := dnsstamps.ServerStamp{
+		Proto:        dnsstamps.StampProtoTypeDoH,
+		ProviderName: "dns.example",
+		Path:         "/dns-query",
+		Hashes:       [][]byte{hash},
+	}
+	got, err := initNameserver(stamp.String())
+	if err != nil {
+		t.Fatalf("initNameserver() error = %v", err)
+	}
+	want := models.Nameserver{
+		Address:       "https://dns.example/dns-query",
+		Type:          models.DOHResolver,
+		TLSCertHashes: []string{hex.EncodeToString(hash)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("initNameserver() = %#v, want %#v", got, want)
+	}
+}
+
 func TestLoadNameserversReturnsErrorWhenExplicitInternalStrategyHasNoPrivateNameservers(t *testing.T) {
 	app := newTestApp()
 	app.QueryFlags.Nameservers = []string{"1.1.1.1", "8.8.8.8"}
@@ -168,7 +244,7 @@ func assertNameservers(t *testing.T, got, want []models.Nameserver) {
 	}
 
 	for i := range want {
-		if got[i] != want[i] {
+		if !reflect.DeepEqual(got[i], want[i]) {
 			t.Fatalf("nameservers[%d] = %#v, want %#v", i, got[i], want[i])
 		}
 	}
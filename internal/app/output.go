@@ -3,7 +3,9 @@ package app
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strings"
 
 	"github.com/fatih/color"
 	"github.com/miekg/dns"
@@ -55,36 +57,7 @@ func (app *App) outputTerminal(rsp []resolvers.Response) {
 	}
 
 	// Conditional Time column.
-	table := tablewriter.NewWriter(color.Output)
-	table.Options(
-		tablewriter.WithRendition(tw.Rendition{
-			Borders: tw.Border{
-				Left:   tw.Off,
-				Right:  tw.Off,
-				Top:    tw.Off,
-				Bottom: tw.Off,
-			},
-			Settings: tw.Settings{
-				Separators: tw.Separators{
-					ShowHeader:     tw.Off,
-					ShowFooter:     tw.Off,
-					BetweenRows:    tw.Off,
-					BetweenColumns: tw.Off,
-				},
-				Lines: tw.Lines{
-					ShowTop:        tw.Off,
-					ShowBottom:     tw.Off,
-					ShowHeaderLine: tw.Off,
-					ShowFooterLine: tw.Off,
-				},
-			},
-			Symbols: tw.NewSymbols(tw.StyleLight),
-		}),
-		tablewriter.WithPadding(tw.Padding{Left: "", Right: "  ", Overwrite: true}),
-		tablewriter.WithRowAutoWrap(tw.WrapNormal),
-		tablewriter.WithRowMaxWidth(30),
-		tablewriter.WithHeaderAlignment(tw.AlignLeft),
-	)
+	table := newTable()
 
 	header := []interface{}{"Name", "Type", "Class", "TTL", "Address", "Nameserver"}
 	if app.QueryFlags.DisplayTimeTaken {
@@ -160,36 +133,240 @@ func (app *App) outputTerminal(rsp []resolvers.Response) {
 	table.Render()
 
 	// Display EDNS information if present (only once, from the first response)
-	hasEdns := false
 	for _, r := range rsp {
-		if r.Edns != nil && !hasEdns {
-			hasEdns = true
+		if r.Edns != nil {
+			outputEdns(r.Edns)
+			break
+		}
+	}
+
+	outputHTTPVersions(rsp)
+	outputDNSCryptCerts(rsp)
+	outputTLSInfo(rsp)
+	if app.QueryFlags.DisplayTimeTaken {
+		outputHandshakes(rsp)
+	}
+	outputAttempts(rsp)
+
+	// Display the DNSSEC verdict of every validated response.
+	hasDNSSEC := false
+	for _, r := range rsp {
+		if r.DNSSEC == nil {
+			continue
+		}
+		if !hasDNSSEC {
+			hasDNSSEC = true
 			fmt.Println()
-			fmt.Println(TerminalColorYellow("EDNS Information:"))
-			if r.Edns.NSID != "" {
-				fmt.Printf("  NSID: %s\n", TerminalColorCyan(r.Edns.NSID))
-			}
-			if r.Edns.Cookie != "" {
-				fmt.Printf("  Cookie: %s\n", TerminalColorCyan(r.Edns.Cookie))
-			}
-			if r.Edns.Subnet != "" {
-				fmt.Printf("  Client Subnet: %s (Scope: %d)\n",
-					TerminalColorCyan(r.Edns.Subnet), r.Edns.SubnetScope)
-			}
-			if r.Edns.ExtendedErr != "" {
-				fmt.Printf("  Extended Error: %s\n", TerminalColorRed(r.Edns.ExtendedErr))
-			}
-			if r.Edns.UDPSize > 0 {
-				fmt.Printf("  UDP Size: %s\n", TerminalColorCyan(fmt.Sprintf("%d", r.Edns.UDPSize)))
-			}
-			if r.Edns.DNSSECOk {
-				fmt.Printf("  DNSSEC OK: %s\n", TerminalColorGreen("true"))
+			fmt.Println(TerminalColorYellow("DNSSEC Validation:"))
+		}
+		question := ""
+		if len(r.Questions) > 0 {
+			q := r.Questions[len(r.Questions)-1]
+			question = q.Name + " " + q.Type
+		}
+		fmt.Printf("  %s: %s\n", question, getColoredVerdict(r.DNSSEC.Verdict))
+		if r.DNSSEC.FailingLink != "" {
+			fmt.Printf("    Failing link: %s\n", TerminalColorCyan(r.DNSSEC.FailingLink))
+		}
+		if r.DNSSEC.Reason != "" {
+			fmt.Printf("    Reason: %s\n", r.DNSSEC.Reason)
+		}
+	}
+}
+
+// outputEdns prints the EDNS options of a response, if it had any.
+func outputEdns(edns *resolvers.EdnsInfo) {
+	if edns == nil {
+		return
+	}
+	fmt.Println()
+	fmt.Println(TerminalColorYellow("EDNS Information:"))
+	if edns.NSID != "" {
+		fmt.Printf("  NSID: %s\n", TerminalColorCyan(edns.NSID))
+	}
+	if edns.Cookie != "" {
+		fmt.Printf("  Cookie: %s\n", TerminalColorCyan(edns.Cookie))
+	}
+	if edns.Subnet != "" {
+		fmt.Printf("  Client Subnet: %s (Scope: %d)\n",
+			TerminalColorCyan(edns.Subnet), edns.SubnetScope)
+	}
+	if edns.ExtendedErr != "" {
+		fmt.Printf("  Extended Error: %s\n", TerminalColorRed(edns.ExtendedErr))
+	}
+	if edns.UDPSize > 0 {
+		fmt.Printf("  UDP Size: %s\n", TerminalColorCyan(fmt.Sprintf("%d", edns.UDPSize)))
+	}
+	if edns.DNSSECOk {
+		fmt.Printf("  DNSSEC OK: %s\n", TerminalColorGreen("true"))
+	}
+}
+
+// outputHTTPVersions prints the HTTP version every DoH nameserver answered
+// over.
+func outputHTTPVersions(rsp []resolvers.Response) {
+	seen := make(map[string]bool)
+	for _, r := range rsp {
+		if r.HTTPVersion == "" {
+			continue
+		}
+		key := r.Nameserver + " " + r.HTTPVersion
+		if seen[key] {
+			continue
+		}
+		if len(seen) == 0 {
+			fmt.Println()
+			fmt.Println(TerminalColorYellow("HTTP Version:"))
+		}
+		seen[key] = true
+		fmt.Printf("  %s: %s\n", r.Nameserver, TerminalColorCyan(r.HTTPVersion))
+	}
+}
+
+// outputHandshakes prints how long it took to establish the connections the
+// queries were sent on. It isn't part of the time taken by the answers.
+func outputHandshakes(rsp []resolvers.Response) {
+	printed := false
+	for _, r := range rsp {
+		if r.Handshake == "" {
+			continue
+		}
+		if !printed {
+			printed = true
+			fmt.Println()
+			fmt.Println(TerminalColorYellow("Handshake:"))
+		}
+		fmt.Printf("  %s: %s\n", r.Nameserver, TerminalColorCyan(r.Handshake))
+	}
+}
+
+// outputAttempts prints the number of times every query was sent, when
+// --tries or --retry-timeout are set.
+func outputAttempts(rsp []resolvers.Response) {
+	printed := false
+	for _, r := range rsp {
+		if r.Attempts == 0 {
+			continue
+		}
+		if !printed {
+			printed = true
+			fmt.Println()
+			fmt.Println(TerminalColorYellow("Attempts:"))
+		}
+		question := ""
+		if len(r.Questions) > 0 {
+			q := r.Questions[len(r.Questions)-1]
+			question = " " + q.Name + " " + q.Type
+		}
+		fmt.Printf("  %s%s: %s\n", r.Nameserver, question, TerminalColorCyan(fmt.Sprintf("%d", r.Attempts)))
+	}
+}
+
+// outputTLSInfo prints the TLS connection of every DoT, DoH and DoQ
+// nameserver, for --tls-info.
+func outputTLSInfo(rsp []resolvers.Response) {
+	seen := make(map[string]bool)
+	for _, r := range rsp {
+		if r.TLS == nil || seen[r.Nameserver] {
+			continue
+		}
+		if len(seen) == 0 {
+			fmt.Println()
+			fmt.Println(TerminalColorYellow("TLS Information:"))
+		}
+		seen[r.Nameserver] = true
+		fmt.Printf("  %s: %s, %s\n", r.Nameserver, TerminalColorCyan(r.TLS.Version), r.TLS.CipherSuite)
+		if r.TLS.ALPN != "" {
+			fmt.Printf("    ALPN: %s\n", r.TLS.ALPN)
+		}
+		fmt.Printf("    Resumed: %t\n", r.TLS.Resumed)
+		for i, cert := range r.TLS.Certificates {
+			fmt.Printf("    Certificate %d: %s\n", i, TerminalColorGreen(cert.Subject))
+			if len(cert.SANs) > 0 {
+				fmt.Printf("      SANs: %s\n", strings.Join(cert.SANs, ", "))
 			}
-			break // Only display EDNS info once
+			fmt.Printf("      Issuer: %s\n", cert.Issuer)
+			fmt.Printf("      Expires: %s\n", cert.NotAfter)
+		}
+	}
+}
+
+// outputDNSCryptCerts prints the certificate every DNSCrypt nameserver
+// answered with.
+func outputDNSCryptCerts(rsp []resolvers.Response) {
+	seen := make(map[string]bool)
+	for _, r := range rsp {
+		if r.DNSCrypt == nil {
+			continue
 		}
+		key := fmt.Sprintf("%s %d", r.Nameserver, r.DNSCrypt.Serial)
+		if seen[key] {
+			continue
+		}
+		if len(seen) == 0 {
+			fmt.Println()
+			fmt.Println(TerminalColorYellow("DNSCrypt Certificate:"))
+		}
+		seen[key] = true
+		fmt.Printf("  %s: %s\n", r.Nameserver, TerminalColorCyan(r.DNSCrypt.Provider))
+		fmt.Printf("    Serial: %d\n", r.DNSCrypt.Serial)
+		fmt.Printf("    ES version: %s\n", r.DNSCrypt.EsVersion)
+		fmt.Printf("    Valid: %s to %s\n", r.DNSCrypt.ValidFrom, r.DNSCrypt.ValidUntil)
+	}
+}
+
+func getColoredVerdict(v string) string {
+	switch v {
+	case resolvers.DNSSECSecure:
+		return TerminalColorGreen(v)
+	case resolvers.DNSSECInsecure:
+		return TerminalColorYellow(v)
+	default:
+		return TerminalColorRed(v)
 	}
 }
 
+// newTable returns a borderless table writer in the style shared by every
+// terminal output mode.
+func newTable() *tablewriter.Table {
+	return newTableTo(color.Output)
+}
+
+// newTableTo returns a table writer in the style of newTable printing to w.
+func newTableTo(w io.Writer) *tablewriter.Table {
+	table := tablewriter.NewWriter(w)
+	table.Options(
+		tablewriter.WithRendition(tw.Rendition{
+			Borders: tw.Border{
+				Left:   tw.Off,
+				Right:  tw.Off,
+				Top:    tw.Off,
+				Bottom: tw.Off,
+			},
+			Settings: tw.Settings{
+				Separators: tw.Separators{
+					ShowHeader:     tw.Off,
+					ShowFooter:     tw.Off,
+					BetweenRows:    tw.Off,
+					BetweenColumns: tw.Off,
+				},
+				Lines: tw.Lines{
+					ShowTop:        tw.Off,
+					ShowBottom:     tw.Off,
+					ShowHeaderLine: tw.Off,
+					ShowFooterLine: tw.Off,
+				},
+			},
+			Symbols: tw.NewSymbols(tw.StyleLight),
+		}),
+		tablewriter.WithPadding(tw.Padding{Left: "", Right: "  ", Overwrite: true}),
+		tablewriter.WithRowAutoWrap(tw.WrapNormal),
+		tablewriter.WithRowMaxWidth(30),
+		tablewriter.WithHeaderAlignment(tw.AlignLeft),
+	)
+	return table
+}
+
 func getColoredType(t string) string {
 	switch t {
 	case "A":
@@ -0,0 +1,264 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/pkg/models"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+)
+
+// Propagation is the view of one question across a catalogue of public
+// resolvers.
+type Propagation struct {
+	Name      string              `json:"name"`
+	Type      string              `json:"type"`
+	Catalogue string              `json:"catalogue"`
+	Consensus string              `json:"consensus"`
+	Agreeing  int                 `json:"agreeing"`
+	Answered  int                 `json:"answered"`
+	Total     int                 `json:"total"`
+	Results   []PropagationResult `json:"results"`
+}
+
+// PropagationResult is the answer of a single resolver. Answer holds the
+// sorted values of the answer, or the response code when there were none.
+// Remaining is the share of the TTL left, relative to the highest TTL any
+// resolver returned for the same answer.
+type PropagationResult struct {
+	Operator   string `json:"operator"`
+	Region     string `json:"region"`
+	Protocol   string `json:"protocol"`
+	Nameserver string `json:"nameserver"`
+	Answer     string `json:"answer,omitempty"`
+	TTL        string `json:"ttl,omitempty"`
+	Remaining  int    `json:"remaining"`
+	RTT        string `json:"rtt,omitempty"`
+	Agrees     bool   `json:"agrees"`
+	Error      string `json:"error,omitempty"`
+
+	ttl int
+}
+
+// Propagation asks every resolver of catalogue every question and works out
+// which answer most of them agree on. version identifies the catalogue in
+// the output.
+func (app *App) Propagation(ctx context.Context, catalogue []models.PublicResolver, version string, opts resolvers.Options, flags resolvers.QueryFlags) []Propagation {
+	props := make([]Propagation, len(app.Questions))
+	for i, q := range app.Questions {
+		props[i] = Propagation{
+			Name:      q.Name,
+			Type:      dns.TypeToString[q.Qtype],
+			Catalogue: version,
+			Total:     len(catalogue),
+			Results:   make([]PropagationResult, len(catalogue)),
+		}
+	}
+
+	var (
+		wg     sync.WaitGroup
+		opened []resolvers.Resolver
+	)
+	for i, pr := range catalogue {
+		opts := opts
+		opts.Nameservers = []models.Nameserver{pr.Nameserver}
+		rslvrs, err := resolvers.LoadResolvers(opts)
+		opened = append(opened, rslvrs...)
+		for j, q := range app.Questions {
+			res := PropagationResult{
+				Operator:   pr.Operator,
+				Region:     pr.Region,
+				Protocol:   pr.Type,
+				Nameserver: pr.Address,
+			}
+			if err != nil || len(rslvrs) == 0 {
+				res.Error = fmt.Sprintf("unable to create resolver: %v", err)
+				props[j].Results[i] = res
+				continue
+			}
+			wg.Add(1)
+			go func(r resolvers.Resolver, q dns.Question, res PropagationResult) {
+				defer wg.Done()
+				rsp, err := r.Lookup(ctx, []dns.Question{q}, flags)
+				if err != nil {
+					res.Error = err.Error()
+				} else if len(rsp) > 0 {
+					res.RTT = responseRTT(rsp[0])
+					res.Answer, res.ttl = propagationAnswer(rsp[0], q)
+					if res.ttl >= 0 {
+						res.TTL = strconv.Itoa(res.ttl) + "s"
+					}
+				}
+				// Every goroutine writes its own slot, no locking needed.
+				props[j].Results[i] = res
+			}(rslvrs[0], q, res)
+		}
+	}
+	wg.Wait()
+	resolvers.Close(opened)
+
+	for i := range props {
+		props[i].consensus()
+	}
+	return props
+}
+
+// propagationAnswer reduces a response to a comparable answer. Only the
+// records of the queried type count, so resolvers that return the CNAME
+// chain and ones that don't still agree. ttl is the lowest TTL of those
+// records, or -1 if there were none.
+func propagationAnswer(rsp resolvers.Response, q dns.Question) (answer string, ttl int) {
+	qtype := dns.TypeToString[q.Qtype]
+	var values []string
+	ttl = -1
+	for _, a := range rsp.Answers {
+		if a.Type != qtype && q.Qtype != dns.TypeANY {
+			continue
+		}
+		values = append(values, a.Address)
+		if t, err := strconv.Atoi(strings.TrimSuffix(a.TTL, "s")); err == nil && (ttl < 0 || t < ttl) {
+			ttl = t
+		}
+	}
+	if len(values) == 0 {
+		// Fall back to the whole chain, then to the response code.
+		for _, a := range rsp.Answers {
+			values = append(values, a.Type+" "+a.Address)
+		}
+	}
+	if len(values) == 0 {
+		// The response code is only known from the SOA of a negative answer.
+		if len(rsp.Authorities) == 0 {
+			return "no answers", -1
+		}
+		if status := rsp.Authorities[0].Status; status != dns.RcodeToString[dns.RcodeSuccess] {
+			return status, -1
+		}
+		return "NODATA", -1
+	}
+	sort.Strings(values)
+	return strings.Join(values, ", "), ttl
+}
+
+// responseRTT returns how long a response took, which is only recorded on
+// its records.
+func responseRTT(rsp resolvers.Response) string {
+	if len(rsp.Answers) > 0 {
+		return rsp.Answers[0].RTT
+	}
+	if len(rsp.Authorities) > 0 {
+		return rsp.Authorities[0].RTT
+	}
+	return ""
+}
+
+// consensus picks the answer returned by most resolvers, preferring the one
+// listed first in the catalogue on a tie, and marks who agrees with it.
+func (p *Propagation) consensus() {
+	counts := make(map[string]int)
+	maxTTL := make(map[string]int)
+	for _, res := range p.Results {
+		if res.Error != "" {
+			continue
+		}
+		p.Answered++
+		counts[res.Answer]++
+		maxTTL[res.Answer] = max(maxTTL[res.Answer], res.ttl)
+		if counts[res.Answer] > counts[p.Consensus] || p.Consensus == "" {
+			p.Consensus = res.Answer
+		}
+	}
+	p.Agreeing = counts[p.Consensus]
+	for i := range p.Results {
+		res := &p.Results[i]
+		if res.Error != "" {
+			continue
+		}
+		res.Agrees = res.Answer == p.Consensus
+		if top := maxTTL[res.Answer]; top > 0 && res.ttl >= 0 {
+			res.Remaining = res.ttl * 100 / top
+		}
+	}
+}
+
+// OutputPropagation displays the consensus of every question.
+func (app *App) OutputPropagation(props []Propagation) {
+	if app.QueryFlags.ShowJSON {
+		jsonOutput := struct {
+			Propagation []Propagation `json:"propagation"`
+		}{
+			Propagation: props,
+		}
+		// Pretty print with 4 spaces.
+		res, err := json.MarshalIndent(jsonOutput, "", "    ")
+		if err != nil {
+			app.Logger.Error("unable to output data in JSON", "error", err)
+			os.Exit(-1)
+		}
+		fmt.Printf("%s\n", res)
+		return
+	}
+	if app.QueryFlags.ShortOutput {
+		for _, p := range props {
+			fmt.Println(p.Consensus)
+		}
+		return
+	}
+
+	// Disables colorized output if user specified.
+	if !app.QueryFlags.Color {
+		color.NoColor = true
+	}
+
+	for i, p := range props {
+		if i > 0 {
+			fmt.Println()
+		}
+		summary := fmt.Sprintf("%s %s across %d resolvers (catalogue %s)", TerminalColorGreen(p.Name), getColoredType(p.Type), p.Total, p.Catalogue)
+		fmt.Println(summary)
+		if p.Answered == 0 {
+			fmt.Println(TerminalColorRed("No resolver answered"))
+		} else {
+			share := TerminalColorGreen
+			if p.Agreeing < p.Answered {
+				share = TerminalColorYellow
+			}
+			fmt.Printf("Consensus: %s (%s of %d answering resolvers)\n", TerminalColorCyan(p.Consensus), share(fmt.Sprintf("%d", p.Agreeing)), p.Answered)
+		}
+		fmt.Println()
+
+		table := newTable()
+		header := []interface{}{"Operator", "Region", "Protocol", "Nameserver", "Answer", "TTL"}
+		if app.QueryFlags.DisplayTimeTaken {
+			header = append(header, "Time Taken")
+		}
+		table.Header(header...)
+		for _, res := range p.Results {
+			answer := TerminalColorGreen(res.Answer)
+			switch {
+			case res.Error != "":
+				answer = TerminalColorRed("error: " + res.Error)
+			case !res.Agrees:
+				answer = TerminalColorRed(res.Answer)
+			}
+			ttl := res.TTL
+			if res.TTL != "" {
+				ttl = fmt.Sprintf("%s (%d%%)", res.TTL, res.Remaining)
+			}
+			row := []string{res.Operator, res.Region, res.Protocol, res.Nameserver, answer, ttl}
+			if app.QueryFlags.DisplayTimeTaken {
+				row = append(row, res.RTT)
+			}
+			table.Append(row)
+		}
+		table.Render()
+	}
+}
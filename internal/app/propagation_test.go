@@ -0,0 +1,108 @@
+package app
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/pkg/models"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+)
+
+// standInResolver starts a UDP server that answers every A query with
+// address and ttl, standing in for a public resolver.
+func standInResolver(t *testing.T, operator, address string, ttl int) models.PublicResolver {
+	t.Helper()
+	port := startTraceServer(t, "127.0.0.1", 0, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = append(m.Answer,
+			mustRR(t, req.Question[0].Name+" "+strconv.Itoa(ttl)+" IN CNAME edge.example.net."),
+			mustRR(t, "edge.example.net. "+strconv.Itoa(ttl)+" IN A "+address))
+		_ = w.WriteMsg(m)
+	})
+	return models.PublicResolver{
+		Operator:   operator,
+		Region:     models.RegionGlobal,
+		Nameserver: models.Nameserver{Type: models.UDPResolver, Address: net.JoinHostPort("127.0.0.1", strconv.Itoa(port))},
+	}
+}
+
+func TestPropagationConsensus(t *testing.T) {
+	// A listener that is closed straight away gives an address nothing
+	// answers on.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	dead := conn.LocalAddr().String()
+	conn.Close()
+
+	catalogue := []models.PublicResolver{
+		standInResolver(t, "Fresh", "192.0.2.2", 300),
+		standInResolver(t, "Cached", "192.0.2.2", 150),
+		standInResolver(t, "Stale", "192.0.2.1", 60),
+		standInResolver(t, "Fresh too", "192.0.2.2", 300),
+		{Operator: "Down", Region: models.RegionEurope, Nameserver: models.Nameserver{Type: models.UDPResolver, Address: dead}},
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	a := New(logger, nil, "test")
+	a.Questions = []dns.Question{{Name: "www.example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}}
+	opts := resolvers.Options{Logger: logger, Timeout: time.Second, Strategy: "all"}
+
+	props := a.Propagation(context.Background(), catalogue, "test", opts, resolvers.QueryFlags{RD: true})
+	if len(props) != 1 {
+		t.Fatalf("Propagation() returned %d results, want 1", len(props))
+	}
+	p := props[0]
+	if p.Consensus != "192.0.2.2" || p.Agreeing != 3 || p.Answered != 4 || p.Total != 5 {
+		t.Fatalf("consensus = %q from %d of %d answering (%d total), want 192.0.2.2 from 3 of 4 (5 total)",
+			p.Consensus, p.Agreeing, p.Answered, p.Total)
+	}
+
+	want := []struct {
+		agrees    bool
+		ttl       string
+		remaining int
+		failed    bool
+	}{
+		{true, "300s", 100, false},
+		{true, "150s", 50, false},
+		{false, "60s", 100, false},
+		{true, "300s", 100, false},
+		{false, "", 0, true},
+	}
+	for i, w := range want {
+		res := p.Results[i]
+		if res.Agrees != w.agrees || res.TTL != w.ttl || res.Remaining != w.remaining || (res.Error != "") != w.failed {
+			t.Errorf("%s = agrees %v ttl %q remaining %d error %q, want agrees %v ttl %q remaining %d failed %v",
+				res.Operator, res.Agrees, res.TTL, res.Remaining, res.Error, w.agrees, w.ttl, w.remaining, w.failed)
+		}
+	}
+}
+
+func TestPropagationAnswer(t *testing.T) {
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	rsp := resolvers.Response{Answers: []resolvers.Answer{
+		{Type: "A", Address: "192.0.2.9", TTL: "30s"},
+		{Type: "A", Address: "192.0.2.1", TTL: "20s"},
+	}}
+	if answer, ttl := propagationAnswer(rsp, q); answer != "192.0.2.1, 192.0.2.9" || ttl != 20 {
+		t.Errorf("propagationAnswer() = %q, %d, want sorted values and the lowest TTL", answer, ttl)
+	}
+
+	nx := resolvers.Response{Authorities: []resolvers.Authority{{Type: "SOA", Status: "NXDOMAIN"}}}
+	if answer, _ := propagationAnswer(nx, q); answer != "NXDOMAIN" {
+		t.Errorf("propagationAnswer(NXDOMAIN) = %q, want NXDOMAIN", answer)
+	}
+	nodata := resolvers.Response{Authorities: []resolvers.Authority{{Type: "SOA", Status: "NOERROR"}}}
+	if answer, _ := propagationAnswer(nodata, q); answer != "NODATA" {
+		t.Errorf("propagationAnswer(NODATA) = %q, want NODATA", answer)
+	}
+}
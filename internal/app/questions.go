@@ -13,7 +13,9 @@ import (
 // that are not specified by the user but necessary
 // for the resolver.
 func (app *App) LoadFallbacks() {
-	if app.QueryFlags.QueryAny {
+	if app.QueryFlags.IXFRSerial > 0 && len(app.QueryFlags.QTypes) == 0 {
+		app.QueryFlags.QTypes = []string{"IXFR"}
+	} else if app.QueryFlags.QueryAny {
 		app.QueryFlags.QTypes = models.GetCommonRecordTypes()
 	} else if len(app.QueryFlags.QTypes) == 0 {
 		if app.QueryFlags.UseIPv4 {
@@ -0,0 +1,153 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/pkg/models"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+)
+
+// Route sends the questions for the names under a domain to their own
+// nameservers, for split DNS. Routes are written as
+// `*.corp.example -> @10.0.0.53 @10.0.0.54`.
+type Route struct {
+	Rule        string
+	Suffix      string
+	Nameservers []models.Nameserver
+	Resolvers   []resolvers.Resolver
+}
+
+// Lookup is a set of questions along with the resolvers they're sent to.
+type Lookup struct {
+	Questions []dns.Question
+	Resolvers []resolvers.Resolver
+}
+
+// ParseRoute parses a routing rule. The domain may start with `*.`, which
+// means the same as without it: the domain and every name under it. The
+// nameservers may be aliases or groups.
+func ParseRoute(rule string) (suffix string, nameservers []string, err error) {
+	pattern, servers, ok := strings.Cut(rule, "->")
+	if !ok {
+		return "", nil, fmt.Errorf("invalid route %q: want DOMAIN -> @NAMESERVER", rule)
+	}
+	suffix = strings.ToLower(strings.TrimSpace(pattern))
+	suffix = strings.TrimSuffix(strings.TrimPrefix(suffix, "*."), ".")
+	if suffix == "" || strings.Contains(suffix, "*") {
+		return "", nil, fmt.Errorf("invalid route %q: the domain must be a name, optionally starting with *.", rule)
+	}
+	for _, s := range strings.Fields(servers) {
+		nameservers = append(nameservers, strings.TrimPrefix(s, "@"))
+	}
+	if len(nameservers) == 0 {
+		return "", nil, fmt.Errorf("invalid route %q: no nameserver", rule)
+	}
+	return suffix, nameservers, nil
+}
+
+// loadRoutes parses the routing rules and keeps the ones that match at least
+// one question. The most specific rule wins when several match.
+func (app *App) loadRoutes() error {
+	app.Routes = nil
+	for _, rule := range app.QueryFlags.Routes {
+		suffix, servers, err := ParseRoute(rule)
+		if err != nil {
+			return err
+		}
+		route := Route{Rule: strings.TrimSpace(rule), Suffix: suffix}
+		for _, srv := range app.expandNameservers(servers) {
+			ns, err := initNameserver(srv)
+			if err != nil {
+				return fmt.Errorf("error parsing nameserver of route %q: %s", route.Rule, srv)
+			}
+			route.Nameservers = append(route.Nameservers, ns)
+		}
+		app.Routes = append(app.Routes, route)
+	}
+
+	// Only keep the routes that are used.
+	used := make(map[int]bool)
+	for _, q := range app.Questions {
+		if i := app.questionRoute(q.Name); i >= 0 {
+			app.Logger.Debug("Question matched route", "name", q.Name, "type", dns.TypeToString[q.Qtype], "rule", app.Routes[i].Rule, "nameservers", app.Routes[i].Nameservers)
+			used[i] = true
+		}
+	}
+	routes := app.Routes[:0]
+	for i, r := range app.Routes {
+		if used[i] {
+			routes = append(routes, r)
+		}
+	}
+	app.Routes = routes
+	return nil
+}
+
+// questionRoute returns the index of the route of a question for name, or -1.
+// A name tried with the search list before it's tried as given is routed by
+// the first completed name that matches a route, eg `db` by `*.corp.example`
+// with `search corp.example`.
+func (app *App) questionRoute(name string) int {
+	for _, n := range resolvers.SearchNames(name, app.ResolverOpts.Ndots, app.ResolverOpts.SearchList) {
+		if i := app.routeIndex(n); i >= 0 || n == dns.Fqdn(name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// routeIndex returns the index of the most specific route for name, or -1.
+func (app *App) routeIndex(name string) int {
+	name = strings.TrimSuffix(strings.ToLower(name), ".")
+	best := -1
+	for i, r := range app.Routes {
+		if name != r.Suffix && !strings.HasSuffix(name, "."+r.Suffix) {
+			continue
+		}
+		if best < 0 || len(r.Suffix) > len(app.Routes[best].Suffix) {
+			best = i
+		}
+	}
+	return best
+}
+
+// allRouted reports whether every question is sent to the nameservers of a
+// route, in which case the default ones aren't needed.
+func (app *App) allRouted() bool {
+	if len(app.Routes) == 0 {
+		return false
+	}
+	for _, q := range app.Questions {
+		if app.questionRoute(q.Name) < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookups groups the questions by the resolvers they're sent to: the ones of
+// the route they match, or app.Resolvers.
+func (app *App) Lookups() []Lookup {
+	if len(app.Routes) == 0 {
+		return []Lookup{{Questions: app.Questions, Resolvers: app.Resolvers}}
+	}
+	lookups := make([]Lookup, len(app.Routes)+1)
+	lookups[0].Resolvers = app.Resolvers
+	for i, r := range app.Routes {
+		lookups[i+1].Resolvers = r.Resolvers
+	}
+	for _, q := range app.Questions {
+		i := app.questionRoute(q.Name) + 1
+		lookups[i].Questions = append(lookups[i].Questions, q)
+	}
+
+	out := lookups[:0]
+	for _, l := range lookups {
+		if len(l.Questions) > 0 {
+			out = append(out, l)
+		}
+	}
+	return out
+}
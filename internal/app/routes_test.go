@@ -0,0 +1,136 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/pkg/models"
+)
+
+func TestParseRoute(t *testing.T) {
+	tests := []struct {
+		rule        string
+		suffix      string
+		nameservers []string
+		wantErr     bool
+	}{
+		{rule: "*.corp.example -> @10.0.0.53", suffix: "corp.example", nameservers: []string{"10.0.0.53"}},
+		{rule: "Consul. -> @127.0.0.1:8600 tls://10.0.0.1", suffix: "consul", nameservers: []string{"127.0.0.1:8600", "tls://10.0.0.1"}},
+		{rule: "*.corp.example @10.0.0.53", wantErr: true},
+		{rule: "*.corp.example ->", wantErr: true},
+		{rule: "-> @10.0.0.53", wantErr: true},
+		{rule: "corp.*.example -> @10.0.0.53", wantErr: true},
+	}
+	for _, tt := range tests {
+		suffix, nameservers, err := ParseRoute(tt.rule)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseRoute(%q) error = nil, want error", tt.rule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseRoute(%q) error = %v", tt.rule, err)
+			continue
+		}
+		if suffix != tt.suffix || len(nameservers) != len(tt.nameservers) {
+			t.Errorf("ParseRoute(%q) = %q, %v, want %q, %v", tt.rule, suffix, nameservers, tt.suffix, tt.nameservers)
+			continue
+		}
+		for i := range nameservers {
+			if nameservers[i] != tt.nameservers[i] {
+				t.Errorf("ParseRoute(%q) nameservers = %v, want %v", tt.rule, nameservers, tt.nameservers)
+			}
+		}
+	}
+}
+
+func TestLoadNameserversRoutesQuestions(t *testing.T) {
+	app := newTestApp()
+	app.QueryFlags.Aliases = map[string]string{"vpn": "tls://10.0.0.53"}
+	app.QueryFlags.Routes = []string{
+		"*.corp.example -> @10.0.0.53",
+		"*.eu.corp.example -> @vpn",
+		"*.consul -> @127.0.0.1:8600",
+	}
+	app.QueryFlags.Nameservers = []string{"1.1.1.1"}
+	app.Questions = []dns.Question{
+		{Name: "www.corp.example.", Qtype: dns.TypeA},
+		{Name: "db.eu.corp.example.", Qtype: dns.TypeA},
+		{Name: "example.com.", Qtype: dns.TypeA},
+		{Name: "notcorp.example.", Qtype: dns.TypeA},
+	}
+
+	if err := app.LoadNameservers(); err != nil {
+		t.Fatalf("LoadNameservers() error = %v", err)
+	}
+
+	// The unused consul route is dropped.
+	if len(app.Routes) != 2 {
+		t.Fatalf("len(Routes) = %d, want 2", len(app.Routes))
+	}
+	assertNameservers(t, app.Nameservers, []models.Nameserver{{Address: "1.1.1.1:53", Type: models.UDPResolver}})
+	assertNameservers(t, app.Routes[0].Nameservers, []models.Nameserver{{Address: "10.0.0.53:53", Type: models.UDPResolver}})
+	assertNameservers(t, app.Routes[1].Nameservers, []models.Nameserver{{Address: "10.0.0.53:853", Type: models.DOTResolver}})
+
+	lookups := app.Lookups()
+	if len(lookups) != 3 {
+		t.Fatalf("len(Lookups()) = %d, want 3", len(lookups))
+	}
+	want := [][]string{
+		{"example.com.", "notcorp.example."},
+		{"www.corp.example."},
+		{"db.eu.corp.example."},
+	}
+	for i, l := range lookups {
+		if len(l.Questions) != len(want[i]) {
+			t.Fatalf("lookup %d questions = %v, want %v", i, l.Questions, want[i])
+		}
+		for j, q := range l.Questions {
+			if q.Name != want[i][j] {
+				t.Errorf("lookup %d question %d = %s, want %s", i, j, q.Name, want[i][j])
+			}
+		}
+	}
+}
+
+func TestLoadNameserversSkipsDefaultsWhenEveryQuestionIsRouted(t *testing.T) {
+	app := newTestApp()
+	app.QueryFlags.Routes = []string{"*.consul -> @127.0.0.1:8600"}
+	app.Questions = []dns.Question{{Name: "web.service.consul.", Qtype: dns.TypeA}}
+
+	if err := app.LoadNameservers(); err != nil {
+		t.Fatalf("LoadNameservers() error = %v", err)
+	}
+	if len(app.Nameservers) != 0 {
+		t.Errorf("Nameservers = %v, want none", app.Nameservers)
+	}
+	if lookups := app.Lookups(); len(lookups) != 1 || len(lookups[0].Questions) != 1 {
+		t.Errorf("Lookups() = %+v, want the routed question only", lookups)
+	}
+}
+
+func TestLookupsRouteSearchListNames(t *testing.T) {
+	app := newTestApp()
+	app.ResolverOpts.Ndots = 1
+	app.ResolverOpts.SearchList = []string{"corp.example"}
+	app.Routes = []Route{{Rule: "*.corp.example -> @10.0.0.53", Suffix: "corp.example"}}
+	app.Questions = []dns.Question{
+		{Name: "db", Qtype: dns.TypeA},
+		{Name: "example.com", Qtype: dns.TypeA},
+		{Name: "db.", Qtype: dns.TypeA},
+	}
+
+	// db is sent as db.corp.example first, example.com as given first and
+	// db. only as given.
+	lookups := app.Lookups()
+	if len(lookups) != 2 {
+		t.Fatalf("len(Lookups()) = %d, want 2", len(lookups))
+	}
+	if got := lookups[1].Questions; len(got) != 1 || got[0].Name != "db" {
+		t.Errorf("routed questions = %v, want db", got)
+	}
+	if got := lookups[0].Questions; len(got) != 2 || got[0].Name != "example.com" || got[1].Name != "db." {
+		t.Errorf("default questions = %v, want example.com and db.", got)
+	}
+}
@@ -0,0 +1,374 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/pkg/models"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+)
+
+// maxTraceHops bounds the number of referrals followed for a single question
+// so a referral loop between misconfigured servers cannot run forever.
+const maxTraceHops = 30
+
+// traceNameserverPort is the port used to reach root servers and every
+// server learned from a referral. Tests override it to run a local hierarchy.
+var traceNameserverPort = models.DefaultUDPPort
+
+// rootHints is the IANA root server list (https://www.internic.net/domain/named.root)
+// used as the starting point of a trace.
+var rootHints = []traceServer{
+	{Name: "a.root-servers.net.", Addrs: []string{"198.41.0.4", "2001:503:ba3e::2:30"}},
+	{Name: "b.root-servers.net.", Addrs: []string{"170.247.170.2", "2801:1b8:10::b"}},
+	{Name: "c.root-servers.net.", Addrs: []string{"192.33.4.12", "2001:500:2::c"}},
+	{Name: "d.root-servers.net.", Addrs: []string{"199.7.91.13", "2001:500:2d::d"}},
+	{Name: "e.root-servers.net.", Addrs: []string{"192.203.230.10", "2001:500:a8::e"}},
+	{Name: "f.root-servers.net.", Addrs: []string{"192.5.5.241", "2001:500:2f::f"}},
+	{Name: "g.root-servers.net.", Addrs: []string{"192.112.36.4", "2001:500:12::d0d"}},
+	{Name: "h.root-servers.net.", Addrs: []string{"198.97.190.53", "2001:500:1::53"}},
+	{Name: "i.root-servers.net.", Addrs: []string{"192.36.148.17", "2001:7fe::53"}},
+	{Name: "j.root-servers.net.", Addrs: []string{"192.58.128.30", "2001:503:c27::2:30"}},
+	{Name: "k.root-servers.net.", Addrs: []string{"193.0.14.129", "2001:7fd::1"}},
+	{Name: "l.root-servers.net.", Addrs: []string{"199.7.83.42", "2001:500:9f::42"}},
+	{Name: "m.root-servers.net.", Addrs: []string{"202.12.27.33", "2001:dc3::35"}},
+}
+
+// traceServer is a nameserver learned from the root hints or a referral,
+// along with any glue addresses that came with it.
+type traceServer struct {
+	Name  string
+	Addrs []string
+}
+
+// TraceHop describes a single step of an iterative resolution: which server
+// was asked, how long it took and what it sent back.
+type TraceHop struct {
+	Zone         string              `json:"zone"`
+	Nameserver   string              `json:"nameserver"`
+	Address      string              `json:"address"`
+	RTT          string              `json:"rtt"`
+	Status       string              `json:"status"`
+	ReferralZone string              `json:"referral_zone,omitempty"`
+	Referral     []string            `json:"referral,omitempty"`
+	Response     *resolvers.Response `json:"response,omitempty"`
+}
+
+// TraceResult holds every hop walked to resolve a single question.
+type TraceResult struct {
+	Question resolvers.Question `json:"question"`
+	Hops     []TraceHop         `json:"hops"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// Trace resolves every prepared question iteratively, starting at the root
+// servers and following referrals down to the authoritative server, in the
+// spirit of `dig +trace`. Results are returned for every question, even
+// when some of them fail; the returned error joins the individual failures.
+// The queries are sent with opts, from its source and through its proxy, over
+// TCP then.
+func (app *App) Trace(ctx context.Context, opts resolvers.Options) ([]TraceResult, error) {
+	// The root and TLD servers don't know the key of the user.
+	opts.TSIG = nil
+	var (
+		results = make([]TraceResult, 0, len(app.Questions))
+		errs    []error
+	)
+	for _, q := range app.Questions {
+		res, err := app.traceQuestion(ctx, opts, q)
+		if err != nil {
+			res.Error = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", res.Question.Name, err))
+		}
+		results = append(results, res)
+	}
+	return results, errors.Join(errs...)
+}
+
+func (app *App) traceQuestion(ctx context.Context, opts resolvers.Options, q dns.Question) (TraceResult, error) {
+	res := TraceResult{
+		Question: resolvers.Question{
+			Name:  dns.Fqdn(q.Name),
+			Type:  dns.TypeToString[q.Qtype],
+			Class: dns.ClassToString[q.Qclass],
+		},
+	}
+
+	zone := "."
+	servers := rootHints
+	for range maxTraceHops {
+		in, srv, addr, rtt, err := app.traceExchange(ctx, opts, q, servers)
+		if err != nil {
+			return res, fmt.Errorf("no nameserver for zone %q answered: %w", zone, err)
+		}
+
+		hop := TraceHop{
+			Zone:       zone,
+			Nameserver: strings.TrimSuffix(srv.Name, "."),
+			Address:    addr,
+			RTT:        fmt.Sprintf("%dms", rtt.Milliseconds()),
+			Status:     dns.RcodeToString[in.Rcode],
+		}
+
+		referralZone, next := parseReferral(in)
+		if len(in.Answer) > 0 || in.Rcode != dns.RcodeSuccess || len(next) == 0 {
+			rsp := resolvers.ParseMessage(in, rtt, addr)
+			hop.Response = &rsp
+			res.Hops = append(res.Hops, hop)
+			return res, nil
+		}
+
+		// A referral must move strictly closer to the question name, otherwise
+		// the server is lame or sending us back up the tree.
+		if referralZone == zone || !dns.IsSubDomain(zone, referralZone) {
+			res.Hops = append(res.Hops, hop)
+			return res, fmt.Errorf("%s sent an upward referral to %q", hop.Nameserver, referralZone)
+		}
+
+		hop.ReferralZone = referralZone
+		for _, s := range next {
+			hop.Referral = append(hop.Referral, strings.TrimSuffix(s.Name, "."))
+		}
+		res.Hops = append(res.Hops, hop)
+
+		app.Logger.Debug("Following referral",
+			"zone", zone,
+			"referral_zone", referralZone,
+			"nameserver", hop.Nameserver,
+			"referral", hop.Referral,
+		)
+		zone, servers = referralZone, next
+	}
+	return res, fmt.Errorf("gave up after %d referrals", maxTraceHops)
+}
+
+// traceExchange sends the non-recursive query to the first server in servers
+// that answers, resolving glueless nameservers via the system resolver.
+func (app *App) traceExchange(ctx context.Context, opts resolvers.Options, q dns.Question, servers []traceServer) (*dns.Msg, traceServer, string, time.Duration, error) {
+	var lastErr error
+	for _, srv := range servers {
+		addrs := app.filterTraceAddrs(srv.Addrs)
+		if len(addrs) == 0 {
+			resolved, err := app.resolveTraceServer(ctx, opts, srv.Name)
+			if err != nil {
+				app.Logger.Debug("Unable to resolve glueless nameserver", "ns", srv.Name, "error", err)
+				lastErr = err
+				continue
+			}
+			addrs = resolved
+		}
+
+		for _, ip := range addrs {
+			addr := net.JoinHostPort(ip, traceNameserverPort)
+
+			m := new(dns.Msg)
+			m.SetQuestion(dns.Fqdn(q.Name), q.Qtype)
+			m.Question[0].Qclass = q.Qclass
+			m.RecursionDesired = false
+
+			in, rtt, err := traceQuery(ctx, opts, m, addr)
+			if err != nil {
+				app.Logger.Debug("Trace query failed", "ns", srv.Name, "address", addr, "error", err)
+				lastErr = err
+				continue
+			}
+			return in, srv, addr, rtt, nil
+		}
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no usable nameserver addresses")
+	}
+	return nil, traceServer{}, "", 0, lastErr
+}
+
+// traceQuery exchanges m with addr over UDP with a ClassicResolver, which
+// retries over TCP when the answer is truncated, or over TCP when the queries
+// go through a proxy.
+func traceQuery(ctx context.Context, opts resolvers.Options, m *dns.Msg, addr string) (*dns.Msg, time.Duration, error) {
+	rslvr, err := resolvers.NewClassicResolver(addr, resolvers.ClassicResolverOpts{UseTCP: opts.Dialer != nil}, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	r, ok := rslvr.(*resolvers.ClassicResolver)
+	if !ok {
+		return nil, 0, fmt.Errorf("unexpected resolver %T for %s", rslvr, addr)
+	}
+	defer r.Close()
+	now := time.Now()
+	in, err := r.Exchange(ctx, m)
+	if err != nil {
+		return nil, 0, err
+	}
+	return in, time.Since(now), nil
+}
+
+// resolveTraceServer looks up the addresses of a nameserver that was
+// delegated to without glue, using the system resolver.
+func (app *App) resolveTraceServer(ctx context.Context, opts resolvers.Options, name string) ([]string, error) {
+	resolver, err := systemResolverAddr()
+	if err != nil {
+		return nil, err
+	}
+
+	qtype := dns.TypeA
+	if app.QueryFlags.UseIPv6 {
+		qtype = dns.TypeAAAA
+	}
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = true
+
+	in, _, err := traceQuery(ctx, opts, m, resolver)
+	if err != nil {
+		return nil, err
+	}
+
+	var addrs []string
+	for _, rr := range in.Answer {
+		switch v := rr.(type) {
+		case *dns.A:
+			addrs = append(addrs, v.A.String())
+		case *dns.AAAA:
+			addrs = append(addrs, v.AAAA.String())
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %q", strings.TrimSuffix(name, "."))
+	}
+	return addrs, nil
+}
+
+// filterTraceAddrs keeps IPv4 addresses unless -6 was requested, in which
+// case only IPv6 addresses are kept. IPv4 is the default because plenty of
+// hosts have no working IPv6 route to the root servers.
+func (app *App) filterTraceAddrs(addrs []string) []string {
+	filtered := make([]string, 0, len(addrs))
+	for _, a := range addrs {
+		if app.QueryFlags.UseIPv6 {
+			if isIPv6(a) {
+				filtered = append(filtered, a)
+			}
+			continue
+		}
+		if isIPv4(a) {
+			filtered = append(filtered, a)
+		}
+	}
+	return filtered
+}
+
+// parseReferral extracts the delegated zone and its nameservers, with any
+// glue from the additional section, from a referral response.
+func parseReferral(in *dns.Msg) (string, []traceServer) {
+	names := nsNames(in.Ns)
+	if len(names) == 0 {
+		return "", nil
+	}
+
+	var zone string
+	for _, rr := range in.Ns {
+		if ns, ok := rr.(*dns.NS); ok {
+			zone = ns.Hdr.Name
+			break
+		}
+	}
+
+	glue := make(map[string][]string)
+	for _, rr := range in.Extra {
+		switch v := rr.(type) {
+		case *dns.A:
+			glue[strings.ToLower(v.Hdr.Name)] = append(glue[strings.ToLower(v.Hdr.Name)], v.A.String())
+		case *dns.AAAA:
+			glue[strings.ToLower(v.Hdr.Name)] = append(glue[strings.ToLower(v.Hdr.Name)], v.AAAA.String())
+		}
+	}
+
+	servers := make([]traceServer, 0, len(names))
+	for _, name := range names {
+		servers = append(servers, traceServer{Name: name, Addrs: glue[strings.ToLower(name)]})
+	}
+	return zone, servers
+}
+
+// OutputTrace renders the result of Trace in the configured output format.
+func (app *App) OutputTrace(results []TraceResult) {
+	if app.QueryFlags.ShowJSON {
+		app.outputTraceJSON(results)
+	} else if app.QueryFlags.ShortOutput {
+		for _, res := range results {
+			if len(res.Hops) == 0 {
+				continue
+			}
+			if rsp := res.Hops[len(res.Hops)-1].Response; rsp != nil {
+				app.outputShort([]resolvers.Response{*rsp})
+			}
+		}
+	} else {
+		app.outputTraceTerminal(results)
+	}
+}
+
+func (app *App) outputTraceJSON(results []TraceResult) {
+	jsonOutput := struct {
+		Traces []TraceResult `json:"traces"`
+	}{
+		Traces: results,
+	}
+
+	// Pretty print with 4 spaces.
+	res, err := json.MarshalIndent(jsonOutput, "", "    ")
+	if err != nil {
+		app.Logger.Error("unable to output data in JSON", "error", err)
+		os.Exit(-1)
+	}
+	fmt.Printf("%s\n", res)
+}
+
+func (app *App) outputTraceTerminal(results []TraceResult) {
+	// Disables colorized output if user specified.
+	if !app.QueryFlags.Color {
+		color.NoColor = true
+	}
+
+	for i, res := range results {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s %s %s\n", TerminalColorYellow("Trace:"), TerminalColorGreen(res.Question.Name), getColoredType(res.Question.Type))
+
+		table := newTable()
+		table.Header("Zone", "Nameserver", "Address", "RTT", "Status", "Referral")
+		var final *resolvers.Response
+		for _, hop := range res.Hops {
+			status := hop.Status
+			if dns.StringToRcode[status] != dns.RcodeSuccess {
+				status = TerminalColorRed(status)
+			}
+			referral := ""
+			if hop.ReferralZone != "" {
+				referral = hop.ReferralZone + " " + strings.Join(hop.Referral, " ")
+			}
+			table.Append([]string{TerminalColorCyan(hop.Zone), hop.Nameserver, hop.Address, hop.RTT, status, referral})
+			if hop.Response != nil {
+				final = hop.Response
+			}
+		}
+		table.Render()
+
+		if final != nil && (len(final.Answers) > 0 || len(final.Authorities) > 0) {
+			fmt.Println()
+			app.outputTerminal([]resolvers.Response{*final})
+		}
+		if res.Error != "" {
+			fmt.Printf("%s %s\n", TerminalColorRed("Error:"), res.Error)
+		}
+	}
+}
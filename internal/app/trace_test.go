@@ -0,0 +1,180 @@
+package app
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+)
+
+// startTraceServer serves handler over UDP on ip:port. A port of 0 picks a
+// free one; the bound port is returned so the rest of the hierarchy can
+// share it.
+func startTraceServer(t *testing.T, ip string, port int, handler dns.HandlerFunc) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP(ip), Port: port})
+	if err != nil {
+		t.Skipf("unable to listen on %s:%d: %v", ip, port, err)
+	}
+	srv := &dns.Server{PacketConn: conn, Handler: handler}
+	ready := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(ready) }
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	select {
+	case <-ready:
+	case <-time.After(2 * time.Second):
+		t.Fatal("DNS test server did not start within 2s")
+	}
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("dns.NewRR(%q): %v", s, err)
+	}
+	return rr
+}
+
+// TestTraceFollowsReferralsToAuthoritativeServer runs a three level
+// hierarchy (root -> test. -> example.test.) on loopback addresses and checks
+// every hop is recorded with the referral it returned.
+func TestTraceFollowsReferralsToAuthoritativeServer(t *testing.T) {
+	port := startTraceServer(t, "127.0.0.1", 0, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Ns = append(m.Ns, mustRR(t, "test. 172800 IN NS ns.test."))
+		m.Extra = append(m.Extra, mustRR(t, "ns.test. 172800 IN A 127.0.0.2"))
+		_ = w.WriteMsg(m)
+	})
+	startTraceServer(t, "127.0.0.2", port, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Ns = append(m.Ns, mustRR(t, "example.test. 3600 IN NS ns1.example.test."))
+		m.Extra = append(m.Extra, mustRR(t, "ns1.example.test. 3600 IN A 127.0.0.3"))
+		_ = w.WriteMsg(m)
+	})
+	startTraceServer(t, "127.0.0.3", port, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Authoritative = true
+		if req.RecursionDesired {
+			m.Rcode = dns.RcodeRefused
+		} else {
+			m.Answer = append(m.Answer, mustRR(t, "www.example.test. 300 IN A 192.0.2.1"))
+		}
+		_ = w.WriteMsg(m)
+	})
+
+	origHints, origPort := rootHints, traceNameserverPort
+	t.Cleanup(func() { rootHints, traceNameserverPort = origHints, origPort })
+	rootHints = []traceServer{{Name: "root.test.", Addrs: []string{"127.0.0.1"}}}
+	traceNameserverPort = strconv.Itoa(port)
+
+	app := newTestApp()
+	app.Questions = []dns.Question{{Name: "www.example.test.", Qtype: dns.TypeA, Qclass: dns.ClassINET}}
+
+	results, err := app.Trace(context.Background(), resolvers.Options{Logger: app.Logger, Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("Trace() error = %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("len(results) = %d, want 1", len(results))
+	}
+
+	hops := results[0].Hops
+	if len(hops) != 3 {
+		t.Fatalf("len(hops) = %d, want 3: %#v", len(hops), hops)
+	}
+
+	wantZones := []string{".", "test.", "example.test."}
+	wantReferrals := []string{"test.", "example.test.", ""}
+	for i, hop := range hops {
+		if hop.Zone != wantZones[i] {
+			t.Errorf("hops[%d].Zone = %q, want %q", i, hop.Zone, wantZones[i])
+		}
+		if hop.ReferralZone != wantReferrals[i] {
+			t.Errorf("hops[%d].ReferralZone = %q, want %q", i, hop.ReferralZone, wantReferrals[i])
+		}
+	}
+	if hops[1].Address != net.JoinHostPort("127.0.0.2", strconv.Itoa(port)) {
+		t.Errorf("hops[1].Address = %q, want glue address 127.0.0.2", hops[1].Address)
+	}
+
+	final := hops[2].Response
+	if final == nil || len(final.Answers) != 1 {
+		t.Fatalf("final hop response = %#v, want a single answer", final)
+	}
+	if final.Answers[0].Address != "192.0.2.1" {
+		t.Errorf("final answer = %q, want 192.0.2.1", final.Answers[0].Address)
+	}
+}
+
+func TestTraceRejectsUpwardReferral(t *testing.T) {
+	port := startTraceServer(t, "127.0.0.1", 0, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Ns = append(m.Ns, mustRR(t, ". 518400 IN NS root.test."))
+		m.Extra = append(m.Extra, mustRR(t, "root.test. 518400 IN A 127.0.0.1"))
+		_ = w.WriteMsg(m)
+	})
+
+	origHints, origPort := rootHints, traceNameserverPort
+	t.Cleanup(func() { rootHints, traceNameserverPort = origHints, origPort })
+	rootHints = []traceServer{{Name: "root.test.", Addrs: []string{"127.0.0.1"}}}
+	traceNameserverPort = strconv.Itoa(port)
+
+	app := newTestApp()
+	app.Questions = []dns.Question{{Name: "loop.test.", Qtype: dns.TypeA, Qclass: dns.ClassINET}}
+
+	results, err := app.Trace(context.Background(), resolvers.Options{Logger: app.Logger, Timeout: 2 * time.Second})
+	if err == nil {
+		t.Fatal("Trace() error = nil, want upward referral error")
+	}
+	if results[0].Error == "" {
+		t.Fatal("results[0].Error is empty, want the failure recorded per question")
+	}
+}
+
+func TestTraceSource(t *testing.T) {
+	remote := make(chan string, 1)
+	port := startTraceServer(t, "127.0.0.1", 0, func(w dns.ResponseWriter, req *dns.Msg) {
+		select {
+		case remote <- w.RemoteAddr().String():
+		default:
+		}
+		m := new(dns.Msg)
+		m.SetReply(req)
+		m.Answer = append(m.Answer, mustRR(t, "www.example.test. 300 IN A 192.0.2.1"))
+		_ = w.WriteMsg(m)
+	})
+
+	origHints, origPort := rootHints, traceNameserverPort
+	t.Cleanup(func() { rootHints, traceNameserverPort = origHints, origPort })
+	rootHints = []traceServer{{Name: "root.test.", Addrs: []string{"127.0.0.1"}}}
+	traceNameserverPort = strconv.Itoa(port)
+
+	ln, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	source := ln.LocalAddr().String()
+	ln.Close()
+
+	app := newTestApp()
+	app.Questions = []dns.Question{{Name: "www.example.test.", Qtype: dns.TypeA, Qclass: dns.ClassINET}}
+	if _, err := app.Trace(context.Background(), resolvers.Options{Logger: app.Logger, Timeout: 2 * time.Second, Source: source}); err != nil {
+		t.Fatalf("Trace() error = %v", err)
+	}
+	if got := <-remote; got != source {
+		t.Errorf("query sent from %s, want %s", got, source)
+	}
+}
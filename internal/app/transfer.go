@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/fatih/color"
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+)
+
+// IsTransfer reports whether the questions ask for a zone transfer (AXFR or
+// IXFR). A transfer can't be combined with regular lookups.
+func (app *App) IsTransfer() (bool, error) {
+	transfers := 0
+	for _, q := range app.Questions {
+		if q.Qtype == dns.TypeAXFR || q.Qtype == dns.TypeIXFR {
+			transfers++
+		}
+	}
+	if transfers > 0 && transfers != len(app.Questions) {
+		return false, errors.New("zone transfers can't be combined with other record types")
+	}
+	return transfers > 0, nil
+}
+
+// Transfer performs a zone transfer of every question from every nameserver,
+// or from the ones of the split DNS route it matches. Transfers run one after
+// another so zone-file output can be streamed as the records arrive.
+func (app *App) Transfer(ctx context.Context) ([]resolvers.TransferResponse, []error) {
+	var (
+		responses []resolvers.TransferResponse
+		errs      []error
+	)
+	for _, l := range app.Lookups() {
+		for _, r := range l.Resolvers {
+			t, ok := r.(resolvers.Transferer)
+			if !ok {
+				errs = append(errs, &resolvers.LookupError{Nameserver: r.Address(), Err: resolvers.ErrTransferUnsupported})
+				continue
+			}
+			for _, q := range l.Questions {
+				opts := resolvers.TransferOptions{Type: q.Qtype}
+				if q.Qtype == dns.TypeIXFR {
+					opts.Serial = app.QueryFlags.IXFRSerial
+				}
+
+				var fn func([]dns.RR)
+				streaming := app.QueryFlags.ZoneFile && !app.QueryFlags.ShowJSON
+				if streaming {
+					fmt.Printf("; %s %s from %s\n", dns.TypeToString[q.Qtype], dns.Fqdn(q.Name), r.Address())
+					fn = printZoneRecords
+				}
+
+				rsp, err := t.Transfer(ctx, q.Name, opts, fn)
+				if err != nil {
+					errs = append(errs, &resolvers.LookupError{Nameserver: r.Address(), Err: err})
+					continue
+				}
+				if streaming {
+					fmt.Printf("; serial %d, %d records in %d messages, %s\n\n", rsp.Serial, len(rsp.Records), rsp.Messages, rsp.RTT)
+				}
+				responses = append(responses, rsp)
+			}
+		}
+	}
+	return responses, errs
+}
+
+// printZoneRecords writes records in RFC 1035 master file format.
+func printZoneRecords(rrs []dns.RR) {
+	for _, rr := range rrs {
+		fmt.Println(rr.String())
+	}
+}
+
+// OutputTransfer displays the records of every zone transfer. Zone-file
+// output is written while the transfer runs, so there's nothing left to do.
+func (app *App) OutputTransfer(responses []resolvers.TransferResponse) {
+	if app.QueryFlags.ZoneFile {
+		return
+	}
+	if app.QueryFlags.ShortOutput {
+		for _, rsp := range responses {
+			for _, rec := range rsp.Records {
+				fmt.Println(rec.Address)
+			}
+		}
+		return
+	}
+
+	// Disables colorized output if user specified.
+	if !app.QueryFlags.Color {
+		color.NoColor = true
+	}
+
+	for i, rsp := range responses {
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("%s %s from %s (serial %d, %d records in %d messages, %s)\n",
+			TerminalColorYellow(rsp.Type), TerminalColorGreen(rsp.Zone), rsp.Nameserver,
+			rsp.Serial, len(rsp.Records), rsp.Messages, rsp.RTT)
+
+		incremental := false
+		for _, rec := range rsp.Records {
+			if rec.Change != "" {
+				incremental = true
+				break
+			}
+		}
+
+		table := newTable()
+		header := []interface{}{"Name", "Type", "Class", "TTL", "Address"}
+		if incremental {
+			header = append([]interface{}{"Change"}, header...)
+		}
+		table.Header(header...)
+		for _, rec := range rsp.Records {
+			output := []string{TerminalColorGreen(rec.Name), getColoredType(rec.Type), rec.Class, rec.TTL, rec.Address}
+			if incremental {
+				output = append([]string{getColoredChange(rec.Change)}, output...)
+			}
+			table.Append(output)
+		}
+		table.Render()
+	}
+}
+
+func getColoredChange(c string) string {
+	switch c {
+	case resolvers.TransferChangeAdd:
+		return TerminalColorGreen("+")
+	case resolvers.TransferChangeDelete:
+		return TerminalColorRed("-")
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,229 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+)
+
+// UpdateSpec describes a dynamic update (RFC 2136) as given on the command
+// line. Names may be relative to Zone.
+type UpdateSpec struct {
+	Zone string
+
+	// Prerequisites.
+	NameInUse      []string // name
+	NameNotInUse   []string // name
+	RRsetExists    []string // "name type", or a full record to also match the value
+	RRsetNotExists []string // "name type"
+
+	// Updates, applied in this order: deletions, replacements, additions.
+	Delete  []string // "name", "name type", or a full record
+	Replace []string // full record, replacing the RRset of the same name and type
+	Add     []string // full record
+}
+
+// BuildUpdate turns spec into an update message.
+func BuildUpdate(spec UpdateSpec) (*dns.Msg, error) {
+	if spec.Zone == "" {
+		return nil, fmt.Errorf("a zone to update is required")
+	}
+	zone := dns.Fqdn(spec.Zone)
+
+	msg := new(dns.Msg)
+	msg.SetUpdate(zone)
+	// EDNS lets the server explain a refusal with an Extended DNS Error.
+	msg.SetEdns0(1232, false)
+
+	for _, n := range spec.NameInUse {
+		msg.NameUsed([]dns.RR{nameRR(n, zone)})
+	}
+	for _, n := range spec.NameNotInUse {
+		msg.NameNotUsed([]dns.RR{nameRR(n, zone)})
+	}
+	for _, s := range spec.RRsetExists {
+		rr, full, err := parseRRsetSpec(s, zone)
+		if err != nil {
+			return nil, err
+		}
+		if full {
+			msg.Used([]dns.RR{rr})
+		} else {
+			msg.RRsetUsed([]dns.RR{rr})
+		}
+	}
+	for _, s := range spec.RRsetNotExists {
+		rr, full, err := parseRRsetSpec(s, zone)
+		if err != nil {
+			return nil, err
+		}
+		if full {
+			return nil, fmt.Errorf("RRset prerequisite %q can't have a value", s)
+		}
+		msg.RRsetNotUsed([]dns.RR{rr})
+	}
+
+	for _, s := range spec.Delete {
+		if len(strings.Fields(s)) == 1 {
+			msg.RemoveName([]dns.RR{nameRR(s, zone)})
+			continue
+		}
+		rr, full, err := parseRRsetSpec(s, zone)
+		if err != nil {
+			return nil, err
+		}
+		if full {
+			msg.Remove([]dns.RR{rr})
+		} else {
+			msg.RemoveRRset([]dns.RR{rr})
+		}
+	}
+
+	var inserts []dns.RR
+	replaced := make(map[string]bool)
+	for _, s := range spec.Replace {
+		rr, err := parseUpdateRR(s, zone, true)
+		if err != nil {
+			return nil, err
+		}
+		// Several records may replace the same RRset, only delete it once.
+		key := dns.CanonicalName(rr.Header().Name) + "/" + dns.TypeToString[rr.Header().Rrtype]
+		if !replaced[key] {
+			replaced[key] = true
+			msg.RemoveRRset([]dns.RR{rr})
+		}
+		inserts = append(inserts, rr)
+	}
+	for _, s := range spec.Add {
+		rr, err := parseUpdateRR(s, zone, true)
+		if err != nil {
+			return nil, err
+		}
+		inserts = append(inserts, rr)
+	}
+	if len(inserts) > 0 {
+		msg.Insert(inserts)
+	}
+
+	if len(msg.Ns) == 0 {
+		return nil, fmt.Errorf("nothing to update: use --add, --delete or --replace")
+	}
+	return msg, nil
+}
+
+// nameRR returns an empty record standing for a name.
+func nameRR(name, zone string) dns.RR {
+	return &dns.ANY{Hdr: dns.RR_Header{Name: absoluteName(name, zone), Rrtype: dns.TypeANY, Class: dns.ClassINET}}
+}
+
+// parseRRsetSpec parses either `name type` or a full record. full reports
+// whether a record with data was given.
+func parseRRsetSpec(s, zone string) (rr dns.RR, full bool, err error) {
+	fields := strings.Fields(s)
+	if len(fields) == 2 {
+		if t, ok := dns.StringToType[strings.ToUpper(fields[1])]; ok {
+			return &dns.ANY{Hdr: dns.RR_Header{Name: absoluteName(fields[0], zone), Rrtype: t, Class: dns.ClassINET}}, false, nil
+		}
+	}
+	// The TTL of a record that is matched against the zone doesn't matter.
+	rr, err = parseUpdateRR(s, zone, false)
+	return rr, true, err
+}
+
+// parseUpdateRR parses a record in zone file syntax, relative to zone. The
+// TTL may only be left out when needTTL is false.
+func parseUpdateRR(s, zone string, needTTL bool) (dns.RR, error) {
+	zp := dns.NewZoneParser(strings.NewReader(s), zone, "")
+	if !needTTL {
+		zp.SetDefaultTTL(0)
+	}
+	rr, ok := zp.Next()
+	if err := zp.Err(); err != nil {
+		return nil, fmt.Errorf("invalid record %q: %w", s, err)
+	}
+	if !ok {
+		return nil, fmt.Errorf("invalid record %q", s)
+	}
+	return rr, nil
+}
+
+// absoluteName qualifies a name relative to zone, the same way as the zone
+// file parser: names ending in a dot are absolute and @ is the zone itself.
+func absoluteName(name, zone string) string {
+	switch {
+	case name == "@":
+		return zone
+	case dns.IsFqdn(name):
+		return name
+	default:
+		return dns.Fqdn(name + "." + strings.TrimSuffix(zone, "."))
+	}
+}
+
+// Update sends msg to every nameserver.
+func (app *App) Update(ctx context.Context, msg *dns.Msg) ([]resolvers.UpdateResponse, []error) {
+	var (
+		responses []resolvers.UpdateResponse
+		errs      []error
+	)
+	for _, r := range app.Resolvers {
+		u, ok := r.(resolvers.Updater)
+		if !ok {
+			errs = append(errs, &resolvers.LookupError{Nameserver: r.Address(), Err: resolvers.ErrUpdateUnsupported})
+			continue
+		}
+		rsp, err := u.Update(ctx, msg)
+		if err != nil {
+			errs = append(errs, &resolvers.LookupError{Nameserver: r.Address(), Err: err})
+			continue
+		}
+		responses = append(responses, rsp)
+	}
+	return responses, errs
+}
+
+// OutputUpdate displays the operations and the outcome of every update.
+func (app *App) OutputUpdate(responses []resolvers.UpdateResponse) {
+	if app.QueryFlags.ShortOutput {
+		for _, rsp := range responses {
+			fmt.Println(rsp.Status)
+		}
+		return
+	}
+
+	// Disables colorized output if user specified.
+	if !app.QueryFlags.Color {
+		color.NoColor = true
+	}
+
+	for i, rsp := range responses {
+		if i > 0 {
+			fmt.Println()
+		}
+		status := TerminalColorGreen(rsp.Status)
+		if rsp.Status != dns.RcodeToString[dns.RcodeSuccess] {
+			status = TerminalColorRed(rsp.Status)
+		}
+		fmt.Printf("Update %s at %s: %s (%s)\n", TerminalColorGreen(rsp.Zone), rsp.Nameserver, status, rsp.RTT)
+
+		table := newTable()
+		table.Header("Section", "Operation", "Name", "Type", "TTL", "Address")
+		for _, op := range rsp.Prerequisites {
+			table.Append([]string{"prerequisite", TerminalColorYellow(op.Operation), TerminalColorGreen(op.Name), getColoredType(op.Type), op.TTL, op.Address})
+		}
+		for _, op := range rsp.Updates {
+			operation := TerminalColorRed(op.Operation)
+			if op.Operation == resolvers.UpdateAdd {
+				operation = TerminalColorGreen(op.Operation)
+			}
+			table.Append([]string{"update", operation, TerminalColorGreen(op.Name), getColoredType(op.Type), op.TTL, op.Address})
+		}
+		table.Render()
+
+		outputEdns(rsp.Edns)
+	}
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+func TestBuildUpdate(t *testing.T) {
+	msg, err := BuildUpdate(UpdateSpec{
+		Zone:           "example.com",
+		NameNotInUse:   []string{"new"},
+		RRsetExists:    []string{"www A", "@ 3600 IN NS ns1"},
+		RRsetNotExists: []string{"www AAAA"},
+		Delete:         []string{"old", "www TXT", "www.example.com. A 192.0.2.9"},
+		Replace:        []string{"mail 300 IN A 192.0.2.20", "mail 300 IN A 192.0.2.21"},
+		Add:            []string{`txt 60 TXT "a, b"`},
+	})
+	if err != nil {
+		t.Fatalf("BuildUpdate() error = %v", err)
+	}
+
+	if msg.Opcode != dns.OpcodeUpdate || msg.Question[0].Name != "example.com." || msg.Question[0].Qtype != dns.TypeSOA {
+		t.Fatalf("zone section = %v opcode %d, want example.com. SOA update", msg.Question, msg.Opcode)
+	}
+
+	type section struct {
+		name   string
+		rrtype uint16
+		class  uint16
+	}
+	check := func(what string, rrs []dns.RR, want []section) {
+		t.Helper()
+		if len(rrs) != len(want) {
+			t.Fatalf("%s has %d records, want %d: %v", what, len(rrs), len(want), rrs)
+		}
+		for i, w := range want {
+			h := rrs[i].Header()
+			if h.Name != w.name || h.Rrtype != w.rrtype || h.Class != w.class {
+				t.Errorf("%s[%d] = %s %s %s, want %s %s %s", what, i,
+					h.Name, dns.TypeToString[h.Rrtype], dns.ClassToString[h.Class],
+					w.name, dns.TypeToString[w.rrtype], dns.ClassToString[w.class])
+			}
+		}
+	}
+
+	check("prerequisites", msg.Answer, []section{
+		{"new.example.com.", dns.TypeANY, dns.ClassNONE},
+		{"www.example.com.", dns.TypeA, dns.ClassANY},
+		{"example.com.", dns.TypeNS, dns.ClassINET},
+		{"www.example.com.", dns.TypeAAAA, dns.ClassNONE},
+	})
+	check("updates", msg.Ns, []section{
+		{"old.example.com.", dns.TypeANY, dns.ClassANY},
+		{"www.example.com.", dns.TypeTXT, dns.ClassANY},
+		{"www.example.com.", dns.TypeA, dns.ClassNONE},
+		// Both replacement records share a single RRset deletion.
+		{"mail.example.com.", dns.TypeA, dns.ClassANY},
+		{"mail.example.com.", dns.TypeA, dns.ClassINET},
+		{"mail.example.com.", dns.TypeA, dns.ClassINET},
+		{"txt.example.com.", dns.TypeTXT, dns.ClassINET},
+	})
+}
+
+func TestBuildUpdateErrors(t *testing.T) {
+	tests := map[string]UpdateSpec{
+		"no zone":           {Add: []string{"www 60 A 192.0.2.1"}},
+		"nothing to update": {Zone: "example.com", NameInUse: []string{"www"}},
+		"invalid record":    {Zone: "example.com", Add: []string{"www 60 A not-an-ip"}},
+		"add without TTL":   {Zone: "example.com", Add: []string{"www A 192.0.2.1"}},
+		"valued not-exists": {Zone: "example.com", RRsetNotExists: []string{"www 60 A 192.0.2.1"}, Add: []string{"www 60 A 192.0.2.1"}},
+	}
+	for name, spec := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := BuildUpdate(spec); err == nil {
+				t.Fatal("BuildUpdate() error = nil, want error")
+			}
+		})
+	}
+}
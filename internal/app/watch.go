@@ -0,0 +1,306 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
+	"github.com/mr-karan/doggo/pkg/resolvers"
+)
+
+// DefaultWatchInterval is used when --watch-until is given without --watch.
+const DefaultWatchInterval = 10 * time.Second
+
+// Change markers for the answers of a watch round, relative to the round
+// before it.
+const (
+	WatchAdded   = "added"
+	WatchRemoved = "removed"
+	WatchChanged = "changed"
+)
+
+// ErrWatchDeadline is returned by Watch when the deadline passes before the
+// value given to --watch-until shows up.
+var ErrWatchDeadline = errors.New("deadline passed before the expected value showed up")
+
+// WatchAnswer is an answer of a watch round. Answers that were in the
+// previous round but are gone are kept with Change set to WatchRemoved.
+type WatchAnswer struct {
+	resolvers.Answer
+	Change string `json:"change,omitempty"`
+}
+
+// WatchRound is the outcome of a single lookup of a watch.
+type WatchRound struct {
+	Round   int              `json:"round"`
+	Time    time.Time        `json:"time"`
+	Answers []WatchAnswer    `json:"answers"`
+	Errors  []watchErrorJSON `json:"errors,omitempty"`
+	Matched bool             `json:"matched,omitempty"`
+}
+
+type watchErrorJSON struct {
+	Nameserver string `json:"nameserver,omitempty"`
+	Error      string `json:"error"`
+}
+
+// LookupFunc performs a single round of lookups for Watch.
+type LookupFunc func(ctx context.Context) ([]resolvers.Response, []error)
+
+// Watch repeats lookup every QueryFlags.Watch and prints what changed
+// between rounds. It returns nil once an answer matches QueryFlags.WatchUntil,
+// or when ctx is cancelled without one being set. ErrWatchDeadline is
+// returned if QueryFlags.WatchDeadline passes before the value shows up.
+func (app *App) Watch(ctx context.Context, lookup LookupFunc) error {
+	// Disables colorized output if user specified.
+	if !app.QueryFlags.Color {
+		color.NoColor = true
+	}
+
+	interval := app.QueryFlags.Watch
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	var deadline time.Time
+	if app.QueryFlags.WatchDeadline > 0 {
+		deadline = time.Now().Add(app.QueryFlags.WatchDeadline)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	// Redrawing the screen only makes sense on a terminal, anything else gets
+	// every round printed once.
+	redraw := !app.QueryFlags.ShowJSON && !app.QueryFlags.ShortOutput && app.stdout == nil && isatty.IsTerminal(os.Stdout.Fd())
+
+	var prev []resolvers.Answer
+	for round := 1; ; round++ {
+		started := time.Now()
+		responses, errs := lookup(ctx)
+		if ctx.Err() != nil {
+			return app.watchStopped(ctx)
+		}
+
+		var answers []resolvers.Answer
+		for _, r := range responses {
+			answers = append(answers, r.Answers...)
+		}
+		w := WatchRound{
+			Round:   round,
+			Time:    started,
+			Answers: diffAnswers(prev, answers, round == 1),
+			Matched: app.QueryFlags.WatchUntil != "" && matchesAnswer(answers, app.QueryFlags.WatchUntil),
+		}
+		for _, err := range errs {
+			w.Errors = append(w.Errors, watchError(err))
+		}
+		prev = answers
+
+		next := started.Add(interval)
+		switch {
+		case app.QueryFlags.ShowJSON:
+			app.outputWatchJSON(w)
+		case app.QueryFlags.ShortOutput:
+			app.outputWatchShort(w)
+		default:
+			app.outputWatchTerminal(w, interval, next, deadline, redraw)
+		}
+		if w.Matched {
+			return nil
+		}
+
+		// Count the TTLs down until the next round.
+		tick := time.NewTicker(time.Second)
+		wait := time.NewTimer(time.Until(next))
+	countdown:
+		for {
+			select {
+			case <-ctx.Done():
+				tick.Stop()
+				wait.Stop()
+				return app.watchStopped(ctx)
+			case <-wait.C:
+				break countdown
+			case <-tick.C:
+				if redraw {
+					app.outputWatchTerminal(w, interval, next, deadline, redraw)
+				}
+			}
+		}
+		tick.Stop()
+	}
+}
+
+// watchStopped decides the outcome of a watch that ended without a match.
+func (app *App) watchStopped(ctx context.Context) error {
+	if app.QueryFlags.WatchUntil == "" {
+		return nil
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return ErrWatchDeadline
+	}
+	return ctx.Err()
+}
+
+// diffAnswers marks every answer of cur that isn't in prev as added, or as
+// changed when prev had other values for the same name, type and nameserver.
+// Answers of prev missing from cur are appended as removed. Nothing is
+// marked in the first round.
+func diffAnswers(prev, cur []resolvers.Answer, first bool) []WatchAnswer {
+	prevRecords := make(map[string]bool, len(prev))
+	prevRRsets := make(map[string]bool, len(prev))
+	for _, a := range prev {
+		prevRecords[recordKey(a)] = true
+		prevRRsets[rrsetKey(a)] = true
+	}
+
+	out := make([]WatchAnswer, 0, len(cur))
+	curRecords := make(map[string]bool, len(cur))
+	for _, a := range cur {
+		curRecords[recordKey(a)] = true
+		w := WatchAnswer{Answer: a}
+		switch {
+		case first, prevRecords[recordKey(a)]:
+		case prevRRsets[rrsetKey(a)]:
+			w.Change = WatchChanged
+		default:
+			w.Change = WatchAdded
+		}
+		out = append(out, w)
+	}
+	for _, a := range prev {
+		if !curRecords[recordKey(a)] {
+			out = append(out, WatchAnswer{Answer: a, Change: WatchRemoved})
+		}
+	}
+	return out
+}
+
+// rrsetKey identifies the RRset an answer belongs to. TTLs are left out as
+// they count down between rounds.
+func rrsetKey(a resolvers.Answer) string {
+	return strings.ToLower(a.Name) + "\x00" + a.Type + "\x00" + a.Class + "\x00" + a.Nameserver
+}
+
+func recordKey(a resolvers.Answer) string {
+	return rrsetKey(a) + "\x00" + a.Address
+}
+
+// matchesAnswer reports whether any answer has value as its address. Names
+// match regardless of case and trailing dot.
+func matchesAnswer(answers []resolvers.Answer, value string) bool {
+	want := strings.TrimSuffix(strings.ToLower(value), ".")
+	for _, a := range answers {
+		if strings.TrimSuffix(strings.ToLower(a.Address), ".") == want {
+			return true
+		}
+	}
+	return false
+}
+
+func watchError(err error) watchErrorJSON {
+	var lookupErr *resolvers.LookupError
+	if errors.As(err, &lookupErr) {
+		return watchErrorJSON{Nameserver: lookupErr.Nameserver, Error: lookupErr.Err.Error()}
+	}
+	return watchErrorJSON{Error: err.Error()}
+}
+
+// remainingTTL counts the TTL of an answer down by the time elapsed since
+// it was received.
+func remainingTTL(ttl string, elapsed time.Duration) string {
+	secs, err := strconv.Atoi(strings.TrimSuffix(ttl, "s"))
+	if err != nil {
+		return ttl
+	}
+	return strconv.Itoa(max(secs-int(elapsed.Seconds()), 0)) + "s"
+}
+
+// outputWatchJSON prints a round as a single line, so the output of a watch
+// can be consumed as NDJSON.
+func (app *App) outputWatchJSON(w WatchRound) {
+	res, err := json.Marshal(w)
+	if err != nil {
+		app.Logger.Error("unable to output data in JSON", "error", err)
+		os.Exit(-1)
+	}
+	fmt.Fprintf(app.output(), "%s\n", res)
+}
+
+// outputWatchShort prints every address of the first round, then only the
+// ones added (+) and removed (-) in later rounds.
+func (app *App) outputWatchShort(w WatchRound) {
+	out := app.output()
+	for _, e := range w.Errors {
+		app.Logger.Warn("lookup failed", "nameserver", e.Nameserver, "error", e.Error)
+	}
+	for _, a := range w.Answers {
+		switch a.Change {
+		case "":
+			if w.Round == 1 {
+				fmt.Fprintf(out, "%s\n", a.Address)
+			}
+		case WatchRemoved:
+			fmt.Fprintf(out, "- %s\n", a.Address)
+		default:
+			fmt.Fprintf(out, "+ %s\n", a.Address)
+		}
+	}
+}
+
+func (app *App) outputWatchTerminal(w WatchRound, interval time.Duration, next, deadline time.Time, redraw bool) {
+	out := app.output()
+	if redraw {
+		// Move the cursor home and clear the screen.
+		fmt.Fprint(out, "\033[H\033[2J")
+	} else if w.Round > 1 {
+		fmt.Fprintln(out)
+	}
+
+	status := fmt.Sprintf("Every %s: round %d at %s", interval, w.Round, w.Time.Format(time.TimeOnly))
+	if redraw {
+		status += fmt.Sprintf(", next in %s", time.Until(next).Round(time.Second))
+	}
+	fmt.Fprintln(out, TerminalColorYellow(status))
+	if app.QueryFlags.WatchUntil != "" {
+		until := "Waiting for " + TerminalColorCyan(app.QueryFlags.WatchUntil)
+		if w.Matched {
+			until = "Found " + TerminalColorGreen(app.QueryFlags.WatchUntil)
+		} else if !deadline.IsZero() {
+			until += " until " + deadline.Format(time.TimeOnly)
+		}
+		fmt.Fprintln(out, until)
+	}
+	fmt.Fprintln(out)
+
+	elapsed := time.Since(w.Time)
+	table := newTableTo(out)
+	table.Header("Change", "Name", "Type", "Class", "TTL", "Address", "Nameserver")
+	for _, a := range w.Answers {
+		change, address, ttl := "", a.Address, remainingTTL(a.TTL, elapsed)
+		switch a.Change {
+		case WatchAdded:
+			change, address = TerminalColorGreen("+"), TerminalColorGreen(a.Address)
+		case WatchChanged:
+			change, address = TerminalColorYellow("~"), TerminalColorYellow(a.Address)
+		case WatchRemoved:
+			change, address, ttl = TerminalColorRed("-"), TerminalColorRed(a.Address), "-"
+		}
+		table.Append([]string{change, TerminalColorGreen(a.Name), getColoredType(a.Type), a.Class, ttl, address, a.Nameserver})
+	}
+	table.Render()
+
+	for _, e := range w.Errors {
+		if e.Nameserver != "" {
+			fmt.Fprintf(out, "%s %s: %s\n", TerminalColorRed("Error"), e.Nameserver, e.Error)
+		} else {
+			fmt.Fprintf(out, "%s %s\n", TerminalColorRed("Error"), e.Error)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mr-karan/doggo/pkg/resolvers"
+)
+
+func watchAnswer(address string) resolvers.Answer {
+	return resolvers.Answer{Name: "www.example.com.", Type: "A", Class: "IN", TTL: "60s", Address: address, Nameserver: "127.0.0.1:53"}
+}
+
+func TestDiffAnswers(t *testing.T) {
+	prev := []resolvers.Answer{watchAnswer("192.0.2.1"), watchAnswer("192.0.2.2")}
+	kept := watchAnswer("192.0.2.1")
+	kept.TTL = "42s"
+	cname := resolvers.Answer{Name: "alias.example.com.", Type: "CNAME", Class: "IN", TTL: "60s", Address: "www.example.com.", Nameserver: "127.0.0.1:53"}
+	cur := []resolvers.Answer{kept, watchAnswer("192.0.2.3"), cname}
+
+	got := diffAnswers(prev, cur, false)
+	want := []struct{ address, change string }{
+		{"192.0.2.1", ""},
+		{"192.0.2.3", WatchChanged},
+		{"www.example.com.", WatchAdded},
+		{"192.0.2.2", WatchRemoved},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("diffAnswers() returned %d answers, want %d: %+v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		if got[i].Address != w.address || got[i].Change != w.change {
+			t.Errorf("answer %d = %s %q, want %s %q", i, got[i].Address, got[i].Change, w.address, w.change)
+		}
+	}
+
+	for _, a := range diffAnswers(nil, cur, true) {
+		if a.Change != "" {
+			t.Errorf("first round marked %s as %s", a.Address, a.Change)
+		}
+	}
+}
+
+func TestRemainingTTL(t *testing.T) {
+	if got := remainingTTL("60s", 15*time.Second); got != "45s" {
+		t.Errorf("remainingTTL(60s, 15s) = %s, want 45s", got)
+	}
+	if got := remainingTTL("10s", time.Minute); got != "0s" {
+		t.Errorf("remainingTTL(10s, 1m) = %s, want 0s", got)
+	}
+}
+
+// newWatchApp returns an app watching with --short, along with what it
+// prints.
+func newWatchApp(until string, deadline time.Duration) (*App, *strings.Builder) {
+	a := New(slog.New(slog.NewTextHandler(io.Discard, nil)), nil, "test")
+	a.QueryFlags.ShortOutput = true
+	a.QueryFlags.Watch = 10 * time.Millisecond
+	a.QueryFlags.WatchUntil = until
+	a.QueryFlags.WatchDeadline = deadline
+	out := new(strings.Builder)
+	a.stdout = out
+	return &a, out
+}
+
+func TestWatchUntilValueShowsUp(t *testing.T) {
+	a, out := newWatchApp("192.0.2.9", time.Minute)
+	rounds := 0
+	err := a.Watch(context.Background(), func(context.Context) ([]resolvers.Response, []error) {
+		rounds++
+		address := "192.0.2.1"
+		if rounds == 3 {
+			address = "192.0.2.9"
+		}
+		return []resolvers.Response{{Answers: []resolvers.Answer{watchAnswer(address)}}}, nil
+	})
+	if err != nil {
+		t.Fatalf("Watch() error = %v", err)
+	}
+	if rounds != 3 {
+		t.Errorf("Watch() ran %d rounds, want 3", rounds)
+	}
+	if want := "192.0.2.1\n+ 192.0.2.9\n- 192.0.2.1\n"; out.String() != want {
+		t.Errorf("Watch() printed %q, want %q", out.String(), want)
+	}
+}
+
+func TestWatchDeadline(t *testing.T) {
+	a, _ := newWatchApp("192.0.2.9", 50*time.Millisecond)
+	err := a.Watch(context.Background(), func(context.Context) ([]resolvers.Response, []error) {
+		return []resolvers.Response{{Answers: []resolvers.Answer{watchAnswer("192.0.2.1")}}}, nil
+	})
+	if !errors.Is(err, ErrWatchDeadline) {
+		t.Fatalf("Watch() error = %v, want ErrWatchDeadline", err)
+	}
+
+	// Without a value to wait for, the deadline just ends the watch.
+	a, _ = newWatchApp("", 50*time.Millisecond)
+	err = a.Watch(context.Background(), func(context.Context) ([]resolvers.Response, []error) {
+		return nil, nil
+	})
+	if err != nil {
+		t.Fatalf("Watch() without --watch-until error = %v, want nil", err)
+	}
+}
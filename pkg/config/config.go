@@ -1,9 +1,59 @@
 package config
 
-import "net"
+import (
+	"bufio"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The limits glibc puts on the attempts and timeout options of resolv.conf.
+const (
+	maxResolvAttempts = 5
+	maxResolvTimeout  = 30 * time.Second
+)
 
 // the whole `FEC0::/10` prefix is deprecated.
 // [RFC 3879]: https://tools.ietf.org/html/rfc3879
 func isUnicastLinkLocal(ip net.IP) bool {
 	return len(ip) == net.IPv6len && ip[0] == 0xfe && ip[1] == 0xc0
 }
+
+// parseResolvOptions returns the `options attempts:n` and `timeout:n` of the
+// resolv.conf at path, 0 when they aren't set. As with glibc, the last ones
+// win and they are capped at 5 attempts and 30 seconds.
+func parseResolvOptions(path string) (int, time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	var (
+		attempts int
+		timeout  time.Duration
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || fields[0] != "options" {
+			continue
+		}
+		for _, opt := range fields[1:] {
+			name, value, ok := strings.Cut(opt, ":")
+			n, err := strconv.Atoi(value)
+			if !ok || err != nil || n < 1 {
+				continue
+			}
+			switch name {
+			case "attempts":
+				attempts = min(n, maxResolvAttempts)
+			case "timeout":
+				timeout = min(time.Duration(n)*time.Second, maxResolvTimeout)
+			}
+		}
+	}
+	return attempts, timeout, scanner.Err()
+}
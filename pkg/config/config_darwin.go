@@ -11,6 +11,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -290,3 +291,9 @@ func fallbackToResolvConf() ([]string, int, []string, error) {
 
 	return servers, cfg.Ndots, cfg.Search, nil
 }
+
+// GetResolvOptions returns the number of attempts and the timeout of the
+// queries set in /etc/resolv.conf, 0 when they aren't.
+func GetResolvOptions() (int, time.Duration, error) {
+	return parseResolvOptions("/etc/resolv.conf")
+}
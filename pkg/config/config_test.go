@@ -0,0 +1,34 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseResolvOptions(t *testing.T) {
+	for _, tc := range []struct {
+		conf     string
+		attempts int
+		timeout  time.Duration
+	}{
+		{"nameserver 192.0.2.53\n", 0, 0},
+		{"nameserver 192.0.2.53\noptions ndots:5 attempts:3 timeout:2\n", 3, 2 * time.Second},
+		{"options attempts:2\noptions timeout:1 attempts:4\n", 4, time.Second},
+		{"options attempts:10 timeout:60\n", 5, 30 * time.Second},
+		{"options attempts:0 timeout:x rotate\n# options attempts:3\n", 0, 0},
+	} {
+		path := filepath.Join(t.TempDir(), "resolv.conf")
+		if err := os.WriteFile(path, []byte(tc.conf), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		attempts, timeout, err := parseResolvOptions(path)
+		if err != nil || attempts != tc.attempts || timeout != tc.timeout {
+			t.Errorf("parseResolvOptions(%q) = %d, %s, %v, want %d, %s", tc.conf, attempts, timeout, err, tc.attempts, tc.timeout)
+		}
+	}
+	if _, _, err := parseResolvOptions(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("parseResolvOptions succeeded on a missing file")
+	}
+}
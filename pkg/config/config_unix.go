@@ -4,6 +4,7 @@ package config
 
 import (
 	"net"
+	"time"
 
 	"github.com/miekg/dns"
 )
@@ -35,3 +36,9 @@ func GetDefaultServers() ([]string, int, []string, error) {
 func GetAllServers() ([]string, int, []string, error) {
 	return GetDefaultServers()
 }
+
+// GetResolvOptions returns the number of attempts and the timeout of the
+// queries set in resolv.conf, 0 when they aren't.
+func GetResolvOptions() (int, time.Duration, error) {
+	return parseResolvOptions(DefaultResolvConfPath)
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"golang.org/x/sys/windows"
@@ -125,3 +126,9 @@ func GetDefaultServers() ([]string, int, []string, error) {
 func GetAllServers() ([]string, int, []string, error) {
 	return GetDefaultServers()
 }
+
+// GetResolvOptions returns no attempts and timeout, Windows has no
+// resolv.conf to set them.
+func GetResolvOptions() (int, time.Duration, error) {
+	return 0, 0, nil
+}
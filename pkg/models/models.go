@@ -16,6 +16,8 @@ const (
 	DefaultDOQPort   = "853"
 	UDPResolver      = "udp"
 	DOHResolver      = "doh"
+	DOHJSONResolver  = "dohjson"
+	ODOHResolver     = "odoh"
 	TCPResolver      = "tcp"
 	DOTResolver      = "dot"
 	DNSCryptResolver = "dnscrypt"
@@ -35,6 +37,8 @@ type QueryFlags struct {
 	UseIPv6            bool          `koanf:"ipv6" json:"ipv6"`
 	Ndots              int           `koanf:"ndots" json:"ndots"`
 	Timeout            time.Duration `koanf:"timeout" json:"timeout"`
+	Tries              int           `koanf:"tries" json:"tries"`
+	RetryTimeout       time.Duration `koanf:"retry-timeout" json:"retry-timeout"`
 	Color              bool          `koanf:"color" json:"-"`
 	DisplayTimeTaken   bool          `koanf:"time" json:"-"`
 	ShowJSON           bool          `koanf:"json" json:"-"`
@@ -44,8 +48,36 @@ type QueryFlags struct {
 	Strategy           string        `koanf:"strategy" strategy:"-"`
 	InsecureSkipVerify bool          `koanf:"skip-hostname-verification" skip-hostname-verification:"-"`
 	TLSHostname        string        `koanf:"tls-hostname" tls-hostname:"-"`
+	DOHHTTP3           bool          `koanf:"doh-http3" json:"-"`
+	ODoHRelay          string        `koanf:"odoh-relay" json:"-"`
+	DNSCryptTCP        bool          `koanf:"dnscrypt-tcp" json:"-"`
+	TLSInfo            bool          `koanf:"tls-info" json:"-"`
+	TLSCert            string        `koanf:"tls-cert" json:"-"`
+	TLSKey             string        `koanf:"tls-key" json:"-"`
+	TLSCA              string        `koanf:"tls-ca" json:"-"`
+	TLSPins            []string      `koanf:"tls-pin" json:"-"`
+	Source             string        `koanf:"source" json:"-"`
+	Interface          string        `koanf:"interface" json:"-"`
+	Proxy              string        `koanf:"proxy" json:"-"`
 	QueryAny           bool          `koanf:"any" json:"any"`
 	UseAuthoritative   bool          `koanf:"authoritative" json:"authoritative"`
+	Trace              bool          `koanf:"trace" json:"-"`
+	IXFRSerial         uint32        `koanf:"ixfr-serial" json:"ixfr-serial"`
+	ZoneFile           bool          `koanf:"zone-file" json:"-"`
+	TSIG               string        `koanf:"tsig" json:"-"`
+	TSIGFile           string        `koanf:"tsig-file" json:"-"`
+	Watch              time.Duration `koanf:"watch" json:"-"`
+	WatchUntil         string        `koanf:"watch-until" json:"-"`
+	WatchDeadline      time.Duration `koanf:"watch-deadline" json:"-"`
+	Propagation        bool          `koanf:"propagation" json:"-"`
+	Batch              string        `koanf:"batch" json:"-"`
+	BatchConcurrency   int           `koanf:"batch-concurrency" json:"-"`
+
+	// Nameserver aliases and groups, only set from the config file.
+	Aliases map[string]string   `koanf:"aliases" json:"-"`
+	Groups  map[string][]string `koanf:"groups" json:"-"`
+	// Split DNS routes, eg "*.corp.example -> @10.0.0.53".
+	Routes []string `koanf:"route" json:"-"`
 
 	// DNS Query Flags
 	AA bool `koanf:"aa" json:"aa"` // Authoritative Answer
@@ -63,6 +95,9 @@ type QueryFlags struct {
 	ECS     string `koanf:"ecs" json:"ecs"`         // EDNS Client Subnet
 	Bufsize uint16 `koanf:"bufsize" json:"bufsize"` // EDNS UDP buffer size (default: 1232 when EDNS enabled)
 
+	// DNSSEC validation
+	Validate bool `koanf:"validate" json:"validate"` // Validate the chain of trust from the root
+
 	// Globalping flags
 	GPFrom  string `koanf:"gp-from" json:"gp-from"`
 	GPLimit int    `koanf:"gp-limit" json:"gp-limit"`
@@ -73,6 +108,18 @@ type QueryFlags struct {
 type Nameserver struct {
 	Address string
 	Type    string
+
+	// The client certificate, its key and the CA bundle of an encrypted
+	// nameserver, from its tls-cert, tls-key and tls-ca URL parameters. They
+	// override --tls-cert, --tls-key and --tls-ca.
+	TLSCert string
+	TLSKey  string
+	TLSCA   string
+	// TLSPins are the SPKI pins of its tls-pin URL parameters, overriding
+	// --tls-pin. TLSCertHashes are the hashes of the certificates of its
+	// DNS stamp, in hex.
+	TLSPins       []string
+	TLSCertHashes []string
 }
 
 // GetCommonRecordTypes returns a slice of common DNS record types
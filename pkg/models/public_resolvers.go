@@ -0,0 +1,65 @@
+package models
+
+// PublicResolversVersion identifies the revision of PublicResolvers. Bump it
+// whenever an entry is added, changed or removed.
+const PublicResolversVersion = "2026.10"
+
+// Regions of PublicResolvers. Anycast networks without a home region are
+// listed as global.
+const (
+	RegionGlobal       = "Global"
+	RegionNorthAmerica = "North America"
+	RegionEurope       = "Europe"
+	RegionAsia         = "Asia"
+)
+
+// PublicResolver is a public recursive resolver queried by --propagation.
+type PublicResolver struct {
+	Operator string `json:"operator"`
+	Region   string `json:"region"`
+	Nameserver
+}
+
+// PublicResolvers is the catalogue of open recursive resolvers that
+// --propagation checks, grouped by operator. Only unfiltered endpoints are
+// listed, as a filtering resolver disagreeing on purpose would be noise.
+// Users add their own in the [[public_resolvers]] tables of the config file.
+var PublicResolvers = []PublicResolver{
+	{"Cloudflare", RegionGlobal, Nameserver{Type: UDPResolver, Address: "1.1.1.1:53"}},
+	{"Cloudflare", RegionGlobal, Nameserver{Type: DOHResolver, Address: "https://cloudflare-dns.com/dns-query"}},
+	{"Cloudflare", RegionGlobal, Nameserver{Type: DOTResolver, Address: "one.one.one.one:853"}},
+
+	{"Google", RegionGlobal, Nameserver{Type: UDPResolver, Address: "8.8.8.8:53"}},
+	{"Google", RegionGlobal, Nameserver{Type: DOHResolver, Address: "https://dns.google/dns-query"}},
+	{"Google", RegionGlobal, Nameserver{Type: DOTResolver, Address: "dns.google:853"}},
+
+	{"Quad9", RegionGlobal, Nameserver{Type: UDPResolver, Address: "9.9.9.10:53"}},
+	{"Quad9", RegionGlobal, Nameserver{Type: DOHResolver, Address: "https://dns10.quad9.net/dns-query"}},
+	{"Quad9", RegionGlobal, Nameserver{Type: DOTResolver, Address: "dns10.quad9.net:853"}},
+
+	{"OpenDNS", RegionGlobal, Nameserver{Type: UDPResolver, Address: "208.67.222.222:53"}},
+	{"OpenDNS", RegionGlobal, Nameserver{Type: DOHResolver, Address: "https://doh.opendns.com/dns-query"}},
+
+	{"AdGuard", RegionGlobal, Nameserver{Type: UDPResolver, Address: "94.140.14.140:53"}},
+	{"AdGuard", RegionGlobal, Nameserver{Type: DOHResolver, Address: "https://unfiltered.adguard-dns.com/dns-query"}},
+	{"AdGuard", RegionGlobal, Nameserver{Type: DOTResolver, Address: "unfiltered.adguard-dns.com:853"}},
+
+	{"Control D", RegionGlobal, Nameserver{Type: UDPResolver, Address: "76.76.2.0:53"}},
+	{"Control D", RegionGlobal, Nameserver{Type: DOHResolver, Address: "https://freedns.controld.com/p0"}},
+
+	{"Level3", RegionNorthAmerica, Nameserver{Type: UDPResolver, Address: "4.2.2.1:53"}},
+	{"Hurricane Electric", RegionNorthAmerica, Nameserver{Type: UDPResolver, Address: "74.82.42.42:53"}},
+	{"CIRA Canadian Shield", RegionNorthAmerica, Nameserver{Type: UDPResolver, Address: "149.112.121.10:53"}},
+	{"CIRA Canadian Shield", RegionNorthAmerica, Nameserver{Type: DOHResolver, Address: "https://private.canadianshield.cira.ca/dns-query"}},
+
+	{"DNS.SB", RegionEurope, Nameserver{Type: UDPResolver, Address: "185.222.222.222:53"}},
+	{"DNS.SB", RegionEurope, Nameserver{Type: DOHResolver, Address: "https://doh.dns.sb/dns-query"}},
+	{"Mullvad", RegionEurope, Nameserver{Type: DOHResolver, Address: "https://dns.mullvad.net/dns-query"}},
+	{"Mullvad", RegionEurope, Nameserver{Type: DOTResolver, Address: "dns.mullvad.net:853"}},
+
+	{"AliDNS", RegionAsia, Nameserver{Type: UDPResolver, Address: "223.5.5.5:53"}},
+	{"AliDNS", RegionAsia, Nameserver{Type: DOHResolver, Address: "https://dns.alidns.com/dns-query"}},
+	{"DNSPod", RegionAsia, Nameserver{Type: UDPResolver, Address: "119.29.29.29:53"}},
+	{"Quad101", RegionAsia, Nameserver{Type: UDPResolver, Address: "101.101.101.101:53"}},
+	{"IIJ", RegionAsia, Nameserver{Type: DOHResolver, Address: "https://public.dns.iij.jp/dns-query"}},
+}
@@ -0,0 +1,197 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// exchanger is implemented by every resolver of this package: it sends a
+// single message and returns the raw reply, without parsing it.
+type exchanger interface {
+	exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error)
+}
+
+// BenchOptions configures a benchmark of a single resolver.
+type BenchOptions struct {
+	// Count is the number of queries to send.
+	Count int
+	// Concurrency is the number of queries in flight at once.
+	Concurrency int
+	// QPS caps the rate queries are sent at. Zero sends them as fast as the
+	// concurrency allows.
+	QPS float64
+	// Timeout applies to every query.
+	Timeout time.Duration
+}
+
+// BenchResult summarises a benchmark. Latencies are in milliseconds and only
+// cover queries that got a response, whatever its rcode.
+type BenchResult struct {
+	Nameserver string         `json:"nameserver"`
+	Protocol   string         `json:"protocol,omitempty"`
+	Queries    int            `json:"queries"`
+	Responses  int            `json:"responses"`
+	Timeouts   int            `json:"timeouts"`
+	Errors     int            `json:"errors"`
+	Duration   float64        `json:"duration_ms"`
+	QPS        float64        `json:"qps"`
+	Min        float64        `json:"min_ms"`
+	P50        float64        `json:"p50_ms"`
+	P90        float64        `json:"p90_ms"`
+	P99        float64        `json:"p99_ms"`
+	Max        float64        `json:"max_ms"`
+	Rcodes     map[string]int `json:"rcodes"`
+	// Error is the first error other than a timeout, if any.
+	Error string `json:"error,omitempty"`
+}
+
+// TimeoutRate returns the share of queries that timed out, in percent.
+func (b BenchResult) TimeoutRate() float64 {
+	return percentOf(b.Timeouts, b.Queries)
+}
+
+// ErrorRate returns the share of queries that failed other than by timing
+// out, in percent.
+func (b BenchResult) ErrorRate() float64 {
+	return percentOf(b.Errors, b.Queries)
+}
+
+func percentOf(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// Bench sends opts.Count queries to r, cycling through questions, and
+// measures how long every one of them takes. The name of a question is
+// queried as is, without the search list.
+func Bench(ctx context.Context, r Resolver, questions []dns.Question, flags QueryFlags, opts BenchOptions) (BenchResult, error) {
+	res := BenchResult{Nameserver: r.Address(), Rcodes: make(map[string]int)}
+	ex, ok := r.(exchanger)
+	if !ok {
+		return res, fmt.Errorf("benchmarking isn't supported for %s", r.Address())
+	}
+	if len(questions) == 0 || opts.Count <= 0 {
+		return res, errors.New("nothing to benchmark")
+	}
+
+	msgs := make([]dns.Msg, len(questions))
+	for i, q := range questions {
+		msgs[i] = prepareMessages(q, flags, 0, nil, nil)[0]
+	}
+
+	// Queries are handed out by a single dispatcher, which paces them when a
+	// rate is set.
+	jobs := make(chan int)
+	go func() {
+		defer close(jobs)
+		var tick <-chan time.Time
+		if opts.QPS > 0 {
+			ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.QPS))
+			defer ticker.Stop()
+			tick = ticker.C
+		}
+		for i := 0; i < opts.Count; i++ {
+			if tick != nil && i > 0 {
+				select {
+				case <-tick:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case jobs <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		latencies []time.Duration
+	)
+	start := time.Now()
+	for range max(opts.Concurrency, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				msg := msgs[i%len(msgs)].Copy()
+				msg.Id = dns.Id()
+
+				qctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+				now := time.Now()
+				in, err := ex.exchange(qctx, msg)
+				rtt := time.Since(now)
+				cancel()
+				if err != nil && ctx.Err() != nil {
+					// Interrupted, this query doesn't count.
+					continue
+				}
+
+				mu.Lock()
+				res.Queries++
+				switch {
+				case err == nil:
+					res.Responses++
+					res.Rcodes[dns.RcodeToString[in.Rcode]]++
+					latencies = append(latencies, rtt)
+				case isTimeout(err):
+					res.Timeouts++
+				default:
+					res.Errors++
+					if res.Error == "" {
+						res.Error = err.Error()
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	res.Duration = milliseconds(elapsed)
+	if elapsed > 0 {
+		res.QPS = float64(res.Queries) / elapsed.Seconds()
+	}
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		res.Min = milliseconds(latencies[0])
+		res.P50 = milliseconds(percentile(latencies, 50))
+		res.P90 = milliseconds(percentile(latencies, 90))
+		res.P99 = milliseconds(percentile(latencies, 99))
+		res.Max = milliseconds(latencies[len(latencies)-1])
+	}
+	return res, ctx.Err()
+}
+
+// percentile returns the p-th percentile of sorted using the nearest-rank
+// method.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	return sorted[max(rank, 1)-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// isTimeout reports whether err means the nameserver didn't answer in time.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,120 @@
+package resolvers
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startBenchServer answers A queries over UDP, with SERVFAIL for
+// fail.example. and not at all for drop.example.
+func startBenchServer(t *testing.T) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	srv := &dns.Server{PacketConn: conn}
+	srv.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		switch req.Question[0].Name {
+		case "drop.example.":
+			return
+		case "fail.example.":
+			m.Rcode = dns.RcodeServerFailure
+		default:
+			m.Answer = append(m.Answer, testRR(t, req.Question[0].Name+" 60 IN A 192.0.2.1"))
+		}
+		_ = w.WriteMsg(m)
+	})
+	ready := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(ready) }
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	select {
+	case <-ready:
+	case <-time.After(2 * time.Second):
+		t.Fatal("DNS test server did not start within 2s")
+	}
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+func newBenchResolver(t *testing.T, addr string) Resolver {
+	t.Helper()
+	r, err := NewClassicResolver(addr, ClassicResolverOpts{}, Options{Logger: discardLogger(), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewClassicResolver: %v", err)
+	}
+	return r
+}
+
+func TestBenchCountsRcodesTimeoutsAndLatency(t *testing.T) {
+	r := newBenchResolver(t, startBenchServer(t))
+	questions := []dns.Question{
+		{Name: "ok.example", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+		{Name: "fail.example", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+		{Name: "drop.example", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+	}
+	res, err := Bench(context.Background(), r, questions, QueryFlags{RD: true}, BenchOptions{
+		Count:       30,
+		Concurrency: 5,
+		Timeout:     100 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Bench() error = %v", err)
+	}
+
+	if res.Queries != 30 || res.Responses != 20 || res.Timeouts != 10 || res.Errors != 0 {
+		t.Errorf("Bench() = %d queries, %d responses, %d timeouts, %d errors, want 30, 20, 10, 0",
+			res.Queries, res.Responses, res.Timeouts, res.Errors)
+	}
+	if res.Rcodes["NOERROR"] != 10 || res.Rcodes["SERVFAIL"] != 10 {
+		t.Errorf("Rcodes = %v, want 10 NOERROR and 10 SERVFAIL", res.Rcodes)
+	}
+	if !(res.Min > 0 && res.Min <= res.P50 && res.P50 <= res.P90 && res.P90 <= res.P99 && res.P99 <= res.Max) {
+		t.Errorf("latencies aren't ordered: min %v p50 %v p90 %v p99 %v max %v", res.Min, res.P50, res.P90, res.P99, res.Max)
+	}
+	if got := res.TimeoutRate(); got < 33.3 || got > 33.4 {
+		t.Errorf("TimeoutRate() = %v, want 33.3", got)
+	}
+}
+
+func TestBenchQPS(t *testing.T) {
+	r := newBenchResolver(t, startBenchServer(t))
+	questions := []dns.Question{{Name: "ok.example", Qtype: dns.TypeA, Qclass: dns.ClassINET}}
+	res, err := Bench(context.Background(), r, questions, QueryFlags{RD: true}, BenchOptions{
+		Count:       6,
+		Concurrency: 6,
+		QPS:         50,
+		Timeout:     time.Second,
+	})
+	if err != nil {
+		t.Fatalf("Bench() error = %v", err)
+	}
+	// Six queries at 50 QPS are spread over five 20ms intervals, give or
+	// take the ticker starting just before the clock.
+	if res.Duration < 80 {
+		t.Errorf("Duration = %vms, want about 100ms at 50 QPS", res.Duration)
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := make([]time.Duration, 100)
+	for i := range sorted {
+		sorted[i] = time.Duration(i+1) * time.Millisecond
+	}
+	for p, want := range map[int]time.Duration{50: 50 * time.Millisecond, 90: 90 * time.Millisecond, 99: 99 * time.Millisecond} {
+		if got := percentile(sorted, p); got != want {
+			t.Errorf("percentile(%d) = %v, want %v", p, got, want)
+		}
+	}
+	if got := percentile(sorted[:1], 99); got != time.Millisecond {
+		t.Errorf("percentile of a single value = %v, want 1ms", got)
+	}
+}
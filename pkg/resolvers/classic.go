@@ -3,16 +3,23 @@ package resolvers
 import (
 	"context"
 	"crypto/tls"
+	"fmt"
+	"net"
+	"strings"
 	"time"
 
 	"github.com/miekg/dns"
 )
 
 // ClassicResolver represents the config options for setting up a Resolver.
+// Over TCP and DoT, its queries are pipelined on pooled connections.
 type ClassicResolver struct {
 	client          *dns.Client
+	pool            *connPool
+	dialer          *dialer
 	server          string
 	resolverOptions Options
+	validator       *dnssecValidator
 }
 
 // ClassicResolverOpts holds options for setting up a Classic resolver.
@@ -43,19 +50,40 @@ func NewClassicResolver(server string, classicOpts ClassicResolverOpts, resolver
 	if classicOpts.UseTLS {
 		net = net + "-tls"
 		// Provide extra TLS config for doing/skipping hostname verification.
-		client.TLSConfig = &tls.Config{
-			ServerName:         resolverOpts.TLSHostname,
-			InsecureSkipVerify: resolverOpts.InsecureSkipVerify,
+		config, err := newTLSConfig(resolverOpts, resolverOpts.TLSHostname)
+		if err != nil {
+			return nil, err
 		}
+		client.TLSConfig = config
 	}
 
 	client.Net = net
 
-	return &ClassicResolver{
+	d, err := newDialer(resolverOpts)
+	if err != nil {
+		return nil, err
+	}
+	if resolverOpts.Dialer != nil && !classicOpts.UseTCP {
+		return nil, fmt.Errorf("%s: %w", server, ErrProxyUDP)
+	}
+
+	if resolverOpts.TSIG != nil {
+		client.TsigSecret = resolverOpts.TSIG.secrets()
+	}
+
+	r := &ClassicResolver{
 		client:          client,
+		dialer:          d,
 		server:          server,
 		resolverOptions: resolverOpts,
-	}, nil
+	}
+	if classicOpts.UseTCP || classicOpts.UseTLS {
+		r.pool = newConnPool(server, func(ctx context.Context) (*dns.Conn, error) {
+			return r.dial(ctx, client)
+		}, resolverOpts.Timeout, resolverOpts.Logger)
+	}
+	r.validator = newDNSSECValidator(r.exchange, resolverOpts.Logger)
+	return r, nil
 }
 
 // query takes a dns.Question and sends them to DNS Server.
@@ -63,7 +91,8 @@ func NewClassicResolver(server string, classicOpts ClassicResolverOpts, resolver
 func (r *ClassicResolver) query(ctx context.Context, question dns.Question, flags QueryFlags) (Response, error) {
 	var (
 		rsp      Response
-		messages = prepareMessages(question, flags, r.resolverOptions.Ndots, r.resolverOptions.SearchList)
+		final    *dns.Msg
+		messages = prepareMessages(question, flags, r.resolverOptions.Ndots, r.resolverOptions.SearchList, r.resolverOptions.TSIG)
 	)
 	for _, msg := range messages {
 		r.resolverOptions.Logger.Debug("Attempting to resolve",
@@ -76,31 +105,14 @@ func (r *ClassicResolver) query(ctx context.Context, question dns.Question, flag
 		// it's better to not rely on `rtt` provided here and calculate it ourselves.
 		now := time.Now()
 
-		in, _, err := r.client.ExchangeContext(ctx, &msg, r.server)
+		in, info, err := r.roundTrip(ctx, &msg)
 		if err != nil {
-			if err == context.Canceled || err == context.DeadlineExceeded {
-				return rsp, err
+			if r.resolverOptions.TLSInfo {
+				err = wrapTLSError(err)
 			}
 			return rsp, err
 		}
 
-		// In case the response size exceeds 512 bytes (can happen with lot of TXT records),
-		// fallback to TCP as with UDP the response is truncated. Fallback mechanism is in-line with `dig`.
-		if in.Truncated {
-			switch r.client.Net {
-			case "udp":
-				r.client.Net = "tcp"
-			case "udp4":
-				r.client.Net = "tcp4"
-			case "udp6":
-				r.client.Net = "tcp6"
-			default:
-				r.client.Net = "tcp"
-			}
-			r.resolverOptions.Logger.Debug("Response truncated; retrying now", "protocol", r.client.Net)
-			return r.query(ctx, question, flags)
-		}
-
 		// Pack questions in output.
 		for _, q := range msg.Question {
 			ques := Question{
@@ -110,7 +122,8 @@ func (r *ClassicResolver) query(ctx context.Context, question dns.Question, flag
 			}
 			rsp.Questions = append(rsp.Questions, ques)
 		}
-		rtt := time.Since(now)
+		// The handshake of a new connection is reported on its own.
+		rtt := time.Since(now) - info.handshake
 
 		// Get the authorities and answers.
 		output := parseMessage(in, rtt, r.server)
@@ -118,6 +131,15 @@ func (r *ClassicResolver) query(ctx context.Context, question dns.Question, flag
 		rsp.Answers = output.Answers
 		rsp.Additional = output.Additional
 		rsp.Edns = output.Edns
+		rsp.Status = output.Status
+		rsp.Nameserver = output.Nameserver
+		rsp.Handshake = formatHandshake(info.handshake)
+		rsp.Source = r.dialer.info()
+		if r.resolverOptions.TLSInfo {
+			rsp.TLS = newTLSInfo(info.tls)
+		}
+
+		final = in
 
 		if len(output.Answers) > 0 || in.Rcode == dns.RcodeSuccess {
 			// Stop iterating the searchlist.
@@ -132,15 +154,126 @@ func (r *ClassicResolver) query(ctx context.Context, question dns.Question, flag
 			// Continue to next iteration
 		}
 	}
+
+	if flags.Validate && final != nil {
+		rsp.DNSSEC = r.validator.validate(ctx, final)
+	}
 	return rsp, nil
 }
 
+// Exchange sends msg, built by the caller as for the non-recursive queries of
+// a trace, as many times as Options.Tries allows and returns the raw reply.
+// Truncated replies over UDP are retried over TCP.
+func (r *ClassicResolver) Exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	var in *dns.Msg
+	_, err := retry(ctx, r.resolverOptions, r.server, msg.Question[0].Name, func(ctx context.Context) error {
+		var err error
+		in, err = r.exchange(ctx, msg)
+		return err
+	})
+	return in, err
+}
+
+// exchange sends a single message to the nameserver and returns the raw reply.
+func (r *ClassicResolver) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	in, _, err := r.roundTrip(ctx, msg)
+	return in, err
+}
+
+// roundTrip sends a single message to the nameserver and returns the raw
+// reply, along with the details of the connection it was sent on.
+// In case the response size exceeds 512 bytes (can happen with lot of TXT records),
+// the message is retried over TCP as with UDP the response is truncated.
+// Fallback mechanism is in-line with `dig`.
+func (r *ClassicResolver) roundTrip(ctx context.Context, msg *dns.Msg) (*dns.Msg, connInfo, error) {
+	// The dns library strips the TSIG record off a message while signing it,
+	// so copies are sent to keep msg intact for the retry.
+	signed := msg.IsTsig() != nil
+
+	// Verifying a signed reply needs the state of its own request, so signed
+	// messages aren't pipelined.
+	if r.pool != nil && !signed {
+		return r.pool.exchange(ctx, msg)
+	}
+
+	in, err := r.exchangeWith(ctx, r.client, msg.Copy())
+	if err == nil && in.Truncated && strings.HasPrefix(r.client.Net, "udp") {
+		tcpClient := *r.client
+		tcpClient.Net = strings.Replace(r.client.Net, "udp", "tcp", 1)
+		r.resolverOptions.Logger.Debug("Response truncated; retrying now", "protocol", tcpClient.Net)
+		in, err = r.exchangeWith(ctx, &tcpClient, msg.Copy())
+	}
+
+	// Signed requests expect a signed response. The dns library only checks
+	// the signature when there is one, so a missing TSIG is caught here.
+	if key := r.resolverOptions.TSIG; key != nil && signed {
+		err = key.verify(in, err)
+	}
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+	return in, connInfo{}, nil
+}
+
+// exchangeWith sends msg on a new connection of client.
+func (r *ClassicResolver) exchangeWith(ctx context.Context, client *dns.Client, msg *dns.Msg) (*dns.Msg, error) {
+	conn, err := r.dial(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	in, _, err := client.ExchangeWithConnContext(ctx, msg, conn)
+	return in, err
+}
+
+// dial opens a connection to the nameserver over the network of client,
+// with the dialer of the resolver so that TCP connections can go through a
+// proxy.
+func (r *ClassicResolver) dial(ctx context.Context, client *dns.Client) (*dns.Conn, error) {
+	if r.resolverOptions.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.resolverOptions.Timeout)
+		defer cancel()
+	}
+	network, useTLS := strings.CutSuffix(client.Net, "-tls")
+	conn, err := r.dialer.DialContext(ctx, network, r.server)
+	if err != nil {
+		return nil, err
+	}
+	if useTLS {
+		config := client.TLSConfig
+		if config.ServerName == "" {
+			// As tls.Dial does, the hostname is taken from the address.
+			config = config.Clone()
+			config.ServerName = r.server
+			if host, _, err := net.SplitHostPort(r.server); err == nil {
+				config.ServerName = host
+			}
+		}
+		tc := tls.Client(conn, config)
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+	return &dns.Conn{Conn: conn, UDPSize: client.UDPSize}, nil
+}
+
 // Address implements the Resolver interface.
 func (r *ClassicResolver) Address() string {
 	return r.server
 }
 
+// Close implements io.Closer, closing the pooled TCP and DoT connections.
+func (r *ClassicResolver) Close() error {
+	if r.pool != nil {
+		r.pool.close()
+	}
+	return nil
+}
+
 // Lookup implements the Resolver interface
 func (r *ClassicResolver) Lookup(ctx context.Context, questions []dns.Question, flags QueryFlags) ([]Response, error) {
-	return ConcurrentLookup(ctx, questions, flags, r.query, r.resolverOptions.Logger)
+	return ConcurrentLookup(ctx, questions, flags, withRetries(r.query, r.Address(), r.resolverOptions), r.resolverOptions.Logger)
 }
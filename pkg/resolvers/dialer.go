@@ -0,0 +1,245 @@
+package resolvers
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/quic-go/quic-go"
+)
+
+// ErrProxyUDP is returned for the nameservers queried over UDP or QUIC when
+// Options.Dialer is set, as it only opens TCP connections.
+var ErrProxyUDP = errors.New("UDP and QUIC can't go through a proxy, use tcp://, tls:// or https://")
+
+// Dialer opens the TCP connections of the resolvers, eg through a proxy. See
+// NewProxyDialer.
+type Dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Source is the address and the interface queries are sent from, when
+// Options.Source or Options.Interface chose them.
+type Source struct {
+	Address   string `json:"address,omitempty"`
+	Interface string `json:"interface,omitempty"`
+}
+
+// dialer opens the sockets of a resolver, bound to the address of
+// Options.Source and the interface of Options.Interface when they are set.
+// Its TCP connections go through Options.Dialer when it's set, and through
+// the proxy of the HTTPS_PROXY environment variable otherwise.
+type dialer struct {
+	source  netip.AddrPort
+	iface   string
+	proxy   Dialer
+	timeout time.Duration
+	logger  *slog.Logger
+
+	// port is held by the UDP socket bound to the port of the source, as
+	// several sockets sending to the same nameserver from the same port
+	// would receive each other's responses.
+	port chan struct{}
+}
+
+func newDialer(opts Options) (*dialer, error) {
+	d := &dialer{iface: opts.Interface, proxy: opts.Dialer, timeout: opts.Timeout, logger: opts.Logger}
+	if opts.Source != "" {
+		source, err := parseSource(opts.Source)
+		if err != nil {
+			return nil, err
+		}
+		d.source = source
+		if source.Port() != 0 {
+			d.port = make(chan struct{}, 1)
+		}
+	}
+	if d.iface != "" {
+		if _, err := net.InterfaceByName(d.iface); err != nil {
+			return nil, fmt.Errorf("invalid interface %s: %w", d.iface, err)
+		}
+	}
+	return d, nil
+}
+
+// parseSource parses a source address, an IP optionally followed by a port.
+// The port is 0, any, when there's none.
+func parseSource(s string) (netip.AddrPort, error) {
+	if addr, err := netip.ParseAddr(strings.Trim(s, "[]")); err == nil {
+		return netip.AddrPortFrom(addr, 0), nil
+	}
+	source, err := netip.ParseAddrPort(s)
+	if err != nil {
+		return netip.AddrPort{}, fmt.Errorf("invalid source address %s: want an IP, optionally with a port", s)
+	}
+	return source, nil
+}
+
+// bound reports whether the sockets are bound to a source or an interface.
+func (d *dialer) bound() bool {
+	return d != nil && (d.source.IsValid() || d.iface != "")
+}
+
+// info returns the source of the responses, or nil when the sockets aren't
+// bound.
+func (d *dialer) info() *Source {
+	if !d.bound() {
+		return nil
+	}
+	s := &Source{Interface: d.iface}
+	if d.source.IsValid() {
+		s.Address = d.source.Addr().String()
+		if d.source.Port() != 0 {
+			s.Address = d.source.String()
+		}
+	}
+	return s
+}
+
+// proxied reports whether the TCP connections to address go through a proxy.
+func (d *dialer) proxied(address string) bool {
+	return d.proxy != nil || envProxy(address) != nil
+}
+
+// DialContext opens a connection to address over network, "udp" or "tcp"
+// and their 4 and 6 variants. TCP connections go through the proxy, if any.
+func (d *dialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if !strings.HasPrefix(network, "tcp") {
+		if d.proxy != nil {
+			return nil, ErrProxyUDP
+		}
+		return d.dialDirect(ctx, network, address)
+	}
+	if d.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.timeout)
+		defer cancel()
+	}
+	if d.proxy != nil {
+		d.logger.Debug("Connecting through the dialer", "address", address)
+		return d.proxy.DialContext(ctx, network, address)
+	}
+	if u := envProxy(address); u != nil {
+		d.logger.Debug("Connecting through the proxy of the environment", "proxy", u.Redacted(), "address", address)
+		pd, err := newProxyDialer(u, d.dialDirect)
+		if err != nil {
+			return nil, err
+		}
+		return pd.DialContext(ctx, network, address)
+	}
+	return d.dialDirect(ctx, network, address)
+}
+
+// dialDirect opens a connection to address without going through a proxy.
+// When the source has a port, UDP sockets wait for the previous one to be
+// closed.
+func (d *dialer) dialDirect(ctx context.Context, network, address string) (net.Conn, error) {
+	if d.port == nil || !strings.HasPrefix(network, "udp") {
+		return d.netDialer(network).DialContext(ctx, network, address)
+	}
+	select {
+	case d.port <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	conn, err := d.netDialer(network).DialContext(ctx, network, address)
+	if err != nil {
+		<-d.port
+		return nil, err
+	}
+	return &portConn{UDPConn: conn.(*net.UDPConn), port: d.port}, nil
+}
+
+// portConn is a UDP socket holding the port of the source until it's closed.
+type portConn struct {
+	*net.UDPConn
+	port chan struct{}
+	once sync.Once
+}
+
+func (c *portConn) Close() error {
+	err := c.UDPConn.Close()
+	c.once.Do(func() { <-c.port })
+	return err
+}
+
+// netDialer returns the dialer of the direct connections over network.
+func (d *dialer) netDialer(network string) *net.Dialer {
+	nd := &net.Dialer{Timeout: d.timeout}
+	if !d.bound() {
+		return nd
+	}
+	nd.Control = d.control
+	if d.source.IsValid() {
+		if strings.HasPrefix(network, "udp") {
+			nd.LocalAddr = net.UDPAddrFromAddrPort(d.source)
+		} else {
+			nd.LocalAddr = net.TCPAddrFromAddrPort(d.source)
+		}
+	}
+	return nd
+}
+
+// dialQUIC opens a QUIC connection to address. When the sockets are bound,
+// it's sent from its own UDP socket, closed along with the connection.
+func (d *dialer) dialQUIC(ctx context.Context, address string, tlsConf *tls.Config, conf *quic.Config) (*quic.Conn, error) {
+	if !d.bound() {
+		return quic.DialAddr(ctx, address, tlsConf, conf)
+	}
+	raddr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+	laddr := ""
+	if d.source.IsValid() {
+		laddr = d.source.String()
+	}
+	lc := net.ListenConfig{Control: d.control}
+	pconn, err := lc.ListenPacket(ctx, "udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	tr := &quic.Transport{Conn: pconn}
+	conn, err := tr.Dial(ctx, raddr, tlsConf, conf)
+	if err != nil {
+		_ = tr.Close()
+		return nil, err
+	}
+	go func() {
+		<-conn.Context().Done()
+		_ = tr.Close()
+	}()
+	return conn, nil
+}
+
+// control binds a socket to the interface before it's connected. When the
+// source has a port, the socket shares it with the sockets of the other
+// resolvers.
+func (d *dialer) control(network, address string, c syscall.RawConn) error {
+	d.logger.Debug("Binding socket", "network", network, "address", address, "source", d.source, "interface", d.iface)
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		if d.source.Port() != 0 {
+			if err = reusePort(fd); err != nil {
+				err = fmt.Errorf("reusing port %d: %w", d.source.Port(), err)
+				return
+			}
+		}
+		if d.iface != "" {
+			if err = bindToInterface(fd, network, d.iface); err != nil {
+				err = fmt.Errorf("binding to interface %s: %w", d.iface, err)
+			}
+		}
+	}); cerr != nil {
+		return cerr
+	}
+	return err
+}
@@ -0,0 +1,28 @@
+package resolvers
+
+import (
+	"net"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// bindToInterface sends the packets of the socket out of iface only.
+func bindToInterface(fd uintptr, network string, iface string) error {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return err
+	}
+	if strings.HasSuffix(network, "6") {
+		return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_BOUND_IF, ifi.Index))
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_BOUND_IF, ifi.Index))
+}
+
+// reusePort lets sockets share their address and port with others.
+func reusePort(fd uintptr) error {
+	if err := syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1); err != nil {
+		return os.NewSyscallError("setsockopt", err)
+	}
+	return os.NewSyscallError("setsockopt", syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_REUSEPORT, 1))
+}
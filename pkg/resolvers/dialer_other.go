@@ -0,0 +1,19 @@
+//go:build !linux && !darwin
+
+package resolvers
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// bindToInterface isn't supported on this platform.
+func bindToInterface(uintptr, string, string) error {
+	return fmt.Errorf("binding to an interface isn't supported on %s", runtime.GOOS)
+}
+
+// reusePort does nothing on this platform: the sockets of a resolver bound to
+// a port are still opened one at a time, but several resolvers can't share it.
+func reusePort(uintptr) error {
+	return nil
+}
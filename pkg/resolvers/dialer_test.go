@@ -0,0 +1,199 @@
+package resolvers
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestParseSource(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want string
+	}{
+		{"192.0.2.10", "192.0.2.10:0"},
+		{"192.0.2.10:5353", "192.0.2.10:5353"},
+		{"2001:db8::10", "[2001:db8::10]:0"},
+		{"[2001:db8::10]", "[2001:db8::10]:0"},
+		{"[2001:db8::10]:5353", "[2001:db8::10]:5353"},
+	} {
+		got, err := parseSource(tc.in)
+		if err != nil || got != netip.MustParseAddrPort(tc.want) {
+			t.Errorf("parseSource(%q) = %v, %v, want %s", tc.in, got, err, tc.want)
+		}
+	}
+	for _, in := range []string{"eth0", "192.0.2.10:port", "example.com:53"} {
+		if _, err := parseSource(in); err == nil {
+			t.Errorf("parseSource(%q) succeeded", in)
+		}
+	}
+}
+
+// freePort returns a port of 127.0.0.1 nothing listens on.
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+// loopbackInterface returns the name of the loopback interface, or "" on
+// the platforms binding to an interface isn't supported on.
+func loopbackInterface(t *testing.T) string {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		return ""
+	}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagLoopback != 0 {
+			return ifi.Name
+		}
+	}
+	return ""
+}
+
+func TestClassicResolverSource(t *testing.T) {
+	for name, opts := range map[string]ClassicResolverOpts{
+		"udp": {},
+		"tcp": {UseTCP: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var (
+				mu     sync.Mutex
+				remote string
+			)
+			srv := &dns.Server{Net: name, Addr: "127.0.0.1:0"}
+			srv.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+				mu.Lock()
+				remote = w.RemoteAddr().String()
+				mu.Unlock()
+				_ = w.WriteMsg(pipelineReply(t, req))
+			})
+			ready := make(chan struct{})
+			srv.NotifyStartedFunc = func() { close(ready) }
+			go func() { _ = srv.ListenAndServe() }()
+			select {
+			case <-ready:
+			case <-time.After(2 * time.Second):
+				t.Skip("unable to listen on loopback")
+			}
+			t.Cleanup(func() { _ = srv.Shutdown() })
+			var server string
+			if srv.PacketConn != nil {
+				server = srv.PacketConn.LocalAddr().String()
+			} else {
+				server = srv.Listener.Addr().String()
+			}
+
+			source := "127.0.0.1:" + strconv.Itoa(freePort(t))
+			r, err := NewClassicResolver(server, opts, Options{Logger: discardLogger(), Timeout: 2 * time.Second, Source: source})
+			if err != nil {
+				t.Fatalf("NewClassicResolver: %v", err)
+			}
+			rsp, err := r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{})
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if remote != source {
+				t.Errorf("query sent from %s, want %s", remote, source)
+			}
+			if rsp[0].Source == nil || rsp[0].Source.Address != source {
+				t.Errorf("Source = %+v, want %s", rsp[0].Source, source)
+			}
+		})
+	}
+}
+
+func TestSourcePortShared(t *testing.T) {
+	servers := []string{
+		startStrategyServer(t, "192.0.2.1", 0),
+		startStrategyServer(t, "192.0.2.2", 0),
+	}
+	opts := Options{Logger: discardLogger(), Timeout: 2 * time.Second, Source: "127.0.0.1:" + strconv.Itoa(freePort(t))}
+	questions := append(strategyQuestions(), dns.Question{Name: "c.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET})
+
+	// Every question to every nameserver is sent from the same port at once.
+	var wg sync.WaitGroup
+	for i, server := range servers {
+		r, err := NewClassicResolver(server, ClassicResolverOpts{}, opts)
+		if err != nil {
+			t.Fatalf("NewClassicResolver: %v", err)
+		}
+		wg.Go(func() {
+			rsp, err := r.Lookup(context.Background(), questions, QueryFlags{})
+			if err != nil {
+				t.Errorf("%s: Lookup: %v", server, err)
+				return
+			}
+			want := "192.0.2." + strconv.Itoa(i+1)
+			for _, rs := range rsp {
+				if len(rs.Answers) != 1 || rs.Answers[0].Address != want {
+					t.Errorf("%s: answers = %+v, want %s", server, rs.Answers, want)
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func TestSourceTransports(t *testing.T) {
+	opts := Options{
+		Logger:             discardLogger(),
+		Timeout:            2 * time.Second,
+		InsecureSkipVerify: true,
+		Source:             "127.0.0.1",
+		Interface:          loopbackInterface(t),
+	}
+	doq, _, _ := startDOQServer(t)
+	h3URL, h2URL := startDOHServers(t)
+	stamp := startDNSCryptServer(t)
+
+	for name, newResolver := range map[string]func() (Resolver, error){
+		"doq":         func() (Resolver, error) { return NewDOQResolver(doq, opts) },
+		"doh":         func() (Resolver, error) { return NewDOHResolver(h2URL, opts) },
+		"doh3":        func() (Resolver, error) { return NewDOHResolver(h3URL, opts) },
+		"dnscrypt":    func() (Resolver, error) { return NewDNSCryptResolver(stamp, DNSCryptResolverOpts{}, opts) },
+		"dnscrypttcp": func() (Resolver, error) { return NewDNSCryptResolver(stamp, DNSCryptResolverOpts{UseTCP: true}, opts) },
+	} {
+		t.Run(name, func(t *testing.T) {
+			r, err := newResolver()
+			if err != nil {
+				t.Fatalf("new resolver: %v", err)
+			}
+			rsp, err := r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{})
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+			want := Source{Address: "127.0.0.1", Interface: opts.Interface}
+			if rsp[0].Source == nil || *rsp[0].Source != want {
+				t.Errorf("Source = %+v, want %+v", rsp[0].Source, want)
+			}
+		})
+	}
+}
+
+func TestDialerErrors(t *testing.T) {
+	for name, opts := range map[string]Options{
+		"source":    {Source: "eth0"},
+		"interface": {Interface: "doggo-no-such-interface"},
+	} {
+		if _, err := NewClassicResolver("127.0.0.1:53", ClassicResolverOpts{}, opts); err == nil {
+			t.Errorf("%s: NewClassicResolver succeeded", name)
+		}
+	}
+}
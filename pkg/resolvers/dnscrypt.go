@@ -2,18 +2,32 @@ package resolvers
 
 import (
 	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"sync"
 	"time"
 
 	"github.com/ameshkov/dnscrypt/v2"
+	"github.com/ameshkov/dnscrypt/v2/xsecretbox"
+	"github.com/ameshkov/dnsstamps"
 	"github.com/miekg/dns"
+	"golang.org/x/crypto/nacl/box"
 )
 
 // DNSCryptResolver represents the config options for setting up a Resolver.
+// The certificate of the server is only fetched by the first query, and
+// fetched again once it expires.
 type DNSCryptResolver struct {
 	client          *dnscrypt.Client
+	dialer          *dialer
+	stamp           dnsstamps.ServerStamp
 	server          string
-	resolverInfo    *dnscrypt.ResolverInfo
 	resolverOptions Options
+	validator       *dnssecValidator
+
+	mu           sync.Mutex
+	resolverInfo *dnscrypt.ResolverInfo
 }
 
 // DNSCryptResolverOpts holds options for setting up a DNSCrypt resolver.
@@ -21,24 +35,49 @@ type DNSCryptResolverOpts struct {
 	UseTCP bool
 }
 
-// NewDNSCryptResolver accepts a list of nameservers and configures a DNS resolver.
+// DNSCryptCert holds the details of the certificate a DNSCrypt server
+// answered with.
+type DNSCryptCert struct {
+	Provider   string `json:"provider"`
+	Serial     uint32 `json:"serial"`
+	EsVersion  string `json:"es_version"`
+	ValidFrom  string `json:"valid_from"`
+	ValidUntil string `json:"valid_until"`
+}
+
+// NewDNSCryptResolver accepts a sdns:// stamp of a DNSCrypt server and
+// configures a DNS resolver. Nothing is sent to the server until the first
+// query.
 func NewDNSCryptResolver(server string, dnscryptOpts DNSCryptResolverOpts, resolverOpts Options) (Resolver, error) {
+	stamp, err := dnsstamps.NewServerStampFromString(server)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DNSCrypt stamp %s: %w", server, err)
+	}
+	if stamp.Proto != dnsstamps.StampProtoTypeDNSCrypt {
+		return nil, fmt.Errorf("%s is not a DNSCrypt stamp", server)
+	}
+
 	net := "udp"
 	if dnscryptOpts.UseTCP {
 		net = "tcp"
 	}
 
-	client := &dnscrypt.Client{Net: net, Timeout: resolverOpts.Timeout, UDPSize: 1232}
-	resolverInfo, err := client.Dial(server)
+	d, err := newDialer(resolverOpts)
 	if err != nil {
 		return nil, err
 	}
-	return &DNSCryptResolver{
-		client:          client,
-		resolverInfo:    resolverInfo,
-		server:          resolverInfo.ServerAddress,
+	if resolverOpts.Dialer != nil && !dnscryptOpts.UseTCP {
+		return nil, fmt.Errorf("%s: %w", server, ErrProxyUDP)
+	}
+	r := &DNSCryptResolver{
+		client:          &dnscrypt.Client{Net: net, Timeout: resolverOpts.Timeout, UDPSize: 1232},
+		dialer:          d,
+		stamp:           stamp,
+		server:          stamp.ServerAddrStr,
 		resolverOptions: resolverOpts,
-	}, nil
+	}
+	r.validator = newDNSSECValidator(r.exchange, resolverOpts.Logger)
+	return r, nil
 }
 
 // Address implements the Resolver interface.
@@ -48,14 +87,15 @@ func (r *DNSCryptResolver) Address() string {
 
 // Lookup implements the Resolver interface
 func (r *DNSCryptResolver) Lookup(ctx context.Context, questions []dns.Question, flags QueryFlags) ([]Response, error) {
-	return ConcurrentLookup(ctx, questions, flags, r.query, r.resolverOptions.Logger)
+	return ConcurrentLookup(ctx, questions, flags, withRetries(r.query, r.Address(), r.resolverOptions), r.resolverOptions.Logger)
 }
 
 // query performs a single DNS query
 func (r *DNSCryptResolver) query(ctx context.Context, question dns.Question, flags QueryFlags) (Response, error) {
 	var (
 		rsp      Response
-		messages = prepareMessages(question, flags, r.resolverOptions.Ndots, r.resolverOptions.SearchList)
+		final    *dns.Msg
+		messages = prepareMessages(question, flags, r.resolverOptions.Ndots, r.resolverOptions.SearchList, nil)
 	)
 	for _, msg := range messages {
 		r.resolverOptions.Logger.Debug("Attempting to resolve",
@@ -65,53 +105,256 @@ func (r *DNSCryptResolver) query(ctx context.Context, question dns.Question, fla
 		)
 
 		now := time.Now()
+		in, info, err := r.roundTrip(ctx, &msg)
+		if err != nil {
+			return rsp, err
+		}
+		rtt := time.Since(now)
 
-		// Use a channel to handle the result of the Exchange
-		resultChan := make(chan struct {
-			resp *dns.Msg
-			err  error
-		})
-
-		go func() {
-			resp, err := r.client.Exchange(&msg, r.resolverInfo)
-			resultChan <- struct {
-				resp *dns.Msg
-				err  error
-			}{resp, err}
-		}()
-
-		// Wait for either the query to complete or the context to be cancelled
-		select {
-		case result := <-resultChan:
-			if result.err != nil {
-				return rsp, result.err
+		// pack questions in output.
+		for _, q := range msg.Question {
+			ques := Question{
+				Name:  q.Name,
+				Class: dns.ClassToString[q.Qclass],
+				Type:  dns.TypeToString[q.Qtype],
 			}
-			in := result.resp
-			rtt := time.Since(now)
-
-			// pack questions in output.
-			for _, q := range msg.Question {
-				ques := Question{
-					Name:  q.Name,
-					Class: dns.ClassToString[q.Qclass],
-					Type:  dns.TypeToString[q.Qtype],
-				}
-				rsp.Questions = append(rsp.Questions, ques)
-			}
-			// get the authorities and answers.
-			output := parseMessage(in, rtt, r.server)
-			rsp.Authorities = output.Authorities
-			rsp.Answers = output.Answers
-			rsp.Additional = output.Additional
-			rsp.Edns = output.Edns
-
-			if len(output.Answers) > 0 || in.Rcode == dns.RcodeSuccess {
-				// stop iterating the searchlist.
-				return rsp, nil
-			}
-		case <-ctx.Done():
-			return rsp, ctx.Err()
+			rsp.Questions = append(rsp.Questions, ques)
+		}
+		// get the authorities and answers.
+		output := parseMessage(in, rtt, r.server)
+		rsp.Authorities = output.Authorities
+		rsp.Answers = output.Answers
+		rsp.Additional = output.Additional
+		rsp.Edns = output.Edns
+		rsp.Status = output.Status
+		rsp.Nameserver = output.Nameserver
+		rsp.DNSCrypt = dnscryptCert(info)
+		rsp.Source = r.dialer.info()
+		final = in
+
+		if len(output.Answers) > 0 || in.Rcode == dns.RcodeSuccess {
+			// stop iterating the searchlist.
+			break
 		}
 	}
+
+	if flags.Validate && final != nil {
+		rsp.DNSSEC = r.validator.validate(ctx, final)
+	}
 	return rsp, nil
 }
+
+// exchange sends a single message to the DNSCrypt server and returns the raw
+// reply, giving up as soon as the context is done.
+func (r *DNSCryptResolver) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	in, _, err := r.roundTrip(ctx, msg)
+	return in, err
+}
+
+// roundTrip sends msg to the server with the current certificate and returns
+// the reply along with the resolver info it was encrypted with.
+func (r *DNSCryptResolver) roundTrip(ctx context.Context, msg *dns.Msg) (*dns.Msg, *dnscrypt.ResolverInfo, error) {
+	// Use a channel to handle the result of the Exchange
+	resultChan := make(chan struct {
+		resp *dns.Msg
+		info *dnscrypt.ResolverInfo
+		err  error
+	}, 1)
+
+	go func() {
+		info, err := r.dial(ctx)
+		var resp *dns.Msg
+		if err == nil {
+			resp, err = r.send(ctx, msg, info)
+		}
+		resultChan <- struct {
+			resp *dns.Msg
+			info *dnscrypt.ResolverInfo
+			err  error
+		}{resp, info, err}
+	}()
+
+	// Wait for either the query to complete or the context to be cancelled
+	select {
+	case result := <-resultChan:
+		return result.resp, result.info, result.err
+	case <-ctx.Done():
+		return nil, nil, ctx.Err()
+	}
+}
+
+// send encrypts msg with info and sends it to the server, on a connection of
+// the dialer.
+func (r *DNSCryptResolver) send(ctx context.Context, msg *dns.Msg, info *dnscrypt.ResolverInfo) (*dns.Msg, error) {
+	conn, err := r.dialer.DialContext(ctx, r.client.Net, r.server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, ok := conn.(*net.TCPConn); ok || r.client.Net == "udp" {
+		return r.client.ExchangeConn(conn, msg, info)
+	}
+	return r.sendStream(conn, msg, info)
+}
+
+// sendStream does what dnscrypt.Client.ExchangeConn does on the TCP
+// connections it doesn't recognize as such, those of a proxy: it only
+// prefixes the messages with their length on a *net.TCPConn.
+func (r *DNSCryptResolver) sendStream(conn net.Conn, msg *dns.Msg, info *dnscrypt.ResolverInfo) (*dns.Msg, error) {
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+	q := dnscrypt.EncryptedQuery{
+		EsVersion:   info.ResolverCert.EsVersion,
+		ClientMagic: info.ResolverCert.ClientMagic,
+		ClientPk:    info.PublicKey,
+	}
+	query, err := q.Encrypt(packed, info.SharedKey)
+	if err != nil {
+		return nil, err
+	}
+	if r.client.Timeout > 0 {
+		_ = conn.SetDeadline(time.Now().Add(r.client.Timeout))
+	}
+	stream := &dns.Conn{Conn: conn}
+	if _, err := stream.Write(query); err != nil {
+		return nil, err
+	}
+	b := make([]byte, dns.MaxMsgSize)
+	n, err := stream.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	resp := dnscrypt.EncryptedResponse{EsVersion: info.ResolverCert.EsVersion}
+	plain, err := resp.Decrypt(b[:n], info.SharedKey)
+	if err != nil {
+		return nil, err
+	}
+	in := new(dns.Msg)
+	if err := in.Unpack(plain); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
+
+// dial returns the resolver info of the server, fetching its certificate if
+// it hasn't been yet or if the one it has expired.
+func (r *DNSCryptResolver) dial(ctx context.Context) (*dnscrypt.ResolverInfo, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.resolverInfo != nil {
+		notAfter := time.Unix(int64(r.resolverInfo.ResolverCert.NotAfter), 0)
+		if time.Now().Before(notAfter) {
+			return r.resolverInfo, nil
+		}
+		r.resolverOptions.Logger.Debug("DNSCrypt certificate expired, fetching a new one",
+			"nameserver", r.server,
+			"serial", r.resolverInfo.ResolverCert.Serial,
+			"not_after", notAfter,
+		)
+	}
+
+	info, err := r.dialStamp(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("fetching the DNSCrypt certificate: %w", err)
+	}
+	r.resolverOptions.Logger.Debug("Fetched DNSCrypt certificate",
+		"nameserver", r.server,
+		"provider", info.ProviderName,
+		"serial", info.ResolverCert.Serial,
+	)
+	r.resolverInfo = info
+	return info, nil
+}
+
+// dialStamp does what dnscrypt.Client.DialStamp does, on the sockets of the
+// dialer: it fetches the certificates of the server, keeps the valid one
+// with the highest serial and computes the key shared with the server.
+func (r *DNSCryptResolver) dialStamp(ctx context.Context) (*dnscrypt.ResolverInfo, error) {
+	provider := dns.Fqdn(r.stamp.ProviderName)
+	query := new(dns.Msg)
+	query.SetQuestion(provider, dns.TypeTXT)
+	conn, err := r.dialer.DialContext(ctx, r.client.Net, r.stamp.ServerAddrStr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	client := &dns.Client{Net: r.client.Net, Timeout: r.client.Timeout}
+	in, _, err := client.ExchangeWithConnContext(ctx, query, &dns.Conn{Conn: conn, UDPSize: 1252})
+	if err != nil {
+		return nil, err
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		return nil, dnscrypt.ErrFailedToFetchCert
+	}
+
+	var cert *dnscrypt.Cert
+	for _, rr := range in.Answer {
+		txt, ok := rr.(*dns.TXT)
+		if !ok {
+			continue
+		}
+		c := &dnscrypt.Cert{}
+		if err := c.Deserialize(txtBytes(txt)); err != nil || !c.VerifyDate() || !c.VerifySignature(r.stamp.ServerPk) {
+			r.resolverOptions.Logger.Debug("Skipping invalid DNSCrypt certificate", "provider", provider, "error", err)
+			continue
+		}
+		if cert == nil || c.Serial > cert.Serial || c.Serial == cert.Serial && c.EsVersion > cert.EsVersion {
+			cert = c
+		}
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("no valid certificate for provider %s", provider)
+	}
+
+	pk, sk, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	info := &dnscrypt.ResolverInfo{
+		SecretKey:       *sk,
+		PublicKey:       *pk,
+		ServerPublicKey: r.stamp.ServerPk,
+		ServerAddress:   r.stamp.ServerAddrStr,
+		ProviderName:    r.stamp.ProviderName,
+		ResolverCert:    cert,
+	}
+	switch cert.EsVersion {
+	case dnscrypt.XChacha20Poly1305:
+		if info.SharedKey, err = xsecretbox.SharedKey(info.SecretKey, cert.ResolverPk); err != nil {
+			return nil, err
+		}
+	case dnscrypt.XSalsa20Poly1305:
+		box.Precompute(&info.SharedKey, &cert.ResolverPk, &info.SecretKey)
+	default:
+		return nil, dnscrypt.ErrEsVersion
+	}
+	return info, nil
+}
+
+// txtBytes returns the strings of txt concatenated, with their presentation
+// format escapes turned back into raw bytes.
+func txtBytes(txt *dns.TXT) []byte {
+	var b []byte
+	for _, s := range txt.Txt {
+		b = append(b, unescapeLabel(s)...)
+	}
+	return b
+}
+
+// dnscryptCert returns the details of the certificate of info.
+func dnscryptCert(info *dnscrypt.ResolverInfo) *DNSCryptCert {
+	if info == nil || info.ResolverCert == nil {
+		return nil
+	}
+	cert := info.ResolverCert
+	return &DNSCryptCert{
+		Provider:   info.ProviderName,
+		Serial:     cert.Serial,
+		EsVersion:  cert.EsVersion.String(),
+		ValidFrom:  time.Unix(int64(cert.NotBefore), 0).UTC().Format(time.RFC3339),
+		ValidUntil: time.Unix(int64(cert.NotAfter), 0).UTC().Format(time.RFC3339),
+	}
+}
@@ -0,0 +1,156 @@
+package resolvers
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/dnscrypt/v2"
+	"github.com/miekg/dns"
+)
+
+type dnscryptHandler struct {
+	t *testing.T
+}
+
+// ServeDNS answers every A query with 192.0.2.1.
+func (h dnscryptHandler) ServeDNS(rw dnscrypt.ResponseWriter, r *dns.Msg) error {
+	m := new(dns.Msg)
+	m.SetReply(r)
+	m.Answer = append(m.Answer, testRR(h.t, r.Question[0].Name+" 60 IN A 192.0.2.1"))
+	return rw.WriteMsg(m)
+}
+
+// startDNSCryptServer starts a DNSCrypt server over UDP and TCP on the same
+// port and returns its stamp.
+func startDNSCryptServer(t *testing.T) string {
+	t.Helper()
+	rc, err := dnscrypt.GenerateResolverConfig("example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc.EsVersion = dnscrypt.XChacha20Poly1305
+	cert, err := rc.CreateCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := &dnscrypt.Server{
+		ProviderName: rc.ProviderName,
+		ResolverCert: cert,
+		Handler:      dnscryptHandler{t: t},
+		Logger:       discardLogger(),
+	}
+
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	tcp, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: udp.LocalAddr().(*net.UDPAddr).Port})
+	if err != nil {
+		_ = udp.Close()
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	go func() { _ = srv.ServeUDP(udp) }()
+	go func() { _ = srv.ServeTCP(tcp) }()
+	t.Cleanup(func() { _ = srv.Shutdown(context.Background()) })
+
+	stamp, err := rc.CreateStamp(udp.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return stamp.String()
+}
+
+func dnscryptLookup(t *testing.T, r Resolver) Response {
+	t.Helper()
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	rsp, err := r.Lookup(context.Background(), []dns.Question{q}, QueryFlags{})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(rsp) != 1 || len(rsp[0].Answers) != 1 || rsp[0].Answers[0].Address != "192.0.2.1" {
+		t.Fatalf("responses = %+v, want the answer 192.0.2.1", rsp)
+	}
+	return rsp[0]
+}
+
+func TestDNSCryptResolver(t *testing.T) {
+	stamp := startDNSCryptServer(t)
+	for _, tcp := range []bool{false, true} {
+		r, err := NewDNSCryptResolver(stamp, DNSCryptResolverOpts{UseTCP: tcp}, Options{Logger: discardLogger(), Timeout: 2 * time.Second})
+		if err != nil {
+			t.Fatalf("NewDNSCryptResolver: %v", err)
+		}
+		rsp := dnscryptLookup(t, r)
+		if rsp.Nameserver != r.Address() {
+			t.Errorf("tcp=%v: Nameserver = %q, want %q", tcp, rsp.Nameserver, r.Address())
+		}
+		cert := rsp.DNSCrypt
+		if cert == nil {
+			t.Fatalf("tcp=%v: the response has no certificate", tcp)
+		}
+		if cert.Provider != "2.dnscrypt-cert.example.org" || cert.EsVersion != "XChacha20Poly1305" || cert.Serial == 0 {
+			t.Errorf("tcp=%v: certificate = %+v", tcp, cert)
+		}
+		if _, err := time.Parse(time.RFC3339, cert.ValidUntil); err != nil {
+			t.Errorf("tcp=%v: ValidUntil = %q: %v", tcp, cert.ValidUntil, err)
+		}
+	}
+}
+
+func TestDNSCryptResolverFetchesCertLazily(t *testing.T) {
+	stamp := startDNSCryptServer(t)
+	r, err := NewDNSCryptResolver(stamp, DNSCryptResolverOpts{}, Options{Logger: discardLogger(), Timeout: 2 * time.Second})
+	if err != nil {
+		t.Fatalf("NewDNSCryptResolver: %v", err)
+	}
+	dr := r.(*DNSCryptResolver)
+	if dr.resolverInfo != nil {
+		t.Fatal("the certificate was fetched before the first query")
+	}
+
+	dnscryptLookup(t, r)
+	first := dr.resolverInfo
+	dnscryptLookup(t, r)
+	if dr.resolverInfo != first {
+		t.Error("the certificate was fetched again while still valid")
+	}
+
+	// Once it expires, the next query fetches it again.
+	first.ResolverCert.NotAfter = uint32(time.Now().Add(-time.Minute).Unix())
+	dnscryptLookup(t, r)
+	if dr.resolverInfo == first {
+		t.Error("the expired certificate wasn't refreshed")
+	}
+}
+
+func TestDNSCryptResolverUnreachable(t *testing.T) {
+	// Nothing answers on that socket.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	rc, err := dnscrypt.GenerateResolverConfig("example.org", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stamp, err := rc.CreateStamp(conn.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewDNSCryptResolver(stamp.String(), DNSCryptResolverOpts{}, Options{Logger: discardLogger(), Timeout: 200 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewDNSCryptResolver of an unreachable server: %v", err)
+	}
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	if _, err := r.Lookup(context.Background(), []dns.Question{q}, QueryFlags{}); err == nil {
+		t.Error("Lookup of an unreachable server succeeded")
+	}
+
+	if _, err := NewDNSCryptResolver("sdns://invalid", DNSCryptResolverOpts{}, Options{}); err == nil {
+		t.Error("NewDNSCryptResolver accepted an invalid stamp")
+	}
+}
@@ -0,0 +1,765 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DNSSEC validation verdicts, as described in RFC 4035 section 4.3.
+const (
+	DNSSECSecure        = "secure"
+	DNSSECInsecure      = "insecure"
+	DNSSECBogus         = "bogus"
+	DNSSECIndeterminate = "indeterminate"
+)
+
+// DNSSECValidation is the outcome of validating a response's chain of trust
+// from the root trust anchor down to the queried name. FailingLink names the
+// RRset (e.g. "DS example.com.") where the chain stopped being secure.
+type DNSSECValidation struct {
+	Verdict     string `json:"verdict"`
+	FailingLink string `json:"failing_link,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+// rootTrustAnchors are the DS records of the root zone KSKs published by IANA
+// (https://data.iana.org/root-anchors/root-anchors.xml).
+var rootTrustAnchors = []string{
+	". 0 IN DS 20326 8 2 E06D44B80B8F1D39A95C0B0D7C65D08458E880409BBC683457104237C7F8EC8D",
+	". 0 IN DS 38696 8 2 683D2D0ACB8C9B712A1948B27F741219298D0A450D612C483AF444A4C0FB2B16",
+}
+
+// exchangeFunc sends a single prepared message to a nameserver and returns
+// the raw reply. Every resolver exposes one so the validator can fetch
+// DNSKEY and DS RRsets over the same transport as the original query.
+type exchangeFunc func(ctx context.Context, msg *dns.Msg) (*dns.Msg, error)
+
+// dnssecValidator walks the chain of trust for responses obtained from a
+// single nameserver. Zone results are cached so a lookup with many questions
+// only establishes trust in each zone once.
+type dnssecValidator struct {
+	exchange exchangeFunc
+	logger   *slog.Logger
+	now      func() time.Time
+
+	mu    sync.Mutex
+	zones map[string]*zoneTrustEntry
+}
+
+// zoneTrust is the outcome of establishing trust in a zone's DNSKEY RRset.
+// keys is only populated for secure zones.
+type zoneTrust struct {
+	keys []*dns.DNSKEY
+	DNSSECValidation
+}
+
+type zoneTrustEntry struct {
+	once  sync.Once
+	trust zoneTrust
+}
+
+func newDNSSECValidator(exchange exchangeFunc, logger *slog.Logger) *dnssecValidator {
+	return &dnssecValidator{
+		exchange: exchange,
+		logger:   logger,
+		now:      time.Now,
+		zones:    make(map[string]*zoneTrustEntry),
+	}
+}
+
+// validate returns the verdict for a response: every answer RRset is checked
+// against the zone that signed it, and negative answers must carry a signed
+// denial of existence.
+func (v *dnssecValidator) validate(ctx context.Context, in *dns.Msg) *DNSSECValidation {
+	if len(in.Question) == 0 {
+		return &DNSSECValidation{Verdict: DNSSECIndeterminate, Reason: "response carries no question"}
+	}
+	q := in.Question[0]
+
+	if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+		return &DNSSECValidation{
+			Verdict:     DNSSECIndeterminate,
+			FailingLink: rrsetLink(q.Qtype, q.Name),
+			Reason:      fmt.Sprintf("server returned %s", dns.RcodeToString[in.Rcode]),
+		}
+	}
+
+	result := DNSSECValidation{Verdict: DNSSECSecure}
+	order, sets, sigs := groupRRsets(in.Answer)
+	for _, key := range order {
+		result = worseVerdict(result, v.validateRRset(ctx, in, key, sets[key], sigs[key]))
+	}
+	if len(order) == 0 {
+		result = worseVerdict(result, v.validateDenial(ctx, in, q))
+	}
+
+	v.logger.Debug("DNSSEC validation finished",
+		"name", q.Name,
+		"type", dns.TypeToString[q.Qtype],
+		"verdict", result.Verdict,
+		"failing_link", result.FailingLink,
+	)
+	return &result
+}
+
+// validateRRset checks a single RRset of in against the keys of its signer
+// zone. An RRset expanded from a wildcard also needs a signed proof in the
+// authority section that no closer name exists.
+func (v *dnssecValidator) validateRRset(ctx context.Context, in *dns.Msg, key rrsetKey, rrset []dns.RR, sigs []*dns.RRSIG) DNSSECValidation {
+	link := rrsetLink(key.rrtype, key.name)
+	if len(sigs) == 0 {
+		// Unsigned data is fine in an insecure zone and bogus in a signed one.
+		trust := v.zoneTrust(ctx, v.findZone(ctx, key.name))
+		if trust.Verdict != DNSSECSecure {
+			return trust.DNSSECValidation
+		}
+		return DNSSECValidation{Verdict: DNSSECBogus, FailingLink: link, Reason: "missing RRSIG in a signed zone"}
+	}
+
+	signer := sigs[0].SignerName
+	if !dns.IsSubDomain(signer, key.name) {
+		return DNSSECValidation{Verdict: DNSSECBogus, FailingLink: link, Reason: fmt.Sprintf("signer %s is not an ancestor of the owner name", signer)}
+	}
+	trust := v.zoneTrust(ctx, signer)
+	if trust.Verdict != DNSSECSecure {
+		return trust.DNSSECValidation
+	}
+	if err := v.verifyRRset(rrset, sigs, trust.keys); err != nil {
+		return DNSSECValidation{Verdict: DNSSECBogus, FailingLink: link, Reason: err.Error()}
+	}
+
+	// The Labels field of an RRSIG counts the labels of the wildcard the
+	// RRset was expanded from, without the "*".
+	labels := dns.CountLabel(key.name)
+	for _, sig := range sigs {
+		labels = min(labels, int(sig.Labels))
+	}
+	if labels < dns.CountLabel(key.name) && !strings.HasPrefix(key.name, "*.") {
+		order, sets, nsSigs := groupRRsets(in.Ns)
+		denial, err := v.signedDenial(order, sets, nsSigs, trust.keys)
+		if err != nil {
+			return DNSSECValidation{Verdict: DNSSECBogus, FailingLink: link, Reason: "wildcard expansion: " + err.Error()}
+		}
+		if !nameCovered(denial, key.name, lastLabels(key.name, labels)) {
+			return DNSSECValidation{Verdict: DNSSECBogus, FailingLink: link, Reason: fmt.Sprintf("wildcard expansion without a proof that %s does not exist", key.name)}
+		}
+	}
+	return DNSSECValidation{Verdict: DNSSECSecure}
+}
+
+// validateDenial checks the signed NSEC/NSEC3 proof carried by an NXDOMAIN or
+// NODATA response.
+func (v *dnssecValidator) validateDenial(ctx context.Context, in *dns.Msg, q dns.Question) DNSSECValidation {
+	link := rrsetLink(dns.TypeNSEC, q.Name)
+	order, sets, sigs := groupRRsets(in.Ns)
+
+	var signer string
+	for _, key := range order {
+		if len(sigs[key]) > 0 {
+			signer = sigs[key][0].SignerName
+			break
+		}
+	}
+	if signer == "" {
+		zone := soaOwner(in.Ns)
+		if zone == "" {
+			zone = v.findZone(ctx, q.Name)
+		}
+		trust := v.zoneTrust(ctx, zone)
+		if trust.Verdict != DNSSECSecure {
+			return trust.DNSSECValidation
+		}
+		return DNSSECValidation{Verdict: DNSSECBogus, FailingLink: link, Reason: "denial of existence is not signed"}
+	}
+
+	trust := v.zoneTrust(ctx, signer)
+	if trust.Verdict != DNSSECSecure {
+		return trust.DNSSECValidation
+	}
+	if res, ok := v.verifyDenial(order, sets, sigs, trust.keys, q.Name, q.Qtype, in.Rcode == dns.RcodeNameError); !ok {
+		res.FailingLink = link
+		return res
+	}
+	return DNSSECValidation{Verdict: DNSSECSecure}
+}
+
+// verifyDenial verifies every signed RRset in an authority section and checks
+// that NSEC or NSEC3 records prove name/qtype does not exist. With nxdomain,
+// they must prove that neither name nor the wildcard that could have been
+// expanded for it exists.
+func (v *dnssecValidator) verifyDenial(order []rrsetKey, sets map[rrsetKey][]dns.RR, sigs map[rrsetKey][]*dns.RRSIG, keys []*dns.DNSKEY, name string, qtype uint16, nxdomain bool) (DNSSECValidation, bool) {
+	denial, err := v.signedDenial(order, sets, sigs, keys)
+	if err != nil {
+		return DNSSECValidation{Verdict: DNSSECBogus, Reason: err.Error()}, false
+	}
+	if nxdomain {
+		if !nameDenied(denial, name) {
+			return DNSSECValidation{Verdict: DNSSECBogus, Reason: fmt.Sprintf("NSEC records do not prove %s and its wildcard do not exist", name)}, false
+		}
+	} else if !denialCovers(denial, name, qtype) {
+		return DNSSECValidation{Verdict: DNSSECBogus, Reason: fmt.Sprintf("NSEC records do not cover %s", name)}, false
+	}
+	return DNSSECValidation{Verdict: DNSSECSecure}, true
+}
+
+// signedDenial verifies the NSEC, NSEC3 and SOA RRsets of an authority
+// section and returns its NSEC and NSEC3 records.
+func (v *dnssecValidator) signedDenial(order []rrsetKey, sets map[rrsetKey][]dns.RR, sigs map[rrsetKey][]*dns.RRSIG, keys []*dns.DNSKEY) ([]dns.RR, error) {
+	var denial []dns.RR
+	for _, key := range order {
+		if key.rrtype != dns.TypeNSEC && key.rrtype != dns.TypeNSEC3 && key.rrtype != dns.TypeSOA {
+			continue
+		}
+		if len(sigs[key]) == 0 {
+			return nil, fmt.Errorf("missing RRSIG for %s", rrsetLink(key.rrtype, key.name))
+		}
+		if err := v.verifyRRset(sets[key], sigs[key], keys); err != nil {
+			return nil, fmt.Errorf("%s: %w", rrsetLink(key.rrtype, key.name), err)
+		}
+		if key.rrtype != dns.TypeSOA {
+			denial = append(denial, sets[key]...)
+		}
+	}
+	if len(denial) == 0 {
+		return nil, errors.New("no NSEC or NSEC3 records prove the denial")
+	}
+	return denial, nil
+}
+
+// zoneTrust returns the cached trust status of zone, establishing it on
+// first use.
+func (v *dnssecValidator) zoneTrust(ctx context.Context, zone string) zoneTrust {
+	zone = dns.CanonicalName(zone)
+
+	v.mu.Lock()
+	entry, ok := v.zones[zone]
+	if !ok {
+		entry = &zoneTrustEntry{}
+		v.zones[zone] = entry
+	}
+	v.mu.Unlock()
+
+	entry.once.Do(func() {
+		entry.trust = v.establish(ctx, zone)
+		v.logger.Debug("Established DNSSEC zone trust",
+			"zone", zone,
+			"verdict", entry.trust.Verdict,
+			"failing_link", entry.trust.FailingLink,
+		)
+	})
+	return entry.trust
+}
+
+// establish builds trust in a zone's DNSKEY RRset: the root is anchored to
+// rootTrustAnchors, every other zone to a DS RRset validated by its parent.
+// A signed proof that the parent has no DS for the zone makes it insecure.
+func (v *dnssecValidator) establish(ctx context.Context, zone string) zoneTrust {
+	if zone == "." {
+		anchors := make([]*dns.DS, 0, len(rootTrustAnchors))
+		for _, a := range rootTrustAnchors {
+			if rr, err := dns.NewRR(a); err == nil {
+				if ds, ok := rr.(*dns.DS); ok {
+					anchors = append(anchors, ds)
+				}
+			}
+		}
+		return v.verifyZoneKeys(ctx, zone, anchors)
+	}
+
+	dsLink := rrsetLink(dns.TypeDS, zone)
+	in, err := v.fetch(ctx, zone, dns.TypeDS)
+	if err != nil {
+		return failedTrust(DNSSECIndeterminate, dsLink, err.Error())
+	}
+	if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+		return failedTrust(DNSSECIndeterminate, dsLink, fmt.Sprintf("server returned %s", dns.RcodeToString[in.Rcode]))
+	}
+
+	var (
+		dsSet  []dns.RR
+		anchor []*dns.DS
+		dsSigs []*dns.RRSIG
+	)
+	for _, rr := range in.Answer {
+		switch r := rr.(type) {
+		case *dns.DS:
+			if strings.EqualFold(r.Hdr.Name, zone) {
+				dsSet = append(dsSet, r)
+				anchor = append(anchor, r)
+			}
+		case *dns.RRSIG:
+			if r.TypeCovered == dns.TypeDS && strings.EqualFold(r.Hdr.Name, zone) {
+				dsSigs = append(dsSigs, r)
+			}
+		}
+	}
+
+	if len(dsSet) > 0 {
+		parent := ""
+		if len(dsSigs) > 0 {
+			parent = dsSigs[0].SignerName
+		} else {
+			parent = v.findZone(ctx, parentName(zone))
+		}
+		if !isProperAncestor(parent, zone) {
+			return failedTrust(DNSSECBogus, dsLink, fmt.Sprintf("DS signed by %s, which is not a parent zone", parent))
+		}
+		parentTrust := v.zoneTrust(ctx, parent)
+		if parentTrust.Verdict != DNSSECSecure {
+			return parentTrust
+		}
+		if len(dsSigs) == 0 {
+			return failedTrust(DNSSECBogus, dsLink, "missing RRSIG in a signed zone")
+		}
+		if err := v.verifyRRset(dsSet, dsSigs, parentTrust.keys); err != nil {
+			return failedTrust(DNSSECBogus, dsLink, err.Error())
+		}
+		return v.verifyZoneKeys(ctx, zone, anchor)
+	}
+
+	// No DS RRset: the delegation is insecure if the parent is secure and
+	// proves the absence with a signed NSEC/NSEC3 record.
+	order, sets, sigs := groupRRsets(in.Ns)
+	parent := ""
+	for _, key := range order {
+		if len(sigs[key]) > 0 {
+			parent = sigs[key][0].SignerName
+			break
+		}
+	}
+	if parent == "" {
+		parent = soaOwner(in.Ns)
+	}
+	if parent == "" || !isProperAncestor(parent, zone) {
+		parent = v.findZone(ctx, parentName(zone))
+	}
+	if !isProperAncestor(parent, zone) {
+		return failedTrust(DNSSECIndeterminate, dsLink, "unable to locate the parent zone")
+	}
+	parentTrust := v.zoneTrust(ctx, parent)
+	if parentTrust.Verdict != DNSSECSecure {
+		return parentTrust
+	}
+	if res, ok := v.verifyDenial(order, sets, sigs, parentTrust.keys, zone, dns.TypeDS, in.Rcode == dns.RcodeNameError); !ok {
+		return failedTrust(res.Verdict, dsLink, "DS absence is not proven: "+res.Reason)
+	}
+	return failedTrust(DNSSECInsecure, dsLink, "parent proves there is no DS record; delegation is unsigned")
+}
+
+// verifyZoneKeys fetches the DNSKEY RRset of zone, checks it contains a key
+// matching one of the DS records and that the RRset is signed by that key.
+func (v *dnssecValidator) verifyZoneKeys(ctx context.Context, zone string, anchors []*dns.DS) zoneTrust {
+	link := rrsetLink(dns.TypeDNSKEY, zone)
+	in, err := v.fetch(ctx, zone, dns.TypeDNSKEY)
+	if err != nil {
+		return failedTrust(DNSSECIndeterminate, link, err.Error())
+	}
+	if in.Rcode != dns.RcodeSuccess {
+		return failedTrust(DNSSECIndeterminate, link, fmt.Sprintf("server returned %s", dns.RcodeToString[in.Rcode]))
+	}
+
+	var (
+		keys    []*dns.DNSKEY
+		keySet  []dns.RR
+		keySigs []*dns.RRSIG
+	)
+	for _, rr := range in.Answer {
+		switch r := rr.(type) {
+		case *dns.DNSKEY:
+			if strings.EqualFold(r.Hdr.Name, zone) {
+				keys = append(keys, r)
+				keySet = append(keySet, r)
+			}
+		case *dns.RRSIG:
+			if r.TypeCovered == dns.TypeDNSKEY && strings.EqualFold(r.Hdr.Name, zone) {
+				keySigs = append(keySigs, r)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return failedTrust(DNSSECIndeterminate, link, "no DNSKEY records returned")
+	}
+
+	// Only zone keys that aren't revoked may sign the data of the zone
+	// (RFC 4034 section 2.1.1, RFC 5011 section 2.1).
+	var usable []*dns.DNSKEY
+	for _, key := range keys {
+		if key.Flags&dns.ZONE != 0 && key.Flags&dns.REVOKE == 0 {
+			usable = append(usable, key)
+		}
+	}
+
+	var (
+		trusted []*dns.DNSKEY
+		reason  = "no DNSKEY matches the DS RRset"
+	)
+	for _, ds := range anchors {
+		for _, key := range keys {
+			if key.KeyTag() != ds.KeyTag || key.Algorithm != ds.Algorithm {
+				continue
+			}
+			digest := key.ToDS(ds.DigestType)
+			if digest == nil || !strings.EqualFold(digest.Digest, ds.Digest) {
+				continue
+			}
+			switch {
+			case key.Flags&dns.ZONE == 0:
+				reason = fmt.Sprintf("DNSKEY %d matching the DS RRset is not a zone key", key.KeyTag())
+			case key.Flags&dns.REVOKE != 0:
+				reason = fmt.Sprintf("DNSKEY %d matching the DS RRset is revoked", key.KeyTag())
+			default:
+				trusted = append(trusted, key)
+			}
+		}
+	}
+	if len(trusted) == 0 {
+		return failedTrust(DNSSECBogus, link, reason)
+	}
+	if err := v.verifyRRset(keySet, keySigs, trusted); err != nil {
+		return failedTrust(DNSSECBogus, link, err.Error())
+	}
+	return zoneTrust{keys: usable, DNSSECValidation: DNSSECValidation{Verdict: DNSSECSecure}}
+}
+
+// verifyRRset succeeds if at least one currently valid RRSIG over rrset was
+// made by one of keys.
+func (v *dnssecValidator) verifyRRset(rrset []dns.RR, sigs []*dns.RRSIG, keys []*dns.DNSKEY) error {
+	if len(sigs) == 0 {
+		return errors.New("missing RRSIG")
+	}
+	lastErr := errors.New("no RRSIG was made by a trusted key")
+	for _, sig := range sigs {
+		if !sig.ValidityPeriod(v.now()) {
+			lastErr = fmt.Errorf("RRSIG by key %d is outside its validity period", sig.KeyTag)
+			continue
+		}
+		for _, key := range keys {
+			if key.KeyTag() != sig.KeyTag || key.Algorithm != sig.Algorithm || !strings.EqualFold(key.Hdr.Name, sig.SignerName) {
+				continue
+			}
+			if err := sig.Verify(key, rrset); err != nil {
+				lastErr = fmt.Errorf("RRSIG by key %d: %w", sig.KeyTag, err)
+				continue
+			}
+			return nil
+		}
+	}
+	return lastErr
+}
+
+// findZone returns the apex of the zone name belongs to, using the owner of
+// the SOA record returned for it and walking up on failure.
+func (v *dnssecValidator) findZone(ctx context.Context, name string) string {
+	name = dns.Fqdn(name)
+	for {
+		if name == "." {
+			return name
+		}
+		if in, err := v.fetch(ctx, name, dns.TypeSOA); err == nil {
+			if zone := soaOwner(append(in.Answer, in.Ns...)); zone != "" && dns.IsSubDomain(zone, name) {
+				return zone
+			}
+		}
+		name = parentName(name)
+	}
+}
+
+// fetch asks the nameserver for name/qtype with DO set so signatures are
+// returned, and CD set so the data is handed over even if the upstream
+// resolver considers it bogus.
+func (v *dnssecValidator) fetch(ctx context.Context, name string, qtype uint16) (*dns.Msg, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(name), qtype)
+	m.RecursionDesired = true
+	m.CheckingDisabled = true
+	m.SetEdns0(1232, true)
+	return v.exchange(ctx, m)
+}
+
+func failedTrust(verdict, link, reason string) zoneTrust {
+	return zoneTrust{DNSSECValidation: DNSSECValidation{Verdict: verdict, FailingLink: link, Reason: reason}}
+}
+
+// verdictSeverity orders verdicts so a response is only as trustworthy as
+// its weakest RRset.
+var verdictSeverity = map[string]int{
+	DNSSECSecure:        0,
+	DNSSECInsecure:      1,
+	DNSSECIndeterminate: 2,
+	DNSSECBogus:         3,
+}
+
+func worseVerdict(a, b DNSSECValidation) DNSSECValidation {
+	if verdictSeverity[b.Verdict] > verdictSeverity[a.Verdict] {
+		return b
+	}
+	return a
+}
+
+type rrsetKey struct {
+	name   string
+	rrtype uint16
+}
+
+// groupRRsets splits a section into RRsets keyed by owner and type, keeping
+// the RRSIGs covering each RRset alongside. OPT records are skipped.
+func groupRRsets(rrs []dns.RR) ([]rrsetKey, map[rrsetKey][]dns.RR, map[rrsetKey][]*dns.RRSIG) {
+	var (
+		order []rrsetKey
+		sets  = make(map[rrsetKey][]dns.RR)
+		sigs  = make(map[rrsetKey][]*dns.RRSIG)
+	)
+	for _, rr := range rrs {
+		h := rr.Header()
+		if h.Rrtype == dns.TypeOPT {
+			continue
+		}
+		if sig, ok := rr.(*dns.RRSIG); ok {
+			key := rrsetKey{name: dns.CanonicalName(h.Name), rrtype: sig.TypeCovered}
+			sigs[key] = append(sigs[key], sig)
+			continue
+		}
+		key := rrsetKey{name: dns.CanonicalName(h.Name), rrtype: h.Rrtype}
+		if _, ok := sets[key]; !ok {
+			order = append(order, key)
+		}
+		sets[key] = append(sets[key], rr)
+	}
+	return order, sets, sigs
+}
+
+// denialCovers reports whether one of the NSEC/NSEC3 records either matches
+// name without listing qtype in its type bitmap, or covers name (proving it
+// does not exist, or falls under an NSEC3 opt-out span).
+func denialCovers(rrs []dns.RR, name string, qtype uint16) bool {
+	name = dns.CanonicalName(name)
+	for _, rr := range rrs {
+		switch r := rr.(type) {
+		case *dns.NSEC:
+			owner := dns.CanonicalName(r.Hdr.Name)
+			if owner == name {
+				if !hasType(r.TypeBitMap, qtype) && !hasType(r.TypeBitMap, dns.TypeCNAME) {
+					return true
+				}
+				continue
+			}
+			if denialCoversName(r, name) {
+				return true
+			}
+		case *dns.NSEC3:
+			if r.Match(name) {
+				if !hasType(r.TypeBitMap, qtype) && !hasType(r.TypeBitMap, dns.TypeCNAME) {
+					return true
+				}
+				continue
+			}
+			if r.Cover(name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// nameDenied reports whether the NSEC/NSEC3 records prove an NXDOMAIN for
+// name: name does not exist and neither does the wildcard at its closest
+// encloser, as described in RFC 4035 section 5.4 and RFC 5155 section 8.4.
+func nameDenied(rrs []dns.RR, name string) bool {
+	name = dns.CanonicalName(name)
+	for _, rr := range rrs {
+		if denialMatches(rr, name) {
+			return false
+		}
+	}
+	ce, ok := closestEncloser(rrs, name)
+	if !ok || !nameCovered(rrs, name, ce) {
+		return false
+	}
+	wildcard := "*." + ce
+	if ce == "." {
+		wildcard = "*."
+	}
+	for _, rr := range rrs {
+		if denialMatches(rr, wildcard) {
+			return false
+		}
+	}
+	for _, rr := range rrs {
+		if denialCoversName(rr, wildcard) {
+			return true
+		}
+	}
+	return false
+}
+
+// nameCovered reports whether the NSEC/NSEC3 records prove that no name
+// closer to name than its ancestor ce exists: an NSEC covering name, or an
+// NSEC3 covering the next closer name, one label below ce.
+func nameCovered(rrs []dns.RR, name, ce string) bool {
+	nextCloser := lastLabels(name, dns.CountLabel(ce)+1)
+	for _, rr := range rrs {
+		switch rr.(type) {
+		case *dns.NSEC:
+			if denialCoversName(rr, name) {
+				return true
+			}
+		case *dns.NSEC3:
+			if denialCoversName(rr, nextCloser) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// closestEncloser returns the longest ancestor of name the NSEC/NSEC3
+// records prove to exist: the longest name shared by name and the owner or
+// the next name of an NSEC covering it, or the closest ancestor matching an
+// NSEC3.
+func closestEncloser(rrs []dns.RR, name string) (string, bool) {
+	ce, found := "", false
+	for _, rr := range rrs {
+		r, ok := rr.(*dns.NSEC)
+		if !ok || !denialCoversName(r, name) {
+			continue
+		}
+		for _, other := range []string{r.Hdr.Name, r.NextDomain} {
+			if n := dns.CompareDomainName(name, other); !found || n > dns.CountLabel(ce) {
+				ce, found = lastLabels(name, n), true
+			}
+		}
+	}
+	for ancestor := name; ancestor != "."; {
+		ancestor = parentName(ancestor)
+		for _, rr := range rrs {
+			if _, ok := rr.(*dns.NSEC3); ok && denialMatches(rr, ancestor) {
+				if !found || dns.CountLabel(ancestor) > dns.CountLabel(ce) {
+					ce, found = ancestor, true
+				}
+				return ce, found
+			}
+		}
+	}
+	return ce, found
+}
+
+// denialMatches reports whether an NSEC or NSEC3 record is the one of name.
+func denialMatches(rr dns.RR, name string) bool {
+	switch r := rr.(type) {
+	case *dns.NSEC:
+		return dns.CanonicalName(r.Hdr.Name) == dns.CanonicalName(name)
+	case *dns.NSEC3:
+		return r.Match(name)
+	}
+	return false
+}
+
+// denialCoversName reports whether an NSEC or NSEC3 record proves name does
+// not exist, its owner coming before name and its next name after it.
+func denialCoversName(rr dns.RR, name string) bool {
+	switch r := rr.(type) {
+	case *dns.NSEC:
+		owner, next := dns.CanonicalName(r.Hdr.Name), dns.CanonicalName(r.NextDomain)
+		return canonicalCompare(owner, name) < 0 && (canonicalCompare(name, next) < 0 || canonicalCompare(next, owner) <= 0)
+	case *dns.NSEC3:
+		return r.Cover(name)
+	}
+	return false
+}
+
+// lastLabels returns the ancestor of name made of its n rightmost labels.
+func lastLabels(name string, n int) string {
+	idx := dns.Split(name)
+	switch {
+	case n <= 0:
+		return "."
+	case n >= len(idx):
+		return name
+	}
+	return name[idx[len(idx)-n]:]
+}
+
+func hasType(bitmap []uint16, t uint16) bool {
+	for _, b := range bitmap {
+		if b == t {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalCompare orders two names as described in RFC 4034 section 6.1:
+// label by label from the root, comparing lowercased labels as byte strings.
+func canonicalCompare(a, b string) int {
+	la := dns.SplitDomainName(dns.CanonicalName(a))
+	lb := dns.SplitDomainName(dns.CanonicalName(b))
+	for i, j := len(la)-1, len(lb)-1; i >= 0 && j >= 0; i, j = i-1, j-1 {
+		if c := strings.Compare(unescapeLabel(la[i]), unescapeLabel(lb[j])); c != 0 {
+			return c
+		}
+	}
+	return len(la) - len(lb)
+}
+
+// unescapeLabel turns the presentation format escapes of a label (\DDD and
+// \X) back into the raw bytes they stand for.
+func unescapeLabel(label string) string {
+	if !strings.Contains(label, "\\") {
+		return label
+	}
+	var b strings.Builder
+	for i := 0; i < len(label); i++ {
+		if label[i] != '\\' || i+1 >= len(label) {
+			b.WriteByte(label[i])
+			continue
+		}
+		if i+3 < len(label) && isDigit(label[i+1]) && isDigit(label[i+2]) && isDigit(label[i+3]) {
+			b.WriteByte((label[i+1]-'0')*100 + (label[i+2]-'0')*10 + (label[i+3] - '0'))
+			i += 3
+			continue
+		}
+		b.WriteByte(label[i+1])
+		i++
+	}
+	return b.String()
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// soaOwner returns the owner name of the first SOA record in rrs.
+func soaOwner(rrs []dns.RR) string {
+	for _, rr := range rrs {
+		if soa, ok := rr.(*dns.SOA); ok {
+			return dns.CanonicalName(soa.Hdr.Name)
+		}
+	}
+	return ""
+}
+
+// parentName strips the leftmost label of name.
+func parentName(name string) string {
+	labels := dns.SplitDomainName(name)
+	if len(labels) <= 1 {
+		return "."
+	}
+	return dns.Fqdn(strings.Join(labels[1:], "."))
+}
+
+func isProperAncestor(parent, child string) bool {
+	return dns.IsSubDomain(parent, child) && dns.CanonicalName(parent) != dns.CanonicalName(child)
+}
+
+// rrsetLink formats an RRset reference such as "DS example.com." used to
+// point at the link of the chain that failed.
+func rrsetLink(rrtype uint16, name string) string {
+	return dns.TypeToString[rrtype] + " " + dns.Fqdn(name)
+}
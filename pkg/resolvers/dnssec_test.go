@@ -0,0 +1,326 @@
+package resolvers
+
+import (
+	"context"
+	"crypto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// signedZone is a zone key and its private half used to sign test RRsets.
+type signedZone struct {
+	key  *dns.DNSKEY
+	priv crypto.PrivateKey
+}
+
+func newSignedZone(t *testing.T, name string) signedZone {
+	t.Helper()
+	key := &dns.DNSKEY{
+		Hdr:       dns.RR_Header{Name: name, Rrtype: dns.TypeDNSKEY, Class: dns.ClassINET, Ttl: 3600},
+		Flags:     257,
+		Protocol:  3,
+		Algorithm: dns.ECDSAP256SHA256,
+	}
+	priv, err := key.Generate(256)
+	if err != nil {
+		t.Fatalf("Generate: %v", err)
+	}
+	return signedZone{key: key, priv: priv}
+}
+
+func (z signedZone) sign(t *testing.T, rrset ...dns.RR) *dns.RRSIG {
+	t.Helper()
+	h := rrset[0].Header()
+	sig := &dns.RRSIG{
+		Hdr:         dns.RR_Header{Name: h.Name, Rrtype: dns.TypeRRSIG, Class: dns.ClassINET, Ttl: h.Ttl},
+		TypeCovered: h.Rrtype,
+		Algorithm:   z.key.Algorithm,
+		Labels:      uint8(dns.CountLabel(h.Name)),
+		OrigTtl:     h.Ttl,
+		Expiration:  uint32(time.Now().Add(time.Hour).Unix()),
+		Inception:   uint32(time.Now().Add(-time.Hour).Unix()),
+		KeyTag:      z.key.KeyTag(),
+		SignerName:  z.key.Hdr.Name,
+	}
+	if err := sig.Sign(z.priv.(crypto.Signer), rrset); err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return sig
+}
+
+func testRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatalf("dns.NewRR(%q): %v", s, err)
+	}
+	return rr
+}
+
+// testHierarchy serves a signed root, a signed "example." child and an
+// unsigned "insecure." child from memory.
+type testHierarchy struct {
+	root, example signedZone
+	answers       map[rrsetKey]*dns.Msg
+}
+
+func newTestHierarchy(t *testing.T) *testHierarchy {
+	t.Helper()
+	h := &testHierarchy{
+		root:    newSignedZone(t, "."),
+		example: newSignedZone(t, "example."),
+		answers: make(map[rrsetKey]*dns.Msg),
+	}
+
+	orig := rootTrustAnchors
+	t.Cleanup(func() { rootTrustAnchors = orig })
+	rootTrustAnchors = []string{h.root.key.ToDS(dns.SHA256).String()}
+
+	h.answer(".", dns.TypeDNSKEY, []dns.RR{h.root.key, h.root.sign(t, h.root.key)}, nil)
+
+	ds := h.example.key.ToDS(dns.SHA256)
+	h.answer("example.", dns.TypeDS, []dns.RR{ds, h.root.sign(t, ds)}, nil)
+	h.answer("example.", dns.TypeDNSKEY, []dns.RR{h.example.key, h.example.sign(t, h.example.key)}, nil)
+
+	rootSOA := testRR(t, ". 86400 IN SOA a.root-servers.test. nstld.test. 1 1800 900 604800 86400")
+	nsec := testRR(t, "insecure. 86400 IN NSEC zzz. NS RRSIG NSEC")
+	h.answer("insecure.", dns.TypeDS, nil, []dns.RR{rootSOA, h.root.sign(t, rootSOA), nsec, h.root.sign(t, nsec)})
+
+	insecureSOA := testRR(t, "insecure. 3600 IN SOA ns.insecure. admin.insecure. 1 1800 900 604800 3600")
+	h.answer("host.insecure.", dns.TypeSOA, nil, []dns.RR{insecureSOA})
+	return h
+}
+
+func (h *testHierarchy) answer(name string, qtype uint16, answer, ns []dns.RR) {
+	h.answers[rrsetKey{name: name, rrtype: qtype}] = &dns.Msg{Answer: answer, Ns: ns}
+}
+
+func (h *testHierarchy) exchange(_ context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	q := msg.Question[0]
+	reply := new(dns.Msg)
+	reply.SetReply(msg)
+	if tmpl, ok := h.answers[rrsetKey{name: dns.CanonicalName(q.Name), rrtype: q.Qtype}]; ok {
+		reply.Answer = tmpl.Answer
+		reply.Ns = tmpl.Ns
+	}
+	return reply, nil
+}
+
+func replyTo(name string, qtype uint16, answer ...dns.RR) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetQuestion(name, qtype)
+	m.Response = true
+	m.Answer = answer
+	return m
+}
+
+func TestDNSSECValidatorSecureAnswer(t *testing.T) {
+	h := newTestHierarchy(t)
+	v := newDNSSECValidator(h.exchange, discardLogger())
+
+	a := testRR(t, "www.example. 300 IN A 192.0.2.1")
+	got := v.validate(context.Background(), replyTo("www.example.", dns.TypeA, a, h.example.sign(t, a)))
+
+	if got.Verdict != DNSSECSecure {
+		t.Fatalf("Verdict = %q (%s: %s), want secure", got.Verdict, got.FailingLink, got.Reason)
+	}
+}
+
+func TestDNSSECValidatorTamperedAnswerIsBogus(t *testing.T) {
+	h := newTestHierarchy(t)
+	v := newDNSSECValidator(h.exchange, discardLogger())
+
+	a := testRR(t, "www.example. 300 IN A 192.0.2.1")
+	sig := h.example.sign(t, a)
+	tampered := testRR(t, "www.example. 300 IN A 198.51.100.1")
+	got := v.validate(context.Background(), replyTo("www.example.", dns.TypeA, tampered, sig))
+
+	if got.Verdict != DNSSECBogus {
+		t.Fatalf("Verdict = %q, want bogus", got.Verdict)
+	}
+	if got.FailingLink != "A www.example." {
+		t.Fatalf("FailingLink = %q, want %q", got.FailingLink, "A www.example.")
+	}
+}
+
+func TestDNSSECValidatorUnsignedDelegationIsInsecure(t *testing.T) {
+	h := newTestHierarchy(t)
+	v := newDNSSECValidator(h.exchange, discardLogger())
+
+	a := testRR(t, "host.insecure. 300 IN A 192.0.2.2")
+	got := v.validate(context.Background(), replyTo("host.insecure.", dns.TypeA, a))
+
+	if got.Verdict != DNSSECInsecure {
+		t.Fatalf("Verdict = %q (%s), want insecure", got.Verdict, got.Reason)
+	}
+	if got.FailingLink != "DS insecure." {
+		t.Fatalf("FailingLink = %q, want %q", got.FailingLink, "DS insecure.")
+	}
+}
+
+func TestDNSSECValidatorMissingSignatureInSignedZoneIsBogus(t *testing.T) {
+	h := newTestHierarchy(t)
+	exampleSOA := testRR(t, "example. 3600 IN SOA ns.example. admin.example. 1 1800 900 604800 3600")
+	h.answer("www.example.", dns.TypeSOA, nil, []dns.RR{exampleSOA, h.example.sign(t, exampleSOA)})
+	v := newDNSSECValidator(h.exchange, discardLogger())
+
+	a := testRR(t, "www.example. 300 IN A 192.0.2.1")
+	got := v.validate(context.Background(), replyTo("www.example.", dns.TypeA, a))
+
+	if got.Verdict != DNSSECBogus {
+		t.Fatalf("Verdict = %q, want bogus", got.Verdict)
+	}
+}
+
+func TestDNSSECValidatorUntrustedRootKeyIsBogus(t *testing.T) {
+	h := newTestHierarchy(t)
+	other := newSignedZone(t, ".")
+	rootTrustAnchors = []string{other.key.ToDS(dns.SHA256).String()}
+	v := newDNSSECValidator(h.exchange, discardLogger())
+
+	a := testRR(t, "www.example. 300 IN A 192.0.2.1")
+	got := v.validate(context.Background(), replyTo("www.example.", dns.TypeA, a, h.example.sign(t, a)))
+
+	if got.Verdict != DNSSECBogus {
+		t.Fatalf("Verdict = %q, want bogus", got.Verdict)
+	}
+	if got.FailingLink != "DNSKEY ." {
+		t.Fatalf("FailingLink = %q, want %q", got.FailingLink, "DNSKEY .")
+	}
+}
+
+func TestDNSSECValidatorServfailIsIndeterminate(t *testing.T) {
+	h := newTestHierarchy(t)
+	v := newDNSSECValidator(h.exchange, discardLogger())
+
+	in := replyTo("www.example.", dns.TypeA)
+	in.Rcode = dns.RcodeServerFailure
+	got := v.validate(context.Background(), in)
+
+	if got.Verdict != DNSSECIndeterminate {
+		t.Fatalf("Verdict = %q, want indeterminate", got.Verdict)
+	}
+}
+
+// nxdomainReply returns an NXDOMAIN for name carrying the signed NSEC
+// records of nsecs.
+func (h *testHierarchy) nxdomainReply(t *testing.T, name string, nsecs ...string) *dns.Msg {
+	t.Helper()
+	in := replyTo(name, dns.TypeA)
+	in.Rcode = dns.RcodeNameError
+	soa := testRR(t, "example. 3600 IN SOA ns.example. admin.example. 1 1800 900 604800 3600")
+	in.Ns = []dns.RR{soa, h.example.sign(t, soa)}
+	for _, s := range nsecs {
+		nsec := testRR(t, s)
+		in.Ns = append(in.Ns, nsec, h.example.sign(t, nsec))
+	}
+	return in
+}
+
+func TestDNSSECValidatorNXDOMAIN(t *testing.T) {
+	const (
+		apex = "example. 3600 IN NSEC a.example. NS SOA RRSIG NSEC DNSKEY"
+		span = "mail.example. 3600 IN NSEC www.example. A RRSIG NSEC"
+	)
+	for _, tc := range []struct {
+		name  string
+		qname string
+		nsecs []string
+		want  string
+	}{
+		{"covered", "nope.example.", []string{span, apex}, DNSSECSecure},
+		{"matching NSEC only proves NODATA", "mail.example.", []string{span, apex}, DNSSECBogus},
+		{"wildcard not denied", "nope.example.", []string{span}, DNSSECBogus},
+		{"name not covered", "nope.example.", []string{apex}, DNSSECBogus},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			h := newTestHierarchy(t)
+			v := newDNSSECValidator(h.exchange, discardLogger())
+
+			got := v.validate(context.Background(), h.nxdomainReply(t, tc.qname, tc.nsecs...))
+			if got.Verdict != tc.want {
+				t.Fatalf("Verdict = %q (%s), want %s", got.Verdict, got.Reason, tc.want)
+			}
+		})
+	}
+}
+
+func TestDNSSECValidatorNSEC3NXDOMAIN(t *testing.T) {
+	h := newTestHierarchy(t)
+	v := newDNSSECValidator(h.exchange, discardLogger())
+
+	// Two NSEC3 records chaining the hashes of the only names of the zone.
+	apex := dns.HashName("example.", dns.SHA1, 0, "")
+	www := dns.HashName("www.example.", dns.SHA1, 0, "")
+	in := h.nxdomainReply(t, "nope.example.",
+		strings.ToLower(apex)+".example. 3600 IN NSEC3 1 0 0 - "+www+" NS SOA RRSIG DNSKEY NSEC3PARAM",
+		strings.ToLower(www)+".example. 3600 IN NSEC3 1 0 0 - "+apex+" A RRSIG",
+	)
+
+	if got := v.validate(context.Background(), in); got.Verdict != DNSSECSecure {
+		t.Fatalf("Verdict = %q (%s), want secure", got.Verdict, got.Reason)
+	}
+}
+
+func TestDNSSECValidatorWildcardExpansion(t *testing.T) {
+	h := newTestHierarchy(t)
+
+	wildcard := testRR(t, "*.example. 300 IN A 192.0.2.1")
+	sig := h.example.sign(t, wildcard)
+	a := testRR(t, "host.example. 300 IN A 192.0.2.1")
+	sig.Hdr.Name = "host.example."
+
+	v := newDNSSECValidator(h.exchange, discardLogger())
+	got := v.validate(context.Background(), replyTo("host.example.", dns.TypeA, a, sig))
+	if got.Verdict != DNSSECBogus {
+		t.Fatalf("without a proof: Verdict = %q, want bogus", got.Verdict)
+	}
+
+	in := replyTo("host.example.", dns.TypeA, a, sig)
+	nsec := testRR(t, "example. 3600 IN NSEC www.example. NS SOA RRSIG NSEC DNSKEY")
+	in.Ns = []dns.RR{nsec, h.example.sign(t, nsec)}
+	v = newDNSSECValidator(h.exchange, discardLogger())
+	if got := v.validate(context.Background(), in); got.Verdict != DNSSECSecure {
+		t.Fatalf("with a proof: Verdict = %q (%s), want secure", got.Verdict, got.Reason)
+	}
+}
+
+func TestDNSSECValidatorUnusableKeyIsBogus(t *testing.T) {
+	for name, flags := range map[string]uint16{
+		"not a zone key": dns.SEP,
+		"revoked":        dns.ZONE | dns.SEP | dns.REVOKE,
+	} {
+		t.Run(name, func(t *testing.T) {
+			h := newTestHierarchy(t)
+			h.example = newSignedZone(t, "example.")
+			h.example.key.Flags = flags
+			ds := h.example.key.ToDS(dns.SHA256)
+			h.answer("example.", dns.TypeDS, []dns.RR{ds, h.root.sign(t, ds)}, nil)
+			h.answer("example.", dns.TypeDNSKEY, []dns.RR{h.example.key, h.example.sign(t, h.example.key)}, nil)
+			v := newDNSSECValidator(h.exchange, discardLogger())
+
+			a := testRR(t, "www.example. 300 IN A 192.0.2.1")
+			got := v.validate(context.Background(), replyTo("www.example.", dns.TypeA, a, h.example.sign(t, a)))
+
+			if got.Verdict != DNSSECBogus {
+				t.Fatalf("Verdict = %q, want bogus", got.Verdict)
+			}
+			if got.FailingLink != "DNSKEY example." {
+				t.Fatalf("FailingLink = %q, want %q", got.FailingLink, "DNSKEY example.")
+			}
+		})
+	}
+}
+
+func TestCanonicalCompare(t *testing.T) {
+	// Ordering example from RFC 4034 section 6.1.
+	ordered := []string{"example.", "a.example.", "yljkjljk.a.example.", "Z.a.example.", "zABC.a.EXAMPLE.", "z.example.", "\\001.z.example.", "*.z.example.", "\\200.z.example."}
+	for i := 0; i < len(ordered)-1; i++ {
+		if canonicalCompare(ordered[i], ordered[i+1]) >= 0 {
+			t.Errorf("canonicalCompare(%q, %q) >= 0, want < 0", ordered[i], ordered[i+1])
+		}
+	}
+}
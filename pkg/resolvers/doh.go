@@ -3,47 +3,113 @@ package resolvers
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/base64"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go/http3"
 )
 
 // DOHResolver represents the config options for setting up a DOH based resolver.
 type DOHResolver struct {
 	client          *http.Client
+	h3Client        *http.Client
+	dialer          *dialer
 	server          string
+	url             string
+	http3           bool
 	resolverOptions Options
+	validator       *dnssecValidator
+
+	mu sync.Mutex
+	// altSvc is the URL of the HTTP/3 endpoint the server advertised in an
+	// Alt-Svc header. Once set, the following queries are sent to it.
+	altSvc       string
+	altSvcFailed bool
 }
 
 // NewDOHResolver accepts a nameserver address and configures a DOH based resolver.
+// An h3:// address, or Options.HTTP3, sends the queries over HTTP/3 only.
+// Otherwise HTTP/1.1 or HTTP/2 is used until the server advertises HTTP/3
+// with an Alt-Svc header.
 func NewDOHResolver(server string, resolverOpts Options) (Resolver, error) {
 	// do basic validation
 	u, err := url.ParseRequestURI(server)
 	if err != nil {
 		return nil, fmt.Errorf("%s is not a valid HTTPS nameserver", server)
 	}
-	if u.Scheme != "https" {
+	if u.Scheme != "https" && u.Scheme != "h3" {
 		return nil, fmt.Errorf("missing https in %s", server)
 	}
-	transport := http.DefaultTransport.(*http.Transport).Clone()
-	transport.TLSClientConfig = &tls.Config{
-		ServerName:         resolverOpts.TLSHostname,
-		InsecureSkipVerify: resolverOpts.InsecureSkipVerify,
+	useHTTP3 := u.Scheme == "h3" || resolverOpts.HTTP3
+	u.Scheme = "https"
+
+	d, err := newDialer(resolverOpts)
+	if err != nil {
+		return nil, err
+	}
+	if resolverOpts.Dialer != nil && useHTTP3 {
+		return nil, fmt.Errorf("%s: %w", server, ErrProxyUDP)
+	}
+	client, err := newHTTPClient(resolverOpts, d)
+	if err != nil {
+		return nil, err
 	}
-	httpClient := &http.Client{
+	config, err := newTLSConfig(resolverOpts, resolverOpts.TLSHostname)
+	if err != nil {
+		return nil, err
+	}
+	h3Transport := &http3.Transport{TLSClientConfig: config}
+	if d.bound() {
+		h3Transport.Dial = d.dialQUIC
+	}
+	h3Client := &http.Client{
 		Timeout:   resolverOpts.Timeout,
-		Transport: transport,
+		Transport: h3Transport,
 	}
-	return &DOHResolver{
-		client:          httpClient,
+	r := &DOHResolver{
+		client:          client,
+		h3Client:        h3Client,
+		dialer:          d,
 		server:          server,
+		url:             u.String(),
+		http3:           useHTTP3,
 		resolverOptions: resolverOpts,
+		// HTTP/3 can't go through the proxy, the Alt-Svc headers are
+		// ignored when there's one.
+		altSvcFailed: d.proxied(u.Host),
+	}
+	r.validator = newDNSSECValidator(r.exchange, resolverOpts.Logger)
+	return r, nil
+}
+
+// newHTTPClient returns the HTTP/1.1 and HTTP/2 client of the DoH resolvers,
+// with its connections opened by d. They go through Options.Dialer when it's
+// set, and through the proxy of the environment otherwise.
+func newHTTPClient(opts Options, d *dialer) (*http.Client, error) {
+	config, err := newTLSConfig(opts, opts.TLSHostname)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = config
+	switch {
+	case opts.Dialer != nil:
+		transport.Proxy = nil
+		transport.DialContext = d.DialContext
+	case d.bound():
+		transport.DialContext = d.dialDirect
+	}
+	return &http.Client{
+		Timeout:   opts.Timeout,
+		Transport: transport,
 	}, nil
 }
 
@@ -52,7 +118,8 @@ func NewDOHResolver(server string, resolverOpts Options) (Resolver, error) {
 func (r *DOHResolver) query(ctx context.Context, question dns.Question, flags QueryFlags) (Response, error) {
 	var (
 		rsp      Response
-		messages = prepareMessages(question, flags, r.resolverOptions.Ndots, r.resolverOptions.SearchList)
+		final    *dns.Msg
+		messages = prepareMessages(question, flags, r.resolverOptions.Ndots, r.resolverOptions.SearchList, nil)
 	)
 
 	for _, msg := range messages {
@@ -61,66 +128,19 @@ func (r *DOHResolver) query(ctx context.Context, question dns.Question, flags Qu
 			"ndots", r.resolverOptions.Ndots,
 			"nameserver", r.server,
 		)
-		// get the DNS Message in wire format.
-		b, err := msg.Pack()
-		if err != nil {
-			return rsp, err
-		}
 		now := time.Now()
 
-		// Create a new request with the context
-		req, err := http.NewRequestWithContext(ctx, "POST", r.server, bytes.NewBuffer(b))
-		if err != nil {
-			return rsp, err
-		}
-		req.Header.Set("Content-Type", "application/dns-message")
-
-		// Make an HTTP POST request to the DNS server with the DNS message as wire format bytes in the body.
-		resp, err := r.client.Do(req)
+		in, info, err := r.roundTrip(ctx, &msg)
 		if err != nil {
-			return rsp, err
-		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode == http.StatusMethodNotAllowed {
-			url, err := url.Parse(r.server)
-			if err != nil {
-				return rsp, err
-			}
-			url.RawQuery = fmt.Sprintf("dns=%v", base64.RawURLEncoding.EncodeToString(b))
-
-			req, err = http.NewRequestWithContext(ctx, "GET", url.String(), nil)
-			if err != nil {
-				return rsp, err
+			if r.resolverOptions.TLSInfo {
+				err = wrapTLSError(err)
 			}
-			resp, err = r.client.Do(req)
-			if err != nil {
-				return rsp, err
-			}
-			defer resp.Body.Close()
-		}
-		if resp.StatusCode != http.StatusOK {
-			return rsp, fmt.Errorf("error from nameserver %s", resp.Status)
-		}
-		rtt := time.Since(now)
-
-		// if debug, extract the response headers
-		for header, value := range resp.Header {
-			r.resolverOptions.Logger.Debug("DOH response header", header, value)
-		}
-
-		// extract the binary response in DNS Message.
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
 			return rsp, err
 		}
+		rtt := time.Since(now)
 
-		err = msg.Unpack(body)
-		if err != nil {
-			return rsp, err
-		}
 		// pack questions in output.
-		for _, q := range msg.Question {
+		for _, q := range in.Question {
 			ques := Question{
 				Name:  q.Name,
 				Class: dns.ClassToString[q.Qclass],
@@ -129,13 +149,21 @@ func (r *DOHResolver) query(ctx context.Context, question dns.Question, flags Qu
 			rsp.Questions = append(rsp.Questions, ques)
 		}
 		// get the authorities and answers.
-		output := parseMessage(&msg, rtt, r.server)
+		output := parseMessage(in, rtt, r.server)
 		rsp.Authorities = output.Authorities
 		rsp.Answers = output.Answers
 		rsp.Additional = output.Additional
 		rsp.Edns = output.Edns
+		rsp.Status = output.Status
+		rsp.Nameserver = output.Nameserver
+		rsp.HTTPVersion = info.httpVersion
+		rsp.Source = r.dialer.info()
+		if r.resolverOptions.TLSInfo {
+			rsp.TLS = newTLSInfo(info.tls)
+		}
+		final = in
 
-		if len(output.Answers) > 0 || msg.Rcode == dns.RcodeSuccess {
+		if len(output.Answers) > 0 || in.Rcode == dns.RcodeSuccess {
 			// stop iterating the searchlist.
 			break
 		}
@@ -148,9 +176,160 @@ func (r *DOHResolver) query(ctx context.Context, question dns.Question, flags Qu
 			// Continue to next iteration
 		}
 	}
+
+	if flags.Validate && final != nil {
+		rsp.DNSSEC = r.validator.validate(ctx, final)
+	}
 	return rsp, nil
 }
 
+// exchange sends a single message to the DoH endpoint and returns the raw
+// reply.
+func (r *DOHResolver) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	in, _, err := r.roundTrip(ctx, msg)
+	return in, err
+}
+
+// roundTrip sends msg over HTTP/3 when it's required or was advertised by
+// the server, and over HTTP/1.1 or HTTP/2 otherwise. It returns the reply
+// along with the details of the connection it was received on. A failed
+// upgrade to HTTP/3 falls back to the regular client and isn't tried again.
+func (r *DOHResolver) roundTrip(ctx context.Context, msg *dns.Msg) (*dns.Msg, connInfo, error) {
+	// get the DNS Message in wire format.
+	b, err := msg.Pack()
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+	if r.http3 {
+		return r.post(ctx, r.h3Client, r.url, b)
+	}
+
+	r.mu.Lock()
+	altSvc := r.altSvc
+	r.mu.Unlock()
+	if altSvc != "" {
+		in, info, err := r.post(ctx, r.h3Client, altSvc, b)
+		if err == nil || ctx.Err() != nil {
+			return in, info, err
+		}
+		r.resolverOptions.Logger.Debug("HTTP/3 upgrade failed, falling back", "nameserver", r.server, "url", altSvc, "error", err)
+		r.mu.Lock()
+		r.altSvc, r.altSvcFailed = "", true
+		r.mu.Unlock()
+	}
+	return r.post(ctx, r.client, r.url, b)
+}
+
+// post POSTs the message in wire format to endpoint and falls back to GET for
+// servers that reject POST requests.
+func (r *DOHResolver) post(ctx context.Context, client *http.Client, endpoint string, b []byte) (*dns.Msg, connInfo, error) {
+	// Create a new request with the context
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(b))
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+
+	// Make an HTTP POST request to the DNS server with the DNS message as wire format bytes in the body.
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusMethodNotAllowed {
+		url, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, connInfo{}, err
+		}
+		url.RawQuery = fmt.Sprintf("dns=%v", base64.RawURLEncoding.EncodeToString(b))
+
+		req, err = http.NewRequestWithContext(ctx, "GET", url.String(), nil)
+		if err != nil {
+			return nil, connInfo{}, err
+		}
+		resp, err = client.Do(req)
+		if err != nil {
+			return nil, connInfo{}, err
+		}
+		defer resp.Body.Close()
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, connInfo{}, fmt.Errorf("error from nameserver %s", resp.Status)
+	}
+
+	// if debug, extract the response headers
+	for header, value := range resp.Header {
+		r.resolverOptions.Logger.Debug("DOH response header", header, value)
+	}
+	if client == r.client {
+		r.upgrade(resp.Header.Values("Alt-Svc"))
+	}
+
+	// extract the binary response in DNS Message.
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+
+	in := new(dns.Msg)
+	if err := in.Unpack(body); err != nil {
+		return nil, connInfo{}, err
+	}
+	return in, connInfo{httpVersion: resp.Proto, tls: resp.TLS}, nil
+}
+
+// upgrade switches the following queries to HTTP/3 when the Alt-Svc header
+// of a response advertises it.
+func (r *DOHResolver) upgrade(altSvc []string) {
+	if len(altSvc) == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.altSvc != "" || r.altSvcFailed {
+		return
+	}
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return
+	}
+	if alt := altSvcHTTP3(u, strings.Join(altSvc, ",")); alt != "" {
+		r.resolverOptions.Logger.Debug("Server advertised HTTP/3, upgrading", "nameserver", r.server, "url", alt)
+		r.altSvc = alt
+	}
+}
+
+// altSvcHTTP3 returns the URL of the HTTP/3 endpoint advertised in an Alt-Svc
+// header (RFC 7838), eg `h3=":443"; ma=86400`, or "" when there's none.
+func altSvcHTTP3(u *url.URL, header string) string {
+	for _, alt := range strings.Split(header, ",") {
+		proto, value, ok := strings.Cut(strings.TrimSpace(alt), "=")
+		if !ok || proto != "h3" {
+			continue
+		}
+		authority, _, _ := strings.Cut(value, ";")
+		host, port, err := net.SplitHostPort(strings.Trim(strings.TrimSpace(authority), `"`))
+		if err != nil {
+			continue
+		}
+		if host == "" {
+			host = u.Hostname()
+		}
+		h3 := *u
+		h3.Host = net.JoinHostPort(host, port)
+		return h3.String()
+	}
+	return ""
+}
+
+// Close implements io.Closer, closing the idle HTTP connections.
+func (r *DOHResolver) Close() error {
+	r.client.CloseIdleConnections()
+	r.h3Client.CloseIdleConnections()
+	return nil
+}
+
 // Address implements the Resolver interface.
 func (r *DOHResolver) Address() string {
 	return r.server
@@ -158,5 +337,5 @@ func (r *DOHResolver) Address() string {
 
 // Lookup implements the Resolver interface
 func (r *DOHResolver) Lookup(ctx context.Context, questions []dns.Question, flags QueryFlags) ([]Response, error) {
-	return ConcurrentLookup(ctx, questions, flags, r.query, r.resolverOptions.Logger)
+	return ConcurrentLookup(ctx, questions, flags, withRetries(r.query, r.Address(), r.resolverOptions), r.resolverOptions.Logger)
 }
@@ -0,0 +1,164 @@
+package resolvers
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// dohHandler answers every A query with 192.0.2.1.
+func dohHandler(t *testing.T) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		msg := new(dns.Msg)
+		if err := msg.Unpack(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m := new(dns.Msg)
+		m.SetReply(msg)
+		m.Answer = append(m.Answer, testRR(t, msg.Question[0].Name+" 60 IN A 192.0.2.1"))
+		b, err := m.Pack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/dns-message")
+		_, _ = w.Write(b)
+	})
+}
+
+// startDOHServers starts a DoH server over HTTP/3 and one over HTTP/2 that
+// advertises the first with Alt-Svc. It returns the URLs of both.
+func startDOHServers(t *testing.T) (h3URL, h2URL string) {
+	t.Helper()
+	h2 := httptest.NewUnstartedServer(nil)
+	h2.EnableHTTP2 = true
+	h2.StartTLS()
+	t.Cleanup(h2.Close)
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	h3 := &http3.Server{
+		Handler:   dohHandler(t),
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: h2.TLS.Certificates}),
+	}
+	go func() {
+		_ = h3.Serve(conn)
+	}()
+	t.Cleanup(func() { _ = h3.Close() })
+	port := conn.LocalAddr().(*net.UDPAddr).Port
+
+	handler := dohHandler(t)
+	h2.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Alt-Svc", fmt.Sprintf(`h3=":%d"; ma=60`, port))
+		handler.ServeHTTP(w, req)
+	})
+	return fmt.Sprintf("h3://127.0.0.1:%d/dns-query", port), h2.URL + "/dns-query"
+}
+
+func newDOHResolver(t *testing.T, server string, http3 bool) Resolver {
+	t.Helper()
+	r, err := NewDOHResolver(server, Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true, HTTP3: http3})
+	if err != nil {
+		t.Fatalf("NewDOHResolver: %v", err)
+	}
+	return r
+}
+
+func dohLookup(t *testing.T, r Resolver) Response {
+	t.Helper()
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	rsp, err := r.Lookup(context.Background(), []dns.Question{q}, QueryFlags{})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(rsp) != 1 || len(rsp[0].Answers) != 1 || rsp[0].Answers[0].Address != "192.0.2.1" {
+		t.Fatalf("responses = %+v, want the answer 192.0.2.1", rsp)
+	}
+	return rsp[0]
+}
+
+func TestDOHOverHTTP3(t *testing.T) {
+	h3URL, _ := startDOHServers(t)
+
+	rsp := dohLookup(t, newDOHResolver(t, h3URL, false))
+	if rsp.HTTPVersion != "HTTP/3.0" {
+		t.Errorf("HTTPVersion = %q, want HTTP/3.0", rsp.HTTPVersion)
+	}
+	if rsp.Nameserver != h3URL {
+		t.Errorf("Nameserver = %q, want %q", rsp.Nameserver, h3URL)
+	}
+
+	// --doh-http3 does the same for https:// nameservers.
+	u, _ := url.Parse(h3URL)
+	u.Scheme = "https"
+	rsp = dohLookup(t, newDOHResolver(t, u.String(), true))
+	if rsp.HTTPVersion != "HTTP/3.0" {
+		t.Errorf("HTTPVersion = %q with Options.HTTP3, want HTTP/3.0", rsp.HTTPVersion)
+	}
+}
+
+func TestDOHUpgradesWithAltSvc(t *testing.T) {
+	_, h2URL := startDOHServers(t)
+	r := newDOHResolver(t, h2URL, false)
+
+	if rsp := dohLookup(t, r); rsp.HTTPVersion != "HTTP/2.0" {
+		t.Errorf("first HTTPVersion = %q, want HTTP/2.0", rsp.HTTPVersion)
+	}
+	if rsp := dohLookup(t, r); rsp.HTTPVersion != "HTTP/3.0" {
+		t.Errorf("HTTPVersion after Alt-Svc = %q, want HTTP/3.0", rsp.HTTPVersion)
+	}
+}
+
+func TestDOHFallsBackWhenUpgradeFails(t *testing.T) {
+	h2 := httptest.NewUnstartedServer(nil)
+	h2.EnableHTTP2 = true
+	handler := dohHandler(t)
+	// Nothing listens for QUIC on that port.
+	h2.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Alt-Svc", `h3=":1"`)
+		handler.ServeHTTP(w, req)
+	})
+	h2.StartTLS()
+	t.Cleanup(h2.Close)
+
+	r := newDOHResolver(t, h2.URL+"/dns-query", false)
+	r.(*DOHResolver).h3Client.Timeout = 200 * time.Millisecond
+	for i := 0; i < 3; i++ {
+		if rsp := dohLookup(t, r); rsp.HTTPVersion != "HTTP/2.0" {
+			t.Errorf("lookup %d HTTPVersion = %q, want HTTP/2.0", i, rsp.HTTPVersion)
+		}
+	}
+}
+
+func TestAltSvcHTTP3(t *testing.T) {
+	u, _ := url.Parse("https://dns.example/dns-query")
+	for header, want := range map[string]string{
+		`h3=":443"; ma=86400`:              "https://dns.example:443/dns-query",
+		`h2=":443", h3="alt.example:8443"`: "https://alt.example:8443/dns-query",
+		`h3-29=":443"`:                     "",
+		`clear`:                            "",
+		`h3=garbage`:                       "",
+	} {
+		if got := altSvcHTTP3(u, header); got != want {
+			t.Errorf("altSvcHTTP3(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
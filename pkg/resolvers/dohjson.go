@@ -0,0 +1,263 @@
+package resolvers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// DOHJSONResolver represents the config options for setting up a resolver
+// using the JSON API of DNS over HTTPS (application/dns-json), as served by
+// Google and Cloudflare. Its replies are turned back into DNS messages, so
+// they're output and validated like any other.
+type DOHJSONResolver struct {
+	client          *http.Client
+	dialer          *dialer
+	server          string
+	url             string
+	resolverOptions Options
+	validator       *dnssecValidator
+}
+
+// dohJSONResponse is a reply of the JSON API.
+type dohJSONResponse struct {
+	Status     int             `json:"Status"`
+	TC         bool            `json:"TC"`
+	RA         bool            `json:"RA"`
+	AD         bool            `json:"AD"`
+	Answer     []dohJSONRecord `json:"Answer"`
+	Authority  []dohJSONRecord `json:"Authority"`
+	Additional []dohJSONRecord `json:"Additional"`
+	// Google sends a string, other servers a list of them.
+	Comment any `json:"Comment"`
+}
+
+type dohJSONRecord struct {
+	Name string `json:"name"`
+	Type uint16 `json:"type"`
+	TTL  uint32 `json:"TTL"`
+	Data string `json:"data"`
+}
+
+// NewDOHJSONResolver accepts a https+json:// nameserver address and
+// configures a resolver using the DoH JSON API.
+func NewDOHJSONResolver(server string, resolverOpts Options) (Resolver, error) {
+	u, err := url.ParseRequestURI(server)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid HTTPS nameserver", server)
+	}
+	if u.Scheme != "https+json" {
+		return nil, fmt.Errorf("missing https+json in %s", server)
+	}
+	u.Scheme = "https"
+
+	d, err := newDialer(resolverOpts)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newHTTPClient(resolverOpts, d)
+	if err != nil {
+		return nil, err
+	}
+	r := &DOHJSONResolver{
+		client:          client,
+		dialer:          d,
+		server:          server,
+		url:             u.String(),
+		resolverOptions: resolverOpts,
+	}
+	r.validator = newDNSSECValidator(r.exchange, resolverOpts.Logger)
+	return r, nil
+}
+
+// query takes a dns.Question and sends them to DNS Server.
+// It parses the Response from the server in a custom output format.
+func (r *DOHJSONResolver) query(ctx context.Context, question dns.Question, flags QueryFlags) (Response, error) {
+	var (
+		rsp      Response
+		final    *dns.Msg
+		messages = prepareMessages(question, flags, r.resolverOptions.Ndots, r.resolverOptions.SearchList, nil)
+	)
+
+	for _, msg := range messages {
+		r.resolverOptions.Logger.Debug("Attempting to resolve",
+			"domain", msg.Question[0].Name,
+			"ndots", r.resolverOptions.Ndots,
+			"nameserver", r.server,
+		)
+		now := time.Now()
+
+		in, info, err := r.roundTrip(ctx, &msg)
+		if err != nil {
+			if r.resolverOptions.TLSInfo {
+				err = wrapTLSError(err)
+			}
+			return rsp, err
+		}
+		rtt := time.Since(now)
+
+		// pack questions in output.
+		for _, q := range in.Question {
+			ques := Question{
+				Name:  q.Name,
+				Class: dns.ClassToString[q.Qclass],
+				Type:  dns.TypeToString[q.Qtype],
+			}
+			rsp.Questions = append(rsp.Questions, ques)
+		}
+		// get the authorities and answers.
+		output := parseMessage(in, rtt, r.server)
+		rsp.Authorities = output.Authorities
+		rsp.Answers = output.Answers
+		rsp.Additional = output.Additional
+		rsp.Edns = output.Edns
+		rsp.Status = output.Status
+		rsp.Nameserver = output.Nameserver
+		rsp.HTTPVersion = info.httpVersion
+		rsp.Source = r.dialer.info()
+		if r.resolverOptions.TLSInfo {
+			rsp.TLS = newTLSInfo(info.tls)
+		}
+		final = in
+
+		if len(output.Answers) > 0 || in.Rcode == dns.RcodeSuccess {
+			// stop iterating the searchlist.
+			break
+		}
+
+		// Check if context is done after each iteration
+		select {
+		case <-ctx.Done():
+			return rsp, ctx.Err()
+		default:
+			// Continue to next iteration
+		}
+	}
+
+	if flags.Validate && final != nil {
+		rsp.DNSSEC = r.validator.validate(ctx, final)
+	}
+	return rsp, nil
+}
+
+// exchange sends a single message to the JSON API and returns the reply as a
+// DNS message.
+func (r *DOHJSONResolver) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	in, _, err := r.roundTrip(ctx, msg)
+	return in, err
+}
+
+// roundTrip asks the JSON API the question of msg with a GET request. Only
+// the CD and DO bits and the client subnet of msg are sent, the API has no
+// parameters for the other flags and EDNS options. It returns the reply
+// along with the details of the connection it was received on.
+func (r *DOHJSONResolver) roundTrip(ctx context.Context, msg *dns.Msg) (*dns.Msg, connInfo, error) {
+	q := msg.Question[0]
+	if q.Qclass != dns.ClassINET {
+		return nil, connInfo{}, fmt.Errorf("the DoH JSON API only supports the IN class, not %s", dns.Class(q.Qclass))
+	}
+
+	u, err := url.Parse(r.url)
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+	params := u.Query()
+	params.Set("name", q.Name)
+	params.Set("type", strconv.Itoa(int(q.Qtype)))
+	if msg.CheckingDisabled {
+		params.Set("cd", "1")
+	}
+	if opt := msg.IsEdns0(); opt != nil {
+		if opt.Do() {
+			params.Set("do", "1")
+		}
+		for _, o := range opt.Option {
+			if ecs, ok := o.(*dns.EDNS0_SUBNET); ok {
+				params.Set("edns_client_subnet", fmt.Sprintf("%s/%d", ecs.Address, ecs.SourceNetmask))
+			}
+		}
+	}
+	u.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+	req.Header.Set("Accept", "application/dns-json")
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, connInfo{}, fmt.Errorf("error from nameserver %s", resp.Status)
+	}
+
+	// if debug, extract the response headers
+	for header, value := range resp.Header {
+		r.resolverOptions.Logger.Debug("DOH response header", header, value)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+	var reply dohJSONResponse
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return nil, connInfo{}, fmt.Errorf("invalid DoH JSON response: %w", err)
+	}
+	if reply.Comment != nil {
+		r.resolverOptions.Logger.Debug("DOH JSON comment", "comment", reply.Comment)
+	}
+
+	in := new(dns.Msg)
+	in.SetReply(msg)
+	in.Rcode = reply.Status
+	in.Truncated = reply.TC
+	in.RecursionAvailable = reply.RA
+	in.AuthenticatedData = reply.AD
+	in.Answer = r.records(reply.Answer)
+	in.Ns = r.records(reply.Authority)
+	in.Extra = r.records(reply.Additional)
+	return in, connInfo{httpVersion: resp.Proto, tls: resp.TLS}, nil
+}
+
+// records parses the records of a JSON reply. The ones that can't be parsed
+// are left out with a warning.
+func (r *DOHJSONResolver) records(records []dohJSONRecord) []dns.RR {
+	var rrs []dns.RR
+	for _, rec := range records {
+		typ := dns.Type(rec.Type).String()
+		data := rec.Data
+		// Google sends TXT strings without the quotes, Cloudflare with.
+		if (rec.Type == dns.TypeTXT || rec.Type == dns.TypeSPF) && !strings.HasPrefix(data, `"`) {
+			data = strconv.Quote(data)
+		}
+		rr, err := dns.NewRR(fmt.Sprintf("%s %d IN %s %s", dns.Fqdn(rec.Name), rec.TTL, typ, data))
+		if err != nil || rr == nil {
+			r.resolverOptions.Logger.Warn("Skipping a record of the DoH JSON response", "name", rec.Name, "type", typ, "data", rec.Data, "error", err)
+			continue
+		}
+		rrs = append(rrs, rr)
+	}
+	return rrs
+}
+
+// Address implements the Resolver interface.
+func (r *DOHJSONResolver) Address() string {
+	return r.server
+}
+
+// Lookup implements the Resolver interface
+func (r *DOHJSONResolver) Lookup(ctx context.Context, questions []dns.Question, flags QueryFlags) ([]Response, error) {
+	return ConcurrentLookup(ctx, questions, flags, withRetries(r.query, r.Address(), r.resolverOptions), r.resolverOptions.Logger)
+}
@@ -0,0 +1,133 @@
+package resolvers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startDOHJSONServer serves the DoH JSON API: example.com has an A and a TXT
+// record, every other name is NXDOMAIN. The query string of every request
+// is sent to queries.
+func startDOHJSONServer(t *testing.T, queries chan<- url.Values) string {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Accept") != "application/dns-json" {
+			http.Error(w, "unsupported", http.StatusBadRequest)
+			return
+		}
+		q := req.URL.Query()
+		if queries != nil {
+			queries <- q
+		}
+		w.Header().Set("Content-Type", "application/dns-json")
+		switch {
+		case q.Get("name") == "fail.example.":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case q.Get("name") == "example.com." && q.Get("type") == "1":
+			_, _ = w.Write([]byte(`{"Status":0,"TC":false,"RD":true,"RA":true,"AD":true,"CD":false,
+				"Question":[{"name":"example.com.","type":1}],
+				"Answer":[{"name":"example.com.","type":1,"TTL":300,"data":"192.0.2.1"}]}`))
+		case q.Get("name") == "example.com." && q.Get("type") == "16":
+			_, _ = w.Write([]byte(`{"Status":0,"Question":[{"name":"example.com.","type":16}],
+				"Answer":[{"name":"example.com","type":16,"TTL":300,"data":"v=spf1 -all"}],
+				"Comment":"Response from 192.0.2.53."}`))
+		default:
+			_, _ = w.Write([]byte(`{"Status":3,"Question":[{"name":"` + q.Get("name") + `","type":1}],
+				"Authority":[{"name":"example.","type":6,"TTL":900,"data":"ns.example. hostmaster.example. 2024010101 7200 3600 1209600 3600"}]}`))
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return strings.Replace(srv.URL, "https://", "https+json://", 1) + "/resolve"
+}
+
+func newDOHJSONResolver(t *testing.T, server string) Resolver {
+	t.Helper()
+	r, err := NewDOHJSONResolver(server, Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("NewDOHJSONResolver: %v", err)
+	}
+	return r
+}
+
+func TestDOHJSONResolver(t *testing.T) {
+	queries := make(chan url.Values, 10)
+	server := startDOHJSONServer(t, queries)
+	r := newDOHJSONResolver(t, server)
+
+	rsp, err := r.Lookup(context.Background(), []dns.Question{
+		{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+		{Name: "example.com.", Qtype: dns.TypeTXT, Qclass: dns.ClassINET},
+	}, QueryFlags{CD: true, DO: true})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(rsp) != 2 {
+		t.Fatalf("got %d responses, want 2", len(rsp))
+	}
+	a := rsp[0].Answers
+	if len(a) != 1 || a[0].Type != "A" || a[0].Address != "192.0.2.1" || a[0].TTL != "300s" || a[0].Nameserver != server {
+		t.Errorf("A answers = %+v, want 192.0.2.1 from %s", a, server)
+	}
+	if rd, ok := a[0].RData.(AddressRData); !ok || rd.Address != "192.0.2.1" {
+		t.Errorf("A rdata = %#v, want AddressRData", a[0].RData)
+	}
+	txt := rsp[1].Answers
+	if len(txt) != 1 || txt[0].Address != `"v=spf1 -all"` {
+		t.Errorf("TXT answers = %+v, want the quoted string", txt)
+	}
+	if rsp[0].Status != "NOERROR" {
+		t.Errorf("Status = %q, want NOERROR", rsp[0].Status)
+	}
+
+	q := <-queries
+	if q.Get("cd") != "1" || q.Get("do") != "1" {
+		t.Errorf("query = %v, want cd=1 and do=1", q)
+	}
+}
+
+func TestDOHJSONResolverNXDOMAIN(t *testing.T) {
+	r := newDOHJSONResolver(t, startDOHJSONServer(t, nil))
+
+	rsp, err := r.Lookup(context.Background(), []dns.Question{
+		{Name: "missing.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+	}, QueryFlags{})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if rsp[0].Status != "NXDOMAIN" || len(rsp[0].Answers) != 0 {
+		t.Fatalf("response = %+v, want NXDOMAIN without answers", rsp[0])
+	}
+	auth := rsp[0].Authorities
+	if len(auth) != 1 || auth[0].Type != "SOA" || auth[0].Status != "NXDOMAIN" {
+		t.Fatalf("authorities = %+v, want the SOA", auth)
+	}
+}
+
+func TestDOHJSONResolverErrors(t *testing.T) {
+	r := newDOHJSONResolver(t, startDOHJSONServer(t, nil))
+
+	_, err := r.Lookup(context.Background(), []dns.Question{
+		{Name: "fail.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+	}, QueryFlags{})
+	if err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("err = %v, want the HTTP status", err)
+	}
+
+	_, err = r.Lookup(context.Background(), []dns.Question{
+		{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassCHAOS},
+	}, QueryFlags{})
+	if err == nil || !strings.Contains(err.Error(), "IN class") {
+		t.Errorf("err = %v, want the class to be rejected", err)
+	}
+
+	if _, err := NewDOHJSONResolver("https://dns.example/resolve", Options{}); err == nil {
+		t.Error("NewDOHJSONResolver accepted a https:// address")
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"net"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/miekg/dns"
@@ -15,10 +16,18 @@ import (
 )
 
 // DOQResolver represents the config options for setting up a DOQ based resolver.
+// Its queries are sent on their own streams of a single QUIC connection,
+// opened by the first one and kept until the server closes it or Close is
+// called.
 type DOQResolver struct {
 	tls             *tls.Config
+	dialer          *dialer
 	server          string
 	resolverOptions Options
+	validator       *dnssecValidator
+
+	mu      sync.Mutex
+	session *quic.Conn
 }
 
 // splitHostPort splits a host:port string and handles IPv6 addresses properly.
@@ -35,6 +44,9 @@ func splitHostPort(addr string) (host, port string, err error) {
 
 // NewDOQResolver accepts a nameserver address and configures a DOQ based resolver.
 func NewDOQResolver(server string, resolverOpts Options) (Resolver, error) {
+	if resolverOpts.Dialer != nil {
+		return nil, fmt.Errorf("%s: %w", server, ErrProxyUDP)
+	}
 	// Extract hostname from server address for TLS verification
 	// If TLSHostname is explicitly set via flag, use that; otherwise extract from server address
 	tlsHostname := resolverOpts.TLSHostname
@@ -46,15 +58,35 @@ func NewDOQResolver(server string, resolverOpts Options) (Resolver, error) {
 		}
 	}
 
-	return &DOQResolver{
-		tls: &tls.Config{
-			NextProtos:         []string{"doq"},
-			ServerName:         tlsHostname,
-			InsecureSkipVerify: resolverOpts.InsecureSkipVerify,
-		},
+	config, err := newTLSConfig(resolverOpts, tlsHostname, "doq")
+	if err != nil {
+		return nil, err
+	}
+	d, err := newDialer(resolverOpts)
+	if err != nil {
+		return nil, err
+	}
+	r := &DOQResolver{
+		tls:             config,
+		dialer:          d,
 		server:          server,
 		resolverOptions: resolverOpts,
-	}, nil
+	}
+	r.validator = newDNSSECValidator(r.exchange, resolverOpts.Logger)
+	return r, nil
+}
+
+// Close implements io.Closer, closing the QUIC session with DOQ_NO_ERROR
+// (RFC 9250 section 4.3).
+func (r *DOQResolver) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.session == nil {
+		return nil
+	}
+	err := r.session.CloseWithError(quic.ApplicationErrorCode(quic.NoError), "")
+	r.session = nil
+	return err
 }
 
 // Address implements the Resolver interface.
@@ -64,7 +96,7 @@ func (r *DOQResolver) Address() string {
 
 // Lookup implements the Resolver interface
 func (r *DOQResolver) Lookup(ctx context.Context, questions []dns.Question, flags QueryFlags) ([]Response, error) {
-	return ConcurrentLookup(ctx, questions, flags, r.query, r.resolverOptions.Logger)
+	return ConcurrentLookup(ctx, questions, flags, withRetries(r.query, r.Address(), r.resolverOptions), r.resolverOptions.Logger)
 }
 
 // query takes a dns.Question and sends them to DNS Server.
@@ -72,93 +104,31 @@ func (r *DOQResolver) Lookup(ctx context.Context, questions []dns.Question, flag
 func (r *DOQResolver) query(ctx context.Context, question dns.Question, flags QueryFlags) (Response, error) {
 	var (
 		rsp      Response
-		messages = prepareMessages(question, flags, r.resolverOptions.Ndots, r.resolverOptions.SearchList)
+		final    *dns.Msg
+		messages = prepareMessages(question, flags, r.resolverOptions.Ndots, r.resolverOptions.SearchList, nil)
 	)
 
-	session, err := quic.DialAddr(ctx, r.server, r.tls, nil)
-	if err != nil {
-		return rsp, err
-	}
-	defer session.CloseWithError(quic.ApplicationErrorCode(quic.NoError), "")
-
 	for _, msg := range messages {
 		r.resolverOptions.Logger.Debug("Attempting to resolve",
 			"domain", msg.Question[0].Name,
 			"ndots", r.resolverOptions.Ndots,
 			"nameserver", r.server,
 		)
-
-		// ref: https://www.rfc-editor.org/rfc/rfc9250.html#name-dns-message-ids
-		msg.Id = 0
-
-		// get the DNS Message in wire format.
-		b, err := msg.Pack()
-		if err != nil {
-			return rsp, err
-		}
 		now := time.Now()
 
-		stream, err := session.OpenStreamSync(ctx)
-		if err != nil {
-			return rsp, err
-		}
-
-		msgLen := uint16(len(b))
-		msgLenBytes := []byte{byte(msgLen >> 8), byte(msgLen & 0xFF)}
-		if _, err = stream.Write(msgLenBytes); err != nil {
-			return rsp, err
-		}
-		// Make a QUIC request to the DNS server with the DNS message as wire format bytes in the body.
-		if _, err = stream.Write(b); err != nil {
-			return rsp, err
-		}
-
-		// The client MUST send the DNS query over the selected stream, and MUST
-		// indicate through the STREAM FIN mechanism that no further data will be
-		// sent on that stream. Note, that stream.Close() closes the write-direction
-		// of the stream, but does not prevent reading from it.
-		// See: https://github.com/AdguardTeam/dnsproxy/blob/f901a5f4b9e8d5f143dce459067bc6614c6d927d/upstream/doq.go#L247-L254
-		err = stream.Close()
+		in, info, err := r.roundTrip(ctx, &msg)
 		if err != nil {
-			return rsp, fmt.Errorf("unable to close quic stream: %w", err)
-		}
-
-		// Use a separate context with timeout for reading the response
-		readCtx, cancel := context.WithTimeout(ctx, r.resolverOptions.Timeout)
-		defer cancel()
-
-		var buf []byte
-		errChan := make(chan error, 1)
-		go func() {
-			var err error
-			buf, err = io.ReadAll(stream)
-			errChan <- err
-		}()
-
-		select {
-		case err := <-errChan:
-			if err != nil {
-				return rsp, err
+			if r.resolverOptions.TLSInfo {
+				err = wrapTLSError(err)
 			}
-		case <-readCtx.Done():
-			return rsp, fmt.Errorf("timeout reading response")
+			return rsp, err
 		}
 
-		rtt := time.Since(now)
-
-		if len(buf) < 2 {
-			return rsp, fmt.Errorf("response too short: got %d bytes, need at least 2", len(buf))
-		}
+		// The handshake of a new connection is reported on its own.
+		rtt := time.Since(now) - info.handshake
 
-		packetLen := binary.BigEndian.Uint16(buf[:2])
-		if packetLen != uint16(len(buf[2:])) {
-			return rsp, fmt.Errorf("packet length mismatch")
-		}
-		if err = msg.Unpack(buf[2:]); err != nil {
-			return rsp, err
-		}
 		// pack questions in output.
-		for _, q := range msg.Question {
+		for _, q := range in.Question {
 			ques := Question{
 				Name:  q.Name,
 				Class: dns.ClassToString[q.Qclass],
@@ -167,13 +137,21 @@ func (r *DOQResolver) query(ctx context.Context, question dns.Question, flags Qu
 			rsp.Questions = append(rsp.Questions, ques)
 		}
 		// get the authorities and answers.
-		output := parseMessage(&msg, rtt, r.server)
+		output := parseMessage(in, rtt, r.server)
 		rsp.Authorities = output.Authorities
 		rsp.Answers = output.Answers
 		rsp.Additional = output.Additional
 		rsp.Edns = output.Edns
+		rsp.Status = output.Status
+		rsp.Nameserver = output.Nameserver
+		rsp.Handshake = formatHandshake(info.handshake)
+		rsp.Source = r.dialer.info()
+		if r.resolverOptions.TLSInfo {
+			rsp.TLS = newTLSInfo(info.tls)
+		}
+		final = in
 
-		if len(output.Answers) > 0 || msg.Rcode == dns.RcodeSuccess {
+		if len(output.Answers) > 0 || in.Rcode == dns.RcodeSuccess {
 			// stop iterating the searchlist.
 			break
 		}
@@ -186,5 +164,131 @@ func (r *DOQResolver) query(ctx context.Context, question dns.Question, flags Qu
 			// Continue to next iteration
 		}
 	}
+
+	if flags.Validate && final != nil {
+		rsp.DNSSEC = r.validator.validate(ctx, final)
+	}
 	return rsp, nil
 }
+
+// exchange sends a single message to the DoQ server.
+func (r *DOQResolver) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	in, _, err := r.roundTrip(ctx, msg)
+	return in, err
+}
+
+// roundTrip sends a single message on a stream of the QUIC session and
+// returns the reply, along with the details of the session.
+func (r *DOQResolver) roundTrip(ctx context.Context, msg *dns.Msg) (*dns.Msg, connInfo, error) {
+	session, handshake, err := r.dial(ctx)
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+	in, err := r.exchangeOnSession(ctx, session, msg)
+	if err != nil && handshake == 0 && session.Context().Err() != nil {
+		// The server closed the idle session, the query is sent again on a
+		// new one.
+		r.resolverOptions.Logger.Debug("QUIC session closed; retrying on a new one", "nameserver", r.server, "error", err)
+		if session, handshake, err = r.dial(ctx); err != nil {
+			return nil, connInfo{}, err
+		}
+		in, err = r.exchangeOnSession(ctx, session, msg)
+	}
+	state := session.ConnectionState().TLS
+	return in, connInfo{handshake: handshake, tls: &state}, err
+}
+
+// dial returns the QUIC session to the server, opening it if there is none
+// yet or the previous one was closed.
+func (r *DOQResolver) dial(ctx context.Context) (*quic.Conn, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.session != nil && r.session.Context().Err() == nil {
+		return r.session, 0, nil
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, r.resolverOptions.Timeout)
+	defer cancel()
+	now := time.Now()
+	session, err := r.dialer.dialQUIC(dialCtx, r.server, r.tls, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	handshake := time.Since(now)
+	r.resolverOptions.Logger.Debug("Opened QUIC session", "nameserver", r.server, "handshake", handshake)
+	r.session = session
+	return session, handshake, nil
+}
+
+// exchangeOnSession sends a single message on its own stream of an
+// established QUIC session and returns the raw reply.
+func (r *DOQResolver) exchangeOnSession(ctx context.Context, session *quic.Conn, msg *dns.Msg) (*dns.Msg, error) {
+	// ref: https://www.rfc-editor.org/rfc/rfc9250.html#name-dns-message-ids
+	msg.Id = 0
+
+	// get the DNS Message in wire format.
+	b, err := msg.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	stream, err := session.OpenStreamSync(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	msgLen := uint16(len(b))
+	msgLenBytes := []byte{byte(msgLen >> 8), byte(msgLen & 0xFF)}
+	if _, err = stream.Write(msgLenBytes); err != nil {
+		return nil, err
+	}
+	// Make a QUIC request to the DNS server with the DNS message as wire format bytes in the body.
+	if _, err = stream.Write(b); err != nil {
+		return nil, err
+	}
+
+	// The client MUST send the DNS query over the selected stream, and MUST
+	// indicate through the STREAM FIN mechanism that no further data will be
+	// sent on that stream. Note, that stream.Close() closes the write-direction
+	// of the stream, but does not prevent reading from it.
+	// See: https://github.com/AdguardTeam/dnsproxy/blob/f901a5f4b9e8d5f143dce459067bc6614c6d927d/upstream/doq.go#L247-L254
+	err = stream.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to close quic stream: %w", err)
+	}
+
+	// Use a separate context with timeout for reading the response
+	readCtx, cancel := context.WithTimeout(ctx, r.resolverOptions.Timeout)
+	defer cancel()
+
+	var buf []byte
+	errChan := make(chan error, 1)
+	go func() {
+		var err error
+		buf, err = io.ReadAll(stream)
+		errChan <- err
+	}()
+
+	select {
+	case err := <-errChan:
+		if err != nil {
+			return nil, err
+		}
+	case <-readCtx.Done():
+		return nil, fmt.Errorf("timeout reading response")
+	}
+
+	if len(buf) < 2 {
+		return nil, fmt.Errorf("response too short: got %d bytes, need at least 2", len(buf))
+	}
+
+	packetLen := binary.BigEndian.Uint16(buf[:2])
+	if packetLen != uint16(len(buf[2:])) {
+		return nil, fmt.Errorf("packet length mismatch")
+	}
+	in := new(dns.Msg)
+	if err = in.Unpack(buf[2:]); err != nil {
+		return nil, err
+	}
+	return in, nil
+}
@@ -0,0 +1,616 @@
+package resolvers
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hpke"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// Oblivious DoH, RFC 9230.
+const (
+	odohVersion         = 0x0001
+	odohMessageQuery    = 0x01
+	odohMessageResponse = 0x02
+	odohContentType     = "application/oblivious-dns-message"
+	odohConfigsPath     = "/.well-known/odohconfigs"
+	// Queries are padded to a multiple of this many bytes.
+	odohPaddingBlock = 128
+)
+
+// ODOHResolver represents the config options for setting up an Oblivious DoH
+// resolver. Queries are encrypted with the public key of the target and sent
+// through the relay, so that the relay sees who asks but not what, and the
+// target sees what is asked but not by whom.
+type ODOHResolver struct {
+	client          *http.Client
+	dialer          *dialer
+	server          string
+	target          *url.URL
+	relay           *url.URL
+	resolverOptions Options
+	validator       *dnssecValidator
+
+	mu     sync.Mutex
+	config *odohConfig
+}
+
+// odohConfig is the ObliviousDoHConfigContents of the target, with the HPKE
+// suite it stands for.
+type odohConfig struct {
+	keyID   []byte
+	kemID   uint16
+	kdfID   uint16
+	aeadID  uint16
+	pk      hpke.PublicKey
+	kdf     hpke.KDF
+	aead    hpke.AEAD
+	hash    func() hash.Hash
+	keySize int
+}
+
+// errODoHStaleConfig is returned when the target doesn't know the key the
+// query was encrypted with anymore.
+var errODoHStaleConfig = errors.New("the target rejected the ODoH config")
+
+// NewODOHResolver accepts an odoh:// target address and configures an
+// Oblivious DoH resolver. The relay is taken from the `relay` parameter of
+// the address, eg odoh://odoh.example/dns-query?relay=https://relay.example/proxy,
+// or else from Options.ODoHRelay. Both may be a URL or an ODoH relay stamp.
+func NewODOHResolver(server string, resolverOpts Options) (Resolver, error) {
+	u, err := url.ParseRequestURI(server)
+	if err != nil || u.Scheme != "odoh" || u.Host == "" {
+		return nil, fmt.Errorf("%s is not a valid ODoH nameserver", server)
+	}
+	relay := resolverOpts.ODoHRelay
+	if q := u.Query(); q.Has("relay") {
+		relay = q.Get("relay")
+		q.Del("relay")
+		u.RawQuery = q.Encode()
+	}
+	u.Scheme = "https"
+	if u.Path == "" {
+		u.Path = "/dns-query"
+	}
+
+	d, err := newDialer(resolverOpts)
+	if err != nil {
+		return nil, err
+	}
+	client, err := newHTTPClient(resolverOpts, d)
+	if err != nil {
+		return nil, err
+	}
+	r := &ODOHResolver{
+		client:          client,
+		dialer:          d,
+		server:          server,
+		target:          u,
+		resolverOptions: resolverOpts,
+	}
+	if relay != "" {
+		if r.relay, err = parseODoHRelay(relay); err != nil {
+			return nil, err
+		}
+	} else {
+		resolverOpts.Logger.Warn("No ODoH relay given, the target will see the address of the queries", "nameserver", server)
+	}
+	r.validator = newDNSSECValidator(r.exchange, resolverOpts.Logger)
+	return r, nil
+}
+
+// query takes a dns.Question and sends them to DNS Server.
+// It parses the Response from the server in a custom output format.
+func (r *ODOHResolver) query(ctx context.Context, question dns.Question, flags QueryFlags) (Response, error) {
+	var (
+		rsp      Response
+		final    *dns.Msg
+		messages = prepareMessages(question, flags, r.resolverOptions.Ndots, r.resolverOptions.SearchList, nil)
+	)
+
+	for _, msg := range messages {
+		r.resolverOptions.Logger.Debug("Attempting to resolve",
+			"domain", msg.Question[0].Name,
+			"ndots", r.resolverOptions.Ndots,
+			"nameserver", r.server,
+		)
+		now := time.Now()
+
+		in, proto, err := r.roundTrip(ctx, &msg)
+		if err != nil {
+			return rsp, err
+		}
+		rtt := time.Since(now)
+
+		// pack questions in output.
+		for _, q := range in.Question {
+			ques := Question{
+				Name:  q.Name,
+				Class: dns.ClassToString[q.Qclass],
+				Type:  dns.TypeToString[q.Qtype],
+			}
+			rsp.Questions = append(rsp.Questions, ques)
+		}
+		// get the authorities and answers.
+		output := parseMessage(in, rtt, r.server)
+		rsp.Authorities = output.Authorities
+		rsp.Answers = output.Answers
+		rsp.Additional = output.Additional
+		rsp.Edns = output.Edns
+		rsp.Status = output.Status
+		rsp.Nameserver = output.Nameserver
+		rsp.HTTPVersion = proto
+		rsp.Source = r.dialer.info()
+		final = in
+
+		if len(output.Answers) > 0 || in.Rcode == dns.RcodeSuccess {
+			// stop iterating the searchlist.
+			break
+		}
+
+		// Check if context is done after each iteration
+		select {
+		case <-ctx.Done():
+			return rsp, ctx.Err()
+		default:
+			// Continue to next iteration
+		}
+	}
+
+	if flags.Validate && final != nil {
+		rsp.DNSSEC = r.validator.validate(ctx, final)
+	}
+	return rsp, nil
+}
+
+// exchange sends a single message to the target and returns the decrypted
+// reply.
+func (r *ODOHResolver) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, error) {
+	in, _, err := r.roundTrip(ctx, msg)
+	return in, err
+}
+
+// roundTrip encrypts msg for the target, sends it through the relay and
+// decrypts the reply. The config of the target is fetched on the first
+// query, and again when the target rejects it, eg after a key rotation.
+func (r *ODOHResolver) roundTrip(ctx context.Context, msg *dns.Msg) (*dns.Msg, string, error) {
+	cfg, err := r.loadConfig(ctx, false)
+	if err != nil {
+		return nil, "", err
+	}
+	in, proto, err := r.send(ctx, cfg, msg)
+	if errors.Is(err, errODoHStaleConfig) {
+		r.resolverOptions.Logger.Debug("ODoH config rejected, fetching it again", "nameserver", r.server)
+		if cfg, err = r.loadConfig(ctx, true); err != nil {
+			return nil, "", err
+		}
+		in, proto, err = r.send(ctx, cfg, msg)
+	}
+	return in, proto, err
+}
+
+// loadConfig returns the ODoH config of the target, fetching it from its
+// well-known URL when it isn't known yet or refresh is set.
+func (r *ODOHResolver) loadConfig(ctx context.Context, refresh bool) (*odohConfig, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.config != nil && !refresh {
+		return r.config, nil
+	}
+
+	u := *r.target
+	u.Path, u.RawQuery = odohConfigsPath, ""
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching the ODoH config: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching the ODoH config: %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := parseODoHConfigs(body)
+	if err != nil {
+		return nil, err
+	}
+	r.resolverOptions.Logger.Debug("Fetched ODoH config",
+		"nameserver", r.server,
+		"kem", cfg.kemID,
+		"kdf", cfg.kdfID,
+		"aead", cfg.aeadID,
+		"key_id", base64.StdEncoding.EncodeToString(cfg.keyID),
+	)
+	r.config = cfg
+	return cfg, nil
+}
+
+// send encrypts msg with cfg and POSTs it to the relay, or to the target when
+// there's no relay.
+func (r *ODOHResolver) send(ctx context.Context, cfg *odohConfig, msg *dns.Msg) (*dns.Msg, string, error) {
+	b, err := msg.Pack()
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext := odohPlaintext(b)
+	enc, sender, err := hpke.NewSender(cfg.pk, cfg.kdf, cfg.aead, []byte("odoh query"))
+	if err != nil {
+		return nil, "", err
+	}
+	ciphertext, err := sender.Seal(odohAAD(odohMessageQuery, cfg.keyID), plaintext)
+	if err != nil {
+		return nil, "", err
+	}
+	query := odohMessage(odohMessageQuery, cfg.keyID, append(enc, ciphertext...))
+
+	endpoint := r.target.String()
+	if r.relay != nil {
+		u := *r.relay
+		params := u.Query()
+		params.Set("targethost", r.target.Host)
+		params.Set("targetpath", r.target.Path)
+		u.RawQuery = params.Encode()
+		endpoint = u.String()
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(query))
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Content-Type", odohContentType)
+	req.Header.Set("Accept", odohContentType)
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, "", errODoHStaleConfig
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("error from nameserver %s", resp.Status)
+	}
+
+	// if debug, extract the response headers
+	for header, value := range resp.Header {
+		r.resolverOptions.Logger.Debug("ODOH response header", header, value)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	reply, err := cfg.decryptResponse(sender, plaintext, body)
+	if err != nil {
+		return nil, "", err
+	}
+	in := new(dns.Msg)
+	if err := in.Unpack(reply); err != nil {
+		return nil, "", err
+	}
+	return in, resp.Proto, nil
+}
+
+// decryptResponse decrypts the ObliviousDoHMessage the target replied to the
+// query with, returning the DNS message in wire format (RFC 9230 section
+// 6.2).
+func (cfg *odohConfig) decryptResponse(sender *hpke.Sender, query, response []byte) ([]byte, error) {
+	typ, nonce, ciphertext, err := parseODoHMessage(response)
+	if err != nil {
+		return nil, err
+	}
+	if typ != odohMessageResponse {
+		return nil, fmt.Errorf("invalid ODoH response: message type %d", typ)
+	}
+
+	secret, err := sender.Export("odoh response", cfg.keySize)
+	if err != nil {
+		return nil, err
+	}
+	salt := binary.BigEndian.AppendUint16(bytes.Clone(query), uint16(len(nonce)))
+	salt = append(salt, nonce...)
+	prk, err := hkdf.Extract(cfg.hash, secret, salt)
+	if err != nil {
+		return nil, err
+	}
+	key, err := hkdf.Expand(cfg.hash, prk, "odoh key", cfg.keySize)
+	if err != nil {
+		return nil, err
+	}
+	aeadNonce, err := hkdf.Expand(cfg.hash, prk, "odoh nonce", 12)
+	if err != nil {
+		return nil, err
+	}
+
+	var aead cipher.AEAD
+	switch cfg.aeadID {
+	case 0x0001, 0x0002:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		aead, err = cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		aead, err = chacha20poly1305.New(key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	plaintext, err := aead.Open(nil, aeadNonce, ciphertext, odohAAD(odohMessageResponse, nonce))
+	if err != nil {
+		return nil, fmt.Errorf("unable to decrypt the ODoH response: %w", err)
+	}
+	msg, ok := readODoHVector(plaintext)
+	if !ok || len(msg) == 0 {
+		return nil, errors.New("invalid ODoH response: no DNS message")
+	}
+	return msg, nil
+}
+
+// parseODoHConfigs parses the ObliviousDoHConfigs served by a target and
+// returns the first config whose version and HPKE suite are supported.
+func parseODoHConfigs(b []byte) (*odohConfig, error) {
+	configs, ok := readODoHVector(b)
+	if !ok {
+		return nil, errors.New("invalid ODoH configs")
+	}
+	var lastErr error
+	for len(configs) >= 4 {
+		version := binary.BigEndian.Uint16(configs)
+		contents, ok := readODoHVector(configs[2:])
+		if !ok {
+			return nil, errors.New("invalid ODoH configs")
+		}
+		configs = configs[4+len(contents):]
+		if version != odohVersion {
+			lastErr = fmt.Errorf("unsupported ODoH config version %#04x", version)
+			continue
+		}
+		cfg, err := newODoHConfig(contents)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return cfg, nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("empty ODoH configs")
+	}
+	return nil, lastErr
+}
+
+// newODoHConfig parses an ObliviousDoHConfigContents.
+func newODoHConfig(contents []byte) (*odohConfig, error) {
+	if len(contents) < 6 {
+		return nil, errors.New("invalid ODoH config")
+	}
+	cfg := &odohConfig{
+		kemID:  binary.BigEndian.Uint16(contents),
+		kdfID:  binary.BigEndian.Uint16(contents[2:]),
+		aeadID: binary.BigEndian.Uint16(contents[4:]),
+	}
+	publicKey, ok := readODoHVector(contents[6:])
+	if !ok {
+		return nil, errors.New("invalid ODoH config")
+	}
+
+	kem, err := hpke.NewKEM(cfg.kemID)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported ODoH config: %w", err)
+	}
+	if cfg.pk, err = kem.NewPublicKey(publicKey); err != nil {
+		return nil, fmt.Errorf("invalid ODoH public key: %w", err)
+	}
+	if cfg.kdf, err = hpke.NewKDF(cfg.kdfID); err != nil {
+		return nil, fmt.Errorf("unsupported ODoH config: %w", err)
+	}
+	if cfg.aead, err = hpke.NewAEAD(cfg.aeadID); err != nil {
+		return nil, fmt.Errorf("unsupported ODoH config: %w", err)
+	}
+	switch cfg.kdfID {
+	case 0x0001:
+		cfg.hash = sha256.New
+	case 0x0002:
+		cfg.hash = sha512.New384
+	case 0x0003:
+		cfg.hash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported ODoH KDF %#04x", cfg.kdfID)
+	}
+	switch cfg.aeadID {
+	case 0x0001:
+		cfg.keySize = 16
+	case 0x0002, 0x0003:
+		cfg.keySize = 32
+	default:
+		return nil, fmt.Errorf("unsupported ODoH AEAD %#04x", cfg.aeadID)
+	}
+
+	// key_id = Expand(Extract("", config), "odoh key id", Nh)
+	prk, err := hkdf.Extract(cfg.hash, contents, nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.keyID, err = hkdf.Expand(cfg.hash, prk, "odoh key id", cfg.hash().Size()); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// odohPlaintext returns the ObliviousDoHMessagePlaintext of a DNS message,
+// padded with zeros.
+func odohPlaintext(msg []byte) []byte {
+	padding := (odohPaddingBlock - len(msg)%odohPaddingBlock) % odohPaddingBlock
+	b := binary.BigEndian.AppendUint16(nil, uint16(len(msg)))
+	b = append(b, msg...)
+	b = binary.BigEndian.AppendUint16(b, uint16(padding))
+	return append(b, make([]byte, padding)...)
+}
+
+// odohMessage returns an ObliviousDoHMessage. keyID is the response nonce
+// of responses.
+func odohMessage(typ byte, keyID, encrypted []byte) []byte {
+	b := odohAAD(typ, keyID)
+	b = binary.BigEndian.AppendUint16(b, uint16(len(encrypted)))
+	return append(b, encrypted...)
+}
+
+// parseODoHMessage splits an ObliviousDoHMessage.
+func parseODoHMessage(b []byte) (typ byte, keyID, encrypted []byte, err error) {
+	if len(b) < 1 {
+		return 0, nil, nil, errors.New("invalid ODoH message")
+	}
+	typ = b[0]
+	keyID, ok := readODoHVector(b[1:])
+	if !ok {
+		return 0, nil, nil, errors.New("invalid ODoH message")
+	}
+	encrypted, ok = readODoHVector(b[3+len(keyID):])
+	if !ok {
+		return 0, nil, nil, errors.New("invalid ODoH message")
+	}
+	return typ, keyID, encrypted, nil
+}
+
+// odohAAD returns the additional data the message of an ObliviousDoHMessage
+// is encrypted with: its type and key ID.
+func odohAAD(typ byte, keyID []byte) []byte {
+	b := binary.BigEndian.AppendUint16([]byte{typ}, uint16(len(keyID)))
+	return append(b, keyID...)
+}
+
+// readODoHVector reads a vector with a 2 bytes length prefix.
+func readODoHVector(b []byte) ([]byte, bool) {
+	if len(b) < 2 {
+		return nil, false
+	}
+	n := int(binary.BigEndian.Uint16(b))
+	if len(b) < 2+n {
+		return nil, false
+	}
+	return b[2 : 2+n], true
+}
+
+// parseODoHRelay returns the URL of a relay given as a https:// URL or an
+// ODoH relay stamp.
+func parseODoHRelay(relay string) (*url.URL, error) {
+	if strings.HasPrefix(relay, "sdns://") {
+		host, path, err := parseODoHStamp(relay, odohRelayStamp)
+		if err != nil {
+			return nil, err
+		}
+		return &url.URL{Scheme: "https", Host: host, Path: path}, nil
+	}
+	u, err := url.ParseRequestURI(relay)
+	if err != nil || u.Scheme != "https" || u.Host == "" {
+		return nil, fmt.Errorf("%s is not a valid ODoH relay, want a https:// URL or a relay stamp", relay)
+	}
+	return u, nil
+}
+
+// The protocol identifiers of the ODoH DNS stamps.
+const (
+	odohTargetStamp = 0x05
+	odohRelayStamp  = 0x85
+)
+
+// IsODoHStamp reports whether stamp is the DNS stamp of an ODoH target or
+// relay.
+func IsODoHStamp(stamp string) bool {
+	bin, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(stamp, "sdns://"))
+	return err == nil && len(bin) > 0 && (bin[0] == odohTargetStamp || bin[0] == odohRelayStamp)
+}
+
+// ODoHTargetFromStamp returns the odoh:// address of the target of an ODoH
+// target stamp.
+func ODoHTargetFromStamp(stamp string) (string, error) {
+	host, path, err := parseODoHStamp(stamp, odohTargetStamp)
+	if err != nil {
+		return "", err
+	}
+	u := url.URL{Scheme: "odoh", Host: host, Path: path}
+	return u.String(), nil
+}
+
+// parseODoHStamp returns the host and path of an ODoH target stamp
+// (0x05, props, hostname, path) or relay stamp (0x85, props, addr, hashes,
+// hostname, path, bootstrap IPs).
+func parseODoHStamp(stamp string, proto byte) (host, path string, err error) {
+	bin, err := base64.RawURLEncoding.DecodeString(strings.TrimPrefix(stamp, "sdns://"))
+	if err != nil {
+		return "", "", fmt.Errorf("invalid DNS stamp: %w", err)
+	}
+	if len(bin) < 9 || bin[0] != proto {
+		return "", "", errors.New("invalid ODoH stamp")
+	}
+	b := bin[9:]
+
+	// readLP reads a value prefixed with its length. Hashes are a list of
+	// such values, with the high bit of the length set on all but the last.
+	readLP := func() ([]byte, bool) {
+		if len(b) < 1 || len(b) < 1+int(b[0]&0x7f) {
+			return nil, false
+		}
+		n := int(b[0] & 0x7f)
+		v := b[1 : 1+n]
+		b = b[1+n:]
+		return v, true
+	}
+	if proto == odohRelayStamp {
+		if _, ok := readLP(); !ok {
+			return "", "", errors.New("invalid ODoH stamp")
+		}
+		for len(b) > 0 && b[0]&0x80 != 0 {
+			readLP()
+		}
+		if _, ok := readLP(); !ok {
+			return "", "", errors.New("invalid ODoH stamp")
+		}
+	}
+	h, ok := readLP()
+	if !ok || len(h) == 0 {
+		return "", "", errors.New("invalid ODoH stamp: no hostname")
+	}
+	p, ok := readLP()
+	if !ok {
+		return "", "", errors.New("invalid ODoH stamp: no path")
+	}
+	return string(h), string(p), nil
+}
+
+// Address implements the Resolver interface.
+func (r *ODOHResolver) Address() string {
+	return r.server
+}
+
+// Lookup implements the Resolver interface
+func (r *ODOHResolver) Lookup(ctx context.Context, questions []dns.Question, flags QueryFlags) ([]Response, error) {
+	return ConcurrentLookup(ctx, questions, flags, withRetries(r.query, r.Address(), r.resolverOptions), r.resolverOptions.Logger)
+}
@@ -0,0 +1,245 @@
+package resolvers
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/hpke"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// odohTestTarget is an ODoH target with a X25519, HKDF-SHA256, AES-128-GCM
+// key, answering every A query with 192.0.2.1.
+type odohTestTarget struct {
+	t       *testing.T
+	mu      sync.Mutex
+	sk      hpke.PrivateKey
+	configs []byte
+	keyID   []byte
+	fetches atomic.Int32
+	queries atomic.Int32
+}
+
+// rotate replaces the key of the target.
+func (tg *odohTestTarget) rotate() {
+	sk, err := hpke.DHKEM(ecdh.X25519()).GenerateKey()
+	if err != nil {
+		tg.t.Fatal(err)
+	}
+	contents := []byte{0x00, 0x20, 0x00, 0x01, 0x00, 0x01}
+	contents = binary.BigEndian.AppendUint16(contents, uint16(len(sk.PublicKey().Bytes())))
+	contents = append(contents, sk.PublicKey().Bytes()...)
+	cfg, err := newODoHConfig(contents)
+	if err != nil {
+		tg.t.Fatal(err)
+	}
+	config := binary.BigEndian.AppendUint16(nil, odohVersion)
+	config = binary.BigEndian.AppendUint16(config, uint16(len(contents)))
+	config = append(config, contents...)
+
+	tg.mu.Lock()
+	defer tg.mu.Unlock()
+	tg.sk = sk
+	tg.keyID = cfg.keyID
+	tg.configs = append(binary.BigEndian.AppendUint16(nil, uint16(len(config))), config...)
+}
+
+func (tg *odohTestTarget) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	tg.mu.Lock()
+	sk, keyID, configs := tg.sk, tg.keyID, tg.configs
+	tg.mu.Unlock()
+
+	if req.URL.Path == odohConfigsPath {
+		tg.fetches.Add(1)
+		_, _ = w.Write(configs)
+		return
+	}
+	tg.queries.Add(1)
+	body, _ := io.ReadAll(req.Body)
+	typ, gotKeyID, encrypted, err := parseODoHMessage(body)
+	if err != nil || typ != odohMessageQuery || req.Header.Get("Content-Type") != odohContentType {
+		http.Error(w, "bad query", http.StatusBadRequest)
+		return
+	}
+	if !bytes.Equal(gotKeyID, keyID) {
+		http.Error(w, "unknown key", http.StatusUnauthorized)
+		return
+	}
+	recipient, err := hpke.NewRecipient(encrypted[:32], sk, hpke.HKDFSHA256(), hpke.AES128GCM(), []byte("odoh query"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	plaintext, err := recipient.Open(odohAAD(odohMessageQuery, keyID), encrypted[32:])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	wire, _ := readODoHVector(plaintext)
+	msg := new(dns.Msg)
+	if err := msg.Unpack(wire); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m := new(dns.Msg)
+	m.SetReply(msg)
+	m.Answer = append(m.Answer, testRR(tg.t, msg.Question[0].Name+" 60 IN A 192.0.2.1"))
+	reply, _ := m.Pack()
+
+	// RFC 9230 section 6.3.
+	secret, _ := recipient.Export("odoh response", 16)
+	nonce := make([]byte, 16)
+	_, _ = rand.Read(nonce)
+	salt := binary.BigEndian.AppendUint16(bytes.Clone(plaintext), uint16(len(nonce)))
+	prk, _ := hkdf.Extract(sha256.New, secret, append(salt, nonce...))
+	key, _ := hkdf.Expand(sha256.New, prk, "odoh key", 16)
+	aeadNonce, _ := hkdf.Expand(sha256.New, prk, "odoh nonce", 12)
+	block, _ := aes.NewCipher(key)
+	gcm, _ := cipher.NewGCM(block)
+	ciphertext := gcm.Seal(nil, aeadNonce, odohPlaintext(reply), odohAAD(odohMessageResponse, nonce))
+
+	w.Header().Set("Content-Type", odohContentType)
+	_, _ = w.Write(odohMessage(odohMessageResponse, nonce, ciphertext))
+}
+
+// startODoH starts a target and a relay forwarding to it. It returns the
+// address of the target, with the relay, and the number of relayed queries.
+func startODoH(t *testing.T) (*odohTestTarget, string, *atomic.Int32) {
+	t.Helper()
+	tg := &odohTestTarget{t: t}
+	tg.rotate()
+	target := httptest.NewTLSServer(tg)
+	t.Cleanup(target.Close)
+
+	var relayed atomic.Int32
+	forward := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	relay := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		relayed.Add(1)
+		q := req.URL.Query()
+		fwd, err := http.NewRequest("POST", "https://"+q.Get("targethost")+q.Get("targetpath"), req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fwd.Header.Set("Content-Type", req.Header.Get("Content-Type"))
+		resp, err := forward.Do(fwd)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer resp.Body.Close()
+		w.WriteHeader(resp.StatusCode)
+		_, _ = io.Copy(w, resp.Body)
+	}))
+	t.Cleanup(relay.Close)
+
+	server := strings.Replace(target.URL, "https://", "odoh://", 1) + "/dns-query?relay=" + relay.URL + "/proxy"
+	return tg, server, &relayed
+}
+
+func odohLookup(t *testing.T, r Resolver) Response {
+	t.Helper()
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	rsp, err := r.Lookup(context.Background(), []dns.Question{q}, QueryFlags{})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(rsp) != 1 || len(rsp[0].Answers) != 1 || rsp[0].Answers[0].Address != "192.0.2.1" {
+		t.Fatalf("responses = %+v, want the answer 192.0.2.1", rsp)
+	}
+	return rsp[0]
+}
+
+func TestODOHResolverThroughRelay(t *testing.T) {
+	tg, server, relayed := startODoH(t)
+	r, err := NewODOHResolver(server, Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("NewODOHResolver: %v", err)
+	}
+
+	rsp := odohLookup(t, r)
+	if rsp.Nameserver != server {
+		t.Errorf("Nameserver = %q, want %q", rsp.Nameserver, server)
+	}
+	odohLookup(t, r)
+	if got := relayed.Load(); got != 2 {
+		t.Errorf("relay forwarded %d queries, want 2", got)
+	}
+	if got := tg.fetches.Load(); got != 1 {
+		t.Errorf("config fetched %d times, want once", got)
+	}
+
+	// After a key rotation, the target rejects the old key and the config is
+	// fetched again.
+	tg.rotate()
+	odohLookup(t, r)
+	if got := tg.fetches.Load(); got != 2 {
+		t.Errorf("config fetched %d times after the rotation, want 2", got)
+	}
+}
+
+func TestODOHResolverRelayOption(t *testing.T) {
+	_, server, relayed := startODoH(t)
+	target, relay, _ := strings.Cut(server, "?relay=")
+
+	r, err := NewODOHResolver(target, Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true, ODoHRelay: relay})
+	if err != nil {
+		t.Fatalf("NewODOHResolver: %v", err)
+	}
+	odohLookup(t, r)
+	if relayed.Load() != 1 {
+		t.Error("the query wasn't sent through the relay of Options.ODoHRelay")
+	}
+}
+
+func TestODoHStamps(t *testing.T) {
+	lp := func(s string) []byte { return append([]byte{byte(len(s))}, s...) }
+	props := make([]byte, 8)
+
+	target := append(append([]byte{odohTargetStamp}, props...), lp("odoh.example")...)
+	target = append(target, lp("/dns-query")...)
+	stamp := "sdns://" + base64.RawURLEncoding.EncodeToString(target)
+	if !IsODoHStamp(stamp) {
+		t.Fatalf("IsODoHStamp(%s) = false", stamp)
+	}
+	if got, err := ODoHTargetFromStamp(stamp); err != nil || got != "odoh://odoh.example/dns-query" {
+		t.Errorf("ODoHTargetFromStamp = %q, %v, want odoh://odoh.example/dns-query", got, err)
+	}
+
+	// A relay stamp has an address and certificate hashes before the host.
+	hash := strings.Repeat("h", 32)
+	relay := append(append([]byte{odohRelayStamp}, props...), lp("")...)
+	relay = append(relay, byte(0x80|len(hash)))
+	relay = append(relay, hash...)
+	relay = append(relay, lp(hash)...)
+	relay = append(relay, lp("relay.example")...)
+	relay = append(relay, lp("/proxy")...)
+	u, err := parseODoHRelay("sdns://" + base64.RawURLEncoding.EncodeToString(relay))
+	if err != nil || u.String() != "https://relay.example/proxy" {
+		t.Errorf("parseODoHRelay = %v, %v, want https://relay.example/proxy", u, err)
+	}
+
+	if _, err := ODoHTargetFromStamp("sdns://" + base64.RawURLEncoding.EncodeToString(relay)); err == nil {
+		t.Error("ODoHTargetFromStamp accepted a relay stamp")
+	}
+	if _, err := parseODoHRelay("http://relay.example/proxy"); err == nil {
+		t.Error("parseODoHRelay accepted a http:// URL")
+	}
+}
@@ -0,0 +1,260 @@
+package resolvers
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// maxPipelined is the number of queries in flight on a connection before
+// the pool opens another one.
+const maxPipelined = 64
+
+// connIdleTimeout is how long a connection is kept open without queries.
+const connIdleTimeout = 10 * time.Second
+
+// errConnClosed is returned for the queries in flight on a connection that
+// broke or was closed by the nameserver.
+var errConnClosed = errors.New("connection closed")
+
+// connPool keeps the TCP or TLS connections of a resolver open, so its
+// queries share them instead of each paying for a handshake. Queries are
+// pipelined on a connection and the replies matched to them by ID, in
+// whatever order they arrive (RFC 7766 section 6.2.1.1).
+type connPool struct {
+	dial    func(ctx context.Context) (*dns.Conn, error)
+	server  string
+	timeout time.Duration
+	logger  *slog.Logger
+
+	mu    sync.Mutex
+	conns []*pipelinedConn
+}
+
+func newConnPool(server string, dial func(ctx context.Context) (*dns.Conn, error), timeout time.Duration, logger *slog.Logger) *connPool {
+	if timeout <= 0 {
+		// The default of the dns library.
+		timeout = 2 * time.Second
+	}
+	return &connPool{
+		dial:    dial,
+		server:  server,
+		timeout: timeout,
+		logger:  logger,
+	}
+}
+
+// exchange sends msg on a pooled connection and returns the reply, along with
+// the details of the connection.
+func (p *connPool) exchange(ctx context.Context, msg *dns.Msg) (*dns.Msg, connInfo, error) {
+	conn, handshake, err := p.get(ctx)
+	if err != nil {
+		return nil, connInfo{}, err
+	}
+	in, err := conn.exchange(ctx, msg, p.timeout)
+	if err != nil && handshake == 0 && errors.Is(err, errConnClosed) {
+		// Nameservers close idle connections, the query is sent again on a
+		// new one.
+		p.logger.Debug("Pooled connection closed; retrying on a new one", "nameserver", p.server, "error", err)
+		if conn, handshake, err = p.get(ctx); err != nil {
+			return nil, connInfo{}, err
+		}
+		in, err = conn.exchange(ctx, msg, p.timeout)
+	}
+	return in, connInfo{handshake: handshake, tls: conn.tls}, err
+}
+
+// get returns the least busy open connection, or a new one when they are all
+// broken or busy.
+func (p *connPool) get(ctx context.Context) (*pipelinedConn, time.Duration, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var (
+		best     *pipelinedConn
+		bestLoad = maxPipelined
+	)
+	open := p.conns[:0]
+	for _, c := range p.conns {
+		inFlight, ok := c.load()
+		if !ok {
+			continue
+		}
+		open = append(open, c)
+		if inFlight < bestLoad {
+			best, bestLoad = c, inFlight
+		}
+	}
+	p.conns = open
+	if best != nil {
+		return best, 0, nil
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	now := time.Now()
+	conn, err := p.dial(dialCtx)
+	if err != nil {
+		return nil, 0, err
+	}
+	handshake := time.Since(now)
+	p.logger.Debug("Opened connection", "nameserver", p.server, "handshake", handshake)
+
+	c := &pipelinedConn{conn: conn, pending: make(map[uint16]chan pipelinedReply)}
+	if tc, ok := conn.Conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		c.tls = &state
+	}
+	c.extend(connIdleTimeout)
+	go c.read()
+	p.conns = append(p.conns, c)
+	return c, handshake, nil
+}
+
+// close closes the connections, failing the queries in flight on them.
+func (p *connPool) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		c.fail(net.ErrClosed)
+	}
+	p.conns = nil
+}
+
+// pipelinedConn is a connection queries are pipelined on.
+type pipelinedConn struct {
+	conn *dns.Conn
+	tls  *tls.ConnectionState
+
+	// mu guards the fields below and serializes writes.
+	mu       sync.Mutex
+	pending  map[uint16]chan pipelinedReply
+	deadline time.Time
+	err      error
+}
+
+type pipelinedReply struct {
+	msg *dns.Msg
+	err error
+}
+
+// load returns the number of queries in flight, and false once the
+// connection is broken.
+func (c *pipelinedConn) load() (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.pending), c.err == nil
+}
+
+// exchange writes msg on the connection and waits for its reply.
+func (c *pipelinedConn) exchange(ctx context.Context, msg *dns.Msg, timeout time.Duration) (*dns.Msg, error) {
+	ch := make(chan pipelinedReply, 1)
+
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return nil, c.err
+	}
+	// Replies are matched by ID, so the queries in flight need distinct ones.
+	query := msg.Copy()
+	for {
+		if _, ok := c.pending[query.Id]; !ok {
+			break
+		}
+		query.Id = dns.Id()
+	}
+	c.pending[query.Id] = ch
+	_ = c.conn.SetWriteDeadline(time.Now().Add(timeout))
+	err := c.conn.WriteMsg(query)
+	if err == nil {
+		c.extend(timeout + connIdleTimeout)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		c.fail(err)
+		return nil, fmt.Errorf("%w: %v", errConnClosed, err)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case reply := <-ch:
+		if reply.err != nil {
+			return nil, reply.err
+		}
+		reply.msg.Id = msg.Id
+		return reply.msg, nil
+	case <-ctx.Done():
+		c.forget(query.Id)
+		return nil, ctx.Err()
+	case <-timer.C:
+		c.forget(query.Id)
+		return nil, fmt.Errorf("read tcp %s: %w", c.conn.RemoteAddr(), os.ErrDeadlineExceeded)
+	}
+}
+
+// read hands the replies to the queries waiting for them until the
+// connection breaks or stays idle for connIdleTimeout. Replies to queries
+// given up on are dropped.
+func (c *pipelinedConn) read() {
+	for {
+		b, err := c.conn.ReadMsgHeader(nil)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		id := binary.BigEndian.Uint16(b)
+		reply := pipelinedReply{msg: new(dns.Msg)}
+		if err := reply.msg.Unpack(b); err != nil {
+			reply = pipelinedReply{err: err}
+		}
+
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.extend(connIdleTimeout)
+		c.mu.Unlock()
+		if ok {
+			ch <- reply
+		}
+	}
+}
+
+// extend pushes the read deadline of the connection to d from now, unless it
+// is already later. It must be called with mu held.
+func (c *pipelinedConn) extend(d time.Duration) {
+	if deadline := time.Now().Add(d); deadline.After(c.deadline) {
+		c.deadline = deadline
+		_ = c.conn.SetReadDeadline(deadline)
+	}
+}
+
+// forget stops waiting for the reply to id.
+func (c *pipelinedConn) forget(id uint16) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.pending, id)
+}
+
+// fail closes the connection and fails the queries in flight.
+func (c *pipelinedConn) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = fmt.Errorf("%w: %v", errConnClosed, err)
+	}
+	for id, ch := range c.pending {
+		ch <- pipelinedReply{err: c.err}
+		delete(c.pending, id)
+	}
+	_ = c.conn.Close()
+}
@@ -0,0 +1,313 @@
+package resolvers
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/quic-go/quic-go"
+)
+
+// startPipelineServer accepts TCP connections, over TLS when config is set,
+// and hands each of them to serve. It returns its address and the number of
+// connections accepted.
+func startPipelineServer(t *testing.T, config *tls.Config, serve func(conn *dns.Conn)) (string, *atomic.Int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	if config != nil {
+		ln = tls.NewListener(ln, config)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				defer conn.Close()
+				serve(&dns.Conn{Conn: conn})
+			}()
+		}
+	}()
+	return ln.Addr().String(), &accepted
+}
+
+// pipelineReply answers req with an A record for its name.
+func pipelineReply(t *testing.T, req *dns.Msg) *dns.Msg {
+	m := new(dns.Msg)
+	m.SetReply(req)
+	if req.Question[0].Qtype == dns.TypeA {
+		m.Answer = append(m.Answer, testRR(t, req.Question[0].Name+" 60 IN A 192.0.2.1"))
+	}
+	return m
+}
+
+// serveInOrder answers every query on conn as it arrives.
+func serveInOrder(t *testing.T) func(conn *dns.Conn) {
+	return func(conn *dns.Conn) {
+		for {
+			req, err := conn.ReadMsg()
+			if err != nil {
+				return
+			}
+			_ = conn.WriteMsg(pipelineReply(t, req))
+		}
+	}
+}
+
+func pipelineQuestions(names ...string) []dns.Question {
+	var questions []dns.Question
+	for _, name := range names {
+		questions = append(questions, dns.Question{Name: name, Qtype: dns.TypeA, Qclass: dns.ClassINET})
+	}
+	return questions
+}
+
+func newPipelineResolver(t *testing.T, addr string, opts ClassicResolverOpts) Resolver {
+	t.Helper()
+	r, err := NewClassicResolver(addr, opts, Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("NewClassicResolver: %v", err)
+	}
+	return r
+}
+
+func TestClassicResolverSharesConnection(t *testing.T) {
+	for name, tc := range map[string]struct {
+		config *tls.Config
+		opts   ClassicResolverOpts
+	}{
+		"tcp": {nil, ClassicResolverOpts{UseTCP: true}},
+		"dot": {&tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}, ClassicResolverOpts{UseTCP: true, UseTLS: true}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			addr, accepted := startPipelineServer(t, tc.config, serveInOrder(t))
+			r := newPipelineResolver(t, addr, tc.opts)
+
+			questions := pipelineQuestions("a.example.", "b.example.", "c.example.", "d.example.", "e.example.")
+			rsp, err := r.Lookup(context.Background(), questions, QueryFlags{})
+			if err != nil {
+				t.Fatalf("Lookup: %v", err)
+			}
+			handshakes := 0
+			for i, rs := range rsp {
+				if len(rs.Answers) != 1 || rs.Answers[0].Name != questions[i].Name {
+					t.Errorf("response %d = %+v, want the answer for %s", i, rs.Answers, questions[i].Name)
+				}
+				if rs.Handshake != "" {
+					handshakes++
+				}
+			}
+			if got := accepted.Load(); got != 1 {
+				t.Errorf("%d connections opened, want 1", got)
+			}
+			if handshakes != 1 {
+				t.Errorf("%d responses have a handshake time, want 1", handshakes)
+			}
+
+			// The next lookup is sent on the same connection.
+			rsp, err = r.Lookup(context.Background(), questions[:1], QueryFlags{})
+			if err != nil {
+				t.Fatalf("second Lookup: %v", err)
+			}
+			if accepted.Load() != 1 || rsp[0].Handshake != "" {
+				t.Errorf("the second lookup opened a new connection")
+			}
+		})
+	}
+}
+
+func TestClassicResolverOutOfOrderReplies(t *testing.T) {
+	// The server reads two queries before answering them in reverse.
+	addr, _ := startPipelineServer(t, nil, func(conn *dns.Conn) {
+		var reqs []*dns.Msg
+		for len(reqs) < 2 {
+			req, err := conn.ReadMsg()
+			if err != nil {
+				return
+			}
+			reqs = append(reqs, req)
+		}
+		_ = conn.WriteMsg(pipelineReply(t, reqs[1]))
+		_ = conn.WriteMsg(pipelineReply(t, reqs[0]))
+	})
+	r := newPipelineResolver(t, addr, ClassicResolverOpts{UseTCP: true})
+
+	questions := pipelineQuestions("first.example.", "second.example.")
+	rsp, err := r.Lookup(context.Background(), questions, QueryFlags{})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	for i, rs := range rsp {
+		if len(rs.Answers) != 1 || rs.Answers[0].Name != questions[i].Name {
+			t.Errorf("response %d = %+v, want the answer for %s", i, rs.Answers, questions[i].Name)
+		}
+	}
+}
+
+func TestClassicResolverReopensClosedConnection(t *testing.T) {
+	// The server closes every connection after its first reply.
+	addr, accepted := startPipelineServer(t, nil, func(conn *dns.Conn) {
+		req, err := conn.ReadMsg()
+		if err != nil {
+			return
+		}
+		_ = conn.WriteMsg(pipelineReply(t, req))
+	})
+	r := newPipelineResolver(t, addr, ClassicResolverOpts{UseTCP: true})
+
+	for i := 0; i < 3; i++ {
+		rsp, err := r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{})
+		if err != nil {
+			t.Fatalf("lookup %d: %v", i, err)
+		}
+		if rsp[0].Handshake == "" {
+			t.Errorf("lookup %d wasn't reported as opening a connection", i)
+		}
+	}
+	if got := accepted.Load(); got != 3 {
+		t.Errorf("%d connections opened, want 3", got)
+	}
+}
+
+// startDOQServer answers A queries over DoQ and returns its address, the
+// number of QUIC connections accepted and the errors they were closed with.
+func startDOQServer(t *testing.T) (string, *atomic.Int32, <-chan error) {
+	t.Helper()
+	ln, err := quic.ListenAddr("127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{selfSignedCert(t)},
+		NextProtos:   []string{"doq"},
+	}, nil)
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	var accepted atomic.Int32
+	closed := make(chan error, 16)
+	go func() {
+		for {
+			conn, err := ln.Accept(context.Background())
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			go func() {
+				<-conn.Context().Done()
+				closed <- context.Cause(conn.Context())
+			}()
+			go func() {
+				for {
+					stream, err := conn.AcceptStream(context.Background())
+					if err != nil {
+						return
+					}
+					go func() {
+						defer stream.Close()
+						b, err := io.ReadAll(stream)
+						if err != nil || len(b) < 2 {
+							return
+						}
+						req := new(dns.Msg)
+						if err := req.Unpack(b[2:]); err != nil {
+							return
+						}
+						reply, _ := pipelineReply(t, req).Pack()
+						_, _ = stream.Write(binary.BigEndian.AppendUint16(nil, uint16(len(reply))))
+						_, _ = stream.Write(reply)
+					}()
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String(), &accepted, closed
+}
+
+func TestDOQResolverSharesSession(t *testing.T) {
+	addr, accepted, _ := startDOQServer(t)
+	r, err := NewDOQResolver(addr, Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("NewDOQResolver: %v", err)
+	}
+
+	questions := pipelineQuestions("a.example.", "b.example.", "c.example.", "d.example.")
+	for i := 0; i < 2; i++ {
+		rsp, err := r.Lookup(context.Background(), questions, QueryFlags{})
+		if err != nil {
+			t.Fatalf("Lookup: %v", err)
+		}
+		handshakes := 0
+		for j, rs := range rsp {
+			if len(rs.Answers) != 1 || rs.Answers[0].Name != questions[j].Name {
+				t.Errorf("response %d = %+v, want the answer for %s", j, rs.Answers, questions[j].Name)
+			}
+			if rs.Handshake != "" {
+				handshakes++
+			}
+		}
+		if want := 1 - i; handshakes != want {
+			t.Errorf("lookup %d: %d responses have a handshake time, want %d", i, handshakes, want)
+		}
+	}
+	if got := accepted.Load(); got != 1 {
+		t.Errorf("%d QUIC connections opened, want 1", got)
+	}
+}
+
+func TestCloseResolvers(t *testing.T) {
+	closed := make(chan error, 1)
+	tcpAddr, _ := startPipelineServer(t, nil, func(conn *dns.Conn) {
+		for {
+			req, err := conn.ReadMsg()
+			if err != nil {
+				closed <- err
+				return
+			}
+			_ = conn.WriteMsg(pipelineReply(t, req))
+		}
+	})
+	doqAddr, _, doqClosed := startDOQServer(t)
+	doq, err := NewDOQResolver(doqAddr, Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("NewDOQResolver: %v", err)
+	}
+	rs := []Resolver{newPipelineResolver(t, tcpAddr, ClassicResolverOpts{UseTCP: true}), doq}
+	for _, r := range rs {
+		if _, err := r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{}); err != nil {
+			t.Fatalf("%s: Lookup: %v", r.Address(), err)
+		}
+	}
+	Close(rs)
+
+	select {
+	case err := <-closed:
+		if !errors.Is(err, io.EOF) {
+			t.Errorf("TCP connection closed with %v, want EOF", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("TCP connection still open")
+	}
+	select {
+	case err := <-doqClosed:
+		var appErr *quic.ApplicationError
+		if !errors.As(err, &appErr) || !appErr.Remote || appErr.ErrorCode != quic.ApplicationErrorCode(quic.NoError) {
+			t.Errorf("QUIC connection closed with %v, want DOQ_NO_ERROR", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("QUIC connection still open")
+	}
+}
@@ -0,0 +1,179 @@
+package resolvers
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http/httpproxy"
+	"golang.org/x/net/proxy"
+)
+
+// NewProxyDialer returns a Dialer opening the connections through the proxy
+// at proxyURL: a SOCKS5 proxy with socks5:// or socks5h://, which resolves
+// the hostnames itself, or an HTTP proxy tunneling them with CONNECT with
+// http:// or https://. The connections to the proxy are sent from
+// opts.Source and opts.Interface.
+func NewProxyDialer(proxyURL string, opts Options) (Dialer, error) {
+	u, err := url.Parse(proxyURL)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy %s: want a URL such as socks5://host:port", proxyURL)
+	}
+	opts.Dialer = nil
+	d, err := newDialer(opts)
+	if err != nil {
+		return nil, err
+	}
+	return newProxyDialer(u, d.dialDirect)
+}
+
+// dialFunc opens the connections to the proxy.
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+func (f dialFunc) Dial(network, address string) (net.Conn, error) {
+	return f(context.Background(), network, address)
+}
+
+func (f dialFunc) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	return f(ctx, network, address)
+}
+
+func newProxyDialer(u *url.URL, forward dialFunc) (Dialer, error) {
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		pd, err := proxy.FromURL(u, forward)
+		if err != nil {
+			return nil, err
+		}
+		d := &socksDialer{dialer: pd.(proxy.ContextDialer)}
+		// The hostnames are sent to socks5h:// proxies, and resolved here
+		// for socks5:// ones.
+		d.resolve = u.Scheme == "socks5"
+		return d, nil
+	case "http", "https":
+		return &connectDialer{proxy: u, forward: forward}, nil
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %s: want socks5, socks5h, http or https", u.Scheme)
+}
+
+// envProxy returns the proxy of the HTTPS_PROXY and NO_PROXY environment
+// variables for the connections to address, or nil when they go direct.
+// Loopback addresses never go through it.
+func envProxy(address string) *url.URL {
+	u, err := httpproxy.FromEnvironment().ProxyFunc()(&url.URL{Scheme: "https", Host: address})
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// socksDialer opens connections through a SOCKS5 proxy.
+type socksDialer struct {
+	dialer  proxy.ContextDialer
+	resolve bool
+}
+
+func (d *socksDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil, ErrProxyUDP
+	}
+	if d.resolve {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		if net.ParseIP(host) == nil {
+			addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+			if err != nil {
+				return nil, err
+			}
+			address = net.JoinHostPort(addrs[0], port)
+		}
+	}
+	return d.dialer.DialContext(ctx, "tcp", address)
+}
+
+// connectDialer opens connections tunneled through an HTTP proxy with CONNECT
+// requests.
+type connectDialer struct {
+	proxy   *url.URL
+	forward dialFunc
+}
+
+func (d *connectDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if !strings.HasPrefix(network, "tcp") {
+		return nil, ErrProxyUDP
+	}
+	proxyAddr := d.proxy.Host
+	if d.proxy.Port() == "" {
+		port := "80"
+		if d.proxy.Scheme == "https" {
+			port = "443"
+		}
+		proxyAddr = net.JoinHostPort(d.proxy.Hostname(), port)
+	}
+	conn, err := d.forward(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	if d.proxy.Scheme == "https" {
+		tc := tls.Client(conn, &tls.Config{ServerName: d.proxy.Hostname()})
+		if err := tc.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tc
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if user := d.proxy.User; user != nil {
+		password, _ := user.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(user.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s refused the connection to %s: %s", d.proxy.Redacted(), address, resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn is a connection whose first bytes were read into r.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
@@ -0,0 +1,282 @@
+package resolvers
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ameshkov/dnsstamps"
+	"github.com/miekg/dns"
+)
+
+// testProxy is a SOCKS5 or HTTP CONNECT proxy on loopback, recording the
+// addresses it connected to.
+type testProxy struct {
+	mu      sync.Mutex
+	targets []string
+}
+
+// startProxy starts a proxy for scheme, socks5 or http, and returns its URL.
+func startProxy(t *testing.T, scheme string) (string, *testProxy) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	t.Cleanup(func() { _ = ln.Close() })
+
+	p := &testProxy{}
+	handshake := p.socks5
+	if scheme == "http" {
+		handshake = p.connect
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				br := bufio.NewReader(conn)
+				target, err := handshake(br, conn)
+				if err != nil {
+					return
+				}
+				defer target.Close()
+				go func() { _, _ = io.Copy(target, br) }()
+				_, _ = io.Copy(conn, target)
+			}()
+		}
+	}()
+	return scheme + "://" + ln.Addr().String(), p
+}
+
+// socks5 answers a SOCKS5 CONNECT request without authentication.
+func (p *testProxy) socks5(br *bufio.Reader, conn net.Conn) (net.Conn, error) {
+	hello := make([]byte, 2)
+	if _, err := io.ReadFull(br, hello); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(br, make([]byte, hello[1])); err != nil {
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{5, 0}); err != nil {
+		return nil, err
+	}
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(br, req); err != nil {
+		return nil, err
+	}
+	var host string
+	switch req[3] {
+	case 1, 4:
+		ip := make([]byte, 4)
+		if req[3] == 4 {
+			ip = make([]byte, 16)
+		}
+		if _, err := io.ReadFull(br, ip); err != nil {
+			return nil, err
+		}
+		host = net.IP(ip).String()
+	case 3:
+		n, err := br.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		name := make([]byte, n)
+		if _, err := io.ReadFull(br, name); err != nil {
+			return nil, err
+		}
+		host = string(name)
+	default:
+		return nil, errors.New("unknown address type")
+	}
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(br, port); err != nil {
+		return nil, err
+	}
+	target, err := p.dial(net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port)))))
+	if err != nil {
+		_, _ = conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return nil, err
+	}
+	if _, err := conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		target.Close()
+		return nil, err
+	}
+	return target, nil
+}
+
+// connect answers an HTTP CONNECT request.
+func (p *testProxy) connect(br *bufio.Reader, conn net.Conn) (net.Conn, error) {
+	req, err := http.ReadRequest(br)
+	if err != nil {
+		return nil, err
+	}
+	if req.Method != http.MethodConnect {
+		_, _ = io.WriteString(conn, "HTTP/1.1 405 Method Not Allowed\r\n\r\n")
+		return nil, errors.New("not a CONNECT request")
+	}
+	target, err := p.dial(req.Host)
+	if err != nil {
+		_, _ = io.WriteString(conn, "HTTP/1.1 502 Bad Gateway\r\n\r\n")
+		return nil, err
+	}
+	if _, err := io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n"); err != nil {
+		target.Close()
+		return nil, err
+	}
+	return target, nil
+}
+
+func (p *testProxy) dial(address string) (net.Conn, error) {
+	p.mu.Lock()
+	p.targets = append(p.targets, address)
+	p.mu.Unlock()
+	return net.DialTimeout("tcp", address, 2*time.Second)
+}
+
+// dialed reports whether the proxy connected to address.
+func (p *testProxy) dialed(address string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return slices.Contains(p.targets, address)
+}
+
+func TestProxyDialer(t *testing.T) {
+	tcpAddr, _ := startPipelineServer(t, nil, serveInOrder(t))
+	dotAddr, _ := startPipelineServer(t, &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}, serveInOrder(t))
+	doh := httptest.NewTLSServer(dohHandler(t))
+	t.Cleanup(doh.Close)
+	stamp := startDNSCryptServer(t)
+	dnscryptStamp, err := dnsstamps.NewServerStampFromString(stamp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, scheme := range []string{"socks5", "socks5h", "http"} {
+		t.Run(scheme, func(t *testing.T) {
+			proxyURL, p := startProxy(t, strings.TrimSuffix(scheme, "h"))
+			proxyURL = strings.Replace(proxyURL, "socks5://", scheme+"://", 1)
+			dialer, err := NewProxyDialer(proxyURL, Options{Logger: discardLogger()})
+			if err != nil {
+				t.Fatalf("NewProxyDialer: %v", err)
+			}
+			opts := Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true, Dialer: dialer}
+
+			for _, tc := range []struct {
+				name   string
+				target string
+				new    func() (Resolver, error)
+			}{
+				{"tcp", tcpAddr, func() (Resolver, error) {
+					return NewClassicResolver(tcpAddr, ClassicResolverOpts{UseTCP: true}, opts)
+				}},
+				{"dot", dotAddr, func() (Resolver, error) {
+					return NewClassicResolver(dotAddr, ClassicResolverOpts{UseTCP: true, UseTLS: true}, opts)
+				}},
+				{"doh", doh.Listener.Addr().String(), func() (Resolver, error) {
+					return NewDOHResolver(doh.URL+"/dns-query", opts)
+				}},
+				{"dnscrypt", dnscryptStamp.ServerAddrStr, func() (Resolver, error) {
+					return NewDNSCryptResolver(stamp, DNSCryptResolverOpts{UseTCP: true}, opts)
+				}},
+			} {
+				r, err := tc.new()
+				if err != nil {
+					t.Fatalf("%s: %v", tc.name, err)
+				}
+				q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+				rsp, err := r.Lookup(context.Background(), []dns.Question{q}, QueryFlags{})
+				if err != nil {
+					t.Fatalf("%s: Lookup: %v", tc.name, err)
+				}
+				if len(rsp[0].Answers) != 1 || rsp[0].Answers[0].Address != "192.0.2.1" {
+					t.Errorf("%s: answers = %+v, want 192.0.2.1", tc.name, rsp[0].Answers)
+				}
+				if !p.dialed(tc.target) {
+					t.Errorf("%s: the query didn't go through the proxy", tc.name)
+				}
+			}
+		})
+	}
+}
+
+func TestProxyDialerRefusesUDP(t *testing.T) {
+	dialer, err := NewProxyDialer("socks5://127.0.0.1:1080", Options{})
+	if err != nil {
+		t.Fatalf("NewProxyDialer: %v", err)
+	}
+	opts := Options{Logger: discardLogger(), Timeout: 2 * time.Second, Dialer: dialer}
+	stamp := startDNSCryptServer(t)
+
+	for name, newResolver := range map[string]func() (Resolver, error){
+		"udp": func() (Resolver, error) { return NewClassicResolver("127.0.0.1:53", ClassicResolverOpts{}, opts) },
+		"doq": func() (Resolver, error) { return NewDOQResolver("127.0.0.1:853", opts) },
+		"h3":  func() (Resolver, error) { return NewDOHResolver("h3://127.0.0.1/dns-query", opts) },
+		"dnscrypt": func() (Resolver, error) {
+			return NewDNSCryptResolver(stamp, DNSCryptResolverOpts{}, opts)
+		},
+	} {
+		if _, err := newResolver(); !errors.Is(err, ErrProxyUDP) {
+			t.Errorf("%s: err = %v, want ErrProxyUDP", name, err)
+		}
+	}
+}
+
+func TestProxyDialerRefused(t *testing.T) {
+	// The proxy requires credentials that aren't sent.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusProxyAuthRequired)
+	}))
+	t.Cleanup(proxy.Close)
+	dialer, err := NewProxyDialer(proxy.URL, Options{})
+	if err != nil {
+		t.Fatalf("NewProxyDialer: %v", err)
+	}
+
+	r, err := NewClassicResolver("192.0.2.1:53", ClassicResolverOpts{UseTCP: true}, Options{Logger: discardLogger(), Timeout: 2 * time.Second, Dialer: dialer})
+	if err != nil {
+		t.Fatalf("NewClassicResolver: %v", err)
+	}
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	_, err = r.Lookup(context.Background(), []dns.Question{q}, QueryFlags{})
+	if err == nil || !strings.Contains(err.Error(), "407") {
+		t.Errorf("err = %v, want the 407 of the proxy", err)
+	}
+}
+
+func TestNewProxyDialerErrors(t *testing.T) {
+	for _, proxyURL := range []string{"127.0.0.1:1080", "socks5://", "ftp://127.0.0.1:21"} {
+		if _, err := NewProxyDialer(proxyURL, Options{}); err == nil {
+			t.Errorf("NewProxyDialer(%q) succeeded", proxyURL)
+		}
+	}
+}
+
+func TestEnvProxy(t *testing.T) {
+	t.Setenv("HTTPS_PROXY", "http://proxy.example:3128")
+	t.Setenv("NO_PROXY", "internal.example")
+
+	if u := envProxy("192.0.2.1:853"); u == nil || u.Host != "proxy.example:3128" {
+		t.Errorf("envProxy(192.0.2.1:853) = %v, want http://proxy.example:3128", u)
+	}
+	for _, address := range []string{"dns.internal.example:853", "127.0.0.1:53", "[::1]:853"} {
+		if u := envProxy(address); u != nil {
+			t.Errorf("envProxy(%s) = %v, want no proxy", address, u)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package resolvers
+
+import (
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The RDATA of the common record types, as set in the `rdata` field of the
+// JSON output. Address still carries the presentation format of the whole
+// RDATA, these let scripts use the fields without parsing it again.
+
+// AddressRData is the RDATA of A and AAAA records.
+type AddressRData struct {
+	Address string `json:"address"`
+}
+
+// TargetRData is the RDATA of records pointing at a single name: CNAME,
+// DNAME, NS and PTR.
+type TargetRData struct {
+	Target string `json:"target"`
+}
+
+type MXRData struct {
+	Preference uint16 `json:"preference"`
+	Exchange   string `json:"exchange"`
+}
+
+type SRVRData struct {
+	Priority uint16 `json:"priority"`
+	Weight   uint16 `json:"weight"`
+	Port     uint16 `json:"port"`
+	Target   string `json:"target"`
+}
+
+type SOARData struct {
+	MName   string `json:"mname"`
+	RName   string `json:"rname"`
+	Serial  uint32 `json:"serial"`
+	Refresh uint32 `json:"refresh"`
+	Retry   uint32 `json:"retry"`
+	Expire  uint32 `json:"expire"`
+	Minimum uint32 `json:"minimum"`
+}
+
+// TXTRData is the RDATA of TXT and SPF records. Every character-string is
+// kept apart, as a long value may be split across several of them.
+type TXTRData struct {
+	Strings []string `json:"strings"`
+}
+
+type CAARData struct {
+	Flag  uint8  `json:"flag"`
+	Tag   string `json:"tag"`
+	Value string `json:"value"`
+}
+
+type HINFORData struct {
+	CPU string `json:"cpu"`
+	OS  string `json:"os"`
+}
+
+type NAPTRRData struct {
+	Order       uint16 `json:"order"`
+	Preference  uint16 `json:"preference"`
+	Flags       string `json:"flags"`
+	Service     string `json:"service"`
+	Regexp      string `json:"regexp"`
+	Replacement string `json:"replacement"`
+}
+
+// SVCBRData is the RDATA of SVCB and HTTPS records. Params maps the key of
+// every SvcParam to its value in presentation format.
+type SVCBRData struct {
+	Priority uint16            `json:"priority"`
+	Target   string            `json:"target"`
+	Params   map[string]string `json:"params,omitempty"`
+}
+
+// DSRData is the RDATA of DS and CDS records.
+type DSRData struct {
+	KeyTag     uint16 `json:"key_tag"`
+	Algorithm  uint8  `json:"algorithm"`
+	DigestType uint8  `json:"digest_type"`
+	Digest     string `json:"digest"`
+}
+
+// DNSKEYRData is the RDATA of DNSKEY and CDNSKEY records. PublicKey is
+// base64 encoded.
+type DNSKEYRData struct {
+	Flags     uint16 `json:"flags"`
+	Protocol  uint8  `json:"protocol"`
+	Algorithm uint8  `json:"algorithm"`
+	KeyTag    uint16 `json:"key_tag"`
+	PublicKey string `json:"public_key"`
+}
+
+// RRSIGRData is the RDATA of RRSIG records. Expiration and Inception are in
+// RFC 3339 format.
+type RRSIGRData struct {
+	TypeCovered string `json:"type_covered"`
+	Algorithm   uint8  `json:"algorithm"`
+	Labels      uint8  `json:"labels"`
+	OriginalTTL uint32 `json:"original_ttl"`
+	Expiration  string `json:"expiration"`
+	Inception   string `json:"inception"`
+	KeyTag      uint16 `json:"key_tag"`
+	SignerName  string `json:"signer_name"`
+	Signature   string `json:"signature"`
+}
+
+type NSECRData struct {
+	NextDomain string   `json:"next_domain"`
+	Types      []string `json:"types"`
+}
+
+type TLSARData struct {
+	Usage        uint8  `json:"usage"`
+	Selector     uint8  `json:"selector"`
+	MatchingType uint8  `json:"matching_type"`
+	Certificate  string `json:"certificate"`
+}
+
+type SSHFPRData struct {
+	Algorithm   uint8  `json:"algorithm"`
+	Type        uint8  `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// RDataOf returns the typed RDATA of rr, or nil for the record types that
+// don't have one yet, which are only output as a string.
+func RDataOf(rr dns.RR) any {
+	switch r := rr.(type) {
+	case *dns.A:
+		return AddressRData{Address: r.A.String()}
+	case *dns.AAAA:
+		return AddressRData{Address: r.AAAA.String()}
+	case *dns.CNAME:
+		return TargetRData{Target: r.Target}
+	case *dns.DNAME:
+		return TargetRData{Target: r.Target}
+	case *dns.NS:
+		return TargetRData{Target: r.Ns}
+	case *dns.PTR:
+		return TargetRData{Target: r.Ptr}
+	case *dns.MX:
+		return MXRData{Preference: r.Preference, Exchange: r.Mx}
+	case *dns.SRV:
+		return SRVRData{Priority: r.Priority, Weight: r.Weight, Port: r.Port, Target: r.Target}
+	case *dns.SOA:
+		return SOARData{MName: r.Ns, RName: r.Mbox, Serial: r.Serial, Refresh: r.Refresh, Retry: r.Retry, Expire: r.Expire, Minimum: r.Minttl}
+	case *dns.TXT:
+		return TXTRData{Strings: unescapeStrings(r.Txt)}
+	case *dns.SPF:
+		return TXTRData{Strings: unescapeStrings(r.Txt)}
+	case *dns.CAA:
+		return CAARData{Flag: r.Flag, Tag: r.Tag, Value: unescapeLabel(r.Value)}
+	case *dns.HINFO:
+		return HINFORData{CPU: unescapeLabel(r.Cpu), OS: unescapeLabel(r.Os)}
+	case *dns.NAPTR:
+		return NAPTRRData{Order: r.Order, Preference: r.Preference, Flags: unescapeLabel(r.Flags), Service: unescapeLabel(r.Service), Regexp: unescapeLabel(r.Regexp), Replacement: r.Replacement}
+	case *dns.SVCB:
+		return svcbRData(r.Priority, r.Target, r.Value)
+	case *dns.HTTPS:
+		return svcbRData(r.Priority, r.Target, r.Value)
+	case *dns.DS:
+		return DSRData{KeyTag: r.KeyTag, Algorithm: r.Algorithm, DigestType: r.DigestType, Digest: strings.ToLower(r.Digest)}
+	case *dns.CDS:
+		return DSRData{KeyTag: r.KeyTag, Algorithm: r.Algorithm, DigestType: r.DigestType, Digest: strings.ToLower(r.Digest)}
+	case *dns.DNSKEY:
+		return dnskeyRData(r)
+	case *dns.CDNSKEY:
+		return dnskeyRData(&r.DNSKEY)
+	case *dns.RRSIG:
+		return RRSIGRData{
+			TypeCovered: dns.Type(r.TypeCovered).String(),
+			Algorithm:   r.Algorithm,
+			Labels:      r.Labels,
+			OriginalTTL: r.OrigTtl,
+			Expiration:  signatureTime(r.Expiration),
+			Inception:   signatureTime(r.Inception),
+			KeyTag:      r.KeyTag,
+			SignerName:  r.SignerName,
+			Signature:   r.Signature,
+		}
+	case *dns.NSEC:
+		types := make([]string, len(r.TypeBitMap))
+		for i, t := range r.TypeBitMap {
+			types[i] = dns.Type(t).String()
+		}
+		return NSECRData{NextDomain: r.NextDomain, Types: types}
+	case *dns.TLSA:
+		return TLSARData{Usage: r.Usage, Selector: r.Selector, MatchingType: r.MatchingType, Certificate: strings.ToLower(r.Certificate)}
+	case *dns.SSHFP:
+		return SSHFPRData{Algorithm: r.Algorithm, Type: r.Type, Fingerprint: strings.ToLower(r.FingerPrint)}
+	}
+	return nil
+}
+
+func svcbRData(priority uint16, target string, params []dns.SVCBKeyValue) SVCBRData {
+	rd := SVCBRData{Priority: priority, Target: target}
+	if len(params) > 0 {
+		rd.Params = make(map[string]string, len(params))
+		for _, kv := range params {
+			rd.Params[kv.Key().String()] = kv.String()
+		}
+	}
+	return rd
+}
+
+func dnskeyRData(k *dns.DNSKEY) DNSKEYRData {
+	return DNSKEYRData{
+		Flags:     k.Flags,
+		Protocol:  k.Protocol,
+		Algorithm: k.Algorithm,
+		KeyTag:    k.KeyTag(),
+		PublicKey: k.PublicKey,
+	}
+}
+
+// signatureTime formats the expiration or inception of an RRSIG. They are
+// serial numbers of seconds (RFC 4034 section 3.1.5); dns.TimeToString
+// already resolves the wrap around, so its output is parsed back.
+func signatureTime(t uint32) string {
+	ts, err := time.Parse("20060102150405", dns.TimeToString(t))
+	if err != nil {
+		return dns.TimeToString(t)
+	}
+	return ts.UTC().Format(time.RFC3339)
+}
+
+// unescapeStrings returns the character-strings of a record as they are on
+// the wire. The dns library escapes their quotes, backslashes and the bytes
+// outside of printable ASCII.
+func unescapeStrings(ss []string) []string {
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		out[i] = unescapeLabel(s)
+	}
+	return out
+}
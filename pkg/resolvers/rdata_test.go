@@ -0,0 +1,105 @@
+package resolvers
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestRDataOf(t *testing.T) {
+	tests := []struct {
+		rr   string
+		want any
+	}{
+		{"example.com. 300 IN A 192.0.2.1", AddressRData{Address: "192.0.2.1"}},
+		{"example.com. 300 IN AAAA 2001:db8::1", AddressRData{Address: "2001:db8::1"}},
+		{"www.example.com. 300 IN CNAME example.com.", TargetRData{Target: "example.com."}},
+		{"example.com. 300 IN NS ns1.example.com.", TargetRData{Target: "ns1.example.com."}},
+		{"example.com. 300 IN MX 10 mail.example.com.", MXRData{Preference: 10, Exchange: "mail.example.com."}},
+		{"_sip._tcp.example.com. 300 IN SRV 10 60 5060 sip.example.com.", SRVRData{Priority: 10, Weight: 60, Port: 5060, Target: "sip.example.com."}},
+		{
+			"example.com. 300 IN SOA ns1.example.com. hostmaster.example.com. 2024010101 7200 3600 1209600 300",
+			SOARData{MName: "ns1.example.com.", RName: "hostmaster.example.com.", Serial: 2024010101, Refresh: 7200, Retry: 3600, Expire: 1209600, Minimum: 300},
+		},
+		{`example.com. 300 IN TXT "v=spf1 " "-all"`, TXTRData{Strings: []string{"v=spf1 ", "-all"}}},
+		{`example.com. 300 IN TXT "say \"hi\"" "back\\slash" "caf\195\169 ☕"`, TXTRData{Strings: []string{`say "hi"`, `back\slash`, "café ☕"}}},
+		{`example.com. 300 IN CAA 128 issue "letsencrypt.org"`, CAARData{Flag: 128, Tag: "issue", Value: "letsencrypt.org"}},
+		{`example.com. 300 IN CAA 0 iodef "mailto:\"sécurité\"@example.com"`, CAARData{Flag: 0, Tag: "iodef", Value: `mailto:"sécurité"@example.com`}},
+		{
+			`example.com. 300 IN HTTPS 1 . alpn="h3,h2" port=8443`,
+			SVCBRData{Priority: 1, Target: ".", Params: map[string]string{"alpn": "h3,h2", "port": "8443"}},
+		},
+		{
+			"example.com. 300 IN DS 2371 13 2 1F987CC6583E92DF0890718C42",
+			DSRData{KeyTag: 2371, Algorithm: 13, DigestType: 2, Digest: "1f987cc6583e92df0890718c42"},
+		},
+		{"example.com. 300 IN NSEC a.example.com. A RRSIG NSEC", NSECRData{NextDomain: "a.example.com.", Types: []string{"A", "RRSIG", "NSEC"}}},
+		{"example.com. 300 IN LOC 52 22 23.000 N 4 53 32.000 E -2.00m 0.00m 10000m 10m", nil},
+	}
+	for _, tt := range tests {
+		rr, err := dns.NewRR(tt.rr)
+		if err != nil {
+			t.Fatalf("NewRR(%q): %v", tt.rr, err)
+		}
+		if got := RDataOf(rr); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RDataOf(%q) = %#v, want %#v", tt.rr, got, tt.want)
+		}
+	}
+}
+
+func TestRDataOfRRSIG(t *testing.T) {
+	rr, err := dns.NewRR("example.com. 300 IN RRSIG A 13 2 300 20300101000000 20291201000000 2371 example.com. c2lnbmF0dXJl")
+	if err != nil {
+		t.Fatalf("NewRR: %v", err)
+	}
+	got, ok := RDataOf(rr).(RRSIGRData)
+	if !ok {
+		t.Fatalf("RDataOf = %T, want RRSIGRData", RDataOf(rr))
+	}
+	want := RRSIGRData{
+		TypeCovered: "A",
+		Algorithm:   13,
+		Labels:      2,
+		OriginalTTL: 300,
+		Expiration:  time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		Inception:   time.Date(2029, 12, 1, 0, 0, 0, 0, time.UTC).Format(time.RFC3339),
+		KeyTag:      2371,
+		SignerName:  "example.com.",
+		Signature:   "c2lnbmF0dXJl",
+	}
+	if got != want {
+		t.Errorf("RDataOf = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseMessageRDataJSON(t *testing.T) {
+	msg := new(dns.Msg)
+	msg.SetQuestion("example.com.", dns.TypeMX)
+	mx, _ := dns.NewRR("example.com. 300 IN MX 10 mail.example.com.")
+	msg.Answer = append(msg.Answer, mx)
+
+	rsp := parseMessage(msg, time.Millisecond, "127.0.0.1:53")
+	out, err := json.Marshal(rsp.Answers[0])
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var got struct {
+		Address string `json:"address"`
+		RData   struct {
+			Preference int    `json:"preference"`
+			Exchange   string `json:"exchange"`
+		} `json:"rdata"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if got.Address != "10 mail.example.com." {
+		t.Errorf("address = %q, want the presentation format to be kept", got.Address)
+	}
+	if got.RData.Preference != 10 || got.RData.Exchange != "mail.example.com." {
+		t.Errorf("rdata = %+v, want preference 10 and exchange mail.example.com.", got.RData)
+	}
+}
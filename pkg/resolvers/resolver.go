@@ -2,7 +2,9 @@ package resolvers
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
+	"io"
 	"log/slog"
 	"time"
 
@@ -24,6 +26,52 @@ type Options struct {
 	Strategy           string
 	InsecureSkipVerify bool
 	TLSHostname        string
+	// TLSCert and TLSKey are the PEM files of the client certificate sent to
+	// the DoT, DoH and DoQ nameservers asking for one. TLSKey may be empty
+	// when the key is in the certificate file. TLSCA is a PEM bundle of the
+	// CAs their certificates are verified against, instead of the system
+	// roots. The nameservers can override them, see models.Nameserver.
+	TLSCert string
+	TLSKey  string
+	TLSCA   string
+	// TLSPins are the "sha256/<base64>" digests of the SubjectPublicKeyInfo
+	// of certificates, one of which the DoT, DoH and DoQ nameservers have to
+	// present in their chain. They replace the verification against the CAs
+	// and the hostname. TLSCertHashes are the hex SHA-256 digests of the TBS
+	// certificates of a DNS stamp, checked on top of it. The nameservers can
+	// override them, see models.Nameserver.
+	TLSPins       []string
+	TLSCertHashes []string
+	// HTTP3 sends the queries of every DoH nameserver over HTTP/3.
+	HTTP3 bool
+	// ODoHRelay is the URL or DNS stamp of the relay the queries of the ODoH
+	// nameservers are sent through, unless their address has its own.
+	ODoHRelay string
+	// DNSCryptTCP sends the queries of every DNSCrypt nameserver over TCP.
+	DNSCryptTCP bool
+	// TLSInfo adds the details of the TLS connection to the responses of
+	// the DoT, DoH and DoQ nameservers, and the certificates the server
+	// presented to the certificate errors.
+	TLSInfo bool
+	// Source is the address, an IP optionally followed by a port, and
+	// Interface the name of the network interface the queries are sent
+	// from, for every transport.
+	Source    string
+	Interface string
+	// Dialer opens the TCP connections of the TCP, DoT, DoH, ODoH and
+	// DNSCrypt nameservers, eg through a proxy. The UDP and QUIC ones fail
+	// with ErrProxyUDP when it's set. The TCP connections go through the
+	// proxy of the HTTPS_PROXY environment variable when it's nil.
+	Dialer Dialer
+	// Tries is the number of times a query is sent to a nameserver that
+	// doesn't answer, once when it's 0. RetryTimeout is the timeout of the
+	// first attempt, doubled at every retry up to Timeout, and Timeout when
+	// it's 0.
+	Tries        int
+	RetryTimeout time.Duration
+	// TSIG signs queries and zone transfers when set. Only supported by
+	// the UDP, TCP and DoT resolvers.
+	TSIG *TSIGKey
 }
 
 // Resolver implements the configuration for a DNS
@@ -35,6 +83,17 @@ type Resolver interface {
 	Lookup(ctx context.Context, questions []dns.Question, flags QueryFlags) ([]Response, error)
 }
 
+// Close closes the connections the resolvers keep open between lookups.
+// Resolvers with such connections, the TCP, DoT, DoH and DoQ ones, implement
+// io.Closer.
+func Close(rs []Resolver) {
+	for _, r := range rs {
+		if c, ok := r.(io.Closer); ok {
+			_ = c.Close()
+		}
+	}
+}
+
 // LookupError tags a resolver failure with the nameserver that produced it
 // so partial failures can be reported per-resolver instead of as an opaque
 // top-level error.
@@ -56,13 +115,38 @@ func (e *LookupError) Unwrap() error {
 
 // Response represents a custom output format
 // for DNS queries. It wraps metadata about the DNS query
-// and the DNS Answer as well.
+// and the DNS Answer as well. Status is the RCODE of the reply and
+// Nameserver the server that sent it. DNSCrypt is the certificate of a
+// DNSCrypt server. Handshake is the time spent establishing the connection
+// the query was sent on, when it had to be opened for it; it isn't part of
+// the RTT of the answers. TLS is only set with Options.TLSInfo. Source is
+// only set with Options.Source or Options.Interface.
 type Response struct {
-	Answers     []Answer    `json:"answers"`
-	Authorities []Authority `json:"authorities"`
-	Questions   []Question  `json:"questions"`
-	Additional  []Answer    `json:"additional,omitempty"`
-	Edns        *EdnsInfo   `json:"edns,omitempty"`
+	Answers     []Answer          `json:"answers"`
+	Authorities []Authority       `json:"authorities"`
+	Questions   []Question        `json:"questions"`
+	Additional  []Answer          `json:"additional,omitempty"`
+	Edns        *EdnsInfo         `json:"edns,omitempty"`
+	DNSSEC      *DNSSECValidation `json:"dnssec,omitempty"`
+	Status      string            `json:"status,omitempty"`
+	Nameserver  string            `json:"nameserver,omitempty"`
+	HTTPVersion string            `json:"http_version,omitempty"`
+	DNSCrypt    *DNSCryptCert     `json:"dnscrypt,omitempty"`
+	Handshake   string            `json:"handshake,omitempty"`
+	TLS         *TLSInfo          `json:"tls,omitempty"`
+	Source      *Source           `json:"source,omitempty"`
+	// Attempts is the number of times the query was sent, when
+	// Options.Tries or Options.RetryTimeout are set.
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// connInfo describes the connection a reply was received on.
+type connInfo struct {
+	// handshake is the time spent establishing the connection, when it was
+	// opened for the query.
+	handshake   time.Duration
+	httpVersion string
+	tls         *tls.ConnectionState
 }
 
 type Question struct {
@@ -71,12 +155,16 @@ type Question struct {
 	Class string `json:"class"`
 }
 
+// Answer is a single record of a response. Address is the RDATA in
+// presentation format; RData holds its fields for the common record types
+// (see RDataOf).
 type Answer struct {
 	Name       string `json:"name"`
 	Type       string `json:"type"`
 	Class      string `json:"class"`
 	TTL        string `json:"ttl"`
 	Address    string `json:"address"`
+	RData      any    `json:"rdata,omitempty"`
 	Status     string `json:"status"`
 	RTT        string `json:"rtt"`
 	Nameserver string `json:"nameserver"`
@@ -88,19 +176,20 @@ type Authority struct {
 	Class      string `json:"class"`
 	TTL        string `json:"ttl"`
 	MName      string `json:"mname"`
+	RData      any    `json:"rdata,omitempty"`
 	Status     string `json:"status"`
 	RTT        string `json:"rtt"`
 	Nameserver string `json:"nameserver"`
 }
 
 type EdnsInfo struct {
-	NSID         string `json:"nsid,omitempty"`
-	Cookie       string `json:"cookie,omitempty"`
-	Subnet       string `json:"subnet,omitempty"`
-	SubnetScope  uint8  `json:"subnet_scope,omitempty"`
-	ExtendedErr  string `json:"extended_error,omitempty"`
-	UDPSize      uint16 `json:"udp_size,omitempty"`
-	DNSSECOk     bool   `json:"dnssec_ok,omitempty"`
+	NSID        string `json:"nsid,omitempty"`
+	Cookie      string `json:"cookie,omitempty"`
+	Subnet      string `json:"subnet,omitempty"`
+	SubnetScope uint8  `json:"subnet_scope,omitempty"`
+	ExtendedErr string `json:"extended_error,omitempty"`
+	UDPSize     uint16 `json:"udp_size,omitempty"`
+	DNSSECOk    bool   `json:"dnssec_ok,omitempty"`
 }
 
 // LoadResolvers loads differently configured
@@ -109,7 +198,25 @@ func LoadResolvers(opts Options) ([]Resolver, error) {
 	// For each nameserver, initialise the correct resolver.
 	rslvrs := make([]Resolver, 0, len(opts.Nameservers))
 
+	global := opts
 	for _, ns := range opts.Nameservers {
+		// The TLS options of a nameserver override the global ones.
+		opts := global
+		if ns.TLSCert != "" {
+			opts.TLSCert, opts.TLSKey = ns.TLSCert, ns.TLSKey
+		} else if ns.TLSKey != "" {
+			opts.TLSKey = ns.TLSKey
+		}
+		if ns.TLSCA != "" {
+			opts.TLSCA = ns.TLSCA
+		}
+		if len(ns.TLSPins) > 0 {
+			opts.TLSPins = ns.TLSPins
+		}
+		opts.TLSCertHashes = ns.TLSCertHashes
+		if opts.TSIG != nil && ns.Type != models.UDPResolver && ns.Type != models.TCPResolver && ns.Type != models.DOTResolver {
+			return rslvrs, fmt.Errorf("TSIG is only supported over UDP, TCP and DoT, not for %s", ns.Address)
+		}
 		if ns.Type == models.DOHResolver {
 			opts.Logger.Debug("initiating DOH resolver")
 			rslvr, err := NewDOHResolver(ns.Address, opts)
@@ -118,6 +225,22 @@ func LoadResolvers(opts Options) ([]Resolver, error) {
 			}
 			rslvrs = append(rslvrs, rslvr)
 		}
+		if ns.Type == models.DOHJSONResolver {
+			opts.Logger.Debug("initiating DOH JSON resolver")
+			rslvr, err := NewDOHJSONResolver(ns.Address, opts)
+			if err != nil {
+				return rslvrs, err
+			}
+			rslvrs = append(rslvrs, rslvr)
+		}
+		if ns.Type == models.ODOHResolver {
+			opts.Logger.Debug("initiating ODOH resolver")
+			rslvr, err := NewODOHResolver(ns.Address, opts)
+			if err != nil {
+				return rslvrs, err
+			}
+			rslvrs = append(rslvrs, rslvr)
+		}
 		if ns.Type == models.DOTResolver {
 			opts.Logger.Debug("initiating DOT resolver")
 			rslvr, err := NewClassicResolver(ns.Address,
@@ -159,7 +282,7 @@ func LoadResolvers(opts Options) ([]Resolver, error) {
 			opts.Logger.Debug("initiating DNSCrypt resolver")
 			rslvr, err := NewDNSCryptResolver(ns.Address,
 				DNSCryptResolverOpts{
-					UseTCP: false,
+					UseTCP: opts.DNSCryptTCP,
 				}, opts)
 			if err != nil {
 				return rslvrs, err
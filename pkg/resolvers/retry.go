@@ -0,0 +1,154 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// The pause before the first retry, doubled before every following one up to
+// maxRetryDelay. A nameserver resetting the connections isn't sent the query
+// again straight away.
+const (
+	retryDelay    = 50 * time.Millisecond
+	maxRetryDelay = time.Second
+)
+
+// retryable reports whether err means the query or its reply was lost on the
+// way, so that sending it again may succeed.
+func retryable(err error) bool {
+	return isTimeout(err) ||
+		errors.Is(err, errConnClosed) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET)
+}
+
+// retries reports whether the queries are sent more than once, or with their
+// own timeout.
+func (o Options) retries() bool {
+	return o.Tries > 1 || o.RetryTimeout > 0
+}
+
+// attemptTimeout returns the timeout of the attempt n, from 0: RetryTimeout
+// doubled at every retry, up to Timeout.
+func (o Options) attemptTimeout(n int) time.Duration {
+	if o.RetryTimeout <= 0 {
+		return o.Timeout
+	}
+	timeout := o.RetryTimeout
+	for range n {
+		if o.Timeout > 0 && timeout >= o.Timeout {
+			break
+		}
+		timeout *= 2
+	}
+	if o.Timeout > 0 {
+		return min(timeout, o.Timeout)
+	}
+	return timeout
+}
+
+// attemptDelay returns the pause after the failed attempt n, from 0:
+// retryDelay doubled at every retry, up to maxRetryDelay.
+func attemptDelay(n int) time.Duration {
+	delay := retryDelay
+	for range n {
+		if delay >= maxRetryDelay {
+			break
+		}
+		delay *= 2
+	}
+	return min(delay, maxRetryDelay)
+}
+
+// LookupTimeout returns how long the attempts of a query and the pauses
+// between them can take in all.
+func (o Options) LookupTimeout() time.Duration {
+	var total time.Duration
+	for n := range max(o.Tries, 1) {
+		total += o.attemptTimeout(n)
+		if n > 0 {
+			total += attemptDelay(n - 1)
+		}
+	}
+	return total
+}
+
+// withRetries returns queryFunc sending the query to the nameserver at
+// address up to Options.Tries times, see retry. The responses have the number
+// of attempts they took.
+func withRetries(queryFunc QueryFunc, address string, opts Options) QueryFunc {
+	if !opts.retries() {
+		return queryFunc
+	}
+	return func(ctx context.Context, question dns.Question, flags QueryFlags) (Response, error) {
+		var rsp Response
+		attempts, err := retry(ctx, opts, address, question.Name, func(ctx context.Context) error {
+			var err error
+			rsp, err = queryFunc(ctx, question, flags)
+			return err
+		})
+		if err == nil {
+			rsp.Attempts = attempts
+		}
+		return rsp, err
+	}
+}
+
+// retry calls send for the query of name to the nameserver at address up to
+// Options.Tries times, as long as it fails with a timeout or a closed
+// connection. Every attempt has its own timeout, see Options.attemptTimeout,
+// and the retries wait a little longer every time, see attemptDelay. It
+// returns the number of attempts it took.
+func retry(ctx context.Context, opts Options, address, name string, send func(ctx context.Context) error) (int, error) {
+	tries := max(opts.Tries, 1)
+	attempt := func(n int) error {
+		if timeout := opts.attemptTimeout(n); timeout > 0 {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return send(ctx)
+		}
+		return send(ctx)
+	}
+
+	for n := 0; ; n++ {
+		err := attempt(n)
+		if err == nil {
+			return n + 1, nil
+		}
+		if !retryable(err) {
+			return n + 1, err
+		}
+		if n+1 == tries {
+			if tries > 1 {
+				err = fmt.Errorf("%w (after %d attempts)", err, tries)
+			}
+			return n + 1, err
+		}
+		if ctx.Err() != nil {
+			return n + 1, err
+		}
+		opts.Logger.Debug("Query failed; retrying",
+			"domain", name,
+			"nameserver", address,
+			"attempt", n+1,
+			"timeout", opts.attemptTimeout(n),
+			"delay", attemptDelay(n),
+			"error", err,
+		)
+
+		timer := time.NewTimer(attemptDelay(n))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return n + 1, err
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func TestAttemptTimeout(t *testing.T) {
+	for _, tc := range []struct {
+		opts Options
+		want []time.Duration
+	}{
+		{Options{Timeout: 5 * time.Second}, []time.Duration{5 * time.Second, 5 * time.Second}},
+		{Options{Timeout: 5 * time.Second, RetryTimeout: time.Second}, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}},
+		{Options{RetryTimeout: time.Second}, []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}},
+	} {
+		for n, want := range tc.want {
+			if got := tc.opts.attemptTimeout(n); got != want {
+				t.Errorf("%+v: attemptTimeout(%d) = %s, want %s", tc.opts, n, got, want)
+			}
+		}
+	}
+
+	for n, want := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		if got := attemptDelay(n); got != want {
+			t.Errorf("attemptDelay(%d) = %s, want %s", n, got, want)
+		}
+	}
+
+	// The tries take 1s, 2s, 4s and 5s, with pauses of 50, 100 and 200ms.
+	opts := Options{Timeout: 5 * time.Second, RetryTimeout: time.Second, Tries: 4}
+	if got, want := opts.LookupTimeout(), 12350*time.Millisecond; got != want {
+		t.Errorf("LookupTimeout() = %s, want %s", got, want)
+	}
+	if got, want := (Options{Timeout: 5 * time.Second}).LookupTimeout(), 5*time.Second; got != want {
+		t.Errorf("LookupTimeout() without tries = %s, want %s", got, want)
+	}
+}
+
+func TestWithRetries(t *testing.T) {
+	opts := Options{Logger: discardLogger(), Timeout: time.Second, Tries: 3}
+	q := dns.Question{Name: "example.com.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+
+	timeout := &net.OpError{Op: "read", Net: "udp", Err: errTimeout{}}
+	for _, tc := range []struct {
+		name     string
+		errs     []error
+		attempts int
+		wantErr  string
+	}{
+		{"answered", nil, 1, ""},
+		{"retried", []error{timeout, errConnClosed}, 3, ""},
+		{"reset", []error{syscall.ECONNRESET, io.EOF}, 3, ""},
+		{"gave up", []error{timeout, timeout, timeout}, 3, "after 3 attempts"},
+		{"not retried", []error{errors.New("certificate pin mismatch")}, 1, "certificate pin mismatch"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls atomic.Int32
+			query := withRetries(func(ctx context.Context, question dns.Question, flags QueryFlags) (Response, error) {
+				n := int(calls.Add(1))
+				if _, ok := ctx.Deadline(); !ok {
+					t.Error("the attempt has no timeout")
+				}
+				if n <= len(tc.errs) {
+					return Response{}, tc.errs[n-1]
+				}
+				return Response{Nameserver: "192.0.2.53:53"}, nil
+			}, "192.0.2.53:53", opts)
+
+			start := time.Now()
+			rsp, err := query(context.Background(), q, QueryFlags{})
+			if got := int(calls.Load()); got != tc.attempts {
+				t.Errorf("%d attempts, want %d", got, tc.attempts)
+			}
+			var delays time.Duration
+			for n := range tc.attempts - 1 {
+				delays += attemptDelay(n)
+			}
+			if elapsed := time.Since(start); elapsed < delays {
+				t.Errorf("%d attempts took %s, want a pause of %s between them", tc.attempts, elapsed, delays)
+			}
+			if tc.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+					t.Errorf("err = %v, want %q", err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			if rsp.Attempts != tc.attempts {
+				t.Errorf("Attempts = %d, want %d", rsp.Attempts, tc.attempts)
+			}
+		})
+	}
+}
+
+// errTimeout is a net.Error timing out.
+type errTimeout struct{}
+
+func (errTimeout) Error() string   { return "i/o timeout" }
+func (errTimeout) Timeout() bool   { return true }
+func (errTimeout) Temporary() bool { return true }
+
+func TestClassicResolverRetriesLostQuery(t *testing.T) {
+	// The server drops the first query, as if the packet was lost.
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	var received atomic.Int32
+	srv := &dns.Server{PacketConn: conn, Handler: dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if received.Add(1) == 1 {
+			return
+		}
+		_ = w.WriteMsg(pipelineReply(t, req))
+	})}
+	go func() { _ = srv.ActivateAndServe() }()
+	t.Cleanup(func() { _ = srv.Shutdown() })
+
+	r, err := NewClassicResolver(conn.LocalAddr().String(), ClassicResolverOpts{}, Options{
+		Logger:       discardLogger(),
+		Timeout:      2 * time.Second,
+		Tries:        2,
+		RetryTimeout: 200 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewClassicResolver: %v", err)
+	}
+	rsp, err := r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if len(rsp[0].Answers) != 1 || rsp[0].Attempts != 2 {
+		t.Errorf("response = %+v, want an answer after 2 attempts", rsp[0])
+	}
+	if got := received.Load(); got != 2 {
+		t.Errorf("server received %d queries, want 2", got)
+	}
+}
+
+func TestRetryStopsWaitingWhenCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	opts := Options{Logger: discardLogger(), Tries: 3}
+
+	start := time.Now()
+	attempts, err := retry(ctx, opts, "192.0.2.53:53", "example.com.", func(context.Context) error {
+		cancel()
+		return syscall.ECONNRESET
+	})
+	if attempts != 1 || !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("retry() = %d, %v, want to give up after the canceled attempt", attempts, err)
+	}
+	if elapsed := time.Since(start); elapsed >= retryDelay {
+		t.Errorf("retry() took %s, want no pause once canceled", elapsed)
+	}
+}
@@ -0,0 +1,131 @@
+package resolvers
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Failover sends every question to the resolvers in order and only moves on
+// to the next one when a resolver doesn't answer (it times out or the
+// connection fails) or answers SERVFAIL. Each attempt gets its own timeout,
+// so a dead nameserver doesn't use up the time left for the others.
+//
+// Errors are only returned for the questions none of the resolvers answered;
+// the last SERVFAIL received, if any, is returned for them too.
+func Failover(ctx context.Context, rslvrs []Resolver, questions []dns.Question, flags QueryFlags, timeout time.Duration, logger *slog.Logger) ([]Response, []error) {
+	return eachQuestion(questions, func(q dns.Question) ([]Response, []error) {
+		var (
+			errs     []error
+			servfail []Response
+		)
+		for _, r := range rslvrs {
+			if ctx.Err() != nil {
+				errs = append(errs, &LookupError{Nameserver: r.Address(), Err: ctx.Err()})
+				break
+			}
+			actx, cancel := context.WithTimeout(ctx, timeout)
+			rsp, err := r.Lookup(actx, []dns.Question{q}, flags)
+			cancel()
+			if good(rsp, err) {
+				return rsp, nil
+			}
+			if err != nil {
+				errs = append(errs, &LookupError{Nameserver: r.Address(), Err: err})
+			} else {
+				servfail = rsp
+			}
+			logger.Debug("Nameserver failed, trying the next one", "nameserver", r.Address(), "name", q.Name, "type", dns.TypeToString[q.Qtype], "error", err)
+		}
+		return servfail, errs
+	})
+}
+
+// Fastest races the resolvers for every question and keeps the first answer
+// that isn't a SERVFAIL, cancelling the queries still in flight.
+//
+// Errors are only returned for the questions none of the resolvers answered;
+// the first SERVFAIL received, if any, is returned for them too.
+func Fastest(ctx context.Context, rslvrs []Resolver, questions []dns.Question, flags QueryFlags, logger *slog.Logger) ([]Response, []error) {
+	type result struct {
+		r   Resolver
+		rsp []Response
+		err error
+	}
+
+	return eachQuestion(questions, func(q dns.Question) ([]Response, []error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		// Buffered so that the losers don't block once the race is over.
+		results := make(chan result, len(rslvrs))
+		for _, r := range rslvrs {
+			go func(r Resolver) {
+				rsp, err := r.Lookup(ctx, []dns.Question{q}, flags)
+				results <- result{r: r, rsp: rsp, err: err}
+			}(r)
+		}
+
+		var (
+			errs     []error
+			servfail []Response
+		)
+		for range rslvrs {
+			res := <-results
+			if good(res.rsp, res.err) {
+				logger.Debug("Nameserver answered first", "nameserver", res.r.Address(), "name", q.Name, "type", dns.TypeToString[q.Qtype])
+				return res.rsp, nil
+			}
+			if res.err != nil {
+				errs = append(errs, &LookupError{Nameserver: res.r.Address(), Err: res.err})
+			} else if servfail == nil {
+				servfail = res.rsp
+			}
+		}
+		return servfail, errs
+	})
+}
+
+// eachQuestion runs lookup concurrently for every question and joins the
+// results, keeping the order of the questions.
+func eachQuestion(questions []dns.Question, lookup func(q dns.Question) ([]Response, []error)) ([]Response, []error) {
+	var (
+		wg        sync.WaitGroup
+		responses = make([][]Response, len(questions))
+		errs      = make([][]error, len(questions))
+	)
+	for i, q := range questions {
+		wg.Add(1)
+		go func(i int, q dns.Question) {
+			defer wg.Done()
+			responses[i], errs[i] = lookup(q)
+		}(i, q)
+	}
+	wg.Wait()
+
+	var (
+		allResponses []Response
+		allErrors    []error
+	)
+	for i := range questions {
+		allResponses = append(allResponses, responses[i]...)
+		allErrors = append(allErrors, errs[i]...)
+	}
+	return allResponses, allErrors
+}
+
+// good reports whether a resolver answered, with anything but SERVFAIL.
+func good(rsp []Response, err error) bool {
+	if err != nil || len(rsp) == 0 {
+		return false
+	}
+	for _, r := range rsp {
+		if r.Status == dns.RcodeToString[dns.RcodeServerFailure] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,157 @@
+package resolvers
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startStrategyServer answers every A query over UDP with addr after delay,
+// with SERVFAIL when addr is empty, or not at all when delay is negative.
+func startStrategyServer(t *testing.T, addr string, delay time.Duration) string {
+	t.Helper()
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	srv := &dns.Server{PacketConn: conn}
+	srv.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if delay < 0 {
+			return
+		}
+		time.Sleep(delay)
+		m := new(dns.Msg)
+		m.SetReply(req)
+		if addr == "" {
+			m.Rcode = dns.RcodeServerFailure
+		} else {
+			m.Answer = append(m.Answer, testRR(t, req.Question[0].Name+" 60 IN A "+addr))
+		}
+		_ = w.WriteMsg(m)
+	})
+	ready := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(ready) }
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	select {
+	case <-ready:
+	case <-time.After(2 * time.Second):
+		t.Fatal("DNS test server did not start within 2s")
+	}
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return conn.LocalAddr().String()
+}
+
+func strategyQuestions() []dns.Question {
+	return []dns.Question{
+		{Name: "a.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+		{Name: "b.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET},
+	}
+}
+
+func TestFailoverSkipsTimeoutAndServfail(t *testing.T) {
+	dropped := startStrategyServer(t, "", -1)
+	servfail := startStrategyServer(t, "", 0)
+	good := startStrategyServer(t, "192.0.2.3", 0)
+	unused := startStrategyServer(t, "192.0.2.4", 0)
+	rslvrs := []Resolver{
+		newBenchResolver(t, dropped),
+		newBenchResolver(t, servfail),
+		newBenchResolver(t, good),
+		newBenchResolver(t, unused),
+	}
+
+	responses, errs := Failover(context.Background(), rslvrs, strategyQuestions(), QueryFlags{}, 200*time.Millisecond, discardLogger())
+	if len(errs) != 0 {
+		t.Fatalf("errs = %v, want none", errs)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("len(responses) = %d, want one per question", len(responses))
+	}
+	for i, rsp := range responses {
+		if rsp.Nameserver != good || rsp.Status != "NOERROR" {
+			t.Errorf("responses[%d] from %s with %s, want %s with NOERROR", i, rsp.Nameserver, rsp.Status, good)
+		}
+		if rsp.Questions[0].Name != strategyQuestions()[i].Name {
+			t.Errorf("responses[%d] is for %s, want the order of the questions", i, rsp.Questions[0].Name)
+		}
+	}
+}
+
+func TestFailoverStopsAtFirstAnswer(t *testing.T) {
+	first := startStrategyServer(t, "192.0.2.1", 0)
+	second := startStrategyServer(t, "192.0.2.2", 0)
+	rslvrs := []Resolver{newBenchResolver(t, first), newBenchResolver(t, second)}
+
+	responses, errs := Failover(context.Background(), rslvrs, strategyQuestions()[:1], QueryFlags{}, time.Second, discardLogger())
+	if len(errs) != 0 || len(responses) != 1 {
+		t.Fatalf("got %d responses and errors %v, want a single response", len(responses), errs)
+	}
+	if responses[0].Nameserver != first {
+		t.Fatalf("answered by %s, want the first nameserver %s", responses[0].Nameserver, first)
+	}
+}
+
+func TestFailoverAllFailing(t *testing.T) {
+	dropped := startStrategyServer(t, "", -1)
+	servfail := startStrategyServer(t, "", 0)
+	rslvrs := []Resolver{newBenchResolver(t, servfail), newBenchResolver(t, dropped)}
+
+	responses, errs := Failover(context.Background(), rslvrs, strategyQuestions()[:1], QueryFlags{}, 200*time.Millisecond, discardLogger())
+	if len(errs) != 1 {
+		t.Fatalf("errs = %v, want the timeout of %s", errs, dropped)
+	}
+	if len(responses) != 1 || responses[0].Status != "SERVFAIL" {
+		t.Fatalf("responses = %+v, want the SERVFAIL of %s", responses, servfail)
+	}
+}
+
+func TestFastestKeepsFirstGoodAnswer(t *testing.T) {
+	dropped := startStrategyServer(t, "", -1)
+	servfail := startStrategyServer(t, "", 0)
+	slow := startStrategyServer(t, "192.0.2.1", 300*time.Millisecond)
+	fast := startStrategyServer(t, "192.0.2.2", 20*time.Millisecond)
+	rslvrs := []Resolver{
+		newBenchResolver(t, dropped),
+		newBenchResolver(t, servfail),
+		newBenchResolver(t, slow),
+		newBenchResolver(t, fast),
+	}
+
+	start := time.Now()
+	responses, errs := Fastest(context.Background(), rslvrs, strategyQuestions(), QueryFlags{}, discardLogger())
+	if len(errs) != 0 {
+		t.Fatalf("errs = %v, want none", errs)
+	}
+	if len(responses) != 2 {
+		t.Fatalf("len(responses) = %d, want one per question", len(responses))
+	}
+	for i, rsp := range responses {
+		if rsp.Nameserver != fast {
+			t.Errorf("responses[%d] from %s, want %s", i, rsp.Nameserver, fast)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("took %s, want the slower nameservers not to be waited for", elapsed)
+	}
+}
+
+func TestFastestAllFailing(t *testing.T) {
+	dropped := startStrategyServer(t, "", -1)
+	servfail := startStrategyServer(t, "", 0)
+	rslvrs := []Resolver{newBenchResolver(t, dropped), newBenchResolver(t, servfail)}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	responses, errs := Fastest(ctx, rslvrs, strategyQuestions()[:1], QueryFlags{}, discardLogger())
+	if len(errs) != 1 {
+		t.Fatalf("errs = %v, want the timeout of %s", errs, dropped)
+	}
+	if len(responses) != 1 || responses[0].Status != "SERVFAIL" {
+		t.Fatalf("responses = %+v, want the SERVFAIL of %s", responses, servfail)
+	}
+}
@@ -0,0 +1,251 @@
+package resolvers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// tlsPinPrefix prefixes the base64 SHA-256 digest of the SubjectPublicKeyInfo
+// of a certificate in a --tls-pin.
+const tlsPinPrefix = "sha256/"
+
+// TLSInfo describes the TLS connection a reply was received on, for
+// --tls-info.
+type TLSInfo struct {
+	Version      string           `json:"version,omitempty"`
+	CipherSuite  string           `json:"cipher_suite,omitempty"`
+	ALPN         string           `json:"alpn,omitempty"`
+	Resumed      bool             `json:"resumed"`
+	Certificates []TLSCertificate `json:"certificates"`
+}
+
+// TLSCertificate is a certificate of the chain the server presented, leaf
+// first.
+type TLSCertificate struct {
+	Subject  string   `json:"subject"`
+	SANs     []string `json:"sans,omitempty"`
+	Issuer   string   `json:"issuer"`
+	NotAfter string   `json:"not_after"`
+}
+
+// TLSError is a failed TLS handshake. TLS holds the certificates the server
+// presented when it's the verification of the chain that failed.
+type TLSError struct {
+	Err error
+	TLS *TLSInfo
+}
+
+func (e *TLSError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TLSError) Unwrap() error {
+	return e.Err
+}
+
+// PinError is a server whose certificate chain matches none of the pins it
+// was expected to. Received has the pins of its certificates, leaf first, in
+// the forms of Expected.
+type PinError struct {
+	Expected []string `json:"expected"`
+	Received []string `json:"received"`
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("certificate pin mismatch: expected %s, received %s",
+		strings.Join(e.Expected, " or "), strings.Join(e.Received, ", "))
+}
+
+// newTLSConfig returns the TLS config of the encrypted transports. Sessions
+// are cached, so the connections reopened to a server resume them. The
+// client certificate of Options.TLSCert is sent to servers asking for one,
+// and the certificates of servers are verified against the CA bundle of
+// Options.TLSCA instead of the system roots when it's set.
+func newTLSConfig(opts Options, serverName string, nextProtos ...string) (*tls.Config, error) {
+	config := &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: opts.InsecureSkipVerify,
+		NextProtos:         nextProtos,
+		ClientSessionCache: tls.NewLRUClientSessionCache(0),
+	}
+
+	if opts.TLSKey != "" && opts.TLSCert == "" {
+		return nil, errors.New("a TLS key needs a TLS certificate")
+	}
+	if opts.TLSCert != "" {
+		// The key may be in the same file as the certificate.
+		key := opts.TLSKey
+		if key == "" {
+			key = opts.TLSCert
+		}
+		cert, err := tls.LoadX509KeyPair(opts.TLSCert, key)
+		if err != nil {
+			return nil, fmt.Errorf("loading the TLS client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	if opts.TLSCA != "" {
+		pem, err := os.ReadFile(opts.TLSCA)
+		if err != nil {
+			return nil, fmt.Errorf("loading the TLS CA bundle: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in the TLS CA bundle %s", opts.TLSCA)
+		}
+		config.RootCAs = pool
+	}
+
+	if len(opts.TLSPins) > 0 || len(opts.TLSCertHashes) > 0 {
+		pins, err := newTLSPins(opts.TLSPins, opts.TLSCertHashes)
+		if err != nil {
+			return nil, err
+		}
+		// The SPKI pins authenticate the server on their own (RFC 7858
+		// section 4.2), its certificate isn't checked against the CAs or
+		// the hostname. The hashes of DNS stamps come on top of them.
+		if len(opts.TLSPins) > 0 {
+			config.InsecureSkipVerify = true
+		}
+		config.VerifyConnection = pins.verify
+	}
+	return config, nil
+}
+
+// tlsPins are the SHA-256 digests a certificate of the chain of a server has
+// to match: of its SubjectPublicKeyInfo for the --tls-pin ones, and of the
+// whole certificate but its signature (the TBS certificate) for the hashes
+// of DNS stamps.
+type tlsPins struct {
+	spki     [][]byte
+	tbs      [][]byte
+	expected []string
+}
+
+func newTLSPins(spkiPins, certHashes []string) (*tlsPins, error) {
+	p := &tlsPins{}
+	for _, pin := range spkiPins {
+		digest, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(pin, tlsPinPrefix))
+		if !strings.HasPrefix(pin, tlsPinPrefix) || err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("invalid TLS pin %q: want sha256/ followed by a base64 SHA-256 digest", pin)
+		}
+		p.spki = append(p.spki, digest)
+		p.expected = append(p.expected, pin)
+	}
+	for _, hash := range certHashes {
+		digest, err := hex.DecodeString(hash)
+		if err != nil || len(digest) != sha256.Size {
+			return nil, fmt.Errorf("invalid certificate hash %q", hash)
+		}
+		p.tbs = append(p.tbs, digest)
+		p.expected = append(p.expected, hash)
+	}
+	return p, nil
+}
+
+// verify checks that a certificate of the chain matches a pin. When it isn't
+// the leaf, the leaf has to chain up to it.
+func (p *tlsPins) verify(state tls.ConnectionState) error {
+	certs := state.PeerCertificates
+	var received []string
+	for i, cert := range certs {
+		spki := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+		tbs := sha256.Sum256(cert.RawTBSCertificate)
+		if len(p.spki) > 0 {
+			received = append(received, tlsPinPrefix+base64.StdEncoding.EncodeToString(spki[:]))
+		}
+		if len(p.tbs) > 0 {
+			received = append(received, hex.EncodeToString(tbs[:]))
+		}
+		if !containsDigest(p.spki, spki[:]) && !containsDigest(p.tbs, tbs[:]) {
+			continue
+		}
+		if i == 0 {
+			return nil
+		}
+		roots, intermediates := x509.NewCertPool(), x509.NewCertPool()
+		roots.AddCert(cert)
+		for _, c := range certs[1:i] {
+			intermediates.AddCert(c)
+		}
+		_, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err == nil {
+			return nil
+		}
+	}
+	return &PinError{Expected: p.expected, Received: received}
+}
+
+func containsDigest(digests [][]byte, digest []byte) bool {
+	for _, d := range digests {
+		if bytes.Equal(d, digest) {
+			return true
+		}
+	}
+	return false
+}
+
+// newTLSInfo returns the details of a TLS connection, or nil when there's
+// none.
+func newTLSInfo(state *tls.ConnectionState) *TLSInfo {
+	if state == nil {
+		return nil
+	}
+	return &TLSInfo{
+		Version:      tls.VersionName(state.Version),
+		CipherSuite:  tls.CipherSuiteName(state.CipherSuite),
+		ALPN:         state.NegotiatedProtocol,
+		Resumed:      state.DidResume,
+		Certificates: tlsCertificates(state.PeerCertificates),
+	}
+}
+
+func tlsCertificates(certs []*x509.Certificate) []TLSCertificate {
+	out := make([]TLSCertificate, 0, len(certs))
+	for _, cert := range certs {
+		sans := append([]string{}, cert.DNSNames...)
+		for _, ip := range cert.IPAddresses {
+			sans = append(sans, ip.String())
+		}
+		out = append(out, TLSCertificate{
+			Subject:  cert.Subject.String(),
+			SANs:     sans,
+			Issuer:   cert.Issuer.String(),
+			NotAfter: cert.NotAfter.UTC().Format(time.RFC3339),
+		})
+	}
+	return out
+}
+
+// String summarizes the certificate on one line.
+func (c TLSCertificate) String() string {
+	s := fmt.Sprintf("%s issued by %s, expires %s", c.Subject, c.Issuer, c.NotAfter)
+	if len(c.SANs) > 0 {
+		s += ", SANs " + strings.Join(c.SANs, " ")
+	}
+	return s
+}
+
+// wrapTLSError returns err as a *TLSError holding the certificates the server
+// presented when their verification failed, and err as is otherwise.
+func wrapTLSError(err error) error {
+	var verr *tls.CertificateVerificationError
+	if err == nil || !errors.As(err, &verr) {
+		return err
+	}
+	return &TLSError{Err: err, TLS: &TLSInfo{Certificates: tlsCertificates(verr.UnverifiedCertificates)}}
+}
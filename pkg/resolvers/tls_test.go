@@ -0,0 +1,328 @@
+package resolvers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+func tlsInfoLookup(t *testing.T, r Resolver) Response {
+	t.Helper()
+	rsp, err := r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{})
+	if err != nil {
+		t.Fatalf("Lookup: %v", err)
+	}
+	if rsp[0].TLS == nil {
+		t.Fatal("the response has no TLS information")
+	}
+	return rsp[0]
+}
+
+func TestTLSInfo(t *testing.T) {
+	// The server closes every connection after its first reply, so the
+	// second lookup opens a new one.
+	config := &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}
+	addr, _ := startPipelineServer(t, config, func(conn *dns.Conn) {
+		req, err := conn.ReadMsg()
+		if err != nil {
+			return
+		}
+		_ = conn.WriteMsg(pipelineReply(t, req))
+	})
+	opts := Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true, TLSInfo: true}
+	r, err := NewClassicResolver(addr, ClassicResolverOpts{UseTCP: true, UseTLS: true}, opts)
+	if err != nil {
+		t.Fatalf("NewClassicResolver: %v", err)
+	}
+
+	info := tlsInfoLookup(t, r).TLS
+	if info.Version != "TLS 1.3" || info.CipherSuite == "" || info.Resumed {
+		t.Errorf("TLS = %+v, want a new TLS 1.3 session", info)
+	}
+	if len(info.Certificates) != 1 || !slices.Contains(info.Certificates[0].SANs, "127.0.0.1") {
+		t.Errorf("certificates = %+v, want the test certificate", info.Certificates)
+	}
+	if info := tlsInfoLookup(t, r).TLS; !info.Resumed {
+		t.Error("the session of the second connection wasn't resumed")
+	}
+
+	// Without the option, there's no TLS information.
+	opts.TLSInfo = false
+	r, _ = NewClassicResolver(addr, ClassicResolverOpts{UseTCP: true, UseTLS: true}, opts)
+	rsp, err := r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{})
+	if err != nil || rsp[0].TLS != nil {
+		t.Errorf("TLS = %+v, %v without Options.TLSInfo, want none", rsp[0].TLS, err)
+	}
+}
+
+func TestTLSInfoCertificateError(t *testing.T) {
+	config := &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}
+	addr, _ := startPipelineServer(t, config, serveInOrder(t))
+	r, err := NewClassicResolver(addr, ClassicResolverOpts{UseTCP: true, UseTLS: true}, Options{
+		Logger:  discardLogger(),
+		Timeout: 2 * time.Second,
+		TLSInfo: true,
+	})
+	if err != nil {
+		t.Fatalf("NewClassicResolver: %v", err)
+	}
+
+	_, err = r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{})
+	var tlsErr *TLSError
+	if !errors.As(err, &tlsErr) {
+		t.Fatalf("err = %v, want a TLSError", err)
+	}
+	if len(tlsErr.TLS.Certificates) != 1 || tlsErr.TLS.Certificates[0].NotAfter == "" {
+		t.Errorf("certificates = %+v, want the self-signed one", tlsErr.TLS.Certificates)
+	}
+}
+
+func TestTLSInfoDOQ(t *testing.T) {
+	addr, _, _ := startDOQServer(t)
+	r, err := NewDOQResolver(addr, Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true, TLSInfo: true})
+	if err != nil {
+		t.Fatalf("NewDOQResolver: %v", err)
+	}
+	if info := tlsInfoLookup(t, r).TLS; info.ALPN != "doq" || info.Version != "TLS 1.3" {
+		t.Errorf("TLS = %+v, want TLS 1.3 with the doq ALPN", info)
+	}
+}
+
+func TestTLSInfoDOH(t *testing.T) {
+	_, h2URL := startDOHServers(t)
+	r, err := NewDOHResolver(h2URL, Options{Logger: discardLogger(), Timeout: 2 * time.Second, InsecureSkipVerify: true, TLSInfo: true})
+	if err != nil {
+		t.Fatalf("NewDOHResolver: %v", err)
+	}
+	if info := tlsInfoLookup(t, r).TLS; info.ALPN != "h2" || len(info.Certificates) == 0 {
+		t.Errorf("TLS = %+v, want h2 and the certificates", info)
+	}
+}
+
+// testCA is a CA issuing the certificates of the mutual TLS tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+// issue returns a certificate for 127.0.0.1 signed by the CA.
+func (ca *testCA) issue(t *testing.T, usage x509.ExtKeyUsage) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+// writePEM writes the blocks to a file in a temporary directory.
+func writePEM(t *testing.T, name string, blocks ...*pem.Block) string {
+	t.Helper()
+	var b []byte
+	for _, block := range blocks {
+		b = append(b, pem.EncodeToMemory(block)...)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTLSClientCertificate(t *testing.T) {
+	ca := newTestCA(t)
+	addr, _ := startPipelineServer(t, &tls.Config{
+		Certificates: []tls.Certificate{ca.issue(t, x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    ca.pool,
+	}, serveInOrder(t))
+
+	client := ca.issue(t, x509.ExtKeyUsageClientAuth)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(client.PrivateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile := writePEM(t, "client.pem", &pem.Block{Type: "CERTIFICATE", Bytes: client.Certificate[0]})
+	keyFile := writePEM(t, "client-key.pem", &pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	bothFile := writePEM(t, "client-both.pem",
+		&pem.Block{Type: "CERTIFICATE", Bytes: client.Certificate[0]},
+		&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	caFile := writePEM(t, "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+
+	lookup := func(opts Options) error {
+		opts.Logger, opts.Timeout = discardLogger(), 2*time.Second
+		r, err := NewClassicResolver(addr, ClassicResolverOpts{UseTCP: true, UseTLS: true}, opts)
+		if err != nil {
+			return err
+		}
+		_, err = r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{})
+		return err
+	}
+	if err := lookup(Options{TLSCert: certFile, TLSKey: keyFile, TLSCA: caFile}); err != nil {
+		t.Errorf("lookup with the client certificate: %v", err)
+	}
+	if err := lookup(Options{TLSCert: bothFile, TLSCA: caFile}); err != nil {
+		t.Errorf("lookup with the key in the certificate file: %v", err)
+	}
+	if err := lookup(Options{TLSCA: caFile}); err == nil {
+		t.Error("lookup without a client certificate succeeded")
+	}
+	if err := lookup(Options{TLSCert: certFile, TLSKey: keyFile}); err == nil {
+		t.Error("the certificate of the server was verified without the CA bundle")
+	}
+}
+
+func TestNewTLSConfigErrors(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, opts := range map[string]Options{
+		"key without certificate": {TLSKey: "client-key.pem"},
+		"missing certificate":     {TLSCert: filepath.Join(t.TempDir(), "missing.pem")},
+		"missing CA bundle":       {TLSCA: filepath.Join(t.TempDir(), "missing.pem")},
+		"empty CA bundle":         {TLSCA: notPEM},
+		"pin without sha256/":     {TLSPins: []string{"47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="}},
+		"short pin":               {TLSPins: []string{"sha256/AAAA"}},
+		"certificate hash":        {TLSCertHashes: []string{"not hex"}},
+	} {
+		if _, err := newTLSConfig(opts, ""); err == nil {
+			t.Errorf("%s: newTLSConfig succeeded", name)
+		}
+	}
+}
+
+func spkiPin(cert tls.Certificate) string {
+	c, _ := x509.ParseCertificate(cert.Certificate[0])
+	sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+	return "sha256/" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func TestTLSPin(t *testing.T) {
+	ca := newTestCA(t)
+	leaf := ca.issue(t, x509.ExtKeyUsageServerAuth)
+	caPin := spkiPin(tls.Certificate{Certificate: [][]byte{ca.cert.Raw}})
+	// A self-signed certificate sent along with the certificate of the CA,
+	// which didn't issue it.
+	forged := selfSignedCert(t)
+	forged.Certificate = append(forged.Certificate, ca.cert.Raw)
+
+	lookup := func(cert tls.Certificate, opts Options) error {
+		addr, _ := startPipelineServer(t, &tls.Config{Certificates: []tls.Certificate{cert}}, serveInOrder(t))
+		opts.Logger, opts.Timeout = discardLogger(), 2*time.Second
+		r, err := NewClassicResolver(addr, ClassicResolverOpts{UseTCP: true, UseTLS: true}, opts)
+		if err != nil {
+			return err
+		}
+		_, err = r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{})
+		return err
+	}
+
+	// The pins replace the verification against the system roots.
+	if err := lookup(leaf, Options{TLSPins: []string{spkiPin(leaf)}}); err != nil {
+		t.Errorf("lookup pinning the leaf: %v", err)
+	}
+	if err := lookup(withChain(leaf, ca), Options{TLSPins: []string{caPin}}); err != nil {
+		t.Errorf("lookup pinning the CA: %v", err)
+	}
+
+	err := lookup(forged, Options{TLSPins: []string{caPin}})
+	var pinErr *PinError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("err = %v for a chain not issued by the pinned CA, want a PinError", err)
+	}
+	if !slices.Equal(pinErr.Expected, []string{caPin}) || len(pinErr.Received) != 2 || pinErr.Received[0] != spkiPin(forged) {
+		t.Errorf("PinError = %+v, want the pin of the CA expected and the pins of the chain received", pinErr)
+	}
+}
+
+func TestTLSCertHashes(t *testing.T) {
+	ca := newTestCA(t)
+	leaf := withChain(ca.issue(t, x509.ExtKeyUsageServerAuth), ca)
+	caHash := sha256.Sum256(ca.cert.RawTBSCertificate)
+	caFile := writePEM(t, "ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: ca.cert.Raw})
+	addr, _ := startPipelineServer(t, &tls.Config{Certificates: []tls.Certificate{leaf}}, serveInOrder(t))
+
+	for _, tc := range []struct {
+		hash string
+		ok   bool
+	}{
+		{hex.EncodeToString(caHash[:]), true},
+		{strings.Repeat("00", sha256.Size), false},
+	} {
+		r, err := NewClassicResolver(addr, ClassicResolverOpts{UseTCP: true, UseTLS: true}, Options{
+			Logger:        discardLogger(),
+			Timeout:       2 * time.Second,
+			TLSCA:         caFile,
+			TLSCertHashes: []string{tc.hash},
+		})
+		if err != nil {
+			t.Fatalf("NewClassicResolver: %v", err)
+		}
+		_, err = r.Lookup(context.Background(), pipelineQuestions("example.com."), QueryFlags{})
+		var pinErr *PinError
+		if tc.ok && err != nil || !tc.ok && !errors.As(err, &pinErr) {
+			t.Errorf("hash %s: err = %v", tc.hash, err)
+		}
+	}
+}
+
+// withChain appends the certificate of the CA to the chain of cert.
+func withChain(cert tls.Certificate, ca *testCA) tls.Certificate {
+	cert.Certificate = append(cert.Certificate, ca.cert.Raw)
+	return cert
+}
@@ -0,0 +1,187 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// ErrTransferUnsupported is returned for nameservers whose transport can't
+// carry a zone transfer.
+var ErrTransferUnsupported = errors.New("zone transfers are only supported over TCP and DoT")
+
+// Change markers for records of an incremental (IXFR) transfer.
+const (
+	TransferChangeAdd    = "add"
+	TransferChangeDelete = "delete"
+)
+
+// Transferer is implemented by resolvers that can perform a zone transfer.
+// A transfer streams many messages over a single connection, so only the
+// TCP and DoT resolvers support it.
+type Transferer interface {
+	// Transfer requests zone from the nameserver and calls fn, if set, with
+	// the records of every message as they arrive.
+	Transfer(ctx context.Context, zone string, opts TransferOptions, fn func([]dns.RR)) (TransferResponse, error)
+}
+
+// TransferOptions configures a zone transfer.
+type TransferOptions struct {
+	// Type is either dns.TypeAXFR or dns.TypeIXFR.
+	Type uint16
+	// Serial is the SOA serial the client already has. Only used for IXFR.
+	Serial uint32
+}
+
+// TransferResponse holds every record received during a zone transfer.
+type TransferResponse struct {
+	Zone       string           `json:"zone"`
+	Type       string           `json:"type"`
+	Nameserver string           `json:"nameserver"`
+	Serial     uint32           `json:"serial"`
+	Messages   int              `json:"messages"`
+	RTT        string           `json:"rtt"`
+	Signed     bool             `json:"tsig"`
+	Records    []TransferRecord `json:"records"`
+}
+
+// TransferRecord is a single record of a zone transfer. Change is only set
+// for the records of an incremental transfer.
+type TransferRecord struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Class   string `json:"class"`
+	TTL     string `json:"ttl"`
+	Address string `json:"address"`
+	RData   any    `json:"rdata,omitempty"`
+	Change  string `json:"change,omitempty"`
+}
+
+// Transfer implements the Transferer interface. UDP nameservers are
+// transparently upgraded to TCP, the same as `dig axfr`.
+func (r *ClassicResolver) Transfer(ctx context.Context, zone string, opts TransferOptions, fn func([]dns.RR)) (TransferResponse, error) {
+	zone = dns.Fqdn(zone)
+	rsp := TransferResponse{
+		Zone:       zone,
+		Type:       dns.TypeToString[opts.Type],
+		Nameserver: r.server,
+	}
+
+	msg := new(dns.Msg)
+	switch opts.Type {
+	case dns.TypeAXFR:
+		msg.SetAxfr(zone)
+	case dns.TypeIXFR:
+		msg.SetIxfr(zone, opts.Serial, ".", ".")
+	default:
+		return rsp, fmt.Errorf("unsupported transfer type %d", opts.Type)
+	}
+
+	client := *r.client
+	client.Net = strings.Replace(client.Net, "udp", "tcp", 1)
+
+	r.resolverOptions.Logger.Debug("Starting zone transfer",
+		"zone", zone,
+		"type", rsp.Type,
+		"serial", opts.Serial,
+		"nameserver", r.server,
+		"protocol", client.Net,
+	)
+
+	now := time.Now()
+	conn, err := r.dial(ctx, &client)
+	if err != nil {
+		return rsp, err
+	}
+
+	t := &dns.Transfer{
+		Conn:         conn,
+		ReadTimeout:  r.resolverOptions.Timeout,
+		WriteTimeout: r.resolverOptions.Timeout,
+	}
+	if key := r.resolverOptions.TSIG; key != nil {
+		t.TsigSecret = key.secrets()
+		key.sign(msg)
+		rsp.Signed = true
+	}
+
+	env, err := t.In(msg, r.server)
+	if err != nil {
+		conn.Close()
+		return rsp, err
+	}
+	// The dns library has no way to abort a transfer, closing the connection
+	// makes the pending read fail instead.
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	var rrs []dns.RR
+	for e := range env {
+		if e.Error != nil {
+			// Drain the channel so the transfer goroutine can exit.
+			for range env {
+			}
+			err = e.Error
+			if key := r.resolverOptions.TSIG; key != nil {
+				err = key.verify(nil, err)
+			}
+			break
+		}
+		rsp.Messages++
+		rrs = append(rrs, e.RR...)
+		if fn != nil {
+			fn(e.RR)
+		}
+	}
+	rsp.RTT = fmt.Sprintf("%dms", time.Since(now).Milliseconds())
+	rsp.Records = transferRecords(rrs, opts.Type == dns.TypeIXFR)
+	if len(rrs) > 0 {
+		if soa, ok := rrs[0].(*dns.SOA); ok {
+			rsp.Serial = soa.Serial
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	return rsp, err
+}
+
+// transferRecords converts the records of a transfer to the output format.
+// An incremental transfer is laid out as the new SOA, followed by pairs of
+// (old SOA, deleted records, new SOA, added records) and the new SOA again
+// (RFC 1995 section 4); each record in between is tagged accordingly. A
+// server may answer an IXFR with the full zone instead, which is left as is.
+func transferRecords(rrs []dns.RR, ixfr bool) []TransferRecord {
+	records := make([]TransferRecord, 0, len(rrs))
+	incremental := ixfr && len(rrs) > 2 && rrs[1].Header().Rrtype == dns.TypeSOA
+	change := ""
+	for i, rr := range rrs {
+		h := rr.Header()
+		if incremental && i > 0 && i < len(rrs)-1 && h.Rrtype == dns.TypeSOA {
+			if change == TransferChangeDelete {
+				change = TransferChangeAdd
+			} else {
+				change = TransferChangeDelete
+			}
+		}
+		parts := strings.Split(rr.String(), "\t")
+		rec := TransferRecord{
+			Name:    toUnicodeDomain(h.Name),
+			Type:    dns.Type(h.Rrtype).String(),
+			Class:   dns.Class(h.Class).String(),
+			TTL:     strconv.FormatInt(int64(h.Ttl), 10) + "s",
+			Address: parts[len(parts)-1],
+			RData:   RDataOf(rr),
+		}
+		if i < len(rrs)-1 {
+			rec.Change = change
+		}
+		records = append(records, rec)
+	}
+	return records
+}
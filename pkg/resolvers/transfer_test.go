@@ -0,0 +1,162 @@
+package resolvers
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startTransferServer serves zone transfers over TCP, sending every slice of
+// records as its own message.
+func startTransferServer(t *testing.T, secrets map[string]string, messages ...[]dns.RR) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	srv := &dns.Server{Listener: ln, TsigSecret: secrets}
+	srv.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		if secrets != nil && (req.IsTsig() == nil || w.TsigStatus() != nil) {
+			m := new(dns.Msg)
+			m.SetRcode(req, dns.RcodeNotAuth)
+			_ = w.WriteMsg(m)
+			return
+		}
+		ch := make(chan *dns.Envelope)
+		tr := new(dns.Transfer)
+		done := make(chan struct{})
+		go func() {
+			_ = tr.Out(w, req, ch)
+			close(done)
+		}()
+		for _, rrs := range messages {
+			ch <- &dns.Envelope{RR: rrs}
+		}
+		close(ch)
+		<-done
+	})
+	ready := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(ready) }
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	select {
+	case <-ready:
+	case <-time.After(2 * time.Second):
+		t.Fatal("DNS test server did not start within 2s")
+	}
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return ln.Addr().String()
+}
+
+// newTSIGClassicResolver returns a classic resolver of addr signing its
+// messages with key, if any.
+func newTSIGClassicResolver(t *testing.T, addr string, key *TSIGKey) Resolver {
+	t.Helper()
+	r, err := NewClassicResolver(addr, ClassicResolverOpts{}, Options{
+		Logger:  discardLogger(),
+		Timeout: 2 * time.Second,
+		TSIG:    key,
+	})
+	if err != nil {
+		t.Fatalf("NewClassicResolver: %v", err)
+	}
+	return r
+}
+
+func TestTransferAXFRStreamsEveryMessage(t *testing.T) {
+	soa := testRR(t, "example. 3600 IN SOA ns.example. admin.example. 42 1800 900 604800 3600")
+	addr := startTransferServer(t, nil,
+		[]dns.RR{soa, testRR(t, "example. 3600 IN NS ns.example.")},
+		[]dns.RR{testRR(t, "www.example. 300 IN A 192.0.2.1"), testRR(t, "mail.example. 300 IN MX 10 mx.example.")},
+		[]dns.RR{soa},
+	)
+
+	var streamed int
+	rsp, err := newTSIGClassicResolver(t, addr, nil).(Transferer).Transfer(context.Background(), "example", TransferOptions{Type: dns.TypeAXFR}, func(rrs []dns.RR) {
+		streamed += len(rrs)
+	})
+	if err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	if rsp.Zone != "example." || rsp.Type != "AXFR" || rsp.Serial != 42 {
+		t.Errorf("Transfer() = %s %s serial %d, want example. AXFR serial 42", rsp.Zone, rsp.Type, rsp.Serial)
+	}
+	if rsp.Messages != 3 {
+		t.Errorf("Messages = %d, want 3", rsp.Messages)
+	}
+	if len(rsp.Records) != 5 || streamed != 5 {
+		t.Fatalf("got %d records (%d streamed), want 5", len(rsp.Records), streamed)
+	}
+	if rsp.Records[3].Address != "10 mx.example." {
+		t.Errorf("Records[3].Address = %q, want %q", rsp.Records[3].Address, "10 mx.example.")
+	}
+	for _, rec := range rsp.Records {
+		if rec.Change != "" {
+			t.Errorf("AXFR record %s %s has change %q, want none", rec.Name, rec.Type, rec.Change)
+		}
+	}
+}
+
+func TestTransferIXFRMarksChanges(t *testing.T) {
+	newSOA := testRR(t, "example. 3600 IN SOA ns.example. admin.example. 43 1800 900 604800 3600")
+	oldSOA := testRR(t, "example. 3600 IN SOA ns.example. admin.example. 42 1800 900 604800 3600")
+	addr := startTransferServer(t, nil, []dns.RR{
+		newSOA,
+		oldSOA, testRR(t, "www.example. 300 IN A 192.0.2.1"),
+		newSOA, testRR(t, "www.example. 300 IN A 192.0.2.2"),
+		newSOA,
+	})
+
+	rsp, err := newTSIGClassicResolver(t, addr, nil).(Transferer).Transfer(context.Background(), "example.", TransferOptions{Type: dns.TypeIXFR, Serial: 42}, nil)
+	if err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	want := []string{"", TransferChangeDelete, TransferChangeDelete, TransferChangeAdd, TransferChangeAdd, ""}
+	if len(rsp.Records) != len(want) {
+		t.Fatalf("got %d records, want %d", len(rsp.Records), len(want))
+	}
+	for i, rec := range rsp.Records {
+		if rec.Change != want[i] {
+			t.Errorf("Records[%d] (%s %s) change = %q, want %q", i, rec.Type, rec.Address, rec.Change, want[i])
+		}
+	}
+}
+
+func TestTransferWithTSIG(t *testing.T) {
+	soa := testRR(t, "example. 3600 IN SOA ns.example. admin.example. 1 1800 900 604800 3600")
+	addr := startTransferServer(t, map[string]string{"xfr-key.": testTSIGSecret}, []dns.RR{soa, soa})
+
+	key, err := ParseTSIGKey("xfr-key:hmac-sha256:" + testTSIGSecret)
+	if err != nil {
+		t.Fatalf("ParseTSIGKey: %v", err)
+	}
+	rsp, err := newTSIGClassicResolver(t, addr, key).(Transferer).Transfer(context.Background(), "example.", TransferOptions{Type: dns.TypeAXFR}, nil)
+	if err != nil {
+		t.Fatalf("Transfer() error = %v", err)
+	}
+	if !rsp.Signed || len(rsp.Records) != 2 {
+		t.Fatalf("Transfer() = signed %v with %d records, want signed with 2", rsp.Signed, len(rsp.Records))
+	}
+
+	wrong, _ := ParseTSIGKey("xfr-key:hmac-sha256:" + "d3Jvbmctc2VjcmV0")
+	if _, err := newTSIGClassicResolver(t, addr, wrong).(Transferer).Transfer(context.Background(), "example.", TransferOptions{Type: dns.TypeAXFR}, nil); err == nil {
+		t.Fatal("Transfer() with the wrong secret succeeded, want an error")
+	}
+	if _, err := newTSIGClassicResolver(t, addr, nil).(Transferer).Transfer(context.Background(), "example.", TransferOptions{Type: dns.TypeAXFR}, nil); err == nil {
+		t.Fatal("Transfer() without a key succeeded, want an error")
+	}
+}
+
+func TestTransferUnsupportedResolver(t *testing.T) {
+	r, err := NewDOHResolver("https://127.0.0.1/dns-query", Options{Logger: discardLogger(), Timeout: time.Second})
+	if err != nil {
+		t.Fatalf("NewDOHResolver: %v", err)
+	}
+	if _, ok := r.(Transferer); ok {
+		t.Fatal("DoH resolver implements Transferer, want only TCP and DoT")
+	}
+}
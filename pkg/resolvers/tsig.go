@@ -0,0 +1,156 @@
+package resolvers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// tsigFudge is the permitted clock skew, in seconds, between doggo and the
+// nameserver when verifying a TSIG signature (RFC 8945 recommends 300).
+const tsigFudge = 300
+
+// tsigAlgorithms maps the algorithm names accepted on the command line to
+// the names used on the wire.
+var tsigAlgorithms = map[string]string{
+	"hmac-sha1":   dns.HmacSHA1,
+	"hmac-sha224": dns.HmacSHA224,
+	"hmac-sha256": dns.HmacSHA256,
+	"hmac-sha384": dns.HmacSHA384,
+	"hmac-sha512": dns.HmacSHA512,
+}
+
+// TSIGError is returned when the TSIG on a response is missing or doesn't
+// verify, so it can be told apart from a malformed response.
+type TSIGError struct {
+	Key    string
+	Reason string
+	Err    error
+}
+
+func (e *TSIGError) Error() string {
+	return fmt.Sprintf("TSIG verification failed for key %s: %s", e.Key, e.Reason)
+}
+
+func (e *TSIGError) Unwrap() error {
+	return e.Err
+}
+
+// TSIGKey is a shared secret used to sign messages with TSIG (RFC 8945).
+type TSIGKey struct {
+	Name      string
+	Algorithm string
+	Secret    string
+}
+
+// ParseTSIGKey parses a key in the `name:algorithm:secret` form. The
+// algorithm may be omitted (`name:secret`), in which case hmac-sha256 is used.
+func ParseTSIGKey(s string) (*TSIGKey, error) {
+	parts := strings.Split(s, ":")
+	var name, alg, secret string
+	switch len(parts) {
+	case 2:
+		name, alg, secret = parts[0], "hmac-sha256", parts[1]
+	case 3:
+		name, alg, secret = parts[0], parts[1], parts[2]
+	default:
+		return nil, fmt.Errorf("invalid TSIG key %q: expected name:algorithm:secret", s)
+	}
+
+	if name == "" {
+		return nil, fmt.Errorf("invalid TSIG key: empty key name")
+	}
+	algorithm, ok := tsigAlgorithms[strings.ToLower(alg)]
+	if !ok {
+		return nil, fmt.Errorf("unsupported TSIG algorithm %q", alg)
+	}
+	if _, err := base64.StdEncoding.DecodeString(secret); err != nil {
+		return nil, fmt.Errorf("invalid TSIG secret for key %s: %w", name, err)
+	}
+
+	return &TSIGKey{
+		Name:      dns.CanonicalName(name),
+		Algorithm: algorithm,
+		Secret:    secret,
+	}, nil
+}
+
+var (
+	keyFileName      = regexp.MustCompile(`key\s+"?([^"\s{]+)"?\s*\{`)
+	keyFileAlgorithm = regexp.MustCompile(`algorithm\s+"?([A-Za-z0-9.-]+)"?\s*;`)
+	keyFileSecret    = regexp.MustCompile(`secret\s+"([^"]+)"\s*;`)
+)
+
+// LoadTSIGKeyFile reads a key in the BIND format written by `tsig-keygen`
+// and `ddns-confgen`. Only the first key of the file is used. A file holding
+// a single `name:algorithm:secret` line is accepted as well.
+func LoadTSIGKeyFile(path string) (*TSIGKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading TSIG key file: %w", err)
+	}
+	data := string(b)
+
+	name := keyFileName.FindStringSubmatch(data)
+	if name == nil {
+		return ParseTSIGKey(strings.TrimSpace(data))
+	}
+	alg := keyFileAlgorithm.FindStringSubmatch(data)
+	secret := keyFileSecret.FindStringSubmatch(data)
+	if alg == nil || secret == nil {
+		return nil, fmt.Errorf("invalid TSIG key file %s: key %s needs an algorithm and a secret", path, name[1])
+	}
+	return ParseTSIGKey(strings.TrimSuffix(name[1], ".") + ":" + strings.TrimSuffix(alg[1], ".") + ":" + secret[1])
+}
+
+// secrets returns the key in the form expected by the dns library.
+func (k *TSIGKey) secrets() map[string]string {
+	return map[string]string{k.Name: k.Secret}
+}
+
+// sign adds a TSIG record to msg. The MAC itself is computed by the dns
+// library when the message is written.
+func (k *TSIGKey) sign(msg *dns.Msg) {
+	msg.SetTsig(k.Name, k.Algorithm, tsigFudge, time.Now().Unix())
+}
+
+// verify checks the TSIG of a response to a request signed with the key. err
+// is the error returned when reading the response, which is turned into a
+// TSIGError if it's caused by the signature.
+func (k *TSIGKey) verify(in *dns.Msg, err error) error {
+	// A server rejecting the request sends the reason in the TSIG error field,
+	// which is more telling than the (unsigned) MAC failing to verify.
+	if in != nil {
+		if t := in.IsTsig(); t != nil && t.Error != dns.RcodeSuccess {
+			return &TSIGError{Key: k.Name, Reason: "rejected by the server with " + dns.RcodeToString[int(t.Error)], Err: err}
+		}
+	}
+
+	switch {
+	case errors.Is(err, dns.ErrAuth):
+		return &TSIGError{Key: k.Name, Reason: "rejected by the server", Err: err}
+	case errors.Is(err, dns.ErrSig):
+		return &TSIGError{Key: k.Name, Reason: "signature mismatch", Err: err}
+	case errors.Is(err, dns.ErrTime):
+		return &TSIGError{Key: k.Name, Reason: "signing time is outside the allowed clock skew", Err: err}
+	case errors.Is(err, dns.ErrSecret):
+		return &TSIGError{Key: k.Name, Reason: "response is signed with an unknown key", Err: err}
+	case errors.Is(err, dns.ErrKeyAlg):
+		return &TSIGError{Key: k.Name, Reason: "response is signed with an unsupported algorithm", Err: err}
+	case errors.Is(err, dns.ErrNoSig):
+		return &TSIGError{Key: k.Name, Reason: "response is not signed", Err: err}
+	case err != nil:
+		return err
+	}
+
+	if in.IsTsig() == nil {
+		return &TSIGError{Key: k.Name, Reason: "response is not signed"}
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package resolvers
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/mr-karan/doggo/pkg/models"
+)
+
+const testTSIGSecret = "c2VjcmV0LXNlY3JldC1zZWNyZXQtc2VjcmV0LXNlYw=="
+
+// startTSIGServer answers A queries over net ("udp", "tcp" or "tcp-tls"),
+// signing the reply with the request's key when sign is set.
+func startTSIGServer(t *testing.T, network string, sign bool) string {
+	t.Helper()
+	srv := &dns.Server{TsigSecret: map[string]string{"query-key.": testTSIGSecret}}
+	srv.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		tsig := req.IsTsig()
+		switch {
+		case tsig == nil:
+			m.Rcode = dns.RcodeRefused
+		case w.TsigStatus() != nil:
+			// RFC 8945 section 5.2.2: reply unsigned with the error set.
+			m.Rcode = dns.RcodeNotAuth
+			m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+			m.Extra[len(m.Extra)-1].(*dns.TSIG).Error = dns.RcodeBadSig
+			// The server writer would try to sign it, bypass it.
+			b, _ := m.Pack()
+			_, _ = w.Write(b)
+			return
+		default:
+			m.Answer = append(m.Answer, testRR(t, req.Question[0].Name+" 60 IN A 192.0.2.1"))
+			if sign {
+				m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+			}
+		}
+		_ = w.WriteMsg(m)
+	})
+
+	ready := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(ready) }
+	var addr string
+	switch network {
+	case "udp":
+		conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Skipf("unable to listen on loopback: %v", err)
+		}
+		srv.PacketConn, addr = conn, conn.LocalAddr().String()
+	case "tcp", "tcp-tls":
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Skipf("unable to listen on loopback: %v", err)
+		}
+		if network == "tcp-tls" {
+			ln = tls.NewListener(ln, &tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}})
+		}
+		srv.Listener, addr = ln, ln.Addr().String()
+	}
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	select {
+	case <-ready:
+	case <-time.After(2 * time.Second):
+		t.Fatal("DNS test server did not start within 2s")
+	}
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return addr
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &priv.PublicKey, priv)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv}
+}
+
+func tsigLookup(t *testing.T, addr string, opts ClassicResolverOpts, key string) ([]Response, error) {
+	t.Helper()
+	k, err := ParseTSIGKey(key)
+	if err != nil {
+		t.Fatalf("ParseTSIGKey: %v", err)
+	}
+	r, err := NewClassicResolver(addr, opts, Options{
+		Logger:             discardLogger(),
+		Timeout:            2 * time.Second,
+		InsecureSkipVerify: true,
+		TSIG:               k,
+	})
+	if err != nil {
+		t.Fatalf("NewClassicResolver: %v", err)
+	}
+	q := dns.Question{Name: "signed.example.", Qtype: dns.TypeA, Qclass: dns.ClassINET}
+	return r.Lookup(context.Background(), []dns.Question{q}, QueryFlags{RD: true})
+}
+
+func TestClassicResolverTSIG(t *testing.T) {
+	transports := []struct {
+		network string
+		opts    ClassicResolverOpts
+	}{
+		{"udp", ClassicResolverOpts{}},
+		{"tcp", ClassicResolverOpts{UseTCP: true}},
+		{"tcp-tls", ClassicResolverOpts{UseTCP: true, UseTLS: true}},
+	}
+	for _, tr := range transports {
+		t.Run(tr.network, func(t *testing.T) {
+			addr := startTSIGServer(t, tr.network, true)
+
+			rsp, err := tsigLookup(t, addr, tr.opts, "query-key:hmac-sha256:"+testTSIGSecret)
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+			if len(rsp) != 1 || len(rsp[0].Answers) != 1 {
+				t.Fatalf("Lookup() = %+v, want one answer", rsp)
+			}
+
+			_, err = tsigLookup(t, addr, tr.opts, "query-key:hmac-sha256:d3Jvbmctc2VjcmV0")
+			var tsigErr *TSIGError
+			if !errors.As(err, &tsigErr) {
+				t.Fatalf("Lookup() with the wrong secret error = %v, want a TSIGError", err)
+			}
+			if !strings.Contains(tsigErr.Error(), "BADSIG") {
+				t.Errorf("TSIGError = %q, want the server's BADSIG reason", tsigErr)
+			}
+		})
+	}
+}
+
+func TestClassicResolverTSIGUnsignedResponse(t *testing.T) {
+	addr := startTSIGServer(t, "udp", false)
+
+	_, err := tsigLookup(t, addr, ClassicResolverOpts{}, "query-key:hmac-sha256:"+testTSIGSecret)
+	var tsigErr *TSIGError
+	if !errors.As(err, &tsigErr) {
+		t.Fatalf("Lookup() error = %v, want a TSIGError", err)
+	}
+	if tsigErr.Reason != "response is not signed" {
+		t.Errorf("Reason = %q, want %q", tsigErr.Reason, "response is not signed")
+	}
+}
+
+func TestLoadResolversRejectsTSIGForEncryptedTransports(t *testing.T) {
+	key, _ := ParseTSIGKey("query-key:" + testTSIGSecret)
+	_, err := LoadResolvers(Options{
+		Logger:      discardLogger(),
+		Nameservers: []models.Nameserver{{Address: "https://127.0.0.1/dns-query", Type: models.DOHResolver}},
+		TSIG:        key,
+	})
+	if err == nil {
+		t.Fatal("LoadResolvers() error = nil, want TSIG to be refused for DoH")
+	}
+}
+
+func TestParseTSIGKey(t *testing.T) {
+	key, err := ParseTSIGKey("Key.Example:HMAC-SHA512:" + testTSIGSecret)
+	if err != nil {
+		t.Fatalf("ParseTSIGKey: %v", err)
+	}
+	if key.Name != "key.example." || key.Algorithm != dns.HmacSHA512 {
+		t.Errorf("ParseTSIGKey() = %s %s, want key.example. %s", key.Name, key.Algorithm, dns.HmacSHA512)
+	}
+
+	key, err = ParseTSIGKey("key:" + testTSIGSecret)
+	if err != nil || key.Algorithm != dns.HmacSHA256 {
+		t.Errorf("ParseTSIGKey(name:secret) = %v, %v, want hmac-sha256 default", key, err)
+	}
+
+	for _, bad := range []string{"", "key", "key:hmac-sha999:" + testTSIGSecret, ":hmac-sha256:" + testTSIGSecret, "key:hmac-sha256:not base64!"} {
+		if _, err := ParseTSIGKey(bad); err == nil {
+			t.Errorf("ParseTSIGKey(%q) error = nil, want error", bad)
+		}
+	}
+}
+
+func TestLoadTSIGKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	bind := filepath.Join(dir, "bind.key")
+	if err := os.WriteFile(bind, []byte("key \"xfr-key\" {\n\talgorithm hmac-sha384;\n\tsecret \""+testTSIGSecret+"\";\n};\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	key, err := LoadTSIGKeyFile(bind)
+	if err != nil {
+		t.Fatalf("LoadTSIGKeyFile: %v", err)
+	}
+	if key.Name != "xfr-key." || key.Algorithm != dns.HmacSHA384 || key.Secret != testTSIGSecret {
+		t.Errorf("LoadTSIGKeyFile() = %+v, want xfr-key. %s", key, dns.HmacSHA384)
+	}
+
+	line := filepath.Join(dir, "line.key")
+	if err := os.WriteFile(line, []byte("xfr-key:hmac-sha1:"+testTSIGSecret+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if key, err = LoadTSIGKeyFile(line); err != nil || key.Algorithm != dns.HmacSHA1 {
+		t.Errorf("LoadTSIGKeyFile(name:algorithm:secret) = %+v, %v", key, err)
+	}
+
+	if _, err := LoadTSIGKeyFile(filepath.Join(dir, "missing.key")); err == nil {
+		t.Error("LoadTSIGKeyFile(missing) error = nil, want error")
+	}
+}
@@ -0,0 +1,134 @@
+package resolvers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// Operations of a dynamic update (RFC 2136), as reported in UpdateResponse.
+const (
+	PrereqNameInUse      = "name-in-use"
+	PrereqNameNotInUse   = "name-not-in-use"
+	PrereqRRsetExists    = "rrset-exists"
+	PrereqRRsetNotExists = "rrset-not-exists"
+	UpdateAdd            = "add"
+	UpdateDeleteName     = "delete-name"
+	UpdateDeleteRRset    = "delete-rrset"
+	UpdateDeleteRecord   = "delete-record"
+)
+
+// ErrUpdateUnsupported is returned for nameservers whose transport can't
+// carry a dynamic update.
+var ErrUpdateUnsupported = errors.New("dynamic updates are only supported over UDP, TCP and DoT")
+
+// Updater is implemented by resolvers that can send RFC 2136 dynamic updates.
+type Updater interface {
+	Update(ctx context.Context, msg *dns.Msg) (UpdateResponse, error)
+}
+
+// UpdateResponse is the outcome of a dynamic update.
+type UpdateResponse struct {
+	Zone          string            `json:"zone"`
+	Nameserver    string            `json:"nameserver"`
+	Status        string            `json:"status"`
+	RTT           string            `json:"rtt"`
+	Signed        bool              `json:"tsig"`
+	Prerequisites []UpdateOperation `json:"prerequisites"`
+	Updates       []UpdateOperation `json:"updates"`
+	Edns          *EdnsInfo         `json:"edns,omitempty"`
+}
+
+// UpdateOperation is a single prerequisite or update of a dynamic update.
+type UpdateOperation struct {
+	Operation string `json:"operation"`
+	Name      string `json:"name"`
+	Type      string `json:"type,omitempty"`
+	TTL       string `json:"ttl,omitempty"`
+	Address   string `json:"address,omitempty"`
+}
+
+// Update implements the Updater interface. msg is signed with the resolver's
+// TSIG key when one is set.
+func (r *ClassicResolver) Update(ctx context.Context, msg *dns.Msg) (UpdateResponse, error) {
+	rsp := UpdateResponse{
+		Nameserver:    r.server,
+		Prerequisites: describeUpdate(msg.Answer, true),
+		Updates:       describeUpdate(msg.Ns, false),
+	}
+	if len(msg.Question) > 0 {
+		rsp.Zone = msg.Question[0].Name
+	}
+
+	msg = msg.Copy()
+	msg.Id = dns.Id()
+	if key := r.resolverOptions.TSIG; key != nil {
+		key.sign(msg)
+		rsp.Signed = true
+	}
+
+	r.resolverOptions.Logger.Debug("Sending dynamic update",
+		"zone", rsp.Zone,
+		"prerequisites", len(msg.Answer),
+		"updates", len(msg.Ns),
+		"nameserver", r.server,
+	)
+
+	now := time.Now()
+	in, err := r.exchange(ctx, msg)
+	if err != nil {
+		return rsp, err
+	}
+	rsp.RTT = fmt.Sprintf("%dms", time.Since(now).Milliseconds())
+	rsp.Status = dns.RcodeToString[in.Rcode]
+	rsp.Edns = parseEdns(in)
+	return rsp, nil
+}
+
+// describeUpdate translates the prerequisite (RFC 2136 section 2.4) or
+// update (section 2.5) section of an update message, which encode the
+// operation in the class and type of every record.
+func describeUpdate(rrs []dns.RR, prereq bool) []UpdateOperation {
+	ops := make([]UpdateOperation, 0, len(rrs))
+	for _, rr := range rrs {
+		h := rr.Header()
+		op := UpdateOperation{Name: h.Name}
+		if h.Rrtype != dns.TypeANY {
+			op.Type = dns.TypeToString[h.Rrtype]
+		}
+		_, empty := rr.(*dns.ANY)
+		if !empty {
+			parts := strings.Split(rr.String(), "\t")
+			op.Address = parts[len(parts)-1]
+		}
+
+		switch {
+		case prereq && h.Class == dns.ClassANY && h.Rrtype == dns.TypeANY:
+			op.Operation = PrereqNameInUse
+		case prereq && h.Class == dns.ClassNONE && h.Rrtype == dns.TypeANY:
+			op.Operation = PrereqNameNotInUse
+		case prereq && h.Class == dns.ClassANY:
+			op.Operation = PrereqRRsetExists
+		case prereq && h.Class == dns.ClassNONE:
+			op.Operation = PrereqRRsetNotExists
+		case prereq:
+			// A record in the zone's class asks for an RRset with these exact values.
+			op.Operation = PrereqRRsetExists
+		case h.Class == dns.ClassANY && h.Rrtype == dns.TypeANY:
+			op.Operation = UpdateDeleteName
+		case h.Class == dns.ClassANY:
+			op.Operation = UpdateDeleteRRset
+		case h.Class == dns.ClassNONE:
+			op.Operation = UpdateDeleteRecord
+		default:
+			op.Operation = UpdateAdd
+			op.TTL = fmt.Sprintf("%ds", h.Ttl)
+		}
+		ops = append(ops, op)
+	}
+	return ops
+}
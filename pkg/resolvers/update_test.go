@@ -0,0 +1,143 @@
+package resolvers
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// startUpdateServer answers dynamic updates over UDP with rcode, explaining
+// a refusal with an Extended DNS Error. Received updates are sent on the
+// returned channel.
+func startUpdateServer(t *testing.T, rcode int) (string, <-chan *dns.Msg) {
+	t.Helper()
+	received := make(chan *dns.Msg, 1)
+	srv := &dns.Server{TsigSecret: map[string]string{"update-key.": testTSIGSecret}}
+	// The default accept function rejects every opcode but QUERY and NOTIFY.
+	srv.MsgAcceptFunc = func(dns.Header) dns.MsgAcceptAction { return dns.MsgAccept }
+	srv.Handler = dns.HandlerFunc(func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(req, rcode)
+		if rcode != dns.RcodeSuccess {
+			m.SetEdns0(1232, false)
+			opt := m.IsEdns0()
+			opt.Option = append(opt.Option, &dns.EDNS0_EDE{InfoCode: dns.ExtendedErrorCodeProhibited, ExtraText: "updates are disabled"})
+		}
+		if tsig := req.IsTsig(); tsig != nil {
+			if w.TsigStatus() != nil {
+				m.Rcode = dns.RcodeNotAuth
+			} else {
+				m.SetTsig(tsig.Hdr.Name, tsig.Algorithm, tsig.Fudge, time.Now().Unix())
+			}
+		}
+		received <- req
+		_ = w.WriteMsg(m)
+	})
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen on loopback: %v", err)
+	}
+	srv.PacketConn = conn
+	ready := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(ready) }
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+	select {
+	case <-ready:
+	case <-time.After(2 * time.Second):
+		t.Fatal("DNS test server did not start within 2s")
+	}
+	t.Cleanup(func() { _ = srv.Shutdown() })
+	return conn.LocalAddr().String(), received
+}
+
+func testUpdateMsg(t *testing.T) *dns.Msg {
+	t.Helper()
+	msg := new(dns.Msg)
+	msg.SetUpdate("example.com.")
+	msg.SetEdns0(1232, false)
+	msg.NameNotUsed([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "new.example.com."}}})
+	msg.RemoveRRset([]dns.RR{&dns.ANY{Hdr: dns.RR_Header{Name: "www.example.com.", Rrtype: dns.TypeA}}})
+	msg.Remove([]dns.RR{testRR(t, "old.example.com. 0 IN TXT \"gone\"")})
+	msg.Insert([]dns.RR{testRR(t, "www.example.com. 300 IN A 192.0.2.1")})
+	return msg
+}
+
+func TestUpdateDescribesOperations(t *testing.T) {
+	addr, received := startUpdateServer(t, dns.RcodeSuccess)
+	rsp, err := newTSIGClassicResolver(t, addr, nil).(Updater).Update(context.Background(), testUpdateMsg(t))
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if rsp.Status != "NOERROR" || rsp.Zone != "example.com." || rsp.Signed {
+		t.Fatalf("Update() = status %s zone %s signed %v, want unsigned NOERROR for example.com.", rsp.Status, rsp.Zone, rsp.Signed)
+	}
+	if req := <-received; len(req.Answer) != 1 || len(req.Ns) != 3 {
+		t.Fatalf("server received %d prerequisites and %d updates, want 1 and 3", len(req.Answer), len(req.Ns))
+	}
+
+	want := []UpdateOperation{
+		{Operation: PrereqNameNotInUse, Name: "new.example.com."},
+		{Operation: UpdateDeleteRRset, Name: "www.example.com.", Type: "A"},
+		{Operation: UpdateDeleteRecord, Name: "old.example.com.", Type: "TXT", Address: `"gone"`},
+		{Operation: UpdateAdd, Name: "www.example.com.", Type: "A", TTL: "300s", Address: "192.0.2.1"},
+	}
+	got := append(rsp.Prerequisites, rsp.Updates...)
+	if len(got) != len(want) {
+		t.Fatalf("got %d operations, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("operation %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestUpdateReportsRefusal(t *testing.T) {
+	addr, _ := startUpdateServer(t, dns.RcodeRefused)
+	rsp, err := newTSIGClassicResolver(t, addr, nil).(Updater).Update(context.Background(), testUpdateMsg(t))
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if rsp.Status != "REFUSED" {
+		t.Errorf("Status = %s, want REFUSED", rsp.Status)
+	}
+	if rsp.Edns == nil || rsp.Edns.ExtendedErr == "" {
+		t.Errorf("Edns = %+v, want the server's extended error", rsp.Edns)
+	}
+}
+
+func TestUpdateWithTSIG(t *testing.T) {
+	addr, received := startUpdateServer(t, dns.RcodeSuccess)
+	key, err := ParseTSIGKey("update-key:hmac-sha256:" + testTSIGSecret)
+	if err != nil {
+		t.Fatalf("ParseTSIGKey: %v", err)
+	}
+	msg := testUpdateMsg(t)
+	rsp, err := newTSIGClassicResolver(t, addr, key).(Updater).Update(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !rsp.Signed || rsp.Status != "NOERROR" {
+		t.Errorf("Update() = status %s signed %v, want signed NOERROR", rsp.Status, rsp.Signed)
+	}
+	if req := <-received; req.IsTsig() == nil {
+		t.Error("server received an unsigned update")
+	}
+	if msg.IsTsig() != nil {
+		t.Error("Update() signed the caller's message")
+	}
+
+	wrong, err := ParseTSIGKey("update-key:hmac-sha256:" + "d3Jvbmctc2VjcmV0LXdyb25nLXNlY3JldC13cm9uZw==")
+	if err != nil {
+		t.Fatalf("ParseTSIGKey: %v", err)
+	}
+	if _, err := newTSIGClassicResolver(t, addr, wrong).(Updater).Update(context.Background(), testUpdateMsg(t)); err == nil {
+		t.Error("Update() with the wrong key error = nil, want a TSIG error")
+	}
+}
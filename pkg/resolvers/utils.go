@@ -28,16 +28,26 @@ type QueryFlags struct {
 	EDE     bool   // Request Extended DNS Errors
 	ECS     string // EDNS Client Subnet (e.g., "192.0.2.0/24" or "2001:db8::/32")
 	Bufsize uint16 // EDNS UDP buffer size (default: 1232 when EDNS enabled)
+
+	Validate bool // Validate the DNSSEC chain of trust for every response
 }
 
 // prepareMessages takes a  DNS Question and returns the
-// corresponding DNS messages for the same.
-func prepareMessages(q dns.Question, flags QueryFlags, ndots int, searchList []string) []dns.Msg {
+// corresponding DNS messages for the same. Messages are signed with tsig
+// when it's set.
+func prepareMessages(q dns.Question, flags QueryFlags, ndots int, searchList []string, tsig *TSIGKey) []dns.Msg {
 	var (
 		possibleQNames = constructPossibleQuestions(q.Name, ndots, searchList)
 		messages       = make([]dns.Msg, 0, len(possibleQNames))
 	)
 
+	// Validation needs the signatures (DO) and the unvalidated data (CD), so
+	// a bogus answer can be told apart from an upstream failure.
+	if flags.Validate {
+		flags.DO = true
+		flags.CD = true
+	}
+
 	for _, qName := range possibleQNames {
 		msg := dns.Msg{}
 		// generate a random id for the transaction.
@@ -100,12 +110,24 @@ func prepareMessages(q dns.Question, flags QueryFlags, ndots int, searchList []s
 			Qtype:  q.Qtype,
 			Qclass: q.Qclass,
 		}}
+
+		// The TSIG record must be the last one in the message.
+		if tsig != nil {
+			tsig.sign(&msg)
+		}
 		messages = append(messages, msg)
 	}
 
 	return messages
 }
 
+// SearchNames returns the names a question for name is sent as, in the order
+// they're tried: the search list completes the names with fewer labels than
+// ndots, and the ones that aren't fully qualified are tried as given too.
+func SearchNames(name string, ndots int, searchList []string) []string {
+	return constructPossibleQuestions(name, ndots, searchList)
+}
+
 // NameList returns all of the names that should be queried based on the
 // config. It is based off of go's net/dns name building, but it does not
 // check the length of the resulting names.
@@ -258,10 +280,36 @@ func parseEdns(msg *dns.Msg) *EdnsInfo {
 	return edns
 }
 
+// ParseMessage converts a `dns.Msg` obtained outside of a Resolver (for
+// example by the iterative trace mode) into the common Response format.
+func ParseMessage(msg *dns.Msg, rtt time.Duration, server string) Response {
+	rsp := parseMessage(msg, rtt, server)
+	for _, q := range msg.Question {
+		rsp.Questions = append(rsp.Questions, Question{
+			Name:  q.Name,
+			Class: dns.ClassToString[q.Qclass],
+			Type:  dns.TypeToString[q.Qtype],
+		})
+	}
+	return rsp
+}
+
+// formatHandshake formats the time spent establishing a connection like the
+// RTT of the answers, or returns "" when no connection was established.
+func formatHandshake(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%dms", d.Milliseconds())
+}
+
 // parseMessage takes a `dns.Message` and returns a custom
 // Response data struct.
 func parseMessage(msg *dns.Msg, rtt time.Duration, server string) Response {
-	var resp Response
+	resp := Response{
+		Status:     dns.RcodeToString[msg.Rcode],
+		Nameserver: server,
+	}
 	timeTaken := fmt.Sprintf("%dms", rtt.Milliseconds())
 
 	// Parse EDNS0 options if present
@@ -293,6 +341,7 @@ func parseMessage(msg *dns.Msg, rtt time.Duration, server string) Response {
 			TTL:        ttl,
 			Class:      qclass,
 			MName:      mname,
+			RData:      RDataOf(soa),
 			Nameserver: server,
 			RTT:        timeTaken,
 			Status:     dns.RcodeToString[msg.Rcode],
@@ -311,6 +360,7 @@ func parseMessage(msg *dns.Msg, rtt time.Duration, server string) Response {
 				TTL:        strconv.FormatInt(int64(h.Ttl), 10) + "s",
 				Class:      dns.Class(h.Class).String(),
 				Address:    parts[len(parts)-1],
+				RData:      RDataOf(a),
 				RTT:        timeTaken,
 				Nameserver: server,
 			}
@@ -335,6 +385,7 @@ func parseMessage(msg *dns.Msg, rtt time.Duration, server string) Response {
 			TTL:        strconv.FormatInt(int64(h.Ttl), 10) + "s",
 			Class:      dns.Class(h.Class).String(),
 			Address:    parts[len(parts)-1],
+			RData:      RDataOf(extra),
 			RTT:        timeTaken,
 			Nameserver: server,
 			Status:     dns.RcodeToString[msg.Rcode],
@@ -49,7 +49,7 @@ func TestPrepareMessagesEDNS(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			msgs := prepareMessages(q, tt.flags, 1, nil)
+			msgs := prepareMessages(q, tt.flags, 1, nil, nil)
 			if len(msgs) != 1 {
 				t.Fatalf("expected 1 message, got %d", len(msgs))
 			}
@@ -109,6 +109,8 @@ func handleLookup(w http.ResponseWriter, r *http.Request) {
 		EDE:     app.QueryFlags.EDE,
 		ECS:     app.QueryFlags.ECS,
 		Bufsize: app.QueryFlags.Bufsize,
+
+		Validate: app.QueryFlags.Validate,
 	}
 
 	// Default to RD=true if not explicitly set